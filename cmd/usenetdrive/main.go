@@ -1,28 +1,36 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/javi11/usenet-drive/db"
 	"github.com/javi11/usenet-drive/internal/adminpanel"
 	"github.com/javi11/usenet-drive/internal/config"
+	"github.com/javi11/usenet-drive/internal/reloader"
 	"github.com/javi11/usenet-drive/internal/serverinfo"
+	"github.com/javi11/usenet-drive/internal/usenet/availabilitychecker"
 	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
 	"github.com/javi11/usenet-drive/internal/usenet/corruptednzbsmanager"
 	"github.com/javi11/usenet-drive/internal/usenet/filereader"
 	"github.com/javi11/usenet-drive/internal/usenet/filewriter"
 	"github.com/javi11/usenet-drive/internal/usenet/nzbloader"
+	"github.com/javi11/usenet-drive/internal/usenet/providerusage"
+	"github.com/javi11/usenet-drive/internal/usenet/segmentcache"
 	status "github.com/javi11/usenet-drive/internal/usenet/statusreporter"
 	"github.com/javi11/usenet-drive/internal/webdav"
 	"github.com/javi11/usenet-drive/pkg/nntpcli"
 	"github.com/javi11/usenet-drive/pkg/osfs"
 	"github.com/javi11/usenet-drive/pkg/rclonecli"
 	"github.com/natefinch/lumberjack"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -39,7 +47,7 @@ var rootCmd = &cobra.Command{
 		// Read the config file
 		config, err := config.FromFile(configFile)
 		if err != nil {
-			slog.ErrorContext(ctx, "Failed to load config file: %v", err)
+			slog.ErrorContext(ctx, "Failed to load config file", "err", err)
 			os.Exit(1)
 		}
 
@@ -70,30 +78,42 @@ var rootCmd = &cobra.Command{
 			nntpcli.WithLogger(log),
 		)
 
+		sqlLite, err := db.NewDB(config.DBPath)
+		if err != nil {
+			log.ErrorContext(ctx, "Failed to open database", "err", err)
+			os.Exit(1)
+		}
+		defer sqlLite.Close()
+
+		reservedConnections, err := connectionpool.ParseReservedConnections(config.Usenet.Download.ReservedConnections)
+		if err != nil {
+			log.ErrorContext(ctx, "Invalid reserved connections", "err", err)
+			os.Exit(1)
+		}
+
 		// download and upload connection pool
 		connPool, err := connectionpool.NewConnectionPool(
 			connectionpool.WithFakeConnections(config.Usenet.FakeConnections),
+			connectionpool.WithFakeConnectionsDir(config.Usenet.FakeConnectionsDir),
 			connectionpool.WithDownloadProviders(config.Usenet.Download.Providers),
 			connectionpool.WithUploadProviders(config.Usenet.Upload.Providers),
 			connectionpool.WithClient(nntpCli),
 			connectionpool.WithLogger(log),
 			connectionpool.WithMaxConnectionTTL(time.Duration(config.Usenet.MaxConnectionTTLInMinutes)*time.Minute),
 			connectionpool.WithMaxConnectionIdleTime(time.Duration(config.Usenet.MaxConnectionIdleTimeInMinutes)*time.Minute),
+			connectionpool.WithSelectionStrategy(connectionpool.SelectionStrategy(config.Usenet.ProviderSelectionStrategy)),
+			connectionpool.WithUsageRepository(providerusage.New(sqlLite)),
+			connectionpool.WithReservedConnections(reservedConnections),
 		)
 		if err != nil {
-			log.ErrorContext(ctx, "Failed to init usenet connection pool: %v", err)
+			log.ErrorContext(ctx, "Failed to init usenet connection pool", "err", err)
 			os.Exit(1)
 		}
 		defer connPool.Quit()
 
-		// Create corrupted nzb list
-		sqlLite, err := db.NewDB(config.DBPath)
-		if err != nil {
-			log.ErrorContext(ctx, "Failed to open database: %v", err)
-			os.Exit(1)
-		}
-		defer sqlLite.Close()
+		prometheus.MustRegister(connectionpool.NewCollector(connPool))
 
+		// Create corrupted nzb list
 		cNzbs := corruptednzbsmanager.New(sqlLite, osFs)
 
 		// Status reporter
@@ -101,13 +121,45 @@ var rootCmd = &cobra.Command{
 		ticker := time.NewTicker(5 * time.Second)
 		go sr.Start(ctx, ticker)
 
-		// Server info
-		serverInfo := serverinfo.NewServerInfo(connPool, sr, config.RootPath)
-
-		adminPanel := adminpanel.New(serverInfo, cNzbs, log, config.Debug)
-		go adminPanel.Start(ctx, config.ApiPort)
+		// The segment cache is disabled unless it has a dir and a size
+		var segmentCache segmentcache.SegmentCache
+		if config.Usenet.SegmentCache.Dir != "" && config.Usenet.SegmentCache.SizeInMb > 0 {
+			segmentCache, err = segmentcache.NewSegmentCache(
+				config.Usenet.SegmentCache.Dir,
+				int64(config.Usenet.SegmentCache.SizeInMb)*1024*1024,
+				log,
+			)
+			if err != nil {
+				log.ErrorContext(ctx, "Failed to create segment cache", "err", err)
+				os.Exit(1)
+			}
+		}
 
 		nzbWriter := nzbloader.NewNzbWriter(osFs)
+		segmentIndexRepository := nzbloader.NewSegmentIndexRepository(sqlLite)
+
+		fileReader, err := filereader.NewFileReader(
+			filereader.WithConnectionPool(connPool),
+			filereader.WithLogger(log),
+			filereader.WithCorruptedNzbsManager(cNzbs),
+			filereader.WithFileSystem(osFs),
+			filereader.WithMaxDownloadRetries(config.Usenet.Download.MaxRetries),
+			filereader.WithMaxDownloadWorkers(config.Usenet.Download.MaxDownloadWorkers),
+			filereader.WithMaxBufferSizeInMb(config.Usenet.Download.MaxBufferSizeInMb),
+			filereader.WithMaxReadAheadSegments(config.Usenet.Download.MaxReadAheadSegments),
+			filereader.WithHedgePercentile(config.Usenet.Download.HedgePercentile),
+			filereader.WithMaxHedgePercent(config.Usenet.Download.MaxHedgePercent),
+			filereader.WithPipelineDepth(config.Usenet.Download.PipelineDepth),
+			filereader.WithSegmentSize(config.Usenet.ArticleSizeInBytes),
+			filereader.WithDebug(config.Debug),
+			filereader.WithStatusReporter(sr),
+			filereader.WithSegmentCache(segmentCache),
+			filereader.WithSegmentIndexRepository(segmentIndexRepository),
+		)
+		if err != nil {
+			log.ErrorContext(ctx, "Failed to create file reader", "err", err)
+			os.Exit(1)
+		}
 
 		fileWriter := filewriter.NewFileWriter(
 			filewriter.WithSegmentSize(config.Usenet.ArticleSizeInBytes),
@@ -121,23 +173,37 @@ var rootCmd = &cobra.Command{
 			filewriter.WithFileSystem(osFs),
 			filewriter.WithMaxUploadRetries(config.Usenet.Upload.MaxRetries),
 			filewriter.WithStatusReporter(sr),
+			filewriter.WithPar2Redundancy(config.Usenet.Upload.Par2Redundancy),
+			filewriter.WithSegmentCache(segmentCache),
+			// The files being read use the new segments of a repaired nzb
+			filewriter.WithNzbInvalidator(fileReader),
+			filewriter.WithSegmentIndexRepository(segmentIndexRepository),
 		)
 
-		fileReader, err := filereader.NewFileReader(
-			filereader.WithConnectionPool(connPool),
-			filereader.WithLogger(log),
-			filereader.WithCorruptedNzbsManager(cNzbs),
-			filereader.WithFileSystem(osFs),
-			filereader.WithMaxDownloadRetries(config.Usenet.Download.MaxRetries),
-			filereader.WithMaxDownloadWorkers(config.Usenet.Download.MaxDownloadWorkers),
-			filereader.WithSegmentSize(config.Usenet.ArticleSizeInBytes),
-			filereader.WithDebug(config.Debug),
-			filereader.WithStatusReporter(sr),
+		// Server info
+		serverInfo := serverinfo.NewServerInfo(connPool, sr, fileReader, config.RootPath)
+
+		// Config reload on SIGHUP or from the admin panel
+		configReloader := reloader.New(configFile, config, connPool, fileWriter, fileReader, log)
+		go reloadOnSignal(ctx, configReloader, log)
+
+		// Background check of the articles of the library
+		availabilityChecker := availabilitychecker.New(
+			availabilitychecker.WithRootPath(config.RootPath),
+			availabilitychecker.WithConnectionPool(connPool),
+			availabilitychecker.WithCorruptedNzbsManager(cNzbs),
+			availabilitychecker.WithRepository(availabilitychecker.NewRepository(sqlLite)),
+			availabilitychecker.WithFileSystem(osFs),
+			availabilitychecker.WithLogger(log),
+			availabilitychecker.WithEnabled(config.Usenet.AvailabilityCheck.Enabled),
+			availabilitychecker.WithInterval(time.Duration(config.Usenet.AvailabilityCheck.IntervalInHours)*time.Hour),
+			availabilitychecker.WithSampleSize(config.Usenet.AvailabilityCheck.SampleSize),
+			availabilitychecker.WithMaxStatsPerSecond(config.Usenet.AvailabilityCheck.MaxStatsPerSecond),
 		)
-		if err != nil {
-			log.ErrorContext(ctx, "Failed to create file reader: %v", err)
-			os.Exit(1)
-		}
+		go availabilityChecker.Run(ctx)
+
+		adminPanel := adminpanel.New(serverInfo, cNzbs, connPool, configReloader, fileWriter, availabilityChecker, log, config.Debug)
+		go adminPanel.Start(ctx, config.ApiPort)
 
 		// Build webdav server
 		webDavOptions := []webdav.Option{
@@ -145,6 +211,7 @@ var rootCmd = &cobra.Command{
 			webdav.WithRootPath(config.RootPath),
 			webdav.WithFileWriter(fileWriter),
 			webdav.WithFileReader(fileReader),
+			webdav.WithSegmentIndexRepository(segmentIndexRepository),
 		}
 
 		if config.Rclone.VFSUrl != "" {
@@ -156,7 +223,7 @@ var rootCmd = &cobra.Command{
 			webDavOptions...,
 		)
 		if err != nil {
-			log.ErrorContext(ctx, "Failed to create WebDAV server: %v", err)
+			log.ErrorContext(ctx, "Failed to create WebDAV server", "err", err)
 			os.Exit(1)
 		}
 
@@ -165,6 +232,24 @@ var rootCmd = &cobra.Command{
 	},
 }
 
+func reloadOnSignal(ctx context.Context, r reloader.Reloader, log *slog.Logger) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	defer signal.Stop(sighup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sighup:
+			log.InfoContext(ctx, "SIGHUP received, reloading config")
+			if _, err := r.Reload(ctx); err != nil {
+				log.ErrorContext(ctx, "Failed to reload config", "err", err)
+			}
+		}
+	}
+}
+
 func init() {
 	rootCmd.PersistentFlags().
 		StringVarP(&configFile, "config", "c", "", "path to YAML config file")
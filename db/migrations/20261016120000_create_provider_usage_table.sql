@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS provider_usage (
+			provider TEXT NOT NULL,
+			type TEXT NOT NULL,
+			bytes INTEGER NOT NULL DEFAULT 0,
+			period_start TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (provider, type)
+		);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE provider_usage;
+-- +goose StatementEnd
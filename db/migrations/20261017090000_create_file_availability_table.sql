@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS file_availability (
+			path TEXT PRIMARY KEY,
+			total_articles INTEGER NOT NULL,
+			checked_articles INTEGER NOT NULL,
+			missing_articles INTEGER NOT NULL,
+			checked_at TIMESTAMP NOT NULL
+		);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE file_availability;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS segment_index (
+			path TEXT PRIMARY KEY,
+			nzb_size INTEGER NOT NULL,
+			nzb_mod_time INTEGER NOT NULL,
+			data BLOB NOT NULL
+		);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE segment_index;
+-- +goose StatementEnd
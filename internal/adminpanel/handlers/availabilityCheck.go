@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/javi11/usenet-drive/internal/usenet/availabilitychecker"
+	echo "github.com/labstack/echo/v4"
+)
+
+type AvailabilityQueryParams struct {
+	Offset  int  `query:"offset"`
+	Limit   int  `query:"limit"`
+	Missing bool `query:"missing"`
+}
+
+func GetAvailabilityCheckHandler(ac availabilitychecker.Checker) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, ac.Status())
+	}
+}
+
+func GetAvailabilityListHandler(ac availabilitychecker.Checker) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		limit := 10
+
+		queryParams := new(AvailabilityQueryParams)
+		if err := c.Bind(queryParams); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		if queryParams.Limit != 0 {
+			limit = queryParams.Limit
+		}
+
+		result, err := ac.List(c.Request().Context(), limit, queryParams.Offset, queryParams.Missing)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+func StartAvailabilityCheckHandler(ac availabilitychecker.Checker) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := ac.Start(c.Request().Context()); err != nil {
+			if errors.Is(err, availabilitychecker.ErrAlreadyRunning) {
+				return echo.NewHTTPError(http.StatusConflict, err.Error())
+			}
+
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func StopAvailabilityCheckHandler(ac availabilitychecker.Checker) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := ac.Stop(); err != nil {
+			if errors.Is(err, availabilitychecker.ErrNotRunning) {
+				return echo.NewHTTPError(http.StatusConflict, err.Error())
+			}
+
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
+	echo "github.com/labstack/echo/v4"
+)
+
+func EnableProviderHandler(cp connectionpool.UsenetConnectionPool) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+
+		if err := cp.EnableProvider(id); err != nil {
+			if errors.Is(err, connectionpool.ErrProviderNotFound) {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.NoContent(http.StatusNoContent)
+	}
+}
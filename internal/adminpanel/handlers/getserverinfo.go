@@ -5,6 +5,7 @@ import (
 
 	"github.com/javi11/usenet-drive/internal/serverinfo"
 	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
+	"github.com/javi11/usenet-drive/internal/usenet/filereader"
 	"github.com/labstack/echo/v4"
 )
 
@@ -12,6 +13,7 @@ type serverInfoResponse struct {
 	RootFolderDiskUsage serverinfo.DiskUsage          `json:"root_folder_disk_usage"`
 	ProvidersInfo       []connectionpool.ProviderInfo `json:"providers_info"`
 	GlobalActivity      serverinfo.GlobalActivity     `json:"global_activity"`
+	BufferUsage         filereader.BufferUsage        `json:"buffer_usage"`
 }
 
 func GetServerInfoHandler(si serverinfo.ServerInfo) echo.HandlerFunc {
@@ -20,6 +22,7 @@ func GetServerInfoHandler(si serverinfo.ServerInfo) echo.HandlerFunc {
 			RootFolderDiskUsage: si.GetRootFolderDiskUsage(),
 			ProvidersInfo:       si.GetProvidersInfo(),
 			GlobalActivity:      si.GetGlobalActivity(),
+			BufferUsage:         si.GetBufferUsage(),
 		}
 
 		return c.JSON(http.StatusOK, result)
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/javi11/usenet-drive/internal/reloader"
+	echo "github.com/labstack/echo/v4"
+)
+
+func ReloadConfigHandler(r reloader.Reloader) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		result, err := r.Reload(c.Request().Context())
+		if err != nil {
+			if errors.Is(err, reloader.ErrInvalidConfig) {
+				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+			}
+
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.JSON(http.StatusOK, result)
+	}
+}
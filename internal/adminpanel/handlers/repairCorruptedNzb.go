@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/javi11/usenet-drive/internal/usenet/corruptednzbsmanager"
+	"github.com/javi11/usenet-drive/internal/usenet/filewriter"
+	echo "github.com/labstack/echo/v4"
+)
+
+type NzbRepairer interface {
+	StartRepair(ctx context.Context, nzbPath string, done func(ctx context.Context, result filewriter.RepairResult, err error)) error
+	GetRepairStatus(nzbPath string) (filewriter.RepairStatus, bool)
+}
+
+type RepairJob struct {
+	Path string `json:"path"`
+}
+
+// RepairCorruptedNzbHandler starts the repair of the nzb in the background, the list item is
+// removed once every missing segment is re-posted. The progress is returned by
+// GetRepairStatusHandler.
+func RepairCorruptedNzbHandler(cNzb corruptednzbsmanager.CorruptedNzbsManager, r NzbRepairer, log *slog.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+
+		idInt, err := strconv.Atoi(id)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		ctx := c.Request().Context()
+		cnzb, err := cNzb.Get(ctx, idInt)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		err = r.StartRepair(ctx, cnzb.Path, func(ctx context.Context, _ filewriter.RepairResult, err error) {
+			if err != nil {
+				return
+			}
+
+			if _, err := cNzb.Discard(ctx, idInt); err != nil {
+				log.ErrorContext(ctx, "Error discarding the repaired nzb", "path", cnzb.Path, "error", err)
+			}
+		})
+		if err != nil {
+			if errors.Is(err, filewriter.ErrRepairRunning) {
+				return echo.NewHTTPError(http.StatusConflict, err.Error())
+			}
+
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+
+		return c.JSON(http.StatusAccepted, RepairJob{Path: cnzb.Path})
+	}
+}
+
+// GetRepairStatusHandler returns the state of the running or last repair of the nzb
+func GetRepairStatusHandler(r NzbRepairer) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		path := c.QueryParam("path")
+		if path == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "path is required")
+		}
+
+		status, ok := r.GetRepairStatus(path)
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotFound, "no repair found for the nzb")
+		}
+
+		return c.JSON(http.StatusOK, status)
+	}
+}
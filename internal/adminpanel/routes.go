@@ -8,12 +8,16 @@ import (
 	"os"
 
 	"github.com/javi11/usenet-drive/internal/adminpanel/handlers"
+	"github.com/javi11/usenet-drive/internal/reloader"
 	"github.com/javi11/usenet-drive/internal/serverinfo"
+	"github.com/javi11/usenet-drive/internal/usenet/availabilitychecker"
+	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
 	"github.com/javi11/usenet-drive/internal/usenet/corruptednzbsmanager"
 	"github.com/javi11/usenet-drive/web"
 	"github.com/labstack/echo-contrib/pprof"
 	echo "github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	slogecho "github.com/samber/slog-echo"
 )
 
@@ -28,9 +32,25 @@ type adminPanel struct {
 // - GET /api/v1/nzbs/corrupted: Get the list of corrupted nzb.
 // - DELETE /api/v1/nzbs/corrupted: Delete a corrupted nzb.
 // - PUT /api/v1/nzbs/corrupted/discard: Discard just the list item.
+// - PUT /api/v1/nzbs/corrupted/repair: Start re-posting the missing segments in the background,
+// the list item is removed once the nzb is repaired.
+// - GET /api/v1/nzbs/repair?path=: Get the status of the running or last repair of a nzb.
+// - PUT /api/v1/providers/:id/disable: Stop using a provider and close its connections.
+// - PUT /api/v1/providers/:id/drain: Stop using a provider once its connections are released.
+// - PUT /api/v1/providers/:id/enable: Use again a disabled or drained provider.
+// - POST /api/v1/config/reload: Reload the config file, returns the changes that need a restart.
+// - GET /api/v1/availability-check: Get the status of the availability check.
+// - GET /api/v1/availability-check/files: Get the availability of the checked files.
+// - PUT /api/v1/availability-check/start: Start an availability check.
+// - PUT /api/v1/availability-check/stop: Stop the running availability check.
+// - GET /metrics: Prometheus metrics.
 func New(
 	si serverinfo.ServerInfo,
 	cNzb corruptednzbsmanager.CorruptedNzbsManager,
+	cp connectionpool.UsenetConnectionPool,
+	r reloader.Reloader,
+	nr handlers.NzbRepairer,
+	ac availabilitychecker.Checker,
 	log *slog.Logger,
 	debug bool,
 ) *adminPanel {
@@ -48,6 +68,8 @@ func New(
 		pprof.Register(e)
 	}
 
+	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
+
 	v1 := e.Group("/api/v1")
 	{
 		v1.GET("/activity", handlers.GetActivityHandler(si))
@@ -55,7 +77,17 @@ func New(
 		v1.GET("/nzbs/corrupted", handlers.GetCorruptedNzbListHandler(cNzb))
 		v1.DELETE("/nzbs/corrupted/:id", handlers.DeleteCorruptedNzbHandler(cNzb))
 		v1.PUT("/nzbs/corrupted/discard/:id", handlers.DiscardCorruptedNzbHandler(cNzb))
+		v1.PUT("/nzbs/corrupted/repair/:id", handlers.RepairCorruptedNzbHandler(cNzb, nr, log))
+		v1.GET("/nzbs/repair", handlers.GetRepairStatusHandler(nr))
 		v1.GET("/nzbs/corrupted/:id", handlers.GetCorruptedNzbContentHandler(cNzb))
+		v1.PUT("/providers/:id/disable", handlers.DisableProviderHandler(cp))
+		v1.PUT("/providers/:id/drain", handlers.DrainProviderHandler(cp))
+		v1.PUT("/providers/:id/enable", handlers.EnableProviderHandler(cp))
+		v1.POST("/config/reload", handlers.ReloadConfigHandler(r))
+		v1.GET("/availability-check", handlers.GetAvailabilityCheckHandler(ac))
+		v1.GET("/availability-check/files", handlers.GetAvailabilityListHandler(ac))
+		v1.PUT("/availability-check/start", handlers.StartAvailabilityCheckHandler(ac))
+		v1.PUT("/availability-check/stop", handlers.StopAvailabilityCheckHandler(ac))
 	}
 
 	return &adminPanel{
@@ -24,38 +24,99 @@ type Rclone struct {
 }
 
 type Usenet struct {
-	Download                       Download `yaml:"download"`
-	Upload                         Upload   `yaml:"upload"`
-	FakeConnections                bool     `yaml:"fake_connections" default:"false"`
-	ArticleSizeInBytes             int64    `yaml:"article_size_in_bytes" default:"750000"`
-	MaxConnectionIdleTimeInMinutes int      `yaml:"max_connection_idle_time_in_minutes" default:"30"`
-	MaxConnectionTTLInMinutes      int      `yaml:"max_connection_ttl_in_minutes" default:"60"`
+	Download                       Download          `yaml:"download"`
+	Upload                         Upload            `yaml:"upload"`
+	FakeConnections                bool              `yaml:"fake_connections" default:"false"`
+	FakeConnectionsDir             string            `yaml:"fake_connections_dir"`
+	ArticleSizeInBytes             int64             `yaml:"article_size_in_bytes" default:"750000"`
+	MaxConnectionIdleTimeInMinutes int               `yaml:"max_connection_idle_time_in_minutes" default:"30"`
+	MaxConnectionTTLInMinutes      int               `yaml:"max_connection_ttl_in_minutes" default:"60"`
+	ProviderSelectionStrategy      string            `yaml:"provider_selection_strategy" default:"first_fit"`
+	SegmentCache                   SegmentCache      `yaml:"segment_cache"`
+	AvailabilityCheck              AvailabilityCheck `yaml:"availability_check"`
+}
+
+type AvailabilityCheck struct {
+	Enabled           bool `yaml:"enabled" default:"false"`
+	IntervalInHours   int  `yaml:"interval_in_hours" default:"24"`
+	SampleSize        int  `yaml:"sample_size" default:"10"`
+	MaxStatsPerSecond int  `yaml:"max_stats_per_second" default:"20"`
+}
+
+type SegmentCache struct {
+	Dir      string `yaml:"dir"`
+	SizeInMb int    `yaml:"size_in_mb" default:"0"`
 }
 
 type Download struct {
-	MaxDownloadWorkers int              `yaml:"max_download_workers" default:"5"`
-	MaxRetries         int              `yaml:"max_retries" default:"8"`
-	Providers          []UsenetProvider `yaml:"providers"`
+	MaxDownloadWorkers   int              `yaml:"max_download_workers" default:"5"`
+	MaxRetries           int              `yaml:"max_retries" default:"8"`
+	PipelineDepth        int              `yaml:"pipeline_depth" default:"1"`
+	MaxBufferSizeInMb    int              `yaml:"max_buffer_size_in_mb" default:"30"`
+	MaxReadAheadSegments int              `yaml:"max_read_ahead_segments" default:"16"`
+	HedgePercentile      int              `yaml:"hedge_percentile" default:"0"`
+	MaxHedgePercent      int              `yaml:"max_hedge_percent" default:"10"`
+	Providers            []UsenetProvider `yaml:"providers"`
+	ReservedConnections  map[string]int   `yaml:"reserved_connections"`
 }
 
 type Upload struct {
-	DryRun        bool             `yaml:"dry_run" default:"false"`
-	FileAllowlist []string         `yaml:"file_allow_list"`
-	MaxRetries    int              `yaml:"max_retries" default:"8"`
-	Groups        []string         `yaml:"groups"`
-	Providers     []UsenetProvider `yaml:"providers"`
+	DryRun         bool             `yaml:"dry_run" default:"false"`
+	FileAllowlist  []string         `yaml:"file_allow_list"`
+	MaxRetries     int              `yaml:"max_retries" default:"8"`
+	Groups         []string         `yaml:"groups"`
+	Par2Redundancy int              `yaml:"par2_redundancy" default:"0"`
+	Providers      []UsenetProvider `yaml:"providers"`
 }
 
 type UsenetProvider struct {
-	Host           string `yaml:"host"`
-	Port           int    `yaml:"port"`
-	Username       string `yaml:"username"`
-	Password       string `yaml:"password" json:"-"`
-	TLS            bool   `yaml:"tls"`
-	MaxConnections int    `yaml:"max_connections"`
-	InsecureSSL    bool   `yaml:"insecure_ssl" default:"false"`
-	JoinGroup      bool   `yaml:"join_group" default:"false"`
-	Id             string `yaml:"id" default:""`
+	Host                          string `yaml:"host"`
+	Port                          int    `yaml:"port"`
+	Username                      string `yaml:"username"`
+	Password                      string `yaml:"password" json:"-"`
+	TLS                           bool   `yaml:"tls"`
+	MaxConnections                int    `yaml:"max_connections"`
+	InsecureSSL                   bool   `yaml:"insecure_ssl" default:"false"`
+	JoinGroup                     bool   `yaml:"join_group" default:"false"`
+	Id                            string `yaml:"id" default:""`
+	Tier                          int    `yaml:"tier" default:"0"`
+	Weight                        int    `yaml:"weight" default:"1"`
+	QuotaInBytes                  int64  `yaml:"quota_in_bytes" default:"0"`
+	QuotaResetPeriod              string `yaml:"quota_reset_period" default:"never"`
+	Compression                   bool   `yaml:"compression" default:"false"`
+	ProxyURL                      string `yaml:"proxy_url" json:"-"`
+	DialTimeoutInSeconds          int    `yaml:"dial_timeout_in_seconds"`
+	CommandTimeoutInSeconds       int    `yaml:"command_timeout_in_seconds"`
+	IdleTimeoutInSeconds          int    `yaml:"idle_timeout_in_seconds"`
+	MinThroughputInBytesPerSecond int    `yaml:"min_throughput_in_bytes_per_second"`
+	TLSCAFile                     string `yaml:"tls_ca_file"`
+	TLSFingerprint                string `yaml:"tls_fingerprint"`
+	TLSCertFile                   string `yaml:"tls_cert_file"`
+	TLSKeyFile                    string `yaml:"tls_key_file"`
+	TLSMinVersion                 string `yaml:"tls_min_version"`
+	TLSServerName                 string `yaml:"tls_server_name"`
+}
+
+// Defaults of the provider timeouts, a 0 in the config file disables them
+const (
+	defaultDialTimeoutInSeconds          = 10
+	defaultCommandTimeoutInSeconds       = 120
+	defaultIdleTimeoutInSeconds          = 30
+	defaultMinThroughputInBytesPerSecond = 1024
+)
+
+// UnmarshalYAML sets the default timeouts of the provider before its fields are read, so a 0
+// in the config file disables the timeout instead of being replaced by the default. They have
+// no default tag, defaults.Set would replace the 0 once the file is parsed.
+func (p *UsenetProvider) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	p.DialTimeoutInSeconds = defaultDialTimeoutInSeconds
+	p.CommandTimeoutInSeconds = defaultCommandTimeoutInSeconds
+	p.IdleTimeoutInSeconds = defaultIdleTimeoutInSeconds
+	p.MinThroughputInBytesPerSecond = defaultMinThroughputInBytesPerSecond
+
+	type plain UsenetProvider
+
+	return unmarshal((*plain)(p))
 }
 
 func FromFile(path string) (*Config, error) {
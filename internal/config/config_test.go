@@ -0,0 +1,100 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	return path
+}
+
+func TestFromFile(t *testing.T) {
+	t.Run("defaults are set for the missing options", func(t *testing.T) {
+		config, err := FromFile(writeConfig(t, `
+usenet:
+  download:
+    max_download_workers: 3
+    providers:
+      - host: download.example.com
+  availability_check:
+    enabled: true
+`))
+		assert.NoError(t, err)
+
+		assert.Equal(t, "8080", config.WebDavPort)
+		assert.Equal(t, 3, config.Usenet.Download.MaxDownloadWorkers)
+		assert.Equal(t, 8, config.Usenet.Download.MaxRetries)
+		// Pipelining is opt-in
+		assert.Equal(t, 1, config.Usenet.Download.PipelineDepth)
+		assert.Equal(t, 20, config.Usenet.AvailabilityCheck.MaxStatsPerSecond)
+
+		provider := config.Usenet.Download.Providers[0]
+		assert.Equal(t, "download.example.com", provider.Host)
+		assert.Equal(t, 1, provider.Weight)
+		assert.Equal(t, "never", provider.QuotaResetPeriod)
+		assert.Equal(t, 120, provider.CommandTimeoutInSeconds)
+		assert.Equal(t, 30, provider.IdleTimeoutInSeconds)
+		assert.Equal(t, 1024, provider.MinThroughputInBytesPerSecond)
+	})
+
+	t.Run("an explicit 0 of the provider timeouts is not replaced by the default", func(t *testing.T) {
+		config, err := FromFile(writeConfig(t, `
+usenet:
+  download:
+    max_download_workers: 3
+    max_retries: 0
+    providers:
+      - host: download.example.com
+        command_timeout_in_seconds: 0
+        idle_timeout_in_seconds: 0
+        min_throughput_in_bytes_per_second: 0
+  upload:
+    providers:
+      - host: upload.example.com
+        min_throughput_in_bytes_per_second: 0
+  availability_check:
+    max_stats_per_second: 0
+`))
+		assert.NoError(t, err)
+
+		// Only the provider timeouts can be disabled with a 0, the rest of options use the default
+		assert.Equal(t, 8, config.Usenet.Download.MaxRetries)
+		assert.Equal(t, 20, config.Usenet.AvailabilityCheck.MaxStatsPerSecond)
+
+		provider := config.Usenet.Download.Providers[0]
+		assert.Equal(t, 0, provider.CommandTimeoutInSeconds)
+		assert.Equal(t, 0, provider.IdleTimeoutInSeconds)
+		assert.Equal(t, 0, provider.MinThroughputInBytesPerSecond)
+		// The options that are not in the file keep their default
+		assert.Equal(t, 10, provider.DialTimeoutInSeconds)
+
+		assert.Equal(t, 0, config.Usenet.Upload.Providers[0].MinThroughputInBytesPerSecond)
+		assert.Equal(t, 120, config.Usenet.Upload.Providers[0].CommandTimeoutInSeconds)
+	})
+
+	t.Run("max download workers is required", func(t *testing.T) {
+		_, err := FromFile(writeConfig(t, `
+usenet:
+  download:
+    providers:
+      - host: download.example.com
+`))
+		assert.Error(t, err)
+	})
+
+	t.Run("max download workers must be greater than 0", func(t *testing.T) {
+		_, err := FromFile(writeConfig(t, `
+usenet:
+  download:
+    max_download_workers: 0
+`))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "usenet_drive"
+
+// Commands sent to the providers
+const (
+	CommandBody = "body"
+	CommandPost = "post"
+)
+
+var (
+	// Articles downloaded or posted by provider and command
+	Segments = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "segments_total",
+		Help:      "Number of segments downloaded (body) or posted (post) by provider.",
+	}, []string{"provider", "host", "command"})
+
+	Bytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_total",
+		Help:      "Number of bytes downloaded (body) or posted (post) by provider.",
+	}, []string{"provider", "host", "command"})
+
+	CommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "command_duration_seconds",
+		Help:      "Duration of the BODY and POST commands by provider.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"provider", "host", "command"})
+
+	CommandErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "command_errors_total",
+		Help:      "Number of failed BODY and POST commands by provider.",
+	}, []string{"provider", "host", "command"})
+
+	// Time waiting for a connection of the pool, including the time to dial it
+	AcquireDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "connection_acquire_duration_seconds",
+		Help:      "Time waiting to acquire a connection from the pool by provider.",
+		Buckets:   []float64{.001, .01, .05, .1, .5, 1, 5, 10, 30},
+	}, []string{"pool", "provider", "host"})
+
+	CorruptedArticles = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "corrupted_articles_total",
+		Help:      "Number of downloaded articles whose size or CRC32 do not match their yEnc trailer by provider.",
+	}, []string{"provider", "host"})
+
+	DownloadRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "download_retries_total",
+		Help:      "Number of segment download retries.",
+	})
+
+	UploadRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_retries_total",
+		Help:      "Number of segment upload retries.",
+	})
+
+	// Segment downloads hedged on another provider by result: sent, won or lost
+	HedgedRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "hedged_requests_total",
+		Help:      "Number of segment downloads hedged on another provider.",
+	}, []string{"result"})
+
+	// Articles checked by the availability check by result, available or missing
+	CheckedArticles = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "availability_checked_articles_total",
+		Help:      "Number of articles checked by the availability check.",
+	}, []string{"result"})
+
+	CorruptedNzbs = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "corrupted_nzbs_total",
+		Help:      "Number of nzbs added to the corrupted list.",
+	})
+
+	SegmentCacheHits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "segment_cache_hits_total",
+		Help:      "Number of segments read from the segment cache.",
+	})
+
+	SegmentCacheMisses = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "segment_cache_misses_total",
+		Help:      "Number of segments not found in the segment cache.",
+	})
+
+	SegmentCacheEvictions = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "segment_cache_evictions_total",
+		Help:      "Number of segments evicted from the segment cache.",
+	})
+
+	SegmentCacheBytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "segment_cache_bytes",
+		Help:      "Size of the segments stored in the segment cache.",
+	})
+)
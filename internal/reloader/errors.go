@@ -0,0 +1,8 @@
+package reloader
+
+import "errors"
+
+var (
+	ErrInvalidConfig   = errors.New("invalid config")
+	ErrEmptyPostGroups = errors.New("upload groups can not be empty")
+)
@@ -0,0 +1,169 @@
+//go:generate mockgen -source=./reloader.go -destination=./reloader_mock.go -package=reloader Reloader
+
+package reloader
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/javi11/usenet-drive/internal/config"
+	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
+	"github.com/javi11/usenet-drive/internal/usenet/filereader"
+	"github.com/javi11/usenet-drive/internal/usenet/filewriter"
+)
+
+type ReloadResult struct {
+	// Config fields that changed but can not be applied without a restart
+	RestartRequired []string `json:"restartRequired"`
+}
+
+type Reloader interface {
+	Reload(ctx context.Context) (ReloadResult, error)
+}
+
+type FileWriter interface {
+	Reload(options ...filewriter.Option)
+}
+
+type FileReader interface {
+	Reload(options ...filereader.Option)
+}
+
+type reloader struct {
+	mx         sync.Mutex
+	configPath string
+	current    *config.Config
+	cp         connectionpool.UsenetConnectionPool
+	fw         FileWriter
+	fr         FileReader
+	log        *slog.Logger
+}
+
+// New returns a reloader that applies the changes of the config file to the running
+// server. current is the config the server was started with.
+func New(
+	configPath string,
+	current *config.Config,
+	cp connectionpool.UsenetConnectionPool,
+	fw FileWriter,
+	fr FileReader,
+	log *slog.Logger,
+) Reloader {
+	return &reloader{
+		configPath: configPath,
+		current:    current,
+		cp:         cp,
+		fw:         fw,
+		fr:         fr,
+		log:        log,
+	}
+}
+
+// Reload reads the config file again and applies the providers, upload and download
+// settings. The fields that can not be changed live are kept and returned in the result.
+func (r *reloader) Reload(ctx context.Context) (ReloadResult, error) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	cfg, err := config.FromFile(r.configPath)
+	if err != nil {
+		return ReloadResult{}, errors.Join(ErrInvalidConfig, err)
+	}
+
+	if len(cfg.Usenet.Upload.Providers) > 0 && len(cfg.Usenet.Upload.Groups) == 0 {
+		return ReloadResult{}, errors.Join(ErrInvalidConfig, ErrEmptyPostGroups)
+	}
+
+	reservedConnections, err := connectionpool.ParseReservedConnections(cfg.Usenet.Download.ReservedConnections)
+	if err != nil {
+		return ReloadResult{}, errors.Join(ErrInvalidConfig, err)
+	}
+
+	err = r.cp.Reload(
+		connectionpool.WithDownloadProviders(cfg.Usenet.Download.Providers),
+		connectionpool.WithUploadProviders(cfg.Usenet.Upload.Providers),
+		connectionpool.WithSelectionStrategy(connectionpool.SelectionStrategy(cfg.Usenet.ProviderSelectionStrategy)),
+		connectionpool.WithReservedConnections(reservedConnections),
+	)
+	if err != nil {
+		if errors.Is(err, connectionpool.ErrUnknownSelectionStrategy) || errors.Is(err, connectionpool.ErrUnknownQuotaPeriod) {
+			return ReloadResult{}, errors.Join(ErrInvalidConfig, err)
+		}
+
+		return ReloadResult{}, err
+	}
+
+	r.fw.Reload(
+		filewriter.WithPostGroups(cfg.Usenet.Upload.Groups),
+		filewriter.WithFileAllowlist(cfg.Usenet.Upload.FileAllowlist),
+		filewriter.WithDryRun(cfg.Usenet.Upload.DryRun),
+		filewriter.WithMaxUploadRetries(cfg.Usenet.Upload.MaxRetries),
+		filewriter.WithPar2Redundancy(cfg.Usenet.Upload.Par2Redundancy),
+	)
+
+	r.fr.Reload(
+		filereader.WithMaxDownloadRetries(cfg.Usenet.Download.MaxRetries),
+		filereader.WithMaxDownloadWorkers(cfg.Usenet.Download.MaxDownloadWorkers),
+		filereader.WithPipelineDepth(cfg.Usenet.Download.PipelineDepth),
+		filereader.WithMaxBufferSizeInMb(cfg.Usenet.Download.MaxBufferSizeInMb),
+		filereader.WithMaxReadAheadSegments(cfg.Usenet.Download.MaxReadAheadSegments),
+		filereader.WithHedgePercentile(cfg.Usenet.Download.HedgePercentile),
+		filereader.WithMaxHedgePercent(cfg.Usenet.Download.MaxHedgePercent),
+	)
+
+	result := ReloadResult{RestartRequired: restartRequired(r.current, cfg)}
+	if len(result.RestartRequired) > 0 {
+		r.log.WarnContext(ctx, "Some config changes require a restart to be applied", "fields", result.RestartRequired)
+	}
+
+	// Keep the running values of the fields that were not applied
+	applied := *r.current
+	applied.Usenet.Download = cfg.Usenet.Download
+	applied.Usenet.Upload = cfg.Usenet.Upload
+	applied.Usenet.ProviderSelectionStrategy = cfg.Usenet.ProviderSelectionStrategy
+	r.current = &applied
+
+	r.log.InfoContext(ctx, "Config reloaded")
+
+	return result, nil
+}
+
+// restartRequired returns the yaml name of the fields that changed and can not be applied live
+func restartRequired(current, cfg *config.Config) []string {
+	fields := []struct {
+		name    string
+		changed bool
+	}{
+		{"log_path", current.LogPath != cfg.LogPath},
+		{"root_path", current.RootPath != cfg.RootPath},
+		{"web_dav_port", current.WebDavPort != cfg.WebDavPort},
+		{"api_port", current.ApiPort != cfg.ApiPort},
+		{"db_path", current.DBPath != cfg.DBPath},
+		{"debug", current.Debug != cfg.Debug},
+		{"rclone", current.Rclone != cfg.Rclone},
+		{"usenet.fake_connections", current.Usenet.FakeConnections != cfg.Usenet.FakeConnections},
+		{"usenet.fake_connections_dir", current.Usenet.FakeConnectionsDir != cfg.Usenet.FakeConnectionsDir},
+		{"usenet.segment_cache", current.Usenet.SegmentCache != cfg.Usenet.SegmentCache},
+		{"usenet.availability_check", current.Usenet.AvailabilityCheck != cfg.Usenet.AvailabilityCheck},
+		{"usenet.article_size_in_bytes", current.Usenet.ArticleSizeInBytes != cfg.Usenet.ArticleSizeInBytes},
+		{
+			"usenet.max_connection_idle_time_in_minutes",
+			current.Usenet.MaxConnectionIdleTimeInMinutes != cfg.Usenet.MaxConnectionIdleTimeInMinutes,
+		},
+		{
+			"usenet.max_connection_ttl_in_minutes",
+			current.Usenet.MaxConnectionTTLInMinutes != cfg.Usenet.MaxConnectionTTLInMinutes,
+		},
+	}
+
+	restart := []string{}
+	for _, f := range fields {
+		if f.changed {
+			restart = append(restart, f.name)
+		}
+	}
+
+	return restart
+}
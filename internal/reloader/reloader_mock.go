@@ -0,0 +1,130 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./reloader.go
+
+// Package reloader is a generated GoMock package.
+package reloader
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	filereader "github.com/javi11/usenet-drive/internal/usenet/filereader"
+	filewriter "github.com/javi11/usenet-drive/internal/usenet/filewriter"
+)
+
+// MockReloader is a mock of Reloader interface.
+type MockReloader struct {
+	ctrl     *gomock.Controller
+	recorder *MockReloaderMockRecorder
+}
+
+// MockReloaderMockRecorder is the mock recorder for MockReloader.
+type MockReloaderMockRecorder struct {
+	mock *MockReloader
+}
+
+// NewMockReloader creates a new mock instance.
+func NewMockReloader(ctrl *gomock.Controller) *MockReloader {
+	mock := &MockReloader{ctrl: ctrl}
+	mock.recorder = &MockReloaderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockReloader) EXPECT() *MockReloaderMockRecorder {
+	return m.recorder
+}
+
+// Reload mocks base method.
+func (m *MockReloader) Reload(ctx context.Context) (ReloadResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reload", ctx)
+	ret0, _ := ret[0].(ReloadResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reload indicates an expected call of Reload.
+func (mr *MockReloaderMockRecorder) Reload(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reload", reflect.TypeOf((*MockReloader)(nil).Reload), ctx)
+}
+
+// MockFileWriter is a mock of FileWriter interface.
+type MockFileWriter struct {
+	ctrl     *gomock.Controller
+	recorder *MockFileWriterMockRecorder
+}
+
+// MockFileWriterMockRecorder is the mock recorder for MockFileWriter.
+type MockFileWriterMockRecorder struct {
+	mock *MockFileWriter
+}
+
+// NewMockFileWriter creates a new mock instance.
+func NewMockFileWriter(ctrl *gomock.Controller) *MockFileWriter {
+	mock := &MockFileWriter{ctrl: ctrl}
+	mock.recorder = &MockFileWriterMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockFileWriter) EXPECT() *MockFileWriterMockRecorder {
+	return m.recorder
+}
+
+// Reload mocks base method.
+func (m *MockFileWriter) Reload(options ...filewriter.Option) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range options {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "Reload", varargs...)
+}
+
+// Reload indicates an expected call of Reload.
+func (mr *MockFileWriterMockRecorder) Reload(options ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reload", reflect.TypeOf((*MockFileWriter)(nil).Reload), options...)
+}
+
+// MockFileReader is a mock of FileReader interface.
+type MockFileReader struct {
+	ctrl     *gomock.Controller
+	recorder *MockFileReaderMockRecorder
+}
+
+// MockFileReaderMockRecorder is the mock recorder for MockFileReader.
+type MockFileReaderMockRecorder struct {
+	mock *MockFileReader
+}
+
+// NewMockFileReader creates a new mock instance.
+func NewMockFileReader(ctrl *gomock.Controller) *MockFileReader {
+	mock := &MockFileReader{ctrl: ctrl}
+	mock.recorder = &MockFileReaderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockFileReader) EXPECT() *MockFileReaderMockRecorder {
+	return m.recorder
+}
+
+// Reload mocks base method.
+func (m *MockFileReader) Reload(options ...filereader.Option) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range options {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "Reload", varargs...)
+}
+
+// Reload indicates an expected call of Reload.
+func (mr *MockFileReaderMockRecorder) Reload(options ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reload", reflect.TypeOf((*MockFileReader)(nil).Reload), options...)
+}
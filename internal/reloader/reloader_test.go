@@ -0,0 +1,103 @@
+package reloader
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/javi11/usenet-drive/internal/config"
+	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfig = `
+root_path: /nzbs
+usenet:
+  download:
+    max_download_workers: 5
+    providers:
+      - host: download
+        port: 119
+        max_connections: 10
+  upload:
+    groups:
+      - alt.binaries.test
+    providers:
+      - host: upload
+        port: 119
+        max_connections: 10
+`
+
+func TestReload(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	log := slog.Default()
+	ctx := context.Background()
+
+	writeConfig := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		err := os.WriteFile(path, []byte(content), 0644)
+		assert.NoError(t, err)
+
+		return path
+	}
+
+	loadConfig := func(t *testing.T, path string) *config.Config {
+		cfg, err := config.FromFile(path)
+		assert.NoError(t, err)
+
+		return cfg
+	}
+
+	t.Run("apply live changes and report the ones that need a restart", func(t *testing.T) {
+		cp := connectionpool.NewMockUsenetConnectionPool(ctrl)
+		fw := NewMockFileWriter(ctrl)
+		fr := NewMockFileReader(ctrl)
+
+		path := writeConfig(t, testConfig)
+		r := New(path, loadConfig(t, path), cp, fw, fr, log)
+
+		err := os.WriteFile(path, []byte(testConfig+"\napi_port: \"9090\"\n"), 0644)
+		assert.NoError(t, err)
+
+		cp.EXPECT().Reload(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		fw.EXPECT().Reload(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
+		fr.EXPECT().Reload(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(1)
+
+		result, err := r.Reload(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"api_port"}, result.RestartRequired)
+	})
+
+	t.Run("invalid config is not applied", func(t *testing.T) {
+		cp := connectionpool.NewMockUsenetConnectionPool(ctrl)
+		fw := NewMockFileWriter(ctrl)
+		fr := NewMockFileReader(ctrl)
+
+		path := writeConfig(t, testConfig)
+		r := New(path, loadConfig(t, path), cp, fw, fr, log)
+
+		err := os.WriteFile(path, []byte("usenet:\n  download:\n    max_download_workers: 0\n"), 0644)
+		assert.NoError(t, err)
+
+		_, err = r.Reload(ctx)
+		assert.ErrorIs(t, err, ErrInvalidConfig)
+	})
+
+	t.Run("unknown selection strategy is an invalid config", func(t *testing.T) {
+		cp := connectionpool.NewMockUsenetConnectionPool(ctrl)
+		fw := NewMockFileWriter(ctrl)
+		fr := NewMockFileReader(ctrl)
+
+		path := writeConfig(t, testConfig)
+		r := New(path, loadConfig(t, path), cp, fw, fr, log)
+
+		cp.EXPECT().Reload(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(connectionpool.ErrUnknownSelectionStrategy).Times(1)
+
+		_, err := r.Reload(ctx)
+		assert.ErrorIs(t, err, ErrInvalidConfig)
+	})
+}
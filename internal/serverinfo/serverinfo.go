@@ -2,6 +2,7 @@ package serverinfo
 
 import (
 	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
+	"github.com/javi11/usenet-drive/internal/usenet/filereader"
 	status "github.com/javi11/usenet-drive/internal/usenet/statusreporter"
 	"github.com/ricochet2200/go-disk-usage/du"
 )
@@ -11,6 +12,12 @@ type ServerInfo interface {
 	GetProvidersInfo() []connectionpool.ProviderInfo
 	GetActivity() []Activity
 	GetGlobalActivity() GlobalActivity
+	GetBufferUsage() filereader.BufferUsage
+}
+
+// BufferReporter reports the memory used by the read buffers of the open files
+type BufferReporter interface {
+	GetBufferUsage() filereader.BufferUsage
 }
 
 type GlobalActivity struct {
@@ -37,10 +44,16 @@ type serverInfo struct {
 	conPool  connectionpool.UsenetConnectionPool
 	rootPath string
 	sr       status.StatusReporter
+	br       BufferReporter
 }
 
-func NewServerInfo(cp connectionpool.UsenetConnectionPool, sr status.StatusReporter, rootPath string) ServerInfo {
-	return &serverInfo{rootPath: rootPath, conPool: cp, sr: sr}
+func NewServerInfo(
+	cp connectionpool.UsenetConnectionPool,
+	sr status.StatusReporter,
+	br BufferReporter,
+	rootPath string,
+) ServerInfo {
+	return &serverInfo{rootPath: rootPath, conPool: cp, sr: sr, br: br}
 }
 
 func (s *serverInfo) GetRootFolderDiskUsage() DiskUsage {
@@ -93,3 +106,7 @@ func (s *serverInfo) GetGlobalActivity() GlobalActivity {
 		UploadSpeed:   uploadSpeed,
 	}
 }
+
+func (s *serverInfo) GetBufferUsage() filereader.BufferUsage {
+	return s.br.GetBufferUsage()
+}
@@ -0,0 +1,430 @@
+package availabilitychecker
+
+//go:generate mockgen -source=./checker.go -destination=./checker_mock.go -package=availabilitychecker Checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/javi11/usenet-drive/internal/metrics"
+	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
+	"github.com/javi11/usenet-drive/internal/usenet/corruptednzbsmanager"
+	"github.com/javi11/usenet-drive/internal/usenet/nzbloader"
+	"github.com/javi11/usenet-drive/pkg/nntpcli"
+	"github.com/javi11/usenet-drive/pkg/osfs"
+	"golang.org/x/time/rate"
+)
+
+// Checker walks the nzb files of the root path and checks with STAT that their articles
+// are still in at least one of the download providers. The files with missing articles
+// that can not be repaired with their par2 recovery slices are added to the corrupted list.
+type Checker interface {
+	// Start starts a check in the background, the files checked within the interval are skipped
+	Start(ctx context.Context) error
+	// Stop cancels the running check, the next one resumes from the files not checked yet
+	Stop() error
+	Status() Status
+	List(ctx context.Context, limit, offset int, onlyMissing bool) (Result, error)
+	// Run starts a check every interval, if enabled, until the context is canceled
+	Run(ctx context.Context)
+}
+
+type Status struct {
+	Running     bool       `json:"running"`
+	Enabled     bool       `json:"enabled"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	CurrentFile string     `json:"current_file,omitempty"`
+	// Files checked by the current or last check
+	CheckedFiles int `json:"checked_files"`
+	// Files skipped because they were checked within the interval
+	SkippedFiles int `json:"skipped_files"`
+	// Files with articles missing on all the providers
+	UnavailableFiles int    `json:"unavailable_files"`
+	LastError        string `json:"last_error,omitempty"`
+}
+
+type checker struct {
+	mx         sync.Mutex
+	rootPath   string
+	cp         connectionpool.UsenetConnectionPool
+	cNzb       corruptednzbsmanager.CorruptedNzbsManager
+	repository AvailabilityRepository
+	fs         osfs.FileSystem
+	log        *slog.Logger
+	enabled    bool
+	interval   time.Duration
+	sampleSize int
+	limiter    *rate.Limiter
+	status     Status
+	cancel     context.CancelFunc
+	done       chan struct{}
+}
+
+func New(options ...Option) Checker {
+	config := defaultConfig()
+	for _, option := range options {
+		option(config)
+	}
+
+	if config.interval <= 0 {
+		config.interval = defaultConfig().interval
+	}
+
+	limit := rate.Inf
+	if config.maxStatsPerSecond > 0 {
+		limit = rate.Limit(config.maxStatsPerSecond)
+	}
+
+	return &checker{
+		rootPath:   config.rootPath,
+		cp:         config.cp,
+		cNzb:       config.cNzb,
+		repository: config.repository,
+		fs:         config.fs,
+		log:        config.log.With("component", "availability_checker"),
+		enabled:    config.enabled,
+		interval:   config.interval,
+		sampleSize: config.sampleSize,
+		limiter:    rate.NewLimiter(limit, 1),
+		status:     Status{Enabled: config.enabled},
+	}
+}
+
+func (c *checker) Run(ctx context.Context) {
+	if !c.enabled {
+		return
+	}
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.Start(ctx); err != nil && !errors.Is(err, ErrAlreadyRunning) {
+			c.log.ErrorContext(ctx, "Error starting the availability check", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = c.Stop()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *checker) Start(ctx context.Context) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.cancel != nil {
+		return ErrAlreadyRunning
+	}
+
+	// The check outlives the request that started it
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	startedAt := time.Now()
+
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	c.status = Status{
+		Running:   true,
+		Enabled:   c.enabled,
+		StartedAt: &startedAt,
+	}
+
+	go func(done chan struct{}) {
+		defer close(done)
+
+		err := c.check(ctx, startedAt)
+
+		c.mx.Lock()
+		defer c.mx.Unlock()
+
+		finishedAt := time.Now()
+		c.status.Running = false
+		c.status.CurrentFile = ""
+		c.status.FinishedAt = &finishedAt
+		if err != nil && !errors.Is(err, context.Canceled) {
+			c.status.LastError = err.Error()
+		}
+		c.cancel = nil
+		cancel()
+	}(c.done)
+
+	return nil
+}
+
+func (c *checker) Stop() error {
+	c.mx.Lock()
+	if c.cancel == nil {
+		c.mx.Unlock()
+		return ErrNotRunning
+	}
+
+	c.cancel()
+	done := c.done
+	c.mx.Unlock()
+
+	<-done
+
+	return nil
+}
+
+func (c *checker) Status() Status {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	return c.status
+}
+
+func (c *checker) List(ctx context.Context, limit, offset int, onlyMissing bool) (Result, error) {
+	return c.repository.List(ctx, limit, offset, onlyMissing)
+}
+
+// check walks the root path in lexical order, it returns when all the files are checked
+// or the context is canceled
+func (c *checker) check(ctx context.Context, startedAt time.Time) error {
+	c.log.InfoContext(ctx, "Availability check started")
+
+	err := filepath.WalkDir(c.rootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			c.log.WarnContext(ctx, "Error walking the root path", "path", path, "error", err)
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if d.IsDir() || !strings.HasSuffix(path, ".nzb") {
+			return nil
+		}
+
+		return c.checkFile(ctx, path, startedAt)
+	})
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			c.log.InfoContext(ctx, "Availability check stopped")
+		}
+
+		return err
+	}
+
+	// The files not found by a complete check were removed or renamed
+	if err := c.repository.DeleteCheckedBefore(ctx, startedAt.Add(-c.interval)); err != nil {
+		c.log.ErrorContext(ctx, "Error removing the availability of the removed files", "error", err)
+	}
+
+	c.log.InfoContext(ctx, "Availability check finished")
+
+	return nil
+}
+
+// checkFile checks the articles of a file. The errors of the file are logged and the file
+// is checked again by the next check, only the errors that stop the check are returned.
+func (c *checker) checkFile(ctx context.Context, path string, startedAt time.Time) error {
+	last, err := c.repository.Get(ctx, path)
+	if err != nil {
+		return fmt.Errorf("error getting the availability of %s: %w", path, err)
+	}
+
+	if last.CheckedAt.After(startedAt.Add(-c.interval)) {
+		c.mx.Lock()
+		c.status.SkippedFiles++
+		c.mx.Unlock()
+
+		return nil
+	}
+
+	c.mx.Lock()
+	c.status.CurrentFile = path
+	c.mx.Unlock()
+
+	availability, repairable, err := c.statFile(ctx, path)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return err
+		}
+
+		c.log.WarnContext(ctx, "Error checking the availability of the file", "path", path, "error", err)
+
+		return nil
+	}
+
+	if err := c.repository.Save(ctx, availability); err != nil {
+		return fmt.Errorf("error saving the availability of %s: %w", path, err)
+	}
+
+	c.mx.Lock()
+	c.status.CheckedFiles++
+	if availability.MissingArticles > 0 {
+		c.status.UnavailableFiles++
+	}
+	c.mx.Unlock()
+
+	// The missing articles are a lower bound when the check is sampled
+	if !repairable {
+		c.log.WarnContext(ctx,
+			"File with missing articles, marking it as corrupted",
+			"path", path,
+			"missing", availability.MissingArticles,
+			"checked", availability.CheckedArticles,
+		)
+
+		err := c.cNzb.Add(ctx, path, fmt.Sprintf(
+			"%d of %d checked articles are missing on all the providers",
+			availability.MissingArticles,
+			availability.CheckedArticles,
+		))
+		if err != nil {
+			c.log.ErrorContext(ctx, "Error adding corrupted nzb to the database", "path", path, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// statFile sends a STAT for the sampled articles of the file, it returns the availability
+// and whether the missing articles can be repaired with the par2 recovery slices of their
+// recovery sets
+func (c *checker) statFile(ctx context.Context, path string) (Availability, bool, error) {
+	f, err := c.fs.Open(path)
+	if err != nil {
+		return Availability{}, false, err
+	}
+	defer f.Close()
+
+	nzbReader := nzbloader.NewNzbReader(f)
+	defer nzbReader.Close()
+
+	metadata, err := nzbReader.GetMetadata()
+	if err != nil {
+		return Availability{}, false, err
+	}
+
+	if metadata.ChunkSize <= 0 {
+		return Availability{}, false, fmt.Errorf("invalid chunk size %d", metadata.ChunkSize)
+	}
+
+	total := metadata.Segments()
+	availability := Availability{
+		Path:          path,
+		TotalArticles: total,
+	}
+
+	repairable := true
+	missingBySet := map[int]int{}
+	addMissing := func(index int) {
+		availability.MissingArticles++
+
+		if metadata.RecoverySlices == 0 {
+			repairable = false
+			return
+		}
+
+		set := index / metadata.RecoverySetSize
+		missingBySet[set]++
+		if missingBySet[set] > metadata.RecoverySlices {
+			repairable = false
+		}
+	}
+
+	for _, index := range c.sample(total) {
+		availability.CheckedArticles++
+
+		segment, ok := nzbReader.GetSegment(index)
+		if !ok {
+			// The nzb is truncated
+			addMissing(index)
+			continue
+		}
+
+		if err := c.limiter.Wait(ctx); err != nil {
+			return Availability{}, false, err
+		}
+
+		available, err := c.stat(ctx, segment.Id)
+		if err != nil {
+			return Availability{}, false, err
+		}
+
+		if available {
+			metrics.CheckedArticles.WithLabelValues("available").Inc()
+		} else {
+			metrics.CheckedArticles.WithLabelValues("missing").Inc()
+			addMissing(index)
+		}
+	}
+
+	availability.CheckedAt = time.Now()
+
+	return availability, repairable, nil
+}
+
+// sample returns the sorted indexes of the articles to check
+func (c *checker) sample(total int) []int {
+	if c.sampleSize <= 0 || c.sampleSize >= total {
+		indexes := make([]int, total)
+		for i := range indexes {
+			indexes[i] = i
+		}
+
+		return indexes
+	}
+
+	indexes := rand.Perm(total)[:c.sampleSize]
+	sort.Ints(indexes)
+
+	return indexes
+}
+
+// stat reports whether any download provider has the article, the providers that do not
+// have it are excluded until none is left
+func (c *checker) stat(ctx context.Context, msgId string) (bool, error) {
+	var missingOn []string
+	for {
+		opts := []connectionpool.AcquireOption{connectionpool.WithPriority(connectionpool.PriorityMaintenance)}
+		if len(missingOn) > 0 {
+			opts = append(opts, connectionpool.WithExcludedProviders(missingOn...))
+		}
+
+		conn, err := c.cp.GetDownloadConnection(ctx, opts...)
+		if err != nil {
+			// The providers left are quarantined or disabled, the article is missing on the
+			// ones already checked
+			if len(missingOn) > 0 &&
+				(errors.Is(err, connectionpool.ErrNoProviderAvailable) || errors.Is(err, connectionpool.ErrNoHealthyProvider)) {
+				return false, nil
+			}
+
+			return false, fmt.Errorf("error getting nntp connection: %w", err)
+		}
+
+		nntpConn := conn.Value()
+		provider := nntpConn.Provider()
+
+		err = nntpConn.Stat(msgId)
+		if err == nil {
+			c.cp.Free(conn)
+			return true, nil
+		}
+
+		if !nntpcli.IsArticleNotFoundError(err) {
+			c.cp.Close(conn)
+			return false, fmt.Errorf("error checking article on %s: %w", provider.Host, err)
+		}
+
+		c.cp.Free(conn)
+		missingOn = append(missingOn, provider.Id)
+	}
+}
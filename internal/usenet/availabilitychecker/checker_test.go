@@ -0,0 +1,252 @@
+package availabilitychecker
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
+	"github.com/javi11/usenet-drive/internal/usenet/corruptednzbsmanager"
+	"github.com/javi11/usenet-drive/pkg/nntpcli"
+)
+
+const testNzb = `<?xml version="1.0" encoding="utf-8"?>
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+	<head>
+		<meta type="file_size">25</meta>
+		<meta type="file_name">file.bin</meta>
+		<meta type="file_extension">.bin</meta>
+		<meta type="mod_time">2023-09-22 20:06:09</meta>
+		<meta type="chunk_size">10</meta>
+	</head>
+	<file poster="poster" date="1695410374" subject="file.bin">
+		<groups>
+			<group>alt.binaries.test</group>
+		</groups>
+		<segments>
+			<segment bytes="10" number="1">a1@test</segment>
+			<segment bytes="10" number="2">a2@test</segment>
+			<segment bytes="5" number="3">a3@test</segment>
+		</segments>
+	</file>
+</nzb>`
+
+func TestChecker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	rootPath := t.TempDir()
+	path := filepath.Join(rootPath, "dir", "file.bin.nzb")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(testNzb), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(rootPath, "other.txt"), []byte("other"), 0644))
+
+	newChecker := func(
+		cp connectionpool.UsenetConnectionPool,
+		cNzb corruptednzbsmanager.CorruptedNzbsManager,
+		repo AvailabilityRepository,
+	) *checker {
+		return New(
+			WithRootPath(rootPath),
+			WithConnectionPool(cp),
+			WithCorruptedNzbsManager(cNzb),
+			WithRepository(repo),
+			WithLogger(slog.Default()),
+			WithSampleSize(0),
+			WithMaxStatsPerSecond(0),
+		).(*checker)
+	}
+
+	newResource := func(provider nntpcli.Provider, stat func(string) error) *connectionpool.MockResource {
+		mockConn := nntpcli.NewMockConnection(ctrl)
+		mockConn.EXPECT().Provider().Return(provider).AnyTimes()
+		mockConn.EXPECT().Stat(gomock.Any()).DoAndReturn(stat).AnyTimes()
+		mockResource := connectionpool.NewMockResource(ctrl)
+		mockResource.EXPECT().Value().Return(mockConn).AnyTimes()
+
+		return mockResource
+	}
+
+	notFound := &textproto.Error{Code: nntpcli.ArticleNotFoundErrCode, Msg: "No such article"}
+
+	t.Run("All the articles are available", func(t *testing.T) {
+		mockPool := connectionpool.NewMockUsenetConnectionPool(ctrl)
+		mockCNzb := corruptednzbsmanager.NewMockCorruptedNzbsManager(ctrl)
+		mockRepo := NewMockAvailabilityRepository(ctrl)
+		c := newChecker(mockPool, mockCNzb, mockRepo)
+
+		resource := newResource(nntpcli.Provider{Id: "p1"}, func(string) error { return nil })
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(resource, nil).Times(3)
+		mockPool.EXPECT().Free(resource).Times(3)
+
+		mockRepo.EXPECT().Get(gomock.Any(), path).Return(Availability{}, nil).Times(1)
+		mockRepo.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, a Availability) error {
+			assert.Equal(t, path, a.Path)
+			assert.Equal(t, 3, a.TotalArticles)
+			assert.Equal(t, 3, a.CheckedArticles)
+			assert.Equal(t, 0, a.MissingArticles)
+			assert.False(t, a.CheckedAt.IsZero())
+			return nil
+		}).Times(1)
+		mockRepo.EXPECT().DeleteCheckedBefore(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		err := c.check(context.Background(), time.Now())
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, c.status.CheckedFiles)
+		assert.Equal(t, 0, c.status.UnavailableFiles)
+	})
+
+	t.Run("Article missing on all the providers", func(t *testing.T) {
+		mockPool := connectionpool.NewMockUsenetConnectionPool(ctrl)
+		mockCNzb := corruptednzbsmanager.NewMockCorruptedNzbsManager(ctrl)
+		mockRepo := NewMockAvailabilityRepository(ctrl)
+		c := newChecker(mockPool, mockCNzb, mockRepo)
+
+		stat := func(msgId string) error {
+			if msgId == "a2@test" {
+				return notFound
+			}
+			return nil
+		}
+		p1 := newResource(nntpcli.Provider{Id: "p1"}, stat)
+		p2 := newResource(nntpcli.Provider{Id: "p2"}, stat)
+
+		gomock.InOrder(
+			mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(p1, nil).Times(2),
+			// The article is asked to the next provider
+			mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any(), gomock.Any()).Return(p2, nil).Times(1),
+			mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(nil, connectionpool.ErrNoProviderAvailable).Times(1),
+			mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(p1, nil).Times(1),
+		)
+		mockPool.EXPECT().Free(p1).Times(3)
+		mockPool.EXPECT().Free(p2).Times(1)
+
+		mockRepo.EXPECT().Get(gomock.Any(), path).Return(Availability{}, nil).Times(1)
+		mockRepo.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, a Availability) error {
+			assert.Equal(t, 3, a.CheckedArticles)
+			assert.Equal(t, 1, a.MissingArticles)
+			return nil
+		}).Times(1)
+		mockRepo.EXPECT().DeleteCheckedBefore(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockCNzb.EXPECT().Add(gomock.Any(), path, "1 of 3 checked articles are missing on all the providers").
+			Return(nil).Times(1)
+
+		err := c.check(context.Background(), time.Now())
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, c.status.UnavailableFiles)
+	})
+
+	t.Run("Article missing on the provider checked while the other one is quarantined", func(t *testing.T) {
+		mockPool := connectionpool.NewMockUsenetConnectionPool(ctrl)
+		mockCNzb := corruptednzbsmanager.NewMockCorruptedNzbsManager(ctrl)
+		mockRepo := NewMockAvailabilityRepository(ctrl)
+		c := newChecker(mockPool, mockCNzb, mockRepo)
+
+		p1 := newResource(nntpcli.Provider{Id: "p1"}, func(msgId string) error {
+			if msgId == "a2@test" {
+				return notFound
+			}
+			return nil
+		})
+
+		gomock.InOrder(
+			mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(p1, nil).Times(2),
+			// The only provider left is quarantined
+			mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any(), gomock.Any()).
+				Return(nil, connectionpool.ErrNoHealthyProvider).Times(1),
+			mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(p1, nil).Times(1),
+		)
+		mockPool.EXPECT().Free(p1).Times(3)
+
+		mockRepo.EXPECT().Get(gomock.Any(), path).Return(Availability{}, nil).Times(1)
+		mockRepo.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, a Availability) error {
+			assert.Equal(t, 3, a.CheckedArticles)
+			assert.Equal(t, 1, a.MissingArticles)
+			return nil
+		}).Times(1)
+		mockRepo.EXPECT().DeleteCheckedBefore(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+		mockCNzb.EXPECT().Add(gomock.Any(), path, "1 of 3 checked articles are missing on all the providers").
+			Return(nil).Times(1)
+
+		err := c.check(context.Background(), time.Now())
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, c.status.UnavailableFiles)
+	})
+
+	t.Run("Files checked within the interval are skipped", func(t *testing.T) {
+		mockPool := connectionpool.NewMockUsenetConnectionPool(ctrl)
+		mockCNzb := corruptednzbsmanager.NewMockCorruptedNzbsManager(ctrl)
+		mockRepo := NewMockAvailabilityRepository(ctrl)
+		c := newChecker(mockPool, mockCNzb, mockRepo)
+
+		mockRepo.EXPECT().Get(gomock.Any(), path).
+			Return(Availability{Path: path, CheckedAt: time.Now().Add(-time.Hour)}, nil).Times(1)
+		mockRepo.EXPECT().DeleteCheckedBefore(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		err := c.check(context.Background(), time.Now())
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, c.status.SkippedFiles)
+		assert.Equal(t, 0, c.status.CheckedFiles)
+	})
+
+	t.Run("The file is not saved on connection errors", func(t *testing.T) {
+		mockPool := connectionpool.NewMockUsenetConnectionPool(ctrl)
+		mockCNzb := corruptednzbsmanager.NewMockCorruptedNzbsManager(ctrl)
+		mockRepo := NewMockAvailabilityRepository(ctrl)
+		c := newChecker(mockPool, mockCNzb, mockRepo)
+
+		resource := newResource(nntpcli.Provider{Id: "p1"}, func(string) error { return errors.New("broken pipe") })
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(resource, nil).Times(1)
+		mockPool.EXPECT().Close(resource).Times(1)
+
+		mockRepo.EXPECT().Get(gomock.Any(), path).Return(Availability{}, nil).Times(1)
+		mockRepo.EXPECT().DeleteCheckedBefore(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+
+		err := c.check(context.Background(), time.Now())
+		require.NoError(t, err)
+
+		assert.Equal(t, 0, c.status.CheckedFiles)
+	})
+
+	t.Run("Start and stop", func(t *testing.T) {
+		mockPool := connectionpool.NewMockUsenetConnectionPool(ctrl)
+		mockCNzb := corruptednzbsmanager.NewMockCorruptedNzbsManager(ctrl)
+		mockRepo := NewMockAvailabilityRepository(ctrl)
+		c := newChecker(mockPool, mockCNzb, mockRepo)
+
+		assert.ErrorIs(t, c.Stop(), ErrNotRunning)
+
+		started := make(chan struct{})
+		mockRepo.EXPECT().Get(gomock.Any(), path).DoAndReturn(func(ctx context.Context, _ string) (Availability, error) {
+			close(started)
+			<-ctx.Done()
+			return Availability{}, ctx.Err()
+		}).Times(1)
+
+		require.NoError(t, c.Start(context.Background()))
+		<-started
+		assert.ErrorIs(t, c.Start(context.Background()), ErrAlreadyRunning)
+		assert.True(t, c.Status().Running)
+
+		require.NoError(t, c.Stop())
+
+		status := c.Status()
+		assert.False(t, status.Running)
+		assert.NotNil(t, status.FinishedAt)
+		assert.Empty(t, status.LastError)
+	})
+}
@@ -0,0 +1,101 @@
+package availabilitychecker
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
+	"github.com/javi11/usenet-drive/internal/usenet/corruptednzbsmanager"
+	"github.com/javi11/usenet-drive/pkg/osfs"
+)
+
+type Config struct {
+	rootPath          string
+	cp                connectionpool.UsenetConnectionPool
+	cNzb              corruptednzbsmanager.CorruptedNzbsManager
+	repository        AvailabilityRepository
+	fs                osfs.FileSystem
+	log               *slog.Logger
+	enabled           bool
+	interval          time.Duration
+	sampleSize        int
+	maxStatsPerSecond int
+}
+
+type Option func(*Config)
+
+func defaultConfig() *Config {
+	return &Config{
+		fs:                osfs.New(),
+		log:               slog.Default(),
+		interval:          24 * time.Hour,
+		sampleSize:        10,
+		maxStatsPerSecond: 20,
+	}
+}
+
+func WithRootPath(rootPath string) Option {
+	return func(c *Config) {
+		c.rootPath = rootPath
+	}
+}
+
+func WithConnectionPool(cp connectionpool.UsenetConnectionPool) Option {
+	return func(c *Config) {
+		c.cp = cp
+	}
+}
+
+func WithCorruptedNzbsManager(cNzb corruptednzbsmanager.CorruptedNzbsManager) Option {
+	return func(c *Config) {
+		c.cNzb = cNzb
+	}
+}
+
+func WithRepository(repository AvailabilityRepository) Option {
+	return func(c *Config) {
+		c.repository = repository
+	}
+}
+
+func WithFileSystem(fs osfs.FileSystem) Option {
+	return func(c *Config) {
+		c.fs = fs
+	}
+}
+
+func WithLogger(log *slog.Logger) Option {
+	return func(c *Config) {
+		c.log = log
+	}
+}
+
+// WithEnabled runs the check every interval, when disabled it only runs when started
+// from the admin API
+func WithEnabled(enabled bool) Option {
+	return func(c *Config) {
+		c.enabled = enabled
+	}
+}
+
+// WithInterval sets the time between checks, the files checked within the interval are
+// skipped so a stopped check resumes where it was
+func WithInterval(interval time.Duration) Option {
+	return func(c *Config) {
+		c.interval = interval
+	}
+}
+
+// WithSampleSize sets the number of random articles checked per file, 0 checks all of them
+func WithSampleSize(sampleSize int) Option {
+	return func(c *Config) {
+		c.sampleSize = sampleSize
+	}
+}
+
+// WithMaxStatsPerSecond limits the STAT commands sent to the providers, 0 means no limit
+func WithMaxStatsPerSecond(maxStatsPerSecond int) Option {
+	return func(c *Config) {
+		c.maxStatsPerSecond = maxStatsPerSecond
+	}
+}
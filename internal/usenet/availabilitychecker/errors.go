@@ -0,0 +1,8 @@
+package availabilitychecker
+
+import "errors"
+
+var (
+	ErrAlreadyRunning = errors.New("availability check already running")
+	ErrNotRunning     = errors.New("availability check not running")
+)
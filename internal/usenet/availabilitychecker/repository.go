@@ -0,0 +1,133 @@
+package availabilitychecker
+
+//go:generate mockgen -source=./repository.go -destination=./repository_mock.go -package=availabilitychecker AvailabilityRepository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Availability is the result of the last check of a file
+type Availability struct {
+	Path          string `json:"path"`
+	TotalArticles int    `json:"total_articles"`
+	// Articles sent to the providers, all of them unless the check is sampled
+	CheckedArticles int       `json:"checked_articles"`
+	MissingArticles int       `json:"missing_articles"`
+	CheckedAt       time.Time `json:"checked_at"`
+}
+
+type Result struct {
+	Entries    []Availability `json:"entries"`
+	TotalCount int            `json:"total_count"`
+	Offset     int            `json:"offset"`
+	Limit      int            `json:"limit"`
+}
+
+// AvailabilityRepository persists the availability of the files, so a check can resume
+// after a restart
+type AvailabilityRepository interface {
+	// Get returns the availability of the file, an empty one if it was never checked
+	Get(ctx context.Context, path string) (Availability, error)
+	Save(ctx context.Context, availability Availability) error
+	// List returns the files by path, only the ones with missing articles if onlyMissing is set
+	List(ctx context.Context, limit, offset int, onlyMissing bool) (Result, error)
+	// DeleteCheckedBefore removes the files not checked since the given time, they were
+	// removed or renamed
+	DeleteCheckedBefore(ctx context.Context, t time.Time) error
+}
+
+type availabilityRepository struct {
+	db *sql.DB
+}
+
+func NewRepository(db *sql.DB) AvailabilityRepository {
+	return &availabilityRepository{db: db}
+}
+
+func (r *availabilityRepository) Get(ctx context.Context, path string) (Availability, error) {
+	a := Availability{Path: path}
+	err := r.db.QueryRowContext(
+		ctx,
+		"SELECT total_articles, checked_articles, missing_articles, checked_at FROM file_availability WHERE path = ?",
+		path,
+	).Scan(&a.TotalArticles, &a.CheckedArticles, &a.MissingArticles, &a.CheckedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Availability{}, nil
+		}
+
+		return Availability{}, err
+	}
+
+	return a, nil
+}
+
+func (r *availabilityRepository) Save(ctx context.Context, a Availability) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`INSERT INTO file_availability (path, total_articles, checked_articles, missing_articles, checked_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (path) DO UPDATE SET total_articles = excluded.total_articles, checked_articles = excluded.checked_articles,
+		missing_articles = excluded.missing_articles, checked_at = excluded.checked_at`,
+		a.Path,
+		a.TotalArticles,
+		a.CheckedArticles,
+		a.MissingArticles,
+		a.CheckedAt,
+	)
+
+	return err
+}
+
+func (r *availabilityRepository) List(ctx context.Context, limit, offset int, onlyMissing bool) (Result, error) {
+	where := ""
+	if onlyMissing {
+		where = "WHERE missing_articles > 0"
+	}
+
+	var totalCount int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM file_availability "+where).Scan(&totalCount)
+	if err != nil {
+		return Result{}, err
+	}
+
+	rows, err := r.db.QueryContext(
+		ctx,
+		"SELECT path, total_articles, checked_articles, missing_articles, checked_at FROM file_availability "+
+			where+" ORDER BY path LIMIT ? OFFSET ?",
+		limit,
+		offset,
+	)
+	if err != nil {
+		return Result{}, err
+	}
+	defer rows.Close()
+
+	entries := []Availability{}
+	for rows.Next() {
+		var a Availability
+		if err := rows.Scan(&a.Path, &a.TotalArticles, &a.CheckedArticles, &a.MissingArticles, &a.CheckedAt); err != nil {
+			return Result{}, err
+		}
+		entries = append(entries, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return Result{}, err
+	}
+
+	return Result{
+		Entries:    entries,
+		TotalCount: totalCount,
+		Offset:     offset,
+		Limit:      limit,
+	}, nil
+}
+
+func (r *availabilityRepository) DeleteCheckedBefore(ctx context.Context, t time.Time) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM file_availability WHERE checked_at < ?", t)
+
+	return err
+}
@@ -0,0 +1,94 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./repository.go
+
+// Package availabilitychecker is a generated GoMock package.
+package availabilitychecker
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockAvailabilityRepository is a mock of AvailabilityRepository interface.
+type MockAvailabilityRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockAvailabilityRepositoryMockRecorder
+}
+
+// MockAvailabilityRepositoryMockRecorder is the mock recorder for MockAvailabilityRepository.
+type MockAvailabilityRepositoryMockRecorder struct {
+	mock *MockAvailabilityRepository
+}
+
+// NewMockAvailabilityRepository creates a new mock instance.
+func NewMockAvailabilityRepository(ctrl *gomock.Controller) *MockAvailabilityRepository {
+	mock := &MockAvailabilityRepository{ctrl: ctrl}
+	mock.recorder = &MockAvailabilityRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAvailabilityRepository) EXPECT() *MockAvailabilityRepositoryMockRecorder {
+	return m.recorder
+}
+
+// DeleteCheckedBefore mocks base method.
+func (m *MockAvailabilityRepository) DeleteCheckedBefore(ctx context.Context, t time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCheckedBefore", ctx, t)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteCheckedBefore indicates an expected call of DeleteCheckedBefore.
+func (mr *MockAvailabilityRepositoryMockRecorder) DeleteCheckedBefore(ctx, t interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCheckedBefore", reflect.TypeOf((*MockAvailabilityRepository)(nil).DeleteCheckedBefore), ctx, t)
+}
+
+// Get mocks base method.
+func (m *MockAvailabilityRepository) Get(ctx context.Context, path string) (Availability, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, path)
+	ret0, _ := ret[0].(Availability)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockAvailabilityRepositoryMockRecorder) Get(ctx, path interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockAvailabilityRepository)(nil).Get), ctx, path)
+}
+
+// List mocks base method.
+func (m *MockAvailabilityRepository) List(ctx context.Context, limit, offset int, onlyMissing bool) (Result, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, limit, offset, onlyMissing)
+	ret0, _ := ret[0].(Result)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockAvailabilityRepositoryMockRecorder) List(ctx, limit, offset, onlyMissing interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockAvailabilityRepository)(nil).List), ctx, limit, offset, onlyMissing)
+}
+
+// Save mocks base method.
+func (m *MockAvailabilityRepository) Save(ctx context.Context, availability Availability) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, availability)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockAvailabilityRepositoryMockRecorder) Save(ctx, availability interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockAvailabilityRepository)(nil).Save), ctx, availability)
+}
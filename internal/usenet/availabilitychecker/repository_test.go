@@ -0,0 +1,112 @@
+package availabilitychecker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAvailabilityRepository_Get(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	ctx := context.Background()
+	checkedAt := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery("SELECT total_articles, checked_articles, missing_articles, checked_at FROM file_availability").
+		WithArgs("/nzbs/file.nzb").
+		WillReturnRows(
+			sqlmock.NewRows([]string{"total_articles", "checked_articles", "missing_articles", "checked_at"}).
+				AddRow(100, 10, 1, checkedAt),
+		)
+
+	a, err := repo.Get(ctx, "/nzbs/file.nzb")
+	assert.NoError(t, err)
+	assert.Equal(t, Availability{
+		Path:            "/nzbs/file.nzb",
+		TotalArticles:   100,
+		CheckedArticles: 10,
+		MissingArticles: 1,
+		CheckedAt:       checkedAt,
+	}, a)
+
+	mock.ExpectQuery("SELECT total_articles, checked_articles, missing_articles, checked_at FROM file_availability").
+		WithArgs("/nzbs/other.nzb").
+		WillReturnRows(sqlmock.NewRows([]string{"total_articles", "checked_articles", "missing_articles", "checked_at"}))
+
+	a, err = repo.Get(ctx, "/nzbs/other.nzb")
+	assert.NoError(t, err)
+	assert.Equal(t, Availability{}, a)
+}
+
+func TestAvailabilityRepository_Save(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	checkedAt := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec("INSERT INTO file_availability").
+		WithArgs("/nzbs/file.nzb", 100, 10, 1, checkedAt).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = repo.Save(context.Background(), Availability{
+		Path:            "/nzbs/file.nzb",
+		TotalArticles:   100,
+		CheckedArticles: 10,
+		MissingArticles: 1,
+		CheckedAt:       checkedAt,
+	})
+	assert.NoError(t, err)
+}
+
+func TestAvailabilityRepository_List(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	checkedAt := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM file_availability WHERE missing_articles > 0").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT path, total_articles, checked_articles, missing_articles, checked_at FROM file_availability WHERE missing_articles > 0").
+		WithArgs(10, 0).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"path", "total_articles", "checked_articles", "missing_articles", "checked_at"}).
+				AddRow("/nzbs/file.nzb", 100, 10, 1, checkedAt),
+		)
+
+	result, err := repo.List(context.Background(), 10, 0, true)
+	assert.NoError(t, err)
+	assert.Equal(t, Result{
+		Entries: []Availability{
+			{Path: "/nzbs/file.nzb", TotalArticles: 100, CheckedArticles: 10, MissingArticles: 1, CheckedAt: checkedAt},
+		},
+		TotalCount: 1,
+		Offset:     0,
+		Limit:      10,
+	}, result)
+}
+
+func TestAvailabilityRepository_DeleteCheckedBefore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := NewRepository(db)
+	before := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec("DELETE FROM file_availability WHERE checked_at").
+		WithArgs(before).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	err = repo.DeleteCheckedBefore(context.Background(), before)
+	assert.NoError(t, err)
+}
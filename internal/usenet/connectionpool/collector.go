@@ -0,0 +1,55 @@
+package connectionpool
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	connectionsDesc = prometheus.NewDesc(
+		"usenet_drive_pool_connections",
+		"Number of open connections by pool, provider and state (idle or acquired).",
+		[]string{"pool", "provider", "host", "state"},
+		nil,
+	)
+	maxConnectionsDesc = prometheus.NewDesc(
+		"usenet_drive_pool_max_connections",
+		"Max number of connections by pool and provider.",
+		[]string{"pool", "provider", "host"},
+		nil,
+	)
+	remainingQuotaDesc = prometheus.NewDesc(
+		"usenet_drive_provider_quota_remaining_bytes",
+		"Bytes that the provider can still transfer in the current quota period.",
+		[]string{"pool", "provider", "host"},
+		nil,
+	)
+)
+
+type collector struct {
+	cp UsenetConnectionPool
+}
+
+// NewCollector returns a prometheus collector with the connections stats of the pool.
+func NewCollector(cp UsenetConnectionPool) prometheus.Collector {
+	return &collector{cp: cp}
+}
+
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- connectionsDesc
+	ch <- maxConnectionsDesc
+	ch <- remainingQuotaDesc
+}
+
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	for _, info := range c.cp.GetProvidersInfo() {
+		pool := string(info.Type)
+
+		ch <- prometheus.MustNewConstMetric(connectionsDesc, prometheus.GaugeValue, float64(info.IdleConnections), pool, info.Id, info.Host, "idle")
+		ch <- prometheus.MustNewConstMetric(connectionsDesc, prometheus.GaugeValue, float64(info.AcquiredConnections), pool, info.Id, info.Host, "acquired")
+		ch <- prometheus.MustNewConstMetric(maxConnectionsDesc, prometheus.GaugeValue, float64(info.MaxConnections), pool, info.Id, info.Host)
+
+		if info.RemainingQuotaInBytes != nil {
+			ch <- prometheus.MustNewConstMetric(remainingQuotaDesc, prometheus.GaugeValue, float64(*info.RemainingQuotaInBytes), pool, info.Id, info.Host)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package connectionpool
+
+import (
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	cp := NewMockUsenetConnectionPool(ctrl)
+
+	cp.EXPECT().GetProvidersInfo().Return([]ProviderInfo{
+		{Id: "1", Host: "download", Type: DownloadProviderPool, IdleConnections: 2, AcquiredConnections: 3, MaxConnections: 10},
+		// Providers of the same host are different series
+		{Id: "2", Host: "download", Type: DownloadProviderPool, IdleConnections: 1, AcquiredConnections: 1, MaxConnections: 10},
+		{Id: "3", Host: "upload", Type: UploadProviderPool, IdleConnections: 1, AcquiredConnections: 0, MaxConnections: 5},
+	}).Times(1)
+
+	// idle, acquired and max connections by provider
+	assert.Equal(t, 9, testutil.CollectAndCount(NewCollector(cp)))
+}
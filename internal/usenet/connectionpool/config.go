@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/javi11/usenet-drive/internal/config"
+	"github.com/javi11/usenet-drive/internal/usenet/providerusage"
 	"github.com/javi11/usenet-drive/pkg/nntpcli"
 )
 
@@ -13,11 +14,17 @@ type Config struct {
 	uploadProviders        []config.UsenetProvider
 	log                    *slog.Logger
 	fakeConnections        bool
+	fakeConnectionsDir     string
 	cli                    nntpcli.Client
 	maxConnectionTTL       time.Duration
 	maxConnectionIdleTime  time.Duration
 	minDownloadConnections int
 	healthCheckInterval    time.Duration
+	minQuarantineBackoff   time.Duration
+	maxQuarantineBackoff   time.Duration
+	selectionStrategy      SelectionStrategy
+	usageRepository        providerusage.UsageRepository
+	reservedConnections    map[Priority]int
 }
 
 type Option func(*Config)
@@ -29,6 +36,9 @@ func defaultConfig() *Config {
 		maxConnectionIdleTime:  30 * time.Minute,
 		minDownloadConnections: 5,
 		healthCheckInterval:    time.Minute,
+		minQuarantineBackoff:   30 * time.Second,
+		maxQuarantineBackoff:   30 * time.Minute,
+		selectionStrategy:      SelectionStrategyFirstFit,
 	}
 }
 
@@ -62,6 +72,14 @@ func WithFakeConnections(fakeConnections bool) Option {
 	}
 }
 
+// WithFakeConnectionsDir stores the articles posted through the fake connections in dir,
+// so they can be downloaded later. Without it the fake connections discard them.
+func WithFakeConnectionsDir(dir string) Option {
+	return func(c *Config) {
+		c.fakeConnectionsDir = dir
+	}
+}
+
 func WithMaxConnectionTTL(maxConnectionTTL time.Duration) Option {
 	return func(c *Config) {
 		c.maxConnectionTTL = maxConnectionTTL
@@ -85,3 +103,59 @@ func WithHealthCheckInterval(healthCheckInterval time.Duration) Option {
 		c.healthCheckInterval = healthCheckInterval
 	}
 }
+
+// WithQuarantineBackoff sets the time a failing provider is kept out of the pool. The
+// time doubles on every consecutive quarantine until maxBackoff is reached.
+func WithQuarantineBackoff(minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Config) {
+		c.minQuarantineBackoff = minBackoff
+		c.maxQuarantineBackoff = maxBackoff
+	}
+}
+
+// WithSelectionStrategy sets how the provider that serves a connection is chosen between
+// the providers of the same tier.
+func WithSelectionStrategy(strategy SelectionStrategy) Option {
+	return func(c *Config) {
+		c.selectionStrategy = strategy
+	}
+}
+
+// WithUsageRepository persists the usage of the providers with quota. Without it the
+// usage is reset on every restart.
+func WithUsageRepository(repo providerusage.UsageRepository) Option {
+	return func(c *Config) {
+		c.usageRepository = repo
+	}
+}
+
+// WithReservedConnections reserves download connections that can only be used by the
+// requests of the given priority.
+func WithReservedConnections(reserved map[Priority]int) Option {
+	return func(c *Config) {
+		c.reservedConnections = reserved
+	}
+}
+
+type acquireConfig struct {
+	excludedProviders []string
+	priority          Priority
+}
+
+type AcquireOption func(*acquireConfig)
+
+// WithPriority sets the priority of the request. Download connections are
+// PriorityForeground and upload connections PriorityUpload by default.
+func WithPriority(priority Priority) AcquireOption {
+	return func(c *acquireConfig) {
+		c.priority = priority
+	}
+}
+
+// WithExcludedProviders skips the given provider ids when choosing the provider that
+// will serve the connection. Used to fail over to other providers or tiers.
+func WithExcludedProviders(ids ...string) AcquireOption {
+	return func(c *acquireConfig) {
+		c.excludedProviders = append(c.excludedProviders, ids...)
+	}
+}
@@ -4,30 +4,46 @@ package connectionpool
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/jackc/puddle/v2"
+	"github.com/javi11/usenet-drive/internal/metrics"
+	"github.com/javi11/usenet-drive/internal/usenet/providerusage"
 	"github.com/javi11/usenet-drive/pkg/nntpcli"
 )
 
+// Number of times a provider dial is retried on timeouts before giving up
+const maxDialAttempts = 3
+
 type UsenetConnectionPool interface {
-	GetDownloadConnection(ctx context.Context) (Resource, error)
+	GetDownloadConnection(ctx context.Context, opts ...AcquireOption) (Resource, error)
 	GetUploadConnection(ctx context.Context) (Resource, error)
 	GetProvidersInfo() []ProviderInfo
+	DisableProvider(id string) error
+	DrainProvider(id string) error
+	EnableProvider(id string) error
+	Reload(options ...Option) error
 	Free(res Resource)
 	Close(res Resource)
 	Quit()
 }
 
 type connectionPool struct {
-	uploadConnPool         *puddle.Pool[nntpcli.Connection]
-	downloadConnPool       *puddle.Pool[nntpcli.Connection]
+	// Protects the provider pools, they are replaced on reload
+	mx                     sync.RWMutex
+	reloadMx               sync.Mutex
 	uploadProviderPool     *providerPool
 	downloadProviderPool   *providerPool
+	config                 *Config
+	newConnPool            func(provider *Provider) (*puddle.Pool[nntpcli.Connection], error)
+	newQuota               func(provider *Provider) (*providerQuota, error)
+	usageRepository        providerusage.UsageRepository
 	log                    *slog.Logger
 	maxConnectionTTL       time.Duration
 	maxConnectionIdleTime  time.Duration
@@ -42,78 +58,64 @@ func NewConnectionPool(options ...Option) (UsenetConnectionPool, error) {
 		option(config)
 	}
 
-	upp := NewProviderPool(config.uploadProviders, UploadProviderPool)
-	dpp := NewProviderPool(config.downloadProviders, DownloadProviderPool)
-
-	dConnPool, err := puddle.NewPool(
-		&puddle.Config[nntpcli.Connection]{
-			Constructor: func(ctx context.Context) (nntpcli.Connection, error) {
-				provider := dpp.GetProvider()
-				if provider == nil {
-					return nil, nil
-				}
-				maxAgeTime := time.Now().Add(config.maxConnectionTTL)
-
-				return dialNNTP(
-					ctx,
-					config.cli,
-					config.fakeConnections,
-					maxAgeTime,
-					provider,
-					config.log,
-				)
-			},
-			Destructor: func(value nntpcli.Connection) {
-				dpp.FreeProvider(value.Provider().Id)
-				err := value.Close()
-				if err != nil {
-					config.log.Debug(fmt.Sprintf("error closing connection: %v", err))
-				}
+	newConnPool := func(provider *Provider) (*puddle.Pool[nntpcli.Connection], error) {
+		return puddle.NewPool(
+			&puddle.Config[nntpcli.Connection]{
+				Constructor: func(ctx context.Context) (nntpcli.Connection, error) {
+					maxAgeTime := time.Now().Add(config.maxConnectionTTL)
+
+					c, err := dialNNTP(
+						ctx,
+						config.cli,
+						config.fakeConnections,
+						config.fakeConnectionsDir,
+						maxAgeTime,
+						provider,
+						config.log,
+					)
+					if err != nil {
+						return nil, err
+					}
+
+					provider.usedConnections.Add(1)
+
+					return &providerConnection{Connection: c, provider: provider}, nil
+				},
+				Destructor: func(value nntpcli.Connection) {
+					provider.usedConnections.Add(-1)
+					err := value.Close()
+					if err != nil {
+						config.log.Debug(fmt.Sprintf("error closing connection: %v", err))
+					}
+				},
+				MaxSize: int32(provider.MaxConnections),
 			},
-			MaxSize: int32(dpp.GetMaxConnections()),
-		},
-	)
-	if err != nil {
-		return nil, err
+		)
 	}
 
-	uConnPool, err := puddle.NewPool(
-		&puddle.Config[nntpcli.Connection]{
-			Constructor: func(ctx context.Context) (nntpcli.Connection, error) {
-				provider := upp.GetProvider()
-				if provider == nil {
-					return nil, nil
-				}
-				maxAgeTime := time.Now().Add(config.maxConnectionTTL)
-
-				return dialNNTP(
-					ctx,
-					config.cli,
-					config.fakeConnections,
-					maxAgeTime,
-					provider,
-					config.log,
-				)
-			},
-			Destructor: func(value nntpcli.Connection) {
-				upp.FreeProvider(value.Provider().Id)
-				err := value.Close()
-				if err != nil {
-					config.log.Debug(fmt.Sprintf("error closing connection: %v", err))
-				}
-			},
-			MaxSize: int32(upp.GetMaxConnections()),
-		},
-	)
-	if err != nil {
-		return nil, err
+	newQuota := func(provider *Provider) (*providerQuota, error) {
+		quota, err := newProviderQuota(provider.QuotaInBytes, QuotaPeriod(provider.QuotaResetPeriod))
+		if err != nil {
+			return nil, err
+		}
+
+		if config.usageRepository != nil && quota.HasLimit() {
+			usage, err := config.usageRepository.Get(context.Background(), provider.quotaKey(), string(provider.t))
+			if err != nil {
+				return nil, err
+			}
+
+			quota.Load(usage)
+		}
+
+		return quota, nil
 	}
 
 	pool := &connectionPool{
-		uploadProviderPool:     upp,
-		downloadProviderPool:   dpp,
-		uploadConnPool:         uConnPool,
-		downloadConnPool:       dConnPool,
+		config:                 config,
+		newConnPool:            newConnPool,
+		newQuota:               newQuota,
+		usageRepository:        config.usageRepository,
 		log:                    config.log,
 		maxConnectionTTL:       config.maxConnectionTTL,
 		maxConnectionIdleTime:  config.maxConnectionIdleTime,
@@ -122,6 +124,13 @@ func NewConnectionPool(options ...Option) (UsenetConnectionPool, error) {
 		wg:                     sync.WaitGroup{},
 	}
 
+	dpp, upp, err := pool.newProviderPools(config, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	pool.downloadProviderPool = dpp
+	pool.uploadProviderPool = upp
+
 	pool.wg.Add(1)
 	go pool.connectionHealCheck(config.healthCheckInterval)
 
@@ -133,27 +142,110 @@ func (p *connectionPool) Quit() {
 
 	p.wg.Wait()
 
-	p.downloadConnPool.Close()
-	p.uploadConnPool.Close()
+	p.saveUsage()
+
+	p.mx.Lock()
+	defer p.mx.Unlock()
 
 	p.uploadProviderPool.Quit()
 	p.downloadProviderPool.Quit()
+}
+
+// Reload applies the given options over the current config and replaces the providers.
+// Only providers, their selection strategy and quarantine backoff can be changed.
+// Providers that did not change keep their connections, the removed or changed ones
+// are drained, their connections in use are closed once released.
+func (p *connectionPool) Reload(options ...Option) error {
+	p.reloadMx.Lock()
+	defer p.reloadMx.Unlock()
+
+	p.mx.RLock()
+	config := *p.config
+	oldDpp, oldUpp := p.downloadProviderPool, p.uploadProviderPool
+	p.mx.RUnlock()
+
+	for _, option := range options {
+		option(&config)
+	}
 
-	p.uploadConnPool = nil
-	p.downloadConnPool = nil
+	// Changed providers are created again, they need the latest usage
+	p.saveUsage()
+
+	dpp, upp, err := p.newProviderPools(&config, oldDpp, oldUpp)
+	if err != nil {
+		return err
+	}
+
+	p.mx.Lock()
+	p.downloadProviderPool = dpp
+	p.uploadProviderPool = upp
+	p.config = &config
+	p.mx.Unlock()
+
+	removed := append(removedProviders(oldDpp.providers, dpp.providers), removedProviders(oldUpp.providers, upp.providers)...)
+	for _, provider := range removed {
+		p.log.Info(fmt.Sprintf("provider %s removed, draining its connections", provider.Host))
+		provider.health.SetStatus(ProviderStatusDraining)
+
+		// Close waits until all the connections in use are released
+		go provider.connPool.Close()
+	}
+
+	return nil
 }
 
-func (p *connectionPool) GetUploadConnection(ctx context.Context) (Resource, error) {
-	conn, err := p.getConnection(ctx, p.uploadConnPool)
+// newProviderPools creates the download and upload pools, the providers of the old pools
+// that did not change are reused.
+func (p *connectionPool) newProviderPools(config *Config, oldDpp, oldUpp *providerPool) (*providerPool, *providerPool, error) {
+	var dExisting, uExisting []*Provider
+	if oldDpp != nil {
+		dExisting = oldDpp.providers
+	}
+	if oldUpp != nil {
+		uExisting = oldUpp.providers
+	}
+
+	// Each pool has its own selector since some strategies keep state between selections
+	dSelector, err := newSelector(config.selectionStrategy)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	uSelector, err := newSelector(config.selectionStrategy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	newHealth := func() *providerHealth {
+		return newProviderHealth(config.minQuarantineBackoff, config.maxQuarantineBackoff)
+	}
+
+	dpp, err := NewProviderPool(
+		config.downloadProviders,
+		DownloadProviderPool,
+		dSelector,
+		p.newConnPool,
+		newHealth,
+		p.newQuota,
+		config.reservedConnections,
+		dExisting,
+	)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if conn == nil {
-		return p.GetUploadConnection(ctx)
+	// Reservations are only useful in the download pool, uploads do not share it
+	upp, err := NewProviderPool(config.uploadProviders, UploadProviderPool, uSelector, p.newConnPool, newHealth, p.newQuota, nil, uExisting)
+	if err != nil {
+		closeProviders(removedProviders(dpp.providers, dExisting))
+		return nil, nil, err
 	}
 
-	return conn, nil
+	return dpp, upp, nil
+}
+
+func (p *connectionPool) GetUploadConnection(ctx context.Context) (Resource, error) {
+	return p.getConnection(ctx, UploadProviderPool)
 }
 
 func (p *connectionPool) Free(res Resource) {
@@ -176,39 +268,160 @@ func (p *connectionPool) Close(res Resource) {
 	res.Destroy()
 }
 
-func (p *connectionPool) GetDownloadConnection(ctx context.Context) (Resource, error) {
-	conn, err := p.getConnection(ctx, p.downloadConnPool)
+// GetDownloadConnection returns a connection from the lowest provider tier available.
+// Use WithExcludedProviders to skip the providers that already failed to serve an article.
+func (p *connectionPool) GetDownloadConnection(ctx context.Context, opts ...AcquireOption) (Resource, error) {
+	return p.getConnection(ctx, DownloadProviderPool, opts...)
+}
+
+func (p *connectionPool) GetProvidersInfo() []ProviderInfo {
+	p.mx.RLock()
+	defer p.mx.RUnlock()
+
+	return append(p.uploadProviderPool.GetProvidersInfo(), p.downloadProviderPool.GetProvidersInfo()...)
+}
+
+// DisableProvider stops using the provider immediately. Idle connections are closed
+// and the ones in use are closed once they are released.
+func (p *connectionPool) DisableProvider(id string) error {
+	provider, err := p.getProviderById(id)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if conn == nil {
-		return p.GetDownloadConnection(ctx)
+	provider.health.SetStatus(ProviderStatusDisabled)
+	p.closeIdleConnections(provider)
+
+	return nil
+}
+
+// DrainProvider stops giving new connections of the provider, the ones in use are closed
+// once they are released. The provider is disabled when it has no connections left.
+func (p *connectionPool) DrainProvider(id string) error {
+	provider, err := p.getProviderById(id)
+	if err != nil {
+		return err
 	}
 
-	return conn, nil
+	provider.health.SetStatus(ProviderStatusDraining)
+
+	return nil
 }
 
-func (p *connectionPool) GetProvidersInfo() []ProviderInfo {
-	return append(p.uploadProviderPool.GetProvidersInfo(), p.downloadProviderPool.GetProvidersInfo()...)
+// EnableProvider puts back a disabled or drained provider, its health is restored.
+func (p *connectionPool) EnableProvider(id string) error {
+	provider, err := p.getProviderById(id)
+	if err != nil {
+		return err
+	}
+
+	provider.health.SetStatus(ProviderStatusEnabled)
+
+	return nil
+}
+
+func (p *connectionPool) getProviderById(id string) (*Provider, error) {
+	p.mx.RLock()
+	defer p.mx.RUnlock()
+
+	if provider, err := p.downloadProviderPool.GetProviderById(id); err == nil {
+		return provider, nil
+	}
+
+	return p.uploadProviderPool.GetProviderById(id)
+}
+
+func (p *connectionPool) closeIdleConnections(provider *Provider) {
+	for _, res := range provider.connPool.AcquireAllIdle() {
+		res.Destroy()
+	}
 }
 
 func (p *connectionPool) getConnection(
 	ctx context.Context,
-	cPool *puddle.Pool[nntpcli.Connection],
+	t providerType,
+	opts ...AcquireOption,
 ) (Resource, error) {
-	conn, err := cPool.Acquire(ctx)
-	if err != nil {
-		return nil, err
+	ac := &acquireConfig{priority: PriorityForeground}
+	if t == UploadProviderPool {
+		ac.priority = PriorityUpload
+	}
+	for _, opt := range opts {
+		opt(ac)
+	}
+
+	var provider *Provider
+	var conn *puddle.Resource[nntpcli.Connection]
+	var release func()
+	start := time.Now()
+	for {
+		pp := p.getProviderPool(t)
+
+		var err error
+		provider, err = pp.GetProvider(ac.excludedProviders)
+		if err != nil {
+			return nil, err
+		}
+
+		// The slots are the connections of the provider, the requests wait for it by priority
+		release, err = provider.gate.Acquire(ctx, ac.priority)
+		if err != nil {
+			return nil, err
+		}
+
+		// The provider can go down or be disabled while waiting, choose again
+		if !provider.health.IsAvailable() || provider.quota.IsExhausted() {
+			release()
+			continue
+		}
+
+		conn, err = provider.connPool.Acquire(ctx)
+		if err != nil {
+			release()
+
+			// The provider was removed by a reload while acquiring, try with the new providers
+			if errors.Is(err, puddle.ErrClosedPool) && pp != p.getProviderPool(t) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		break
 	}
+	metrics.AcquireDuration.WithLabelValues(string(provider.t), provider.Id, provider.Host).Observe(time.Since(start).Seconds())
+
+	return &gatedResource{Resource: conn, release: release}, nil
+}
+
+func (p *connectionPool) getProviderPool(t providerType) *providerPool {
+	p.mx.RLock()
+	defer p.mx.RUnlock()
+
+	if t == UploadProviderPool {
+		return p.uploadProviderPool
+	}
+
+	return p.downloadProviderPool
+}
+
+// getProviders returns the providers of both pools
+func (p *connectionPool) getProviders() []*Provider {
+	p.mx.RLock()
+	defer p.mx.RUnlock()
+
+	providers := make([]*Provider, 0, len(p.downloadProviderPool.providers)+len(p.uploadProviderPool.providers))
+	providers = append(providers, p.downloadProviderPool.providers...)
+	providers = append(providers, p.uploadProviderPool.providers...)
 
-	return conn, nil
+	return providers
 }
 
 func dialNNTP(
 	ctx context.Context,
 	cli nntpcli.Client,
 	fakeConnections bool,
+	fakeConnectionsDir string,
 	maxAgeTime time.Time,
 	p *Provider,
 	log *slog.Logger,
@@ -216,22 +429,37 @@ func dialNNTP(
 	var err error
 	var c nntpcli.Connection
 
-	for {
-		log.Debug(fmt.Sprintf("connecting to %s:%v", p.UsenetProvider.Host, p.UsenetProvider.Port))
+	provider := nntpcli.Provider{
+		Host:           p.UsenetProvider.Host,
+		Port:           p.UsenetProvider.Port,
+		Username:       p.UsenetProvider.Username,
+		Password:       p.UsenetProvider.Password,
+		JoinGroup:      p.UsenetProvider.JoinGroup,
+		MaxConnections: p.UsenetProvider.MaxConnections,
+		Id:             p.UsenetProvider.Id,
+		Tier:           p.UsenetProvider.Tier,
+		Compression:    p.UsenetProvider.Compression,
+		ProxyURL:       p.UsenetProvider.ProxyURL,
+		DialTimeout:    time.Duration(p.UsenetProvider.DialTimeoutInSeconds) * time.Second,
+		CommandTimeout: time.Duration(p.UsenetProvider.CommandTimeoutInSeconds) * time.Second,
+		IdleTimeout:    time.Duration(p.UsenetProvider.IdleTimeoutInSeconds) * time.Second,
+		MinThroughput:  p.UsenetProvider.MinThroughputInBytesPerSecond,
+		TLS: nntpcli.TLSOptions{
+			CAFile:      p.UsenetProvider.TLSCAFile,
+			Fingerprint: p.UsenetProvider.TLSFingerprint,
+			CertFile:    p.UsenetProvider.TLSCertFile,
+			KeyFile:     p.UsenetProvider.TLSKeyFile,
+			MinVersion:  p.UsenetProvider.TLSMinVersion,
+			ServerName:  p.UsenetProvider.TLSServerName,
+		},
+	}
 
-		provider := nntpcli.Provider{
-			Host:           p.UsenetProvider.Host,
-			Port:           p.UsenetProvider.Port,
-			Username:       p.UsenetProvider.Username,
-			Password:       p.UsenetProvider.Password,
-			JoinGroup:      p.UsenetProvider.JoinGroup,
-			MaxConnections: p.UsenetProvider.MaxConnections,
-			Id:             p.UsenetProvider.Id,
-		}
+	if fakeConnections {
+		return nntpcli.NewFakeConnection(provider, fakeConnectionsDir), nil
+	}
 
-		if fakeConnections {
-			return nntpcli.NewFakeConnection(provider), nil
-		}
+	for attempt := 1; ; attempt++ {
+		log.Debug(fmt.Sprintf("connecting to %s:%v", p.UsenetProvider.Host, p.UsenetProvider.Port))
 
 		if p.TLS {
 			c, err = cli.DialTLS(
@@ -240,38 +468,52 @@ func dialNNTP(
 				p.InsecureSSL,
 				maxAgeTime,
 			)
-			if err != nil {
-				e, ok := err.(net.Error)
-				if ok && e.Timeout() {
-					log.Error(fmt.Sprintf("timeout connecting to %s:%v, retrying", provider.Host, provider.Port), "error", e)
-					continue
-				}
-				return nil, err
-			}
 		} else {
 			c, err = cli.Dial(
 				ctx,
 				provider,
 				maxAgeTime,
 			)
-			if err != nil {
-				// if it's a timeout, ignore and try again
-				e, ok := err.(net.Error)
-				if ok && e.Timeout() {
-					log.Error(fmt.Sprintf("timeout connecting to %s:%v, retrying", provider.Host, provider.Port), "error", e)
-					continue
-				}
-				return nil, err
-			}
 		}
+		p.health.RecordResult(err)
+		if err != nil {
+			// if it's a timeout, try again until the provider is considered unhealthy
+			e, ok := err.(net.Error)
+			if ok && e.Timeout() && attempt < maxDialAttempts && p.health.IsAvailable() {
+				log.Error(fmt.Sprintf("timeout connecting to %s:%v, retrying", provider.Host, provider.Port), "error", e)
+				continue
+			}
 
-		// auth
-		if err := c.Authenticate(); err != nil {
 			return nil, err
 		}
 
 		break
 	}
+
+	// auth
+	err = c.Authenticate()
+	p.health.RecordResult(err)
+	if err != nil {
+		if e := c.Close(); e != nil {
+			log.Debug(fmt.Sprintf("error closing connection: %v", e))
+		}
+
+		return nil, err
+	}
+
+	if provider.Compression {
+		err = c.EnableCompression()
+		if errors.Is(err, nntpcli.ErrCompressionUnavailable) {
+			log.Debug(fmt.Sprintf("compression not available on %s:%v", provider.Host, provider.Port))
+		} else if err != nil {
+			if e := c.Close(); e != nil {
+				log.Debug(fmt.Sprintf("error closing connection: %v", e))
+			}
+
+			return nil, err
+		}
+	}
+
 	return c, nil
 }
 
@@ -286,6 +528,30 @@ func (p *connectionPool) connectionHealCheck(healthCheckInterval time.Duration)
 			return
 		case <-ticker.C:
 			p.checkHealth()
+			p.saveUsage()
+		}
+	}
+}
+
+// saveUsage persists the usage of the providers with quota that changed since the last save
+func (p *connectionPool) saveUsage() {
+	if p.usageRepository == nil {
+		return
+	}
+
+	for _, provider := range p.getProviders() {
+		if !provider.quota.HasLimit() {
+			continue
+		}
+
+		usage, changed := provider.quota.Usage()
+		if !changed {
+			continue
+		}
+
+		err := p.usageRepository.Save(context.Background(), provider.quotaKey(), string(provider.t), usage)
+		if err != nil {
+			p.log.Error(fmt.Sprintf("error saving usage of provider %s", provider.Host), "error", err)
 		}
 	}
 }
@@ -315,17 +581,21 @@ func (p *connectionPool) checkHealth() {
 func (p *connectionPool) checkConnsHealth() bool {
 	var destroyed bool
 
-	dIdle := p.uploadConnPool.AcquireAllIdle()
-	uIdle := p.downloadConnPool.AcquireAllIdle()
+	for _, provider := range p.getProviders() {
+		status := provider.health.Status()
 
-	idle := append(dIdle, uIdle...)
+		for _, res := range provider.connPool.AcquireAllIdle() {
+			if status != ProviderStatusEnabled || p.isExpired(res) || res.IdleDuration() > p.maxConnectionIdleTime {
+				res.Destroy()
+				destroyed = true
+			} else {
+				res.ReleaseUnused()
+			}
+		}
 
-	for _, res := range idle {
-		if p.isExpired(res) || res.IdleDuration() > p.maxConnectionIdleTime {
-			res.Destroy()
-			destroyed = true
-		} else {
-			res.ReleaseUnused()
+		if status == ProviderStatusDraining && provider.usedConnections.Load() == 0 {
+			p.log.Info(fmt.Sprintf("provider %s drained, disabling it", provider.Host))
+			provider.health.SetStatus(ProviderStatusDisabled)
 		}
 	}
 
@@ -334,7 +604,12 @@ func (p *connectionPool) checkConnsHealth() bool {
 
 func (p *connectionPool) createIdleResources(ctx context.Context, toCreate int) error {
 	for i := 0; i < toCreate; i++ {
-		_, err := p.downloadConnPool.Acquire(ctx)
+		provider, err := p.getProviderPool(DownloadProviderPool).GetProvider(nil)
+		if err != nil {
+			return err
+		}
+
+		err = provider.connPool.CreateResource(ctx)
 		if err != nil {
 			return err
 		}
@@ -346,13 +621,25 @@ func (p *connectionPool) checkMinConns() error {
 	// TotalConns can include ones that are being destroyed but we should have
 	// sleep(500ms) around all of the destroys to help prevent that from throwing
 	// off this check
-	toCreate := p.minDownloadConnections - int(p.downloadConnPool.Stat().TotalResources())
+	toCreate := p.minDownloadConnections - p.getProviderPool(DownloadProviderPool).GetTotalConnections()
 	if toCreate > 0 {
 		return p.createIdleResources(context.Background(), int(toCreate))
 	}
 	return nil
 }
 
+// removedProviders returns the providers of old that are not in current
+func removedProviders(old, current []*Provider) []*Provider {
+	var removed []*Provider
+	for _, provider := range old {
+		if !slices.Contains(current, provider) {
+			removed = append(removed, provider)
+		}
+	}
+
+	return removed
+}
+
 func (p *connectionPool) isExpired(res *puddle.Resource[nntpcli.Connection]) bool {
 	return time.Now().After(res.Value().MaxAgeTime())
 }
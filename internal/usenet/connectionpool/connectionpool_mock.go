@@ -46,6 +46,48 @@ func (mr *MockUsenetConnectionPoolMockRecorder) Close(res interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockUsenetConnectionPool)(nil).Close), res)
 }
 
+// DisableProvider mocks base method.
+func (m *MockUsenetConnectionPool) DisableProvider(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DisableProvider", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DisableProvider indicates an expected call of DisableProvider.
+func (mr *MockUsenetConnectionPoolMockRecorder) DisableProvider(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DisableProvider", reflect.TypeOf((*MockUsenetConnectionPool)(nil).DisableProvider), id)
+}
+
+// DrainProvider mocks base method.
+func (m *MockUsenetConnectionPool) DrainProvider(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DrainProvider", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DrainProvider indicates an expected call of DrainProvider.
+func (mr *MockUsenetConnectionPoolMockRecorder) DrainProvider(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DrainProvider", reflect.TypeOf((*MockUsenetConnectionPool)(nil).DrainProvider), id)
+}
+
+// EnableProvider mocks base method.
+func (m *MockUsenetConnectionPool) EnableProvider(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableProvider", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnableProvider indicates an expected call of EnableProvider.
+func (mr *MockUsenetConnectionPoolMockRecorder) EnableProvider(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableProvider", reflect.TypeOf((*MockUsenetConnectionPool)(nil).EnableProvider), id)
+}
+
 // Free mocks base method.
 func (m *MockUsenetConnectionPool) Free(res Resource) {
 	m.ctrl.T.Helper()
@@ -59,18 +101,23 @@ func (mr *MockUsenetConnectionPoolMockRecorder) Free(res interface{}) *gomock.Ca
 }
 
 // GetDownloadConnection mocks base method.
-func (m *MockUsenetConnectionPool) GetDownloadConnection(ctx context.Context) (Resource, error) {
+func (m *MockUsenetConnectionPool) GetDownloadConnection(ctx context.Context, opts ...AcquireOption) (Resource, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetDownloadConnection", ctx)
+	varargs := []interface{}{ctx}
+	for _, a := range opts {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetDownloadConnection", varargs...)
 	ret0, _ := ret[0].(Resource)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetDownloadConnection indicates an expected call of GetDownloadConnection.
-func (mr *MockUsenetConnectionPoolMockRecorder) GetDownloadConnection(ctx interface{}) *gomock.Call {
+func (mr *MockUsenetConnectionPoolMockRecorder) GetDownloadConnection(ctx interface{}, opts ...interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDownloadConnection", reflect.TypeOf((*MockUsenetConnectionPool)(nil).GetDownloadConnection), ctx)
+	varargs := append([]interface{}{ctx}, opts...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDownloadConnection", reflect.TypeOf((*MockUsenetConnectionPool)(nil).GetDownloadConnection), varargs...)
 }
 
 // GetProvidersInfo mocks base method.
@@ -113,3 +160,21 @@ func (mr *MockUsenetConnectionPoolMockRecorder) Quit() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Quit", reflect.TypeOf((*MockUsenetConnectionPool)(nil).Quit))
 }
+
+// Reload mocks base method.
+func (m *MockUsenetConnectionPool) Reload(options ...Option) error {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range options {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Reload", varargs...)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Reload indicates an expected call of Reload.
+func (mr *MockUsenetConnectionPoolMockRecorder) Reload(options ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reload", reflect.TypeOf((*MockUsenetConnectionPool)(nil).Reload), options...)
+}
@@ -10,6 +10,7 @@ import (
 
 	gomock "github.com/golang/mock/gomock"
 	"github.com/javi11/usenet-drive/internal/config"
+	"github.com/javi11/usenet-drive/internal/usenet/providerusage"
 	"github.com/javi11/usenet-drive/pkg/nntpcli"
 	gomockextra "github.com/oxyno-zeta/gomock-extra-matcher"
 	"github.com/stretchr/testify/assert"
@@ -59,7 +60,7 @@ func TestGetDownloadConnection(t *testing.T) {
 		mockNntpCli.EXPECT().
 			Dial(gomock.Any(), gomockextra.StructMatcher().Field("Host", "download"), gomock.Any()).
 			Return(mockCon, nil)
-		mockCon.EXPECT().Provider().Return(provider).Times(2)
+		mockCon.EXPECT().Provider().Return(provider).Times(1)
 		mockCon.EXPECT().Authenticate().Return(nil)
 		mockCon.EXPECT().Close().Return(nil).Times(1)
 
@@ -93,7 +94,7 @@ func TestGetDownloadConnection(t *testing.T) {
 		mockNntpCli.EXPECT().
 			Dial(gomock.Any(), gomockextra.StructMatcher().Field("Host", "download"), gomock.Any()).
 			Return(mockDownloadCon, nil)
-		mockDownloadCon.EXPECT().Provider().Return(provider).Times(2)
+		mockDownloadCon.EXPECT().Provider().Return(provider).Times(1)
 		mockDownloadCon.EXPECT().Authenticate().Return(nil)
 		mockDownloadCon.EXPECT().Close().Return(nil).Times(1)
 
@@ -110,13 +111,6 @@ func TestGetDownloadConnection(t *testing.T) {
 			Return(mockDownloadCon2, nil)
 		mockDownloadCon2.EXPECT().Provider().Return(provider2).Times(1)
 		mockDownloadCon2.EXPECT().Authenticate().Return(nil)
-		mockDownloadCon2.EXPECT().Provider().Return(nntpcli.Provider{
-			Host:     "download",
-			Port:     1244,
-			Username: "user",
-			Password: "pass",
-			Id:       "2",
-		}).Times(1)
 		mockDownloadCon2.EXPECT().Close().Return(nil).Times(1)
 
 		cp, err := NewConnectionPool(
@@ -155,13 +149,6 @@ func TestGetDownloadConnection(t *testing.T) {
 			Dial(gomock.Any(), gomockextra.StructMatcher().Field("Host", "download"), gomock.Any()).
 			Return(mockCon, nil)
 		mockCon.EXPECT().Authenticate().Return(nil)
-		mockCon.EXPECT().Provider().Return(nntpcli.Provider{
-			Host:     "download",
-			Port:     1244,
-			Username: "user",
-			Password: "pass",
-			Id:       "1",
-		}).Times(1)
 		mockCon.EXPECT().Close().Return(nil).Times(1)
 
 		cp, err := NewConnectionPool(
@@ -198,13 +185,6 @@ func TestGetDownloadConnection(t *testing.T) {
 			Return(mockCon, nil)
 		mockCon.EXPECT().Authenticate().Return(nil)
 		mockCon.EXPECT().Close().Return(nil).Times(1)
-		mockCon.EXPECT().Provider().Return(nntpcli.Provider{
-			Host:     "download",
-			Port:     1244,
-			Username: "user",
-			Password: "pass",
-			Id:       "1",
-		}).Times(1)
 
 		cp, err := NewConnectionPool(
 			WithClient(mockNntpCli),
@@ -248,7 +228,7 @@ func TestGetDownloadConnection(t *testing.T) {
 		mockNntpCli.EXPECT().
 			Dial(gomock.Any(), gomockextra.StructMatcher().Field("Host", "download"), gomock.Any()).
 			Return(mockCon, nil)
-		mockCon.EXPECT().Provider().Return(provider).Times(2)
+		mockCon.EXPECT().Provider().Return(provider).Times(1)
 		mockCon.EXPECT().Authenticate().Return(nil)
 		mockCon.EXPECT().Close().Return(nil).Times(1)
 
@@ -282,7 +262,7 @@ func TestGetDownloadConnection(t *testing.T) {
 		mockNntpCli.EXPECT().
 			Dial(gomock.Any(), gomockextra.StructMatcher().Field("Host", "upload"), gomock.Any()).
 			Return(mockCon, nil)
-		mockCon.EXPECT().Provider().Return(provider).Times(2)
+		mockCon.EXPECT().Provider().Return(provider).Times(1)
 		mockCon.EXPECT().Authenticate().Return(nil)
 		mockCon.EXPECT().Close().Return(nil).Times(1)
 
@@ -306,18 +286,10 @@ func TestGetDownloadConnection(t *testing.T) {
 
 	t.Run("connection cleaner should close connections every maxConnectionTTL", func(t *testing.T) {
 		mockCon := nntpcli.NewMockConnection(ctrl)
-		provider := nntpcli.Provider{
-			Host:     "upload",
-			Port:     1244,
-			Username: "user",
-			Password: "pass",
-			Id:       "3",
-		}
 
 		mockNntpCli.EXPECT().
 			Dial(gomock.Any(), gomockextra.StructMatcher().Field("Host", "upload"), gomock.Any()).
 			Return(mockCon, nil)
-		mockCon.EXPECT().Provider().Return(provider).Times(1)
 		mockCon.EXPECT().Authenticate().Return(nil)
 		mockCon.EXPECT().Close().Return(nil).Times(1)
 		mockCon.EXPECT().MaxAgeTime().Return(time.Now().Add(-time.Hour)).Times(1)
@@ -349,6 +321,405 @@ func TestGetDownloadConnection(t *testing.T) {
 	})
 }
 
+func TestGetDownloadConnectionFromTiers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockNntpCli := nntpcli.NewMockClient(ctrl)
+	downloadProviders := []config.UsenetProvider{
+		{
+			Host:           "fill",
+			Port:           1244,
+			Username:       "user",
+			Password:       "pass",
+			MaxConnections: 1,
+			Id:             "2",
+			Tier:           1,
+		},
+		{
+			Host:           "primary",
+			Port:           1243,
+			Username:       "user",
+			Password:       "pass",
+			MaxConnections: 1,
+			Id:             "1",
+			Tier:           0,
+		},
+	}
+	uploadProviders := []config.UsenetProvider{
+		{
+			Host:           "upload",
+			Port:           1244,
+			Username:       "user",
+			Password:       "pass",
+			MaxConnections: 1,
+			Id:             "3",
+		},
+	}
+
+	t.Run("get the connection from the primary tier even if it is not the first provider", func(t *testing.T) {
+		mockCon := nntpcli.NewMockConnection(ctrl)
+		provider := nntpcli.Provider{
+			Host: "primary",
+			Id:   "1",
+		}
+
+		mockNntpCli.EXPECT().
+			Dial(gomock.Any(), gomockextra.StructMatcher().Field("Host", "primary").Field("Tier", 0), gomock.Any()).
+			Return(mockCon, nil)
+		mockCon.EXPECT().Provider().Return(provider).Times(1)
+		mockCon.EXPECT().Authenticate().Return(nil)
+		mockCon.EXPECT().Close().Return(nil).Times(1)
+
+		cp, err := NewConnectionPool(
+			WithClient(mockNntpCli),
+			WithLogger(slog.Default()),
+			WithDownloadProviders(downloadProviders),
+			WithUploadProviders(uploadProviders),
+		)
+		t.Cleanup(func() {
+			cp.Quit()
+		})
+		assert.NoError(t, err)
+
+		conn, err := cp.GetDownloadConnection(context.Background())
+		assert.NoError(t, err)
+		defer cp.Free(conn)
+
+		assert.Equal(t, provider, conn.Value().Provider())
+	})
+
+	t.Run("get the connection from the next tier when the primary provider is excluded", func(t *testing.T) {
+		mockCon := nntpcli.NewMockConnection(ctrl)
+		provider := nntpcli.Provider{
+			Host: "fill",
+			Id:   "2",
+			Tier: 1,
+		}
+
+		mockNntpCli.EXPECT().
+			Dial(gomock.Any(), gomockextra.StructMatcher().Field("Host", "fill").Field("Tier", 1), gomock.Any()).
+			Return(mockCon, nil)
+		mockCon.EXPECT().Provider().Return(provider).Times(1)
+		mockCon.EXPECT().Authenticate().Return(nil)
+		mockCon.EXPECT().Close().Return(nil).Times(1)
+
+		cp, err := NewConnectionPool(
+			WithClient(mockNntpCli),
+			WithLogger(slog.Default()),
+			WithDownloadProviders(downloadProviders),
+			WithUploadProviders(uploadProviders),
+		)
+		t.Cleanup(func() {
+			cp.Quit()
+		})
+		assert.NoError(t, err)
+
+		conn, err := cp.GetDownloadConnection(context.Background(), WithExcludedProviders("1"))
+		assert.NoError(t, err)
+		defer cp.Free(conn)
+
+		assert.Equal(t, provider, conn.Value().Provider())
+	})
+
+	t.Run("return an error when all the providers are excluded", func(t *testing.T) {
+		cp, err := NewConnectionPool(
+			WithClient(mockNntpCli),
+			WithLogger(slog.Default()),
+			WithDownloadProviders(downloadProviders),
+			WithUploadProviders(uploadProviders),
+		)
+		t.Cleanup(func() {
+			cp.Quit()
+		})
+		assert.NoError(t, err)
+
+		_, err = cp.GetDownloadConnection(context.Background(), WithExcludedProviders("1", "2"))
+		assert.ErrorIs(t, err, ErrNoProviderAvailable)
+	})
+}
+
+func TestReload(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockNntpCli := nntpcli.NewMockClient(ctrl)
+	primary := config.UsenetProvider{
+		Host:           "primary",
+		Port:           1243,
+		Username:       "user",
+		Password:       "pass",
+		MaxConnections: 1,
+		Id:             "1",
+	}
+	fill := config.UsenetProvider{
+		Host:           "fill",
+		Port:           1244,
+		Username:       "user",
+		Password:       "pass",
+		MaxConnections: 1,
+		Id:             "2",
+		Tier:           1,
+	}
+
+	t.Run("unchanged providers keep their connections and removed ones are closed once released", func(t *testing.T) {
+		primaryCon := nntpcli.NewMockConnection(ctrl)
+		fillCon := nntpcli.NewMockConnection(ctrl)
+		fillClosed := make(chan struct{})
+
+		mockNntpCli.EXPECT().
+			Dial(gomock.Any(), gomockextra.StructMatcher().Field("Host", "primary"), gomock.Any()).
+			Return(primaryCon, nil).Times(1)
+		mockNntpCli.EXPECT().
+			Dial(gomock.Any(), gomockextra.StructMatcher().Field("Host", "fill"), gomock.Any()).
+			Return(fillCon, nil).Times(1)
+		primaryCon.EXPECT().Authenticate().Return(nil)
+		fillCon.EXPECT().Authenticate().Return(nil)
+		primaryCon.EXPECT().Close().Return(nil).Times(1)
+		fillCon.EXPECT().Close().DoAndReturn(func() error {
+			close(fillClosed)
+			return nil
+		}).Times(1)
+
+		cp, err := NewConnectionPool(
+			WithClient(mockNntpCli),
+			WithLogger(slog.Default()),
+			WithDownloadProviders([]config.UsenetProvider{primary, fill}),
+		)
+		t.Cleanup(func() {
+			cp.Quit()
+		})
+		assert.NoError(t, err)
+
+		primaryConn, err := cp.GetDownloadConnection(context.Background())
+		assert.NoError(t, err)
+		fillConn, err := cp.GetDownloadConnection(context.Background(), WithExcludedProviders("1"))
+		assert.NoError(t, err)
+
+		err = cp.Reload(WithDownloadProviders([]config.UsenetProvider{primary}))
+		assert.NoError(t, err)
+
+		providers := cp.GetProvidersInfo()
+		assert.Len(t, providers, 1)
+		assert.Equal(t, "1", providers[0].Id)
+		assert.Equal(t, 1, providers[0].UsedConnections)
+
+		cp.Free(fillConn)
+		select {
+		case <-fillClosed:
+		case <-time.After(time.Second):
+			t.Fatal("connection of the removed provider was not closed")
+		}
+
+		cp.Free(primaryConn)
+	})
+
+	t.Run("invalid selection strategy keeps the current providers", func(t *testing.T) {
+		cp, err := NewConnectionPool(
+			WithClient(mockNntpCli),
+			WithLogger(slog.Default()),
+			WithDownloadProviders([]config.UsenetProvider{primary}),
+		)
+		t.Cleanup(func() {
+			cp.Quit()
+		})
+		assert.NoError(t, err)
+
+		err = cp.Reload(WithDownloadProviders([]config.UsenetProvider{fill}), WithSelectionStrategy("random"))
+		assert.ErrorIs(t, err, ErrUnknownSelectionStrategy)
+
+		providers := cp.GetProvidersInfo()
+		assert.Len(t, providers, 1)
+		assert.Equal(t, "1", providers[0].Id)
+	})
+
+	t.Run("providers without id keep the same id across restarts and reloads", func(t *testing.T) {
+		withoutId := primary
+		withoutId.Id = ""
+
+		newPool := func() UsenetConnectionPool {
+			cp, err := NewConnectionPool(
+				WithClient(mockNntpCli),
+				WithLogger(slog.Default()),
+				WithDownloadProviders([]config.UsenetProvider{withoutId, withoutId}),
+			)
+			assert.NoError(t, err)
+			t.Cleanup(func() {
+				cp.Quit()
+			})
+
+			return cp
+		}
+
+		ids := func(cp UsenetConnectionPool) []string {
+			var ids []string
+			for _, p := range cp.GetProvidersInfo() {
+				ids = append(ids, p.Id)
+			}
+
+			return ids
+		}
+
+		cp := newPool()
+		// The same account configured twice does not share the id
+		assert.Equal(t, []string{"user@primary:1243", "user@primary:1243-2"}, ids(cp))
+
+		// Restart
+		assert.Equal(t, ids(cp), ids(newPool()))
+
+		// Reload with a change that creates the providers again
+		changed := withoutId
+		changed.MaxConnections = 2
+		err := cp.Reload(WithDownloadProviders([]config.UsenetProvider{changed, changed}))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"user@primary:1243", "user@primary:1243-2"}, ids(cp))
+	})
+}
+
+func TestGetDownloadConnectionByPriority(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockNntpCli := nntpcli.NewMockClient(ctrl)
+	primary := config.UsenetProvider{
+		Host:           "primary",
+		Port:           1243,
+		Username:       "user",
+		Password:       "pass",
+		MaxConnections: 1,
+		Id:             "1",
+	}
+	disabled := config.UsenetProvider{
+		Host:           "disabled",
+		Port:           1244,
+		Username:       "user",
+		Password:       "pass",
+		MaxConnections: 10,
+		Id:             "2",
+		Tier:           1,
+	}
+
+	primaryCon := nntpcli.NewMockConnection(ctrl)
+	mockNntpCli.EXPECT().
+		Dial(gomock.Any(), gomockextra.StructMatcher().Field("Host", "primary"), gomock.Any()).
+		Return(primaryCon, nil).Times(1)
+	primaryCon.EXPECT().Authenticate().Return(nil)
+	primaryCon.EXPECT().MaxAgeTime().Return(time.Now().Add(time.Hour)).AnyTimes()
+	primaryCon.EXPECT().Close().Return(nil).AnyTimes()
+
+	cp, err := NewConnectionPool(
+		WithClient(mockNntpCli),
+		WithLogger(slog.Default()),
+		WithDownloadProviders([]config.UsenetProvider{primary, disabled}),
+	)
+	t.Cleanup(func() {
+		cp.Quit()
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, cp.DisableProvider("2"))
+
+	conn, err := cp.GetDownloadConnection(context.Background())
+	assert.NoError(t, err)
+
+	waiting := func(priority Priority) bool {
+		g := cp.(*connectionPool).getProviderPool(DownloadProviderPool).providers[0].gate
+		g.mx.Lock()
+		defer g.mx.Unlock()
+
+		return len(g.waiters[priority]) > 0
+	}
+
+	// The connections of the disabled provider do not make room for more requests
+	served := make(chan Priority, 2)
+	acquire := func(priority Priority) {
+		c, err := cp.GetDownloadConnection(context.Background(), WithPriority(priority))
+		assert.NoError(t, err)
+		served <- priority
+		cp.Free(c)
+	}
+
+	go acquire(PriorityPrefetch)
+	assert.Eventually(t, func() bool { return waiting(PriorityPrefetch) }, time.Second, time.Millisecond)
+
+	// The slots in use are kept by the providers that did not change
+	assert.NoError(t, cp.Reload(WithDownloadProviders([]config.UsenetProvider{primary, disabled})))
+
+	go acquire(PriorityForeground)
+	assert.Eventually(t, func() bool { return waiting(PriorityForeground) }, time.Second, time.Millisecond)
+	assert.Empty(t, served)
+
+	cp.Free(conn)
+	assert.Equal(t, PriorityForeground, <-served)
+	assert.Equal(t, PriorityPrefetch, <-served)
+}
+
+func TestGetDownloadConnectionWithQuota(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	mockNntpCli := nntpcli.NewMockClient(ctrl)
+	downloadProviders := []config.UsenetProvider{
+		{
+			Host:             "block",
+			Port:             1243,
+			Username:         "user",
+			Password:         "pass",
+			MaxConnections:   1,
+			Id:               "1",
+			QuotaInBytes:     1000,
+			QuotaResetPeriod: "monthly",
+		},
+		{
+			Host:           "fill",
+			Port:           1244,
+			Username:       "user",
+			Password:       "pass",
+			MaxConnections: 1,
+			Id:             "2",
+			Tier:           1,
+		},
+	}
+
+	t.Run("skip the providers without quota left", func(t *testing.T) {
+		repo := providerusage.NewMockUsageRepository(ctrl)
+		mockCon := nntpcli.NewMockConnection(ctrl)
+
+		repo.EXPECT().Get(gomock.Any(), "user@block:1243", "download").Return(providerusage.Usage{
+			Bytes:       1000,
+			PeriodStart: currentPeriodStart(QuotaPeriodMonthly, time.Now()),
+		}, nil).Times(1)
+		mockNntpCli.EXPECT().
+			Dial(gomock.Any(), gomockextra.StructMatcher().Field("Host", "fill"), gomock.Any()).
+			Return(mockCon, nil).Times(1)
+		mockCon.EXPECT().Authenticate().Return(nil)
+		mockCon.EXPECT().Close().Return(nil).Times(1)
+
+		cp, err := NewConnectionPool(
+			WithClient(mockNntpCli),
+			WithLogger(slog.Default()),
+			WithDownloadProviders(downloadProviders),
+			WithUsageRepository(repo),
+		)
+		t.Cleanup(func() {
+			cp.Quit()
+		})
+		assert.NoError(t, err)
+
+		conn, err := cp.GetDownloadConnection(context.Background())
+		assert.NoError(t, err)
+		defer cp.Free(conn)
+
+		for _, info := range cp.GetProvidersInfo() {
+			if info.Id == "1" {
+				assert.Equal(t, int64(0), *info.RemainingQuotaInBytes)
+			} else {
+				assert.Nil(t, info.RemainingQuotaInBytes)
+			}
+		}
+	})
+
+	t.Run("unknown quota reset period", func(t *testing.T) {
+		_, err := NewConnectionPool(
+			WithClient(mockNntpCli),
+			WithLogger(slog.Default()),
+			WithDownloadProviders([]config.UsenetProvider{{Host: "block", MaxConnections: 1, QuotaResetPeriod: "weekly"}}),
+		)
+		assert.ErrorIs(t, err, ErrUnknownQuotaPeriod)
+	})
+}
+
 func getFreeConnections(cp UsenetConnectionPool, t providerType) int {
 	providers := cp.GetProvidersInfo()
 	freeConnections := 0
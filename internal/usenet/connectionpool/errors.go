@@ -0,0 +1,12 @@
+package connectionpool
+
+import "errors"
+
+var (
+	ErrNoProviderAvailable      = errors.New("no provider available")
+	ErrNoHealthyProvider        = errors.New("no healthy provider available")
+	ErrUnknownSelectionStrategy = errors.New("unknown provider selection strategy")
+	ErrUnknownQuotaPeriod       = errors.New("unknown quota reset period")
+	ErrUnknownPriority          = errors.New("unknown priority")
+	ErrProviderNotFound         = errors.New("provider not found")
+)
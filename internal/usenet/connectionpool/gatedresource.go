@@ -0,0 +1,36 @@
+package connectionpool
+
+import (
+	"sync"
+
+	"github.com/jackc/puddle/v2"
+	"github.com/javi11/usenet-drive/pkg/nntpcli"
+)
+
+// gatedResource gives back the priority gate slot of the request once the connection
+// is released or destroyed.
+type gatedResource struct {
+	*puddle.Resource[nntpcli.Connection]
+	once    sync.Once
+	release func()
+}
+
+func (r *gatedResource) Release() {
+	r.Resource.Release()
+	r.once.Do(r.release)
+}
+
+func (r *gatedResource) ReleaseUnused() {
+	r.Resource.ReleaseUnused()
+	r.once.Do(r.release)
+}
+
+func (r *gatedResource) Destroy() {
+	r.Resource.Destroy()
+	r.once.Do(r.release)
+}
+
+func (r *gatedResource) Hijack() {
+	r.Resource.Hijack()
+	r.once.Do(r.release)
+}
@@ -0,0 +1,213 @@
+package connectionpool
+
+import (
+	"context"
+	"sync"
+)
+
+// Priority of a connection request, lower values are served first.
+type Priority int
+
+const (
+	// Reads a player is waiting for
+	PriorityForeground Priority = iota
+	// Segments downloaded ahead of the reads
+	PriorityPrefetch
+	PriorityUpload
+	// Background tasks like health checks
+	PriorityMaintenance
+	priorityCount
+)
+
+var priorityNames = [priorityCount]string{"foreground", "prefetch", "upload", "maintenance"}
+
+func (p Priority) String() string {
+	if p < 0 || p >= priorityCount {
+		return "unknown"
+	}
+
+	return priorityNames[p]
+}
+
+func ParsePriority(name string) (Priority, error) {
+	for i, n := range priorityNames {
+		if n == name {
+			return Priority(i), nil
+		}
+	}
+
+	return 0, ErrUnknownPriority
+}
+
+// ParseReservedConnections converts the reserved connections by priority name of the config.
+func ParseReservedConnections(reserved map[string]int) (map[Priority]int, error) {
+	result := make(map[Priority]int, len(reserved))
+	for name, n := range reserved {
+		priority, err := ParsePriority(name)
+		if err != nil {
+			return nil, err
+		}
+
+		result[priority] = n
+	}
+
+	return result, nil
+}
+
+// priorityGate limits the connections acquired from a provider. When all the slots are
+// taken, the waiting requests are served by priority and then in arrival order.
+// Reserved slots of a priority can only be taken by requests of that priority.
+type priorityGate struct {
+	mx       sync.Mutex
+	capacity int
+	inUse    int
+	reserved [priorityCount]int
+	used     [priorityCount]int
+	waiters  [priorityCount][]chan struct{}
+}
+
+func newPriorityGate(capacity int, reserved map[Priority]int) *priorityGate {
+	g := &priorityGate{capacity: capacity}
+	g.setReserved(reserved)
+
+	return g
+}
+
+// setReserved replaces the reserved slots, the slots in use are kept
+func (g *priorityGate) setReserved(reserved map[Priority]int) {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	g.reserved = [priorityCount]int{}
+	for priority, n := range reserved {
+		if priority >= 0 && priority < priorityCount {
+			g.reserved[priority] = n
+		}
+	}
+
+	g.wakeUp()
+}
+
+// free returns the number of slots not in use
+func (g *priorityGate) free() int {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	return g.capacity - g.inUse
+}
+
+// Acquire waits for a free slot for the given priority. The returned function gives it
+// back and must be called once the connection is released.
+func (g *priorityGate) Acquire(ctx context.Context, priority Priority) (func(), error) {
+	if priority < 0 || priority >= priorityCount {
+		priority = PriorityMaintenance
+	}
+
+	release := func() {
+		g.release(priority)
+	}
+
+	// Pools without providers fail later when choosing the provider
+	if g.capacity <= 0 {
+		return func() {}, nil
+	}
+
+	g.mx.Lock()
+	if !g.hasWaiters(priority) && g.canAcquire(priority) {
+		g.take(priority)
+		g.mx.Unlock()
+
+		return release, nil
+	}
+
+	ready := make(chan struct{})
+	g.waiters[priority] = append(g.waiters[priority], ready)
+	g.mx.Unlock()
+
+	select {
+	case <-ready:
+		return release, nil
+	case <-ctx.Done():
+		g.mx.Lock()
+		defer g.mx.Unlock()
+
+		select {
+		case <-ready:
+			// The slot was given while cancelling, give it to the next request
+			g.inUse--
+			g.used[priority]--
+			g.wakeUp()
+		default:
+			g.removeWaiter(priority, ready)
+		}
+
+		return nil, ctx.Err()
+	}
+}
+
+func (g *priorityGate) release(priority Priority) {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	g.inUse--
+	g.used[priority]--
+	g.wakeUp()
+}
+
+// wakeUp gives the free slots to the waiters, must be called holding the lock
+func (g *priorityGate) wakeUp() {
+	for priority := Priority(0); priority < priorityCount; priority++ {
+		for len(g.waiters[priority]) > 0 && g.canAcquire(priority) {
+			ready := g.waiters[priority][0]
+			g.waiters[priority] = g.waiters[priority][1:]
+			g.take(priority)
+			close(ready)
+		}
+	}
+}
+
+// canAcquire returns true if there is a free slot that is not reserved to other priorities
+func (g *priorityGate) canAcquire(priority Priority) bool {
+	free := g.capacity - g.inUse
+	if free <= 0 {
+		return false
+	}
+
+	if g.used[priority] < g.reserved[priority] {
+		return true
+	}
+
+	reservedByOthers := 0
+	for p := Priority(0); p < priorityCount; p++ {
+		if p != priority {
+			reservedByOthers += max(g.reserved[p]-g.used[p], 0)
+		}
+	}
+
+	return free > reservedByOthers
+}
+
+// hasWaiters returns true if there are requests with the same or higher priority waiting
+func (g *priorityGate) hasWaiters(priority Priority) bool {
+	for p := Priority(0); p <= priority; p++ {
+		if len(g.waiters[p]) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (g *priorityGate) take(priority Priority) {
+	g.inUse++
+	g.used[priority]++
+}
+
+func (g *priorityGate) removeWaiter(priority Priority, ready chan struct{}) {
+	for i, w := range g.waiters[priority] {
+		if w == ready {
+			g.waiters[priority] = append(g.waiters[priority][:i], g.waiters[priority][i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package connectionpool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriorityGate(t *testing.T) {
+	waiting := func(g *priorityGate, priority Priority) bool {
+		g.mx.Lock()
+		defer g.mx.Unlock()
+
+		return len(g.waiters[priority]) > 0
+	}
+
+	t.Run("higher priority requests are served first", func(t *testing.T) {
+		g := newPriorityGate(1, nil)
+
+		release, err := g.Acquire(context.Background(), PriorityForeground)
+		assert.NoError(t, err)
+
+		served := make(chan Priority, 2)
+		go func() {
+			r, err := g.Acquire(context.Background(), PriorityPrefetch)
+			assert.NoError(t, err)
+			served <- PriorityPrefetch
+			r()
+		}()
+		assert.Eventually(t, func() bool { return waiting(g, PriorityPrefetch) }, time.Second, time.Millisecond)
+
+		go func() {
+			r, err := g.Acquire(context.Background(), PriorityForeground)
+			assert.NoError(t, err)
+			served <- PriorityForeground
+			r()
+		}()
+		assert.Eventually(t, func() bool { return waiting(g, PriorityForeground) }, time.Second, time.Millisecond)
+
+		release()
+
+		assert.Equal(t, PriorityForeground, <-served)
+		assert.Equal(t, PriorityPrefetch, <-served)
+	})
+
+	t.Run("reserved slots are only used by their priority", func(t *testing.T) {
+		g := newPriorityGate(2, map[Priority]int{PriorityForeground: 1})
+
+		_, err := g.Acquire(context.Background(), PriorityUpload)
+		assert.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err = g.Acquire(ctx, PriorityPrefetch)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.False(t, waiting(g, PriorityPrefetch))
+
+		_, err = g.Acquire(context.Background(), PriorityForeground)
+		assert.NoError(t, err)
+	})
+
+	t.Run("pools without capacity do not wait", func(t *testing.T) {
+		g := newPriorityGate(0, nil)
+
+		release, err := g.Acquire(context.Background(), PriorityForeground)
+		assert.NoError(t, err)
+		release()
+	})
+
+	t.Run("parse priorities", func(t *testing.T) {
+		reserved, err := ParseReservedConnections(map[string]int{"foreground": 2, "maintenance": 1})
+		assert.NoError(t, err)
+		assert.Equal(t, map[Priority]int{PriorityForeground: 2, PriorityMaintenance: 1}, reserved)
+
+		_, err = ParseReservedConnections(map[string]int{"realtime": 1})
+		assert.ErrorIs(t, err, ErrUnknownPriority)
+	})
+}
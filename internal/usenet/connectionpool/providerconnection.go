@@ -0,0 +1,89 @@
+package connectionpool
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/javi11/usenet-drive/internal/metrics"
+	"github.com/javi11/usenet-drive/pkg/nntpcli"
+)
+
+// providerConnection reports the result and the duration of the commands sent through
+// the connection to the provider that owns it.
+type providerConnection struct {
+	nntpcli.Connection
+	provider *Provider
+}
+
+func (c *providerConnection) Body(msgId string, chunk []byte) (int, error) {
+	start := time.Now()
+	n, err := c.Connection.Body(msgId, chunk)
+	c.record(metrics.CommandBody, err, n, time.Since(start))
+
+	return n, err
+}
+
+func (c *providerConnection) BodyPipelined(requests []nntpcli.BodyRequest) []error {
+	start := time.Now()
+	errs := c.Connection.BodyPipelined(requests)
+	if len(requests) == 0 {
+		return errs
+	}
+
+	// Responses of a pipeline overlap, each one is accounted an equal share of the time
+	elapsed := time.Since(start) / time.Duration(len(requests))
+	for i, err := range errs {
+		c.record(metrics.CommandBody, err, requests[i].Read, elapsed)
+	}
+
+	return errs
+}
+
+func (c *providerConnection) Post(r io.Reader) error {
+	cr := &countingReader{Reader: r}
+	start := time.Now()
+	err := c.Connection.Post(cr)
+	c.record(metrics.CommandPost, err, cr.n, time.Since(start))
+
+	return err
+}
+
+// record accounts the bytes read or written by the command, the provider accounts them even
+// when the command fails.
+func (c *providerConnection) record(command string, err error, bytes int, elapsed time.Duration) {
+	c.provider.health.RecordResult(err)
+	c.provider.quota.Add(bytes)
+	metrics.Bytes.WithLabelValues(c.provider.Id, c.provider.Host, command).Add(float64(bytes))
+
+	// The request was cancelled, it is neither an error nor a sample of the provider speed
+	if errors.Is(err, nntpcli.ErrInterrupted) {
+		return
+	}
+
+	// Final segments has less bytes than chunkSize, that is not an error
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		metrics.CommandErrors.WithLabelValues(c.provider.Id, c.provider.Host, command).Inc()
+		if errors.Is(err, nntpcli.ErrCorruptedArticle) {
+			metrics.CorruptedArticles.WithLabelValues(c.provider.Id, c.provider.Host).Inc()
+		}
+
+		return
+	}
+
+	c.provider.stats.RecordSample(bytes, elapsed)
+	metrics.Segments.WithLabelValues(c.provider.Id, c.provider.Host, command).Inc()
+	metrics.CommandDuration.WithLabelValues(c.provider.Id, c.provider.Host, command).Observe(elapsed.Seconds())
+}
+
+type countingReader struct {
+	io.Reader
+	n int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += n
+
+	return n, err
+}
@@ -0,0 +1,174 @@
+package connectionpool
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/javi11/usenet-drive/internal/config"
+	"github.com/javi11/usenet-drive/internal/metrics"
+	"github.com/javi11/usenet-drive/pkg/nntpcli"
+	"github.com/javi11/usenet-drive/pkg/nntpserver"
+	"github.com/javi11/usenet-drive/pkg/yenc"
+)
+
+func TestProviderConnection(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newProviderConnection := func() (*providerConnection, *nntpcli.MockConnection) {
+		quota, err := newProviderQuota(1000, QuotaPeriodNever)
+		assert.NoError(t, err)
+
+		conn := nntpcli.NewMockConnection(ctrl)
+
+		return &providerConnection{
+			Connection: conn,
+			provider: &Provider{
+				UsenetProvider: config.UsenetProvider{Id: "1", Host: "host"},
+				health:         newProviderHealth(time.Second, time.Minute),
+				stats:          &providerStats{},
+				quota:          quota,
+			},
+		}, conn
+	}
+
+	t.Run("the bytes read are accounted instead of the chunk size", func(t *testing.T) {
+		c, conn := newProviderConnection()
+
+		// The final segment is shorter than the chunk
+		conn.EXPECT().Body("1", gomock.Any()).Return(120, io.ErrUnexpectedEOF).Times(1)
+
+		n, err := c.Body("1", make([]byte, 500))
+		assert.Equal(t, 120, n)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+		assert.Equal(t, int64(880), c.provider.quota.Remaining())
+	})
+
+	t.Run("the bytes of failed commands are accounted", func(t *testing.T) {
+		c, conn := newProviderConnection()
+
+		conn.EXPECT().Body("1", gomock.Any()).Return(300, fmt.Errorf("%w: crc32 mismatch", nntpcli.ErrCorruptedArticle)).Times(1)
+		conn.EXPECT().Post(gomock.Any()).DoAndReturn(func(r io.Reader) error {
+			_, _ = io.CopyN(io.Discard, r, 100)
+			return errors.New("connection reset")
+		}).Times(1)
+
+		_, err := c.Body("1", make([]byte, 500))
+		assert.ErrorIs(t, err, nntpcli.ErrCorruptedArticle)
+
+		err = c.Post(strings.NewReader(strings.Repeat("a", 500)))
+		assert.Error(t, err)
+
+		assert.Equal(t, int64(600), c.provider.quota.Remaining())
+	})
+
+	t.Run("the bytes of every pipelined response are accounted", func(t *testing.T) {
+		c, conn := newProviderConnection()
+
+		conn.EXPECT().BodyPipelined(gomock.Any()).DoAndReturn(func(requests []nntpcli.BodyRequest) []error {
+			requests[0].Read = 200
+			requests[1].Read = 50
+
+			return []error{nil, io.ErrUnexpectedEOF}
+		}).Times(1)
+
+		c.BodyPipelined([]nntpcli.BodyRequest{
+			{MsgId: "1", Chunk: make([]byte, 500)},
+			{MsgId: "2", Chunk: make([]byte, 500)},
+		})
+		assert.Equal(t, int64(750), c.provider.quota.Remaining())
+	})
+
+	t.Run("interrupted commands are not failures of the provider", func(t *testing.T) {
+		c, conn := newProviderConnection()
+
+		conn.EXPECT().Body("1", gomock.Any()).
+			Return(0, fmt.Errorf("%w: %w", nntpcli.ErrInterrupted, io.EOF)).
+			Times(quarantineThreshold)
+
+		for i := 0; i < quarantineThreshold; i++ {
+			_, err := c.Body("1", make([]byte, 500))
+			assert.ErrorIs(t, err, nntpcli.ErrInterrupted)
+		}
+
+		assert.Equal(t, HealthStateHealthy, c.provider.health.State())
+	})
+}
+
+func TestProviderConnection_lostHedge(t *testing.T) {
+	server, err := nntpserver.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		server.Close()
+	})
+
+	data := make([]byte, 200000)
+	_, err = rand.Read(data)
+	assert.NoError(t, err)
+
+	article := bytes.NewBufferString(fmt.Sprintf(
+		"From: poster@example.com\r\nNewsgroups: alt.binaries.test\r\nMessage-ID: <1@test>\r\nSubject: test\r\n\r\n"+
+			"=ybegin part=1 total=1 line=128 size=%d name=test.bin\r\n=ypart begin=1 end=%d\r\n",
+		len(data),
+		len(data),
+	))
+	assert.NoError(t, yenc.Encode(data, article))
+	article.WriteString(fmt.Sprintf("=yend size=%d part=1 pcrc32=%08X\r\n", len(data), crc32.ChecksumIEEE(data)))
+	assert.NoError(t, server.AddArticle(article.Bytes()))
+
+	quota, err := newProviderQuota(0, QuotaPeriodNever)
+	assert.NoError(t, err)
+	provider := &Provider{
+		UsenetProvider: config.UsenetProvider{Id: "lost-hedge", Host: server.Host()},
+		health:         newProviderHealth(time.Second, time.Minute),
+		stats:          &providerStats{},
+		quota:          quota,
+	}
+
+	// Every body is left in the middle until the request that lost the hedge is cancelled
+	server.InjectFault(nntpserver.Fault{
+		Kind:    nntpserver.FaultStalledBody,
+		Command: "BODY",
+		Times:   quarantineThreshold,
+		Delay:   time.Second,
+	})
+
+	for i := 0; i < quarantineThreshold; i++ {
+		nntpConn, err := nntpcli.New(nntpcli.WithTimeout(5*time.Second)).Dial(context.Background(), nntpcli.Provider{
+			Host: server.Host(),
+			Port: server.Port(),
+			Id:   provider.Id,
+		}, time.Now().Add(time.Hour))
+		assert.NoError(t, err)
+
+		c := &providerConnection{Connection: nntpConn, provider: provider}
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := c.Body("1@test", make([]byte, len(data)))
+			done <- err
+		}()
+
+		time.Sleep(100 * time.Millisecond)
+		assert.NoError(t, c.Interrupt())
+		assert.ErrorIs(t, <-done, nntpcli.ErrInterrupted)
+		nntpConn.Close()
+	}
+
+	assert.Equal(t, HealthStateHealthy, provider.health.State())
+	assert.Equal(t, float64(0), testutil.ToFloat64(
+		metrics.CommandErrors.WithLabelValues(provider.Id, provider.Host, metrics.CommandBody),
+	))
+}
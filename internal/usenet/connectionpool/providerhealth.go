@@ -0,0 +1,185 @@
+package connectionpool
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/textproto"
+	"sync"
+	"time"
+
+	"github.com/javi11/usenet-drive/pkg/nntpcli"
+)
+
+type HealthState string
+
+const (
+	HealthStateHealthy     HealthState = "healthy"
+	HealthStateDegraded    HealthState = "degraded"
+	HealthStateQuarantined HealthState = "quarantined"
+)
+
+type ProviderStatus string
+
+const (
+	ProviderStatusEnabled  ProviderStatus = "enabled"
+	ProviderStatusDraining ProviderStatus = "draining"
+	ProviderStatusDisabled ProviderStatus = "disabled"
+)
+
+const (
+	// Consecutive errors needed to consider a provider degraded
+	degradedThreshold = 3
+	// Consecutive errors needed to quarantine a provider
+	quarantineThreshold = 6
+)
+
+type providerHealth struct {
+	mx                sync.Mutex
+	state             HealthState
+	status            ProviderStatus
+	consecutiveErrors int
+	quarantines       int
+	quarantinedUntil  time.Time
+	lastError         string
+	minBackoff        time.Duration
+	maxBackoff        time.Duration
+}
+
+func newProviderHealth(minBackoff, maxBackoff time.Duration) *providerHealth {
+	return &providerHealth{
+		state:      HealthStateHealthy,
+		status:     ProviderStatusEnabled,
+		minBackoff: minBackoff,
+		maxBackoff: maxBackoff,
+	}
+}
+
+// RecordResult updates the health of the provider with the result of a dial or a command.
+// Errors that are not caused by the provider, like a missing article, are ignored.
+func (h *providerHealth) RecordResult(err error) {
+	if err == nil {
+		h.recordSuccess()
+		return
+	}
+
+	if isProviderError(err) {
+		h.recordFailure(err)
+	}
+}
+
+func (h *providerHealth) recordSuccess() {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	h.consecutiveErrors = 0
+	h.quarantines = 0
+	h.state = HealthStateHealthy
+}
+
+func (h *providerHealth) recordFailure(err error) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	h.consecutiveErrors++
+	h.lastError = err.Error()
+
+	if h.state == HealthStateQuarantined {
+		return
+	}
+
+	if h.consecutiveErrors >= quarantineThreshold {
+		h.quarantine()
+	} else if h.consecutiveErrors >= degradedThreshold {
+		h.state = HealthStateDegraded
+	}
+}
+
+// quarantine must be called holding the lock. Every consecutive quarantine doubles the
+// time the provider is kept out until it reaches the max backoff.
+func (h *providerHealth) quarantine() {
+	backoff := h.minBackoff << h.quarantines
+	if backoff > h.maxBackoff || backoff <= 0 {
+		backoff = h.maxBackoff
+	}
+
+	h.quarantines++
+	h.quarantinedUntil = time.Now().Add(backoff)
+	h.state = HealthStateQuarantined
+}
+
+// State returns the current health state. Once the quarantine expires the provider is
+// considered degraded, so it can be tried again and a new error quarantines it again.
+func (h *providerHealth) State() HealthState {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if h.state == HealthStateQuarantined && time.Now().After(h.quarantinedUntil) {
+		h.state = HealthStateDegraded
+		h.consecutiveErrors = quarantineThreshold - 1
+	}
+
+	return h.state
+}
+
+func (h *providerHealth) Status() ProviderStatus {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	return h.status
+}
+
+func (h *providerHealth) SetStatus(status ProviderStatus) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	h.status = status
+	if status == ProviderStatusEnabled {
+		// Give a fresh start to providers enabled manually
+		h.consecutiveErrors = 0
+		h.quarantines = 0
+		h.state = HealthStateHealthy
+	}
+}
+
+// IsAvailable returns true if new connections can be requested to the provider.
+func (h *providerHealth) IsAvailable() bool {
+	return h.Status() == ProviderStatusEnabled && h.State() != HealthStateQuarantined
+}
+
+func (h *providerHealth) QuarantinedUntil() *time.Time {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if h.state != HealthStateQuarantined {
+		return nil
+	}
+
+	t := h.quarantinedUntil
+	return &t
+}
+
+func (h *providerHealth) LastError() string {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	return h.lastError
+}
+
+func isProviderError(err error) bool {
+	// Final segments has less bytes than chunkSize, that is not an error
+	// An interrupted command is a cancelled request, like a lost hedge
+	if errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, nntpcli.ErrInterrupted) ||
+		nntpcli.IsArticleNotFoundError(err) {
+		return false
+	}
+
+	var nntpErr *textproto.Error
+	if ok := errors.As(err, &nntpErr); ok && nntpErr.Code == nntpcli.SegmentAlreadyExistsErrCode {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,83 @@
+package connectionpool
+
+import (
+	"errors"
+	"io"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProviderHealth(t *testing.T) {
+	t.Run("consecutive errors degrade and quarantine the provider", func(t *testing.T) {
+		h := newProviderHealth(time.Minute, time.Hour)
+
+		for i := 0; i < degradedThreshold; i++ {
+			h.RecordResult(errors.New("connection reset"))
+		}
+		assert.Equal(t, HealthStateDegraded, h.State())
+		assert.True(t, h.IsAvailable())
+
+		for i := degradedThreshold; i < quarantineThreshold; i++ {
+			h.RecordResult(errors.New("connection reset"))
+		}
+		assert.Equal(t, HealthStateQuarantined, h.State())
+		assert.False(t, h.IsAvailable())
+		assert.NotNil(t, h.QuarantinedUntil())
+		assert.Equal(t, "connection reset", h.LastError())
+	})
+
+	t.Run("a success restores the provider", func(t *testing.T) {
+		h := newProviderHealth(time.Minute, time.Hour)
+
+		for i := 0; i < degradedThreshold; i++ {
+			h.RecordResult(errors.New("connection reset"))
+		}
+		h.RecordResult(nil)
+
+		assert.Equal(t, HealthStateHealthy, h.State())
+	})
+
+	t.Run("errors not caused by the provider are ignored", func(t *testing.T) {
+		h := newProviderHealth(time.Minute, time.Hour)
+
+		for i := 0; i < quarantineThreshold; i++ {
+			h.RecordResult(&textproto.Error{Code: 430, Msg: "No Such Article"})
+			h.RecordResult(io.ErrUnexpectedEOF)
+		}
+
+		assert.Equal(t, HealthStateHealthy, h.State())
+	})
+
+	t.Run("expired quarantine is quarantined again with a longer backoff on the next error", func(t *testing.T) {
+		h := newProviderHealth(time.Millisecond, time.Hour)
+
+		for i := 0; i < quarantineThreshold; i++ {
+			h.RecordResult(errors.New("connection reset"))
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		assert.Equal(t, HealthStateDegraded, h.State())
+		assert.True(t, h.IsAvailable())
+
+		h.RecordResult(errors.New("connection reset"))
+		assert.Equal(t, HealthStateQuarantined, h.State())
+		assert.Equal(t, 2, h.quarantines)
+	})
+
+	t.Run("disabled providers are not available until enabled", func(t *testing.T) {
+		h := newProviderHealth(time.Minute, time.Hour)
+		for i := 0; i < quarantineThreshold; i++ {
+			h.RecordResult(errors.New("connection reset"))
+		}
+
+		h.SetStatus(ProviderStatusDisabled)
+		assert.False(t, h.IsAvailable())
+
+		h.SetStatus(ProviderStatusEnabled)
+		assert.True(t, h.IsAvailable())
+		assert.Equal(t, HealthStateHealthy, h.State())
+	})
+}
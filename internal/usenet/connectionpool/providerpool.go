@@ -1,10 +1,14 @@
 package connectionpool
 
 import (
+	"fmt"
+	"slices"
 	"sync/atomic"
+	"time"
 
-	"github.com/google/uuid"
+	"github.com/jackc/puddle/v2"
 	"github.com/javi11/usenet-drive/internal/config"
+	"github.com/javi11/usenet-drive/pkg/nntpcli"
 )
 
 type providerType string
@@ -15,67 +19,195 @@ const (
 )
 
 type ProviderInfo struct {
-	Host            string       `json:"host"`
-	Username        string       `json:"username"`
-	UsedConnections int          `json:"usedConnections"`
-	MaxConnections  int          `json:"maxConnections"`
-	Type            providerType `json:"type"`
+	Id                  string         `json:"id"`
+	Host                string         `json:"host"`
+	Username            string         `json:"username"`
+	UsedConnections     int            `json:"usedConnections"`
+	IdleConnections     int            `json:"idleConnections"`
+	AcquiredConnections int            `json:"acquiredConnections"`
+	MaxConnections      int            `json:"maxConnections"`
+	Type                providerType   `json:"type"`
+	Tier                int            `json:"tier"`
+	Health              HealthState    `json:"health"`
+	Status              ProviderStatus `json:"status"`
+	QuarantinedUntil    *time.Time     `json:"quarantinedUntil,omitempty"`
+	LastError           string         `json:"lastError,omitempty"`
+	AvgLatencyMs        int64          `json:"avgLatencyMs"`
+	Throughput          float64        `json:"throughput"`
+	QuotaInBytes        int64          `json:"quotaInBytes,omitempty"`
+	// Nil if the provider has no quota
+	RemainingQuotaInBytes *int64 `json:"remainingQuotaInBytes,omitempty"`
 }
 
 type Provider struct {
 	config.UsenetProvider
 	usedConnections *atomic.Int64
 	t               providerType
+	connPool        *puddle.Pool[nntpcli.Connection]
+	health          *providerHealth
+	stats           *providerStats
+	quota           *providerQuota
+	// Limits the connections acquired by priority, it is kept on reload with its slots in use
+	gate *priorityGate
 }
 
 type providerPool struct {
-	providers []Provider
+	providers []*Provider
+	selector  selector
 }
 
-func NewProviderPool(providers []config.UsenetProvider, t providerType) *providerPool {
-	providerPool := &providerPool{}
+func NewProviderPool(
+	providers []config.UsenetProvider,
+	t providerType,
+	selector selector,
+	newConnPool func(p *Provider) (*puddle.Pool[nntpcli.Connection], error),
+	newHealth func() *providerHealth,
+	newQuota func(p *Provider) (*providerQuota, error),
+	reserved map[Priority]int,
+	existing []*Provider,
+) (*providerPool, error) {
+	providerPool := &providerPool{selector: selector}
+	var created []*Provider
 	for _, provider := range providers {
+		// Providers that did not change keep their connections, health and gate
+		if p := findProvider(existing, providerPool.providers, provider); p != nil {
+			p.gate.setReserved(reserved)
+			providerPool.providers = append(providerPool.providers, p)
+			continue
+		}
+
 		if provider.Id == "" {
-			provider.Id = uuid.New().String()
+			provider.Id = defaultProviderId(provider, providerPool.providers)
 		}
-		providerPool.providers = append(providerPool.providers, Provider{
+		p := &Provider{
 			UsenetProvider:  provider,
 			usedConnections: &atomic.Int64{},
 			t:               t,
-		})
+			gate:            newPriorityGate(provider.MaxConnections, reserved),
+			health:          newHealth(),
+			stats:           &providerStats{},
+		}
+
+		quota, err := newQuota(p)
+		if err != nil {
+			closeProviders(created)
+			return nil, err
+		}
+		p.quota = quota
+
+		connPool, err := newConnPool(p)
+		if err != nil {
+			closeProviders(created)
+			return nil, err
+		}
+		p.connPool = connPool
+
+		providerPool.providers = append(providerPool.providers, p)
+		created = append(created, p)
 	}
-	return providerPool
+
+	// Lower tiers are always tried first, keep the config order inside the same tier
+	slices.SortStableFunc(providerPool.providers, func(a, b *Provider) int {
+		return a.Tier - b.Tier
+	})
+
+	return providerPool, nil
 }
 
-func (p *providerPool) GetProvider() *Provider {
-	for i := range p.providers {
-		usedConnections := p.providers[i].usedConnections.Load()
-		if usedConnections < int64(p.providers[i].MaxConnections) {
-			p.providers[i].usedConnections.Add(1)
-			return &p.providers[i]
+// GetProvider returns the provider that should serve the next connection.
+// Only the lowest tier that still has available providers after applying the exclusions
+// is taken into account. Inside that tier providers with free connections are preferred,
+// and between them the healthiest ones. The selection strategy chooses between the
+// remaining providers. If all of them are busy the caller waits for the chosen one.
+func (p *providerPool) GetProvider(excluded []string) (*Provider, error) {
+	candidates, err := p.getTierCandidates(excluded)
+	if err != nil {
+		return nil, err
+	}
+
+	var free []*Provider
+	for _, provider := range candidates {
+		if provider.hasFreeConnections() {
+			free = append(free, provider)
 		}
 	}
-	return nil
+	if len(free) > 0 {
+		candidates = free
+	}
+
+	return p.selector.Select(healthiest(candidates)), nil
+}
+
+func (p *providerPool) GetProviderById(id string) (*Provider, error) {
+	for _, provider := range p.providers {
+		if provider.Id == id {
+			return provider, nil
+		}
+	}
+
+	return nil, ErrProviderNotFound
 }
 
-func (p *providerPool) FreeProvider(id string) {
-	for i := range p.providers {
-		if p.providers[i].UsenetProvider.Id == id {
-			p.providers[i].usedConnections.Add(-1)
+func (p *providerPool) getTierCandidates(excluded []string) ([]*Provider, error) {
+	var candidates []*Provider
+	unavailable := 0
+	for _, provider := range p.providers {
+		if slices.Contains(excluded, provider.Id) {
+			continue
+		}
+
+		if !provider.health.IsAvailable() || provider.quota.IsExhausted() {
+			unavailable++
+			continue
+		}
+
+		if len(candidates) > 0 && candidates[0].Tier != provider.Tier {
 			break
 		}
+
+		candidates = append(candidates, provider)
+	}
+
+	if len(candidates) == 0 {
+		if unavailable > 0 {
+			// Providers that can serve the connection exist but they are down, disabled or
+			// out of quota
+			return nil, ErrNoHealthyProvider
+		}
+
+		return nil, ErrNoProviderAvailable
 	}
+
+	return candidates, nil
 }
 
 func (p *providerPool) GetProvidersInfo() []ProviderInfo {
 	providersInfo := make([]ProviderInfo, len(p.providers))
 	for i, provider := range p.providers {
+		stat := provider.connPool.Stat()
 		providersInfo[i] = ProviderInfo{
-			Host:            provider.Host,
-			Username:        provider.Username,
-			UsedConnections: int(provider.usedConnections.Load()),
-			MaxConnections:  provider.MaxConnections,
-			Type:            provider.t,
+			IdleConnections:     int(stat.IdleResources()),
+			AcquiredConnections: int(stat.AcquiredResources()),
+			Id:                  provider.Id,
+			Host:                provider.Host,
+			Username:            provider.Username,
+			UsedConnections:     int(provider.usedConnections.Load()),
+			MaxConnections:      provider.MaxConnections,
+			Type:                provider.t,
+			Tier:                provider.Tier,
+			Health:              provider.health.State(),
+			Status:              provider.health.Status(),
+			QuarantinedUntil:    provider.health.QuarantinedUntil(),
+			LastError:           provider.health.LastError(),
+			Throughput:          provider.stats.Throughput(),
+			QuotaInBytes:        provider.QuotaInBytes,
+		}
+		if provider.quota.HasLimit() {
+			remaining := provider.quota.Remaining()
+			providersInfo[i].RemainingQuotaInBytes = &remaining
+		}
+		if latency, ok := provider.stats.Latency(); ok {
+			providersInfo[i].AvgLatencyMs = latency.Milliseconds()
 		}
 	}
 	return providersInfo
@@ -89,6 +221,111 @@ func (p *providerPool) GetMaxConnections() int {
 	return maxConnections
 }
 
+func (p *providerPool) GetTotalConnections() int {
+	var totalConnections int
+	for _, provider := range p.providers {
+		totalConnections += int(provider.connPool.Stat().TotalResources())
+	}
+	return totalConnections
+}
+
 func (p *providerPool) Quit() {
+	closeProviders(p.providers)
 	p.providers = nil
 }
+
+// findProvider returns the provider of existing with the same config that is not already
+// taken, the id is only compared when it is set in the config.
+func findProvider(existing, taken []*Provider, up config.UsenetProvider) *Provider {
+	for _, p := range existing {
+		c := up
+		if c.Id == "" {
+			c.Id = p.Id
+		}
+
+		if p.UsenetProvider == c && !slices.Contains(taken, p) {
+			return p
+		}
+	}
+
+	return nil
+}
+
+func closeProviders(providers []*Provider) {
+	for _, provider := range providers {
+		if provider.connPool != nil {
+			provider.connPool.Close()
+		}
+	}
+}
+
+func (p *Provider) hasFreeConnections() bool {
+	return p.gate.free() > 0
+}
+
+// quotaKey identifies the provider account in the usage repository, it does not use the
+// id since it can be changed in the config.
+func (p *Provider) quotaKey() string {
+	return accountKey(p.UsenetProvider)
+}
+
+// defaultProviderId identifies a provider without an id in the config by its account, so the
+// id and the metrics series of the provider are kept across restarts and reloads. The same
+// account configured twice gets a suffix.
+func defaultProviderId(up config.UsenetProvider, taken []*Provider) string {
+	id := accountKey(up)
+	for i := 2; slices.ContainsFunc(taken, func(p *Provider) bool { return p.Id == id }); i++ {
+		id = fmt.Sprintf("%s-%d", accountKey(up), i)
+	}
+
+	return id
+}
+
+func accountKey(up config.UsenetProvider) string {
+	return fmt.Sprintf("%s@%s:%d", up.Username, up.Host, up.Port)
+}
+
+// usage returns the ratio of connections in use
+func (p *Provider) usage() float64 {
+	if p.MaxConnections <= 0 {
+		return 1
+	}
+
+	return float64(p.connPool.Stat().AcquiredResources()) / float64(p.MaxConnections)
+}
+
+func (p *Provider) weight() int {
+	if p.Weight <= 0 {
+		return 1
+	}
+
+	return p.Weight
+}
+
+// healthiest keeps only the providers with the best health state, keeping the order
+func healthiest(providers []*Provider) []*Provider {
+	best := healthPriority(HealthStateQuarantined)
+	for _, provider := range providers {
+		best = min(best, healthPriority(provider.health.State()))
+	}
+
+	result := make([]*Provider, 0, len(providers))
+	for _, provider := range providers {
+		if healthPriority(provider.health.State()) == best {
+			result = append(result, provider)
+		}
+	}
+
+	return result
+}
+
+func healthPriority(state HealthState) int {
+	switch state {
+	case HealthStateHealthy:
+		return 0
+	case HealthStateDegraded:
+		return 1
+	default:
+		return 2
+	}
+}
@@ -0,0 +1,119 @@
+package connectionpool
+
+import (
+	"sync"
+	"time"
+
+	"github.com/javi11/usenet-drive/internal/usenet/providerusage"
+)
+
+type QuotaPeriod string
+
+const (
+	QuotaPeriodNever   QuotaPeriod = "never"
+	QuotaPeriodDaily   QuotaPeriod = "daily"
+	QuotaPeriodMonthly QuotaPeriod = "monthly"
+)
+
+// providerQuota counts the bytes transferred by the provider in the current period.
+// A limit of 0 means the provider has no quota.
+type providerQuota struct {
+	mx          sync.Mutex
+	limit       int64
+	period      QuotaPeriod
+	used        int64
+	periodStart time.Time
+	// There is usage not saved yet
+	dirty bool
+}
+
+func newProviderQuota(limit int64, period QuotaPeriod) (*providerQuota, error) {
+	switch period {
+	case QuotaPeriodNever, QuotaPeriodDaily, QuotaPeriodMonthly:
+	case "":
+		period = QuotaPeriodNever
+	default:
+		return nil, ErrUnknownQuotaPeriod
+	}
+
+	return &providerQuota{
+		limit:       limit,
+		period:      period,
+		periodStart: currentPeriodStart(period, time.Now()),
+	}, nil
+}
+
+func (q *providerQuota) HasLimit() bool {
+	return q.limit > 0
+}
+
+// Load restores the usage saved before, it is discarded if it belongs to a past period.
+func (q *providerQuota) Load(usage providerusage.Usage) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	if usage.PeriodStart.Equal(q.periodStart) {
+		q.used = usage.Bytes
+	}
+}
+
+func (q *providerQuota) Add(bytes int) {
+	if !q.HasLimit() {
+		return
+	}
+
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	q.resetIfExpired()
+	q.used += int64(bytes)
+	q.dirty = true
+}
+
+// Remaining returns the bytes that can still be transferred in the current period.
+func (q *providerQuota) Remaining() int64 {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	q.resetIfExpired()
+
+	return max(q.limit-q.used, 0)
+}
+
+func (q *providerQuota) IsExhausted() bool {
+	return q.HasLimit() && q.Remaining() == 0
+}
+
+// Usage returns the current usage and true if it changed since the last call.
+func (q *providerQuota) Usage() (providerusage.Usage, bool) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	dirty := q.dirty
+	q.dirty = false
+
+	return providerusage.Usage{Bytes: q.used, PeriodStart: q.periodStart}, dirty
+}
+
+// resetIfExpired must be called holding the lock
+func (q *providerQuota) resetIfExpired() {
+	periodStart := currentPeriodStart(q.period, time.Now())
+	if !periodStart.Equal(q.periodStart) {
+		q.periodStart = periodStart
+		q.used = 0
+		q.dirty = true
+	}
+}
+
+func currentPeriodStart(period QuotaPeriod, now time.Time) time.Time {
+	now = now.UTC()
+
+	switch period {
+	case QuotaPeriodDaily:
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	case QuotaPeriodMonthly:
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Time{}
+	}
+}
@@ -0,0 +1,66 @@
+package connectionpool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/javi11/usenet-drive/internal/usenet/providerusage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProviderQuota(t *testing.T) {
+	t.Run("unknown period", func(t *testing.T) {
+		_, err := newProviderQuota(100, "weekly")
+		assert.ErrorIs(t, err, ErrUnknownQuotaPeriod)
+	})
+
+	t.Run("providers without limit are never exhausted", func(t *testing.T) {
+		q, err := newProviderQuota(0, QuotaPeriodNever)
+		assert.NoError(t, err)
+
+		q.Add(1000)
+		assert.False(t, q.IsExhausted())
+
+		_, changed := q.Usage()
+		assert.False(t, changed)
+	})
+
+	t.Run("exhausted once the limit is reached", func(t *testing.T) {
+		q, err := newProviderQuota(100, QuotaPeriodMonthly)
+		assert.NoError(t, err)
+
+		q.Add(60)
+		assert.Equal(t, int64(40), q.Remaining())
+		assert.False(t, q.IsExhausted())
+
+		q.Add(60)
+		assert.Equal(t, int64(0), q.Remaining())
+		assert.True(t, q.IsExhausted())
+
+		usage, changed := q.Usage()
+		assert.True(t, changed)
+		assert.Equal(t, int64(120), usage.Bytes)
+
+		_, changed = q.Usage()
+		assert.False(t, changed)
+	})
+
+	t.Run("usage of a past period is discarded", func(t *testing.T) {
+		q, err := newProviderQuota(100, QuotaPeriodDaily)
+		assert.NoError(t, err)
+
+		q.Load(providerusage.Usage{Bytes: 100, PeriodStart: time.Now().AddDate(0, 0, -2)})
+		assert.False(t, q.IsExhausted())
+
+		q.Load(providerusage.Usage{Bytes: 100, PeriodStart: currentPeriodStart(QuotaPeriodDaily, time.Now())})
+		assert.True(t, q.IsExhausted())
+	})
+
+	t.Run("period start", func(t *testing.T) {
+		now := time.Date(2023, 10, 15, 13, 30, 0, 0, time.UTC)
+
+		assert.Equal(t, time.Date(2023, 10, 15, 0, 0, 0, 0, time.UTC), currentPeriodStart(QuotaPeriodDaily, now))
+		assert.Equal(t, time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC), currentPeriodStart(QuotaPeriodMonthly, now))
+		assert.True(t, currentPeriodStart(QuotaPeriodNever, now).IsZero())
+	})
+}
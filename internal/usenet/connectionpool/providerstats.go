@@ -0,0 +1,55 @@
+package connectionpool
+
+import (
+	"sync"
+	"time"
+)
+
+// Weight of the last sample in the moving averages
+const statsSmoothing = 0.2
+
+// providerStats keeps the moving average latency and throughput of the BODY/POST
+// commands completed by the provider.
+type providerStats struct {
+	mx         sync.RWMutex
+	samples    int64
+	latency    time.Duration
+	throughput float64
+}
+
+// RecordSample adds a completed command that transferred the given bytes in the given time.
+func (s *providerStats) RecordSample(bytes int, elapsed time.Duration) {
+	if elapsed <= 0 {
+		return
+	}
+
+	throughput := float64(bytes) / elapsed.Seconds()
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if s.samples == 0 {
+		s.latency = elapsed
+		s.throughput = throughput
+	} else {
+		s.latency = time.Duration(statsSmoothing*float64(elapsed) + (1-statsSmoothing)*float64(s.latency))
+		s.throughput = statsSmoothing*throughput + (1-statsSmoothing)*s.throughput
+	}
+	s.samples++
+}
+
+// Latency returns the average latency and false if there are no samples yet.
+func (s *providerStats) Latency() (time.Duration, bool) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	return s.latency, s.samples > 0
+}
+
+// Throughput returns the average throughput in bytes per second.
+func (s *providerStats) Throughput() float64 {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	return s.throughput
+}
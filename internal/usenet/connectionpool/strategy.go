@@ -0,0 +1,124 @@
+package connectionpool
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type SelectionStrategy string
+
+const (
+	// Use the first provider with free connections in config order.
+	SelectionStrategyFirstFit SelectionStrategy = "first_fit"
+	// Rotate the providers on every connection.
+	SelectionStrategyRoundRobin SelectionStrategy = "round_robin"
+	// Rotate the providers proportionally to their weight.
+	SelectionStrategyWeighted SelectionStrategy = "weighted"
+	// Use the provider with the lowest ratio of connections in use.
+	SelectionStrategyLeastUsed SelectionStrategy = "least_used"
+	// Use the provider with the lowest average latency of BODY/POST commands.
+	SelectionStrategyLowestLatency SelectionStrategy = "lowest_latency"
+)
+
+// selector chooses the provider that serves the next connection between candidates that
+// share the same tier and health. Candidates are never empty.
+type selector interface {
+	Select(candidates []*Provider) *Provider
+}
+
+func newSelector(strategy SelectionStrategy) (selector, error) {
+	switch strategy {
+	case SelectionStrategyFirstFit, "":
+		return firstFitSelector{}, nil
+	case SelectionStrategyRoundRobin:
+		return &roundRobinSelector{}, nil
+	case SelectionStrategyWeighted:
+		return &weightedSelector{current: make(map[string]int)}, nil
+	case SelectionStrategyLeastUsed:
+		return leastUsedSelector{}, nil
+	case SelectionStrategyLowestLatency:
+		return lowestLatencySelector{}, nil
+	default:
+		return nil, ErrUnknownSelectionStrategy
+	}
+}
+
+type firstFitSelector struct{}
+
+func (firstFitSelector) Select(candidates []*Provider) *Provider {
+	return candidates[0]
+}
+
+type roundRobinSelector struct {
+	next atomic.Uint64
+}
+
+func (s *roundRobinSelector) Select(candidates []*Provider) *Provider {
+	i := s.next.Add(1) - 1
+
+	return candidates[i%uint64(len(candidates))]
+}
+
+// weightedSelector implements the smooth weighted round robin, so providers with bigger
+// weights are chosen more often without sending them all the consecutive connections.
+type weightedSelector struct {
+	mx      sync.Mutex
+	current map[string]int
+}
+
+func (s *weightedSelector) Select(candidates []*Provider) *Provider {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	var selected *Provider
+	total := 0
+	for _, provider := range candidates {
+		weight := provider.weight()
+		total += weight
+		s.current[provider.Id] += weight
+
+		if selected == nil || s.current[provider.Id] > s.current[selected.Id] {
+			selected = provider
+		}
+	}
+
+	s.current[selected.Id] -= total
+
+	return selected
+}
+
+type leastUsedSelector struct{}
+
+func (leastUsedSelector) Select(candidates []*Provider) *Provider {
+	selected := candidates[0]
+	selectedUsage := selected.usage()
+	for _, provider := range candidates[1:] {
+		if usage := provider.usage(); usage < selectedUsage {
+			selected = provider
+			selectedUsage = usage
+		}
+	}
+
+	return selected
+}
+
+type lowestLatencySelector struct{}
+
+func (lowestLatencySelector) Select(candidates []*Provider) *Provider {
+	var selected *Provider
+	var selectedLatency int64
+	for _, provider := range candidates {
+		latency, ok := provider.stats.Latency()
+		if !ok {
+			// Providers without samples are tried first so they can be measured
+			return provider
+		}
+
+		if selected == nil || int64(latency) < selectedLatency {
+			selected = provider
+			selectedLatency = int64(latency)
+		}
+	}
+
+	return selected
+}
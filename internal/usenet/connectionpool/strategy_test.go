@@ -0,0 +1,75 @@
+package connectionpool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/javi11/usenet-drive/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectors(t *testing.T) {
+	newProvider := func(id string, weight int) *Provider {
+		return &Provider{
+			UsenetProvider: config.UsenetProvider{Id: id, Weight: weight},
+			stats:          &providerStats{},
+		}
+	}
+
+	t.Run("unknown strategy", func(t *testing.T) {
+		_, err := newSelector("random")
+		assert.ErrorIs(t, err, ErrUnknownSelectionStrategy)
+	})
+
+	t.Run("first fit", func(t *testing.T) {
+		s, err := newSelector(SelectionStrategyFirstFit)
+		assert.NoError(t, err)
+
+		candidates := []*Provider{newProvider("1", 1), newProvider("2", 1)}
+		assert.Equal(t, "1", s.Select(candidates).Id)
+		assert.Equal(t, "1", s.Select(candidates).Id)
+	})
+
+	t.Run("round robin", func(t *testing.T) {
+		s, err := newSelector(SelectionStrategyRoundRobin)
+		assert.NoError(t, err)
+
+		candidates := []*Provider{newProvider("1", 1), newProvider("2", 1), newProvider("3", 1)}
+
+		var selected []string
+		for i := 0; i < 4; i++ {
+			selected = append(selected, s.Select(candidates).Id)
+		}
+
+		assert.Equal(t, []string{"1", "2", "3", "1"}, selected)
+	})
+
+	t.Run("weighted", func(t *testing.T) {
+		s, err := newSelector(SelectionStrategyWeighted)
+		assert.NoError(t, err)
+
+		candidates := []*Provider{newProvider("1", 3), newProvider("2", 1)}
+
+		selected := map[string]int{}
+		for i := 0; i < 8; i++ {
+			selected[s.Select(candidates).Id]++
+		}
+
+		assert.Equal(t, map[string]int{"1": 6, "2": 2}, selected)
+	})
+
+	t.Run("lowest latency", func(t *testing.T) {
+		s, err := newSelector(SelectionStrategyLowestLatency)
+		assert.NoError(t, err)
+
+		slow := newProvider("1", 1)
+		slow.stats.RecordSample(750000, 300*time.Millisecond)
+		fast := newProvider("2", 1)
+		fast.stats.RecordSample(750000, 100*time.Millisecond)
+		unknown := newProvider("3", 1)
+
+		assert.Equal(t, "2", s.Select([]*Provider{slow, fast}).Id)
+		// Providers without samples are measured first
+		assert.Equal(t, "3", s.Select([]*Provider{slow, fast, unknown}).Id)
+	})
+}
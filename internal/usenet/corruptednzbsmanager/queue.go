@@ -11,6 +11,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/javi11/usenet-drive/internal/metrics"
 	"github.com/javi11/usenet-drive/internal/usenet"
 	"github.com/javi11/usenet-drive/internal/utils"
 	"github.com/javi11/usenet-drive/pkg/osfs"
@@ -30,6 +31,7 @@ type SortBy struct {
 
 type CorruptedNzbsManager interface {
 	Add(ctx context.Context, path, errorMessage string) error
+	Get(ctx context.Context, id int) (*cNzb, error)
 	Delete(ctx context.Context, id int) error
 	Discard(ctx context.Context, id int) (*cNzb, error)
 	DiscardByPath(ctx context.Context, path string) (*cNzb, error)
@@ -71,14 +73,32 @@ func (q *corruptedNzbsManager) Add(ctx context.Context, path, errorMessage strin
 	}
 	defer stmt.Close()
 
-	_, err = stmt.ExecContext(ctx, usenet.ReplaceFileExtension(path, ".nzb"), errorMessage)
+	res, err := stmt.ExecContext(ctx, usenet.ReplaceFileExtension(path, ".nzb"), errorMessage)
 	if err != nil {
 		return err
 	}
 
+	// The nzb can be already in the list
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		metrics.CorruptedNzbs.Inc()
+	}
+
 	return nil
 }
 
+func (q *corruptedNzbsManager) Get(ctx context.Context, id int) (*cNzb, error) {
+	var j cNzb
+	err := q.db.QueryRowContext(ctx, "SELECT id, path, created_at, error FROM corrupted_nzbs WHERE id = ?", id).
+		Scan(&j.ID, &j.Path, &j.CreatedAt, &j.Error)
+	if err != nil {
+		return nil, err
+	}
+
+	j.Path = usenet.ReplaceFileExtension(j.Path, ".nzb")
+
+	return &j, nil
+}
+
 func (q *corruptedNzbsManager) Delete(ctx context.Context, id int) error {
 	cnzb, err := q.Discard(ctx, id)
 	if err != nil {
@@ -93,6 +93,21 @@ func (mr *MockCorruptedNzbsManagerMockRecorder) DiscardByPath(ctx, path interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DiscardByPath", reflect.TypeOf((*MockCorruptedNzbsManager)(nil).DiscardByPath), ctx, path)
 }
 
+// Get mocks base method.
+func (m *MockCorruptedNzbsManager) Get(ctx context.Context, id int) (*cNzb, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, id)
+	ret0, _ := ret[0].(*cNzb)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockCorruptedNzbsManagerMockRecorder) Get(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockCorruptedNzbsManager)(nil).Get), ctx, id)
+}
+
 // GetFileContent mocks base method.
 func (m *MockCorruptedNzbsManager) GetFileContent(ctx context.Context, id int) (io.ReadCloser, error) {
 	m.ctrl.T.Helper()
@@ -33,6 +33,29 @@ func TestCorruptedNzbsManager_Add(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestCorruptedNzbsManager_Get(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	fs := osfs.NewMockFileSystem(ctrl)
+
+	manager := New(db, fs)
+
+	ctx := context.Background()
+	createdAt := time.Now()
+
+	mock.ExpectQuery("SELECT id, path, created_at, error FROM corrupted_nzbs WHERE id = ?").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "path", "created_at", "error"}).AddRow(1, "test.mkv", createdAt, "error"))
+
+	cnzb, err := manager.Get(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, &cNzb{ID: 1, Path: "test.nzb", CreatedAt: createdAt, Error: "error"}, cnzb)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestCorruptedNzbsManager_Delete(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	fs := osfs.NewMockFileSystem(ctrl)
@@ -0,0 +1,489 @@
+package usenet_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/javi11/usenet-drive/internal/config"
+	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
+	"github.com/javi11/usenet-drive/internal/usenet/corruptednzbsmanager"
+	"github.com/javi11/usenet-drive/internal/usenet/filereader"
+	"github.com/javi11/usenet-drive/internal/usenet/filewriter"
+	"github.com/javi11/usenet-drive/internal/usenet/nzbloader"
+	"github.com/javi11/usenet-drive/internal/usenet/segmentcache"
+	status "github.com/javi11/usenet-drive/internal/usenet/statusreporter"
+	"github.com/javi11/usenet-drive/pkg/nntpcli"
+	"github.com/javi11/usenet-drive/pkg/nntpserver"
+	"github.com/javi11/usenet-drive/pkg/nzb"
+	"github.com/javi11/usenet-drive/pkg/osfs"
+	"github.com/javi11/usenet-drive/pkg/yenc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/webdav"
+)
+
+const segmentSize = 10000
+
+type e2e struct {
+	server *nntpserver.Server
+	cp     connectionpool.UsenetConnectionPool
+	cNzb   *corruptednzbsmanager.MockCorruptedNzbsManager
+	dir    string
+}
+
+// newE2E uploads and downloads through two providers that share the same server,
+// so an article missing in the first one is looked up in the backup
+func newE2E(t *testing.T) *e2e {
+	server, err := nntpserver.New(nntpserver.WithCredentials("user", "pass"))
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		server.Close()
+	})
+
+	provider := func(id string, tier int) config.UsenetProvider {
+		return config.UsenetProvider{
+			Host:           server.Host(),
+			Port:           server.Port(),
+			Username:       "user",
+			Password:       "pass",
+			MaxConnections: 4,
+			Id:             id,
+			Tier:           tier,
+			Weight:         1,
+		}
+	}
+
+	cp, err := connectionpool.NewConnectionPool(
+		connectionpool.WithClient(nntpcli.New(nntpcli.WithTimeout(5*time.Second))),
+		connectionpool.WithLogger(slog.Default()),
+		connectionpool.WithDownloadProviders([]config.UsenetProvider{provider("primary", 0), provider("backup", 1)}),
+		connectionpool.WithUploadProviders([]config.UsenetProvider{provider("upload", 0)}),
+		connectionpool.WithMinDownloadConnections(0),
+	)
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		cp.Quit()
+	})
+
+	ctrl := gomock.NewController(t)
+
+	return &e2e{
+		server: server,
+		cp:     cp,
+		cNzb:   corruptednzbsmanager.NewMockCorruptedNzbsManager(ctrl),
+		dir:    t.TempDir(),
+	}
+}
+
+// newFakeE2E uses fake connections that keep the articles in a local directory
+func newFakeE2E(t *testing.T, articlesDir string) *e2e {
+	cp, err := connectionpool.NewConnectionPool(
+		connectionpool.WithLogger(slog.Default()),
+		connectionpool.WithDownloadProviders([]config.UsenetProvider{{Host: "fake", MaxConnections: 2, Id: "fake"}}),
+		connectionpool.WithUploadProviders([]config.UsenetProvider{{Host: "fake", MaxConnections: 2, Id: "fake-upload"}}),
+		connectionpool.WithFakeConnections(true),
+		connectionpool.WithFakeConnectionsDir(articlesDir),
+		connectionpool.WithMinDownloadConnections(0),
+	)
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		cp.Quit()
+	})
+
+	ctrl := gomock.NewController(t)
+
+	return &e2e{
+		cp:   cp,
+		cNzb: corruptednzbsmanager.NewMockCorruptedNzbsManager(ctrl),
+		dir:  t.TempDir(),
+	}
+}
+
+type fileWriter interface {
+	OpenFile(
+		ctx context.Context,
+		filePath string,
+		fileSize int64,
+		flag int,
+		perm os.FileMode,
+		onClose func(err error) error,
+	) (webdav.File, error)
+	RepairNzb(ctx context.Context, nzbPath string) (filewriter.RepairResult, error)
+}
+
+func (e *e2e) fileWriter(options ...filewriter.Option) fileWriter {
+	fs := osfs.New()
+
+	return filewriter.NewFileWriter(append([]filewriter.Option{
+		filewriter.WithSegmentSize(segmentSize),
+		filewriter.WithConnectionPool(e.cp),
+		filewriter.WithPostGroups([]string{"alt.binaries.test"}),
+		filewriter.WithLogger(slog.Default()),
+		filewriter.WithNzbWriter(nzbloader.NewNzbWriter(fs)),
+		filewriter.WithCorruptedNzbsManager(e.cNzb),
+		filewriter.WithFileSystem(fs),
+		filewriter.WithMaxUploadRetries(3),
+		filewriter.WithStatusReporter(status.NewStatusReporter()),
+	}, options...)...)
+}
+
+func (e *e2e) upload(t *testing.T, name string, data []byte, options ...filewriter.Option) error {
+	f, err := e.fileWriter(options...).OpenFile(
+		context.Background(),
+		filepath.Join(e.dir, name),
+		int64(len(data)),
+		os.O_WRONLY|os.O_CREATE,
+		0644,
+		func(err error) error { return nil },
+	)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	_, err = f.(io.ReaderFrom).ReadFrom(bytes.NewReader(data))
+
+	return err
+}
+
+func (e *e2e) download(t *testing.T, name string) ([]byte, error) {
+	fr, err := filereader.NewFileReader(
+		filereader.WithConnectionPool(e.cp),
+		filereader.WithLogger(slog.Default()),
+		filereader.WithCorruptedNzbsManager(e.cNzb),
+		filereader.WithFileSystem(osfs.New()),
+		filereader.WithMaxDownloadRetries(3),
+		filereader.WithMaxDownloadWorkers(2),
+		filereader.WithStatusReporter(status.NewStatusReporter()),
+	)
+	assert.NoError(t, err)
+
+	ok, f, err := fr.OpenFile(context.Background(), filepath.Join(e.dir, name), func() error { return nil })
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+func (e *e2e) nzb(t *testing.T, name string) *nzb.Nzb {
+	f, err := os.Open(filepath.Join(e.dir, name))
+	require.NoError(t, err)
+	defer f.Close()
+
+	n, err := nzb.ParseFromBuffer(f)
+	require.NoError(t, err)
+
+	return n
+}
+
+func newData(t *testing.T, size int) []byte {
+	data := make([]byte, size)
+	_, err := rand.Read(data)
+	assert.NoError(t, err)
+
+	return data
+}
+
+func TestEndToEnd(t *testing.T) {
+	t.Run("upload and read back a file", func(t *testing.T) {
+		e := newE2E(t)
+		data := newData(t, 4*segmentSize+1234)
+
+		assert.NoError(t, e.upload(t, "file.bin", data))
+		assert.Equal(t, 5, e.server.ArticleCount())
+		assert.FileExists(t, filepath.Join(e.dir, "file.nzb"))
+
+		downloaded, err := e.download(t, "file.nzb")
+		assert.NoError(t, err)
+		assert.Equal(t, data, downloaded)
+	})
+
+	t.Run("upload retries the rejected posts", func(t *testing.T) {
+		e := newE2E(t)
+		data := newData(t, 2*segmentSize)
+
+		e.server.InjectFault(nntpserver.Fault{Kind: nntpserver.FaultTooManyConnections, Command: "POST", Times: 1})
+		e.server.InjectFault(nntpserver.Fault{Kind: nntpserver.FaultDropConnection, Command: "POST", Times: 1})
+
+		assert.NoError(t, e.upload(t, "file.bin", data))
+		assert.Equal(t, 2, e.server.ArticleCount())
+		assert.Equal(t, 4, e.server.CommandCount("POST"))
+
+		downloaded, err := e.download(t, "file.nzb")
+		assert.NoError(t, err)
+		assert.Equal(t, data, downloaded)
+	})
+
+	t.Run("download retries the failed articles", func(t *testing.T) {
+		e := newE2E(t)
+		data := newData(t, 3*segmentSize)
+		assert.NoError(t, e.upload(t, "file.bin", data))
+
+		e.server.InjectFault(nntpserver.Fault{Kind: nntpserver.FaultArticleNotFound, Command: "BODY", Times: 1})
+		e.server.InjectFault(nntpserver.Fault{Kind: nntpserver.FaultDropConnection, Command: "BODY", Times: 1})
+		e.server.InjectFault(nntpserver.Fault{Kind: nntpserver.FaultSlowResponse, Command: "BODY", Times: 1, Delay: 50 * time.Millisecond})
+
+		downloaded, err := e.download(t, "file.nzb")
+		assert.NoError(t, err)
+		assert.Equal(t, data, downloaded)
+		assert.GreaterOrEqual(t, e.server.CommandCount("BODY"), 5)
+	})
+
+	t.Run("missing articles mark the nzb as corrupted", func(t *testing.T) {
+		e := newE2E(t)
+		data := newData(t, segmentSize)
+		assert.NoError(t, e.upload(t, "file.bin", data))
+
+		e.server.InjectFault(nntpserver.Fault{Kind: nntpserver.FaultArticleNotFound, Command: "BODY"})
+		e.cNzb.EXPECT().Add(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).MinTimes(1)
+
+		_, err := e.download(t, "file.nzb")
+		// The reader reports the corrupted segments as a truncated file
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+
+	t.Run("articles corrupted in all the providers mark the nzb as corrupted", func(t *testing.T) {
+		e := newE2E(t)
+		data := newData(t, segmentSize)
+		assert.NoError(t, e.upload(t, "file.bin", data))
+
+		// The article is replaced by one whose data does not match its crc32
+		msgId := e.nzb(t, "file.nzb").Files[0].Segments[0].Id
+		e.server.RemoveArticle(msgId)
+		article := bytes.NewBufferString(fmt.Sprintf(
+			"Message-ID: <%s>\r\nSubject: test\r\n\r\n"+
+				"=ybegin part=1 total=1 line=128 size=%d name=file.bin\r\n=ypart begin=1 end=%d\r\n",
+			msgId,
+			len(data),
+			len(data),
+		))
+		assert.NoError(t, yenc.Encode(data, article))
+		article.WriteString(fmt.Sprintf("=yend size=%d part=1 pcrc32=%08X\r\n", len(data), crc32.ChecksumIEEE(data)+1))
+		assert.NoError(t, e.server.AddArticle(article.Bytes()))
+
+		e.cNzb.EXPECT().Add(gomock.Any(), filepath.Join(e.dir, "file.nzb"), gomock.Any()).Return(nil).MinTimes(1)
+
+		_, err := e.download(t, "file.nzb")
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+}
+
+func TestEndToEnd_Par2(t *testing.T) {
+	t.Run("missing articles are repaired from the recovery slices", func(t *testing.T) {
+		e := newE2E(t)
+		data := newData(t, 9*segmentSize+1234)
+
+		// 10 segments, 2 recovery slices
+		assert.NoError(t, e.upload(t, "file.bin", data, filewriter.WithPar2Redundancy(20)))
+
+		n := e.nzb(t, "file.nzb")
+		require.Len(t, n.Files, 2)
+		assert.Equal(t, "2", n.Meta["par2_recovery_slices"])
+
+		// The last segment is shorter than the others
+		e.server.RemoveArticle(n.Files[0].Segments[3].Id)
+		e.server.RemoveArticle(n.Files[0].Segments[9].Id)
+
+		downloaded, err := e.download(t, "file.nzb")
+		assert.NoError(t, err)
+		assert.Equal(t, data, downloaded)
+	})
+
+	t.Run("more missing articles than recovery slices mark the nzb as corrupted", func(t *testing.T) {
+		e := newE2E(t)
+		data := newData(t, 4*segmentSize)
+		assert.NoError(t, e.upload(t, "file.bin", data, filewriter.WithPar2Redundancy(25)))
+
+		n := e.nzb(t, "file.nzb")
+		e.server.RemoveArticle(n.Files[0].Segments[0].Id)
+		e.server.RemoveArticle(n.Files[0].Segments[1].Id)
+		e.cNzb.EXPECT().Add(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).MinTimes(1)
+
+		_, err := e.download(t, "file.nzb")
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+}
+
+func TestEndToEnd_Repair(t *testing.T) {
+	t.Run("segments missing in one provider are re-posted", func(t *testing.T) {
+		e := newE2E(t)
+		data := newData(t, 3*segmentSize)
+		assert.NoError(t, e.upload(t, "file.bin", data))
+		before := e.nzb(t, "file.nzb")
+
+		// The first STAT does not find the article
+		e.server.InjectFault(nntpserver.Fault{Kind: nntpserver.FaultArticleNotFound, Command: "STAT", Times: 1})
+
+		result, err := e.fileWriter().RepairNzb(context.Background(), filepath.Join(e.dir, "file.nzb"))
+		require.NoError(t, err)
+		assert.Equal(t, filewriter.RepairResult{Reposted: 1}, result)
+		assert.Equal(t, 4, e.server.ArticleCount())
+
+		after := e.nzb(t, "file.nzb")
+		changed := 0
+		for i, segment := range after.Files[0].Segments {
+			if segment.Id != before.Files[0].Segments[i].Id {
+				changed++
+			}
+		}
+		assert.Equal(t, 1, changed)
+
+		downloaded, err := e.download(t, "file.nzb")
+		assert.NoError(t, err)
+		assert.Equal(t, data, downloaded)
+	})
+
+	t.Run("segments missing in all the providers are restored from the segment cache", func(t *testing.T) {
+		e := newE2E(t)
+		data := newData(t, 2*segmentSize+10)
+		assert.NoError(t, e.upload(t, "file.bin", data))
+
+		sc, err := segmentcache.NewSegmentCache(t.TempDir(), 1024*1024, slog.Default())
+		require.NoError(t, err)
+
+		n := e.nzb(t, "file.nzb")
+		require.NoError(t, sc.Put(n.Files[0].Segments[2].Id, data[2*segmentSize:]))
+		e.server.RemoveArticle(n.Files[0].Segments[2].Id)
+
+		result, err := e.fileWriter(filewriter.WithSegmentCache(sc)).
+			RepairNzb(context.Background(), filepath.Join(e.dir, "file.nzb"))
+		require.NoError(t, err)
+		assert.Equal(t, filewriter.RepairResult{Reposted: 1}, result)
+
+		downloaded, err := e.download(t, "file.nzb")
+		assert.NoError(t, err)
+		assert.Equal(t, data, downloaded)
+	})
+
+	t.Run("the nzb is not changed when no segment can be retrieved", func(t *testing.T) {
+		e := newE2E(t)
+		data := newData(t, 2*segmentSize)
+		assert.NoError(t, e.upload(t, "file.bin", data))
+
+		n := e.nzb(t, "file.nzb")
+		e.server.RemoveArticle(n.Files[0].Segments[0].Id)
+
+		result, err := e.fileWriter().RepairNzb(context.Background(), filepath.Join(e.dir, "file.nzb"))
+		assert.ErrorIs(t, err, filewriter.ErrSegmentNotRetrievable)
+		assert.Equal(t, []int64{1}, result.Unrepaired)
+		assert.Equal(t, n, e.nzb(t, "file.nzb"))
+	})
+
+	t.Run("the segments that can be retrieved are re-posted when others can not", func(t *testing.T) {
+		e := newE2E(t)
+		data := newData(t, 3*segmentSize)
+		assert.NoError(t, e.upload(t, "file.bin", data))
+
+		sc, err := segmentcache.NewSegmentCache(t.TempDir(), 1024*1024, slog.Default())
+		require.NoError(t, err)
+
+		before := e.nzb(t, "file.nzb")
+		require.NoError(t, sc.Put(before.Files[0].Segments[2].Id, data[2*segmentSize:]))
+		e.server.RemoveArticle(before.Files[0].Segments[0].Id)
+		e.server.RemoveArticle(before.Files[0].Segments[2].Id)
+
+		result, err := e.fileWriter(filewriter.WithSegmentCache(sc)).
+			RepairNzb(context.Background(), filepath.Join(e.dir, "file.nzb"))
+		assert.ErrorIs(t, err, filewriter.ErrSegmentNotRetrievable)
+		assert.Equal(t, filewriter.RepairResult{Reposted: 1, Unrepaired: []int64{1}}, result)
+
+		after := e.nzb(t, "file.nzb")
+		assert.Equal(t, before.Files[0].Segments[0].Id, after.Files[0].Segments[0].Id)
+		assert.Equal(t, before.Files[0].Segments[1].Id, after.Files[0].Segments[1].Id)
+		assert.NotEqual(t, before.Files[0].Segments[2].Id, after.Files[0].Segments[2].Id)
+	})
+
+	t.Run("segments missing in all the providers are reconstructed from the recovery slices", func(t *testing.T) {
+		e := newE2E(t)
+		data := newData(t, 9*segmentSize+1234)
+
+		// 10 segments, 2 recovery slices
+		assert.NoError(t, e.upload(t, "file.bin", data, filewriter.WithPar2Redundancy(20)))
+
+		// The last segment is shorter than the others
+		before := e.nzb(t, "file.nzb")
+		e.server.RemoveArticle(before.Files[0].Segments[3].Id)
+		e.server.RemoveArticle(before.Files[0].Segments[9].Id)
+
+		result, err := e.fileWriter().RepairNzb(context.Background(), filepath.Join(e.dir, "file.nzb"))
+		require.NoError(t, err)
+		assert.Equal(t, filewriter.RepairResult{Reposted: 2, Reconstructed: 2}, result)
+
+		after := e.nzb(t, "file.nzb")
+		assert.NotEqual(t, before.Files[0].Segments[3].Id, after.Files[0].Segments[3].Id)
+		assert.NotEqual(t, before.Files[0].Segments[9].Id, after.Files[0].Segments[9].Id)
+		// The recovery file is kept
+		assert.Equal(t, before.Files[1], after.Files[1])
+
+		// The file is read without the recovery slices
+		for _, segment := range after.Files[1].Segments {
+			e.server.RemoveArticle(segment.Id)
+		}
+
+		downloaded, err := e.download(t, "file.nzb")
+		assert.NoError(t, err)
+		assert.Equal(t, data, downloaded)
+	})
+
+	t.Run("an open file reads the segments of the repaired nzb", func(t *testing.T) {
+		e := newE2E(t)
+		data := newData(t, 3*segmentSize)
+		assert.NoError(t, e.upload(t, "file.bin", data))
+
+		sc, err := segmentcache.NewSegmentCache(t.TempDir(), 1024*1024, slog.Default())
+		require.NoError(t, err)
+
+		n := e.nzb(t, "file.nzb")
+		require.NoError(t, sc.Put(n.Files[0].Segments[1].Id, data[segmentSize:2*segmentSize]))
+		e.server.RemoveArticle(n.Files[0].Segments[1].Id)
+
+		fr, err := filereader.NewFileReader(
+			filereader.WithConnectionPool(e.cp),
+			filereader.WithLogger(slog.Default()),
+			filereader.WithCorruptedNzbsManager(e.cNzb),
+			filereader.WithFileSystem(osfs.New()),
+			filereader.WithMaxDownloadRetries(3),
+			filereader.WithMaxDownloadWorkers(2),
+			filereader.WithStatusReporter(status.NewStatusReporter()),
+		)
+		require.NoError(t, err)
+
+		ok, f, err := fr.OpenFile(context.Background(), filepath.Join(e.dir, "file.nzb"), func() error { return nil })
+		require.True(t, ok)
+		require.NoError(t, err)
+		defer f.Close()
+
+		_, err = e.fileWriter(filewriter.WithSegmentCache(sc), filewriter.WithNzbInvalidator(fr)).
+			RepairNzb(context.Background(), filepath.Join(e.dir, "file.nzb"))
+		require.NoError(t, err)
+
+		downloaded, err := io.ReadAll(f)
+		assert.NoError(t, err)
+		assert.Equal(t, data, downloaded)
+	})
+}
+
+func TestEndToEnd_FakeConnections(t *testing.T) {
+	articlesDir := t.TempDir()
+	e := newFakeE2E(t, articlesDir)
+	data := newData(t, 2*segmentSize+10)
+
+	assert.NoError(t, e.upload(t, "file.bin", data))
+
+	articles, err := os.ReadDir(articlesDir)
+	assert.NoError(t, err)
+	assert.Len(t, articles, 3)
+
+	downloaded, err := e.download(t, "file.nzb")
+	assert.NoError(t, err)
+	assert.Equal(t, data, downloaded)
+}
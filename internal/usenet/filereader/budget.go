@@ -0,0 +1,154 @@
+package filereader
+
+import (
+	"sort"
+	"sync"
+)
+
+// bufferBudget limits the memory of the segments held by the buffers of all the open files.
+// The prefetch stops when the budget is exhausted and the reads that need memory evict
+// the segments buffered by the other files.
+type bufferBudget struct {
+	mx sync.Mutex
+	// 0 means no limit
+	maxSize int64
+	used    int64
+	buffers map[*buffer]struct{}
+}
+
+// BufferUsage is the memory used by the read buffers of all the open files
+type BufferUsage struct {
+	UsedBytes   int64 `json:"used_bytes"`
+	MaxBytes    int64 `json:"max_bytes"`
+	OpenBuffers int   `json:"open_buffers"`
+}
+
+func newBufferBudget(maxSizeInBytes int64) *bufferBudget {
+	return &bufferBudget{
+		maxSize: maxSizeInBytes,
+		buffers: map[*buffer]struct{}{},
+	}
+}
+
+// setMaxSize changes the limit, the segments over the new limit are freed as the files are read
+func (bb *bufferBudget) setMaxSize(maxSizeInBytes int64) {
+	bb.mx.Lock()
+	defer bb.mx.Unlock()
+
+	bb.maxSize = maxSizeInBytes
+}
+
+func (bb *bufferBudget) register(b *buffer) {
+	if bb == nil {
+		return
+	}
+
+	bb.mx.Lock()
+	defer bb.mx.Unlock()
+
+	bb.buffers[b] = struct{}{}
+}
+
+func (bb *bufferBudget) unregister(b *buffer) {
+	if bb == nil {
+		return
+	}
+
+	bb.mx.Lock()
+	defer bb.mx.Unlock()
+
+	delete(bb.buffers, b)
+}
+
+// tryReserve reserves n bytes for a prefetched segment, it reports false when they do
+// not fit in the budget
+func (bb *bufferBudget) tryReserve(n int) bool {
+	if bb == nil {
+		return true
+	}
+
+	bb.mx.Lock()
+	defer bb.mx.Unlock()
+
+	if bb.maxSize > 0 && bb.used+int64(n) > bb.maxSize {
+		return false
+	}
+
+	bb.used += int64(n)
+
+	return true
+}
+
+// reserve reserves n bytes for a segment that is being read. It never fails, the segments
+// buffered by the other files are evicted to stay within the budget.
+func (bb *bufferBudget) reserve(owner *buffer, n int) {
+	if bb == nil {
+		return
+	}
+
+	bb.mx.Lock()
+	defer bb.mx.Unlock()
+
+	bb.used += int64(n)
+	if bb.maxSize <= 0 {
+		return
+	}
+
+	for b := range bb.buffers {
+		if bb.used <= bb.maxSize {
+			return
+		}
+
+		if b != owner {
+			bb.used -= b.evictSegments(bb.used - bb.maxSize)
+		}
+	}
+}
+
+func (bb *bufferBudget) release(n int) {
+	if bb == nil {
+		return
+	}
+
+	bb.mx.Lock()
+	defer bb.mx.Unlock()
+
+	bb.used -= int64(n)
+}
+
+func (bb *bufferBudget) usage() BufferUsage {
+	bb.mx.Lock()
+	defer bb.mx.Unlock()
+
+	return BufferUsage{
+		UsedBytes:   bb.used,
+		MaxBytes:    bb.maxSize,
+		OpenBuffers: len(bb.buffers),
+	}
+}
+
+// evictSegments frees at least n bytes of buffered segments, the furthest from the start
+// of the file first. It returns the freed bytes, the caller holds the budget lock.
+func (b *buffer) evictSegments(n int64) int64 {
+	var indexes []int
+	b.segmentsBuffer.Range(func(key, _ interface{}) bool {
+		indexes = append(indexes, key.(int))
+		return true
+	})
+	sort.Sort(sort.Reverse(sort.IntSlice(indexes)))
+
+	var freed int64
+	for _, index := range indexes {
+		if freed >= n {
+			break
+		}
+
+		if segment, ok := b.segmentsBuffer.LoadAndDelete(index); ok {
+			freed += int64(len(segment.(*segmentBuffer).data))
+			// The reads copying the segment hold their own reference
+			segment.(*segmentBuffer).release()
+		}
+	}
+
+	return freed
+}
@@ -0,0 +1,82 @@
+package filereader
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBufferBudget(t *testing.T) {
+	newBuffer := func(budget *bufferBudget, indexes ...int) *buffer {
+		b := &buffer{segmentsBuffer: &sync.Map{}, chunkSize: 5, budget: budget}
+		budget.register(b)
+
+		for _, index := range indexes {
+			budget.reserve(b, 5)
+			b.storeSegment(index, segmentBuffers.get(5))
+		}
+
+		return b
+	}
+
+	t.Run("prefetch stops when the budget is exhausted", func(t *testing.T) {
+		budget := newBufferBudget(10)
+
+		assert.True(t, budget.tryReserve(5))
+		assert.True(t, budget.tryReserve(5))
+		assert.False(t, budget.tryReserve(5))
+
+		budget.release(5)
+		assert.True(t, budget.tryReserve(5))
+		assert.Equal(t, int64(10), budget.usage().UsedBytes)
+	})
+
+	t.Run("no limit", func(t *testing.T) {
+		budget := newBufferBudget(0)
+
+		for i := 0; i < 10; i++ {
+			assert.True(t, budget.tryReserve(5))
+		}
+	})
+
+	t.Run("reads evict the segments of other files", func(t *testing.T) {
+		budget := newBufferBudget(15)
+		other := newBuffer(budget, 1, 2, 3)
+		owner := newBuffer(budget)
+
+		budget.reserve(owner, 5)
+
+		// The furthest segment of the other file is evicted
+		_, ok := other.segmentsBuffer.Load(3)
+		assert.False(t, ok)
+		_, ok = other.segmentsBuffer.Load(1)
+		assert.True(t, ok)
+
+		usage := budget.usage()
+		assert.Equal(t, int64(15), usage.UsedBytes)
+		assert.Equal(t, 2, usage.OpenBuffers)
+	})
+
+	t.Run("dropped segments free the budget", func(t *testing.T) {
+		budget := newBufferBudget(15)
+		b := newBuffer(budget, 1, 2)
+
+		b.dropSegment(1)
+		b.dropSegment(1)
+		assert.Equal(t, int64(5), budget.usage().UsedBytes)
+
+		// A segment that is already buffered does not count twice
+		budget.reserve(b, 5)
+		b.storeSegment(2, segmentBuffers.get(5))
+		assert.Equal(t, int64(5), budget.usage().UsedBytes)
+	})
+
+	t.Run("nil budget", func(t *testing.T) {
+		var budget *bufferBudget
+
+		assert.True(t, budget.tryReserve(5))
+		budget.reserve(nil, 5)
+		budget.release(5)
+	})
+}
@@ -8,14 +8,17 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/avast/retry-go"
+	"github.com/javi11/usenet-drive/internal/metrics"
 	"github.com/javi11/usenet-drive/internal/usenet"
 	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
 	"github.com/javi11/usenet-drive/internal/usenet/corruptednzbsmanager"
 	"github.com/javi11/usenet-drive/internal/usenet/nzbloader"
+	"github.com/javi11/usenet-drive/internal/usenet/segmentcache"
 	"github.com/javi11/usenet-drive/pkg/nntpcli"
 	"github.com/javi11/usenet-drive/pkg/nzb"
 )
@@ -30,18 +33,26 @@ type Buffer interface {
 	io.ReaderAt
 	io.ReadSeeker
 	io.Closer
+	// SetNzbReader replaces the reader of the nzb, the segments not downloaded yet are read
+	// from the new one
+	SetNzbReader(nzbReader nzbloader.NzbReader)
 }
 
 // Buf is a Buffer working on a slice of bytes.
 type buffer struct {
-	ctx                    context.Context
-	fileSize               int
-	nzbReader              nzbloader.NzbReader
-	nzbGroups              []string
-	ptr                    int64
-	segmentsBuffer         *sync.Map
-	cp                     connectionpool.UsenetConnectionPool
-	chunkSize              int
+	ctx      context.Context
+	fileSize int
+	// Protects the nzb reader that is replaced when the nzb is rewritten
+	nzbMx          sync.RWMutex
+	nzbReader      nzbloader.NzbReader
+	nzbGroups      []string
+	ptr            int64
+	segmentsBuffer *sync.Map
+	cp             connectionpool.UsenetConnectionPool
+	chunkSize      int
+	// Number of par2 recovery slices and of segments of each par2 recovery set
+	recoverySlices         int
+	recoverySetSize        int
 	dc                     downloadConfig
 	log                    *slog.Logger
 	nextSegment            chan nzb.NzbSegment
@@ -49,6 +60,15 @@ type buffer struct {
 	currentDownloading     *sync.Map
 	filePath               string
 	downloadRetryTimeoutMs int
+	// Optional, shared by all the open files
+	segmentCache segmentcache.SegmentCache
+	budget       *bufferBudget
+	hedger       *hedger
+	readAhead    *readAhead
+	repair       segmentRepair
+	cNzb         corruptednzbsmanager.CorruptedNzbsManager
+	// Numbers of the segments in nextSegment, not taken by a worker yet
+	queued sync.Map
 }
 
 // NewBuffer creates a new data volume based on a buffer
@@ -57,9 +77,14 @@ func NewBuffer(
 	nzbReader nzbloader.NzbReader,
 	fileSize int,
 	chunkSize int,
+	recoverySlices int,
+	recoverySetSize int,
 	dc downloadConfig,
+	budget *bufferBudget,
+	hedger *hedger,
 	cp connectionpool.UsenetConnectionPool,
 	cNzb corruptednzbsmanager.CorruptedNzbsManager,
+	segmentCache segmentcache.SegmentCache,
 	filePath string,
 	log *slog.Logger,
 ) (Buffer, error) {
@@ -74,6 +99,8 @@ func NewBuffer(
 	buffer := &buffer{
 		ctx:                    ctx,
 		chunkSize:              chunkSize,
+		recoverySlices:         recoverySlices,
+		recoverySetSize:        recoverySetSize,
 		fileSize:               fileSize,
 		nzbReader:              nzbReader,
 		nzbGroups:              nzbGroups,
@@ -81,19 +108,25 @@ func NewBuffer(
 		cp:                     cp,
 		dc:                     dc,
 		log:                    log,
-		nextSegment:            make(chan nzb.NzbSegment, 1),
+		nextSegment:            make(chan nzb.NzbSegment, max(max(dc.maxReadAheadSegments, dc.maxDownloadWorkers), 1)),
 		wg:                     &sync.WaitGroup{},
 		currentDownloading:     &sync.Map{},
 		filePath:               filePath,
 		downloadRetryTimeoutMs: int(retryTimeout.Milliseconds()),
+		segmentCache:           segmentCache,
+		budget:                 budget,
+		hedger:                 hedger,
+		readAhead:              newReadAhead(dc.maxDownloadWorkers, dc.maxReadAheadSegments),
+		cNzb:                   cNzb,
 	}
+	budget.register(buffer)
 
 	if dc.maxDownloadWorkers > 0 {
 		for i := 0; i < dc.maxDownloadWorkers; i++ {
 			buffer.wg.Add(1)
 			go func() {
 				defer buffer.wg.Done()
-				buffer.downloadWorker(ctx, cNzb)
+				buffer.downloadWorker(ctx)
 			}()
 		}
 	}
@@ -146,24 +179,50 @@ func (b *buffer) Seek(offset int64, whence int) (int64, error) {
 
 // Close the buffer. Currently no effect.
 func (b *buffer) Close() error {
+	// The segments queued are not downloaded once the file is closed
+	for drained := false; !drained; {
+		select {
+		case <-b.nextSegment:
+		default:
+			drained = true
+		}
+	}
 	close(b.nextSegment)
 
 	if b.dc.maxDownloadWorkers > 0 {
 		b.wg.Wait()
 	}
 
+	b.budget.unregister(b)
 	b.segmentsBuffer.Range(func(key, _ interface{}) bool {
-		b.segmentsBuffer.Delete(key)
+		b.dropSegment(key.(int))
 		return true
 	})
 
 	b.segmentsBuffer = nil
+	b.nzbMx.Lock()
 	b.nzbReader = nil
+	b.nzbMx.Unlock()
 	b.currentDownloading = nil
 
 	return nil
 }
 
+func (b *buffer) SetNzbReader(nzbReader nzbloader.NzbReader) {
+	b.nzbMx.Lock()
+	defer b.nzbMx.Unlock()
+
+	b.nzbReader = nzbReader
+}
+
+// nzb returns the current reader of the nzb
+func (b *buffer) nzb() nzbloader.NzbReader {
+	b.nzbMx.RLock()
+	defer b.nzbMx.RUnlock()
+
+	return b.nzbReader
+}
+
 // Read reads len(p) byte from the Buffer starting at the current offset.
 // It returns the number of bytes read and an error if any.
 // Returns io.EOF error if pointer is at the end of the Buffer.
@@ -175,6 +234,11 @@ func (b *buffer) Read(p []byte) (int, error) {
 		return 0, io.EOF
 	}
 
+	// The last segment is padded up to the chunk size
+	if rem := int64(b.fileSize) - b.ptr; int64(len(p)) > rem {
+		p = p[:rem]
+	}
+
 	currentSegmentIndex := b.calculateCurrentSegmentIndex(b.ptr)
 	beginReadAt := max((int(b.ptr) - (currentSegmentIndex * b.chunkSize)), 0)
 
@@ -193,16 +257,28 @@ func (b *buffer) ReadAt(p []byte, off int64) (int, error) {
 		return 0, io.EOF
 	}
 
+	// The last segment is padded up to the chunk size
+	short := false
+	if rem := int64(b.fileSize) - off; int64(len(p)) > rem {
+		p = p[:rem]
+		short = true
+	}
+
 	currentSegmentIndex := b.calculateCurrentSegmentIndex(off)
 	beginReadAt := max((int(off) - (currentSegmentIndex * b.chunkSize)), 0)
 
-	return b.read(p, currentSegmentIndex, beginReadAt)
+	n, err := b.read(p, currentSegmentIndex, beginReadAt)
+	if err == nil && short {
+		err = io.EOF
+	}
+
+	return n, err
 }
 
 func (b *buffer) deleteSegmentsBefore(index int) {
 	b.segmentsBuffer.Range(func(key, _ interface{}) bool {
 		if key.(int) < index {
-			b.segmentsBuffer.Delete(key)
+			b.dropSegment(key.(int))
 		}
 		return true
 	})
@@ -211,12 +287,51 @@ func (b *buffer) deleteSegmentsBefore(index int) {
 func (b *buffer) deleteSegmentsAfter(index int) {
 	b.segmentsBuffer.Range(func(key, _ interface{}) bool {
 		if key.(int) < index+b.dc.maxDownloadWorkers {
-			b.segmentsBuffer.Delete(key)
+			b.dropSegment(key.(int))
 		}
 		return true
 	})
 }
 
+// storeSegment buffers a segment whose memory is already reserved in the budget, the
+// reference of the caller is moved to the buffer
+func (b *buffer) storeSegment(index int, segment *segmentBuffer) {
+	if _, loaded := b.segmentsBuffer.LoadOrStore(index, segment); loaded {
+		b.budget.release(len(segment.data))
+		segment.release()
+	}
+}
+
+// loadSegment returns a buffered segment with a reference owned by the caller, so it is not
+// reused while it is read even if it is removed from the buffer
+func (b *buffer) loadSegment(index int) (*segmentBuffer, bool) {
+	v, ok := b.segmentsBuffer.Load(index)
+	if !ok {
+		return nil, false
+	}
+
+	segment := v.(*segmentBuffer)
+	if !segment.tryRetain() {
+		return nil, false
+	}
+
+	// The segment could have been released and reused before it was retained
+	if v, ok := b.segmentsBuffer.Load(index); !ok || v != segment {
+		segment.release()
+		return nil, false
+	}
+
+	return segment, true
+}
+
+// dropSegment removes a segment from the buffer and frees its memory from the budget
+func (b *buffer) dropSegment(index int) {
+	if segment, ok := b.segmentsBuffer.LoadAndDelete(index); ok {
+		b.budget.release(len(segment.(*segmentBuffer).data))
+		segment.(*segmentBuffer).release()
+	}
+}
+
 func (b *buffer) calculateCurrentSegmentIndex(offset int64) int {
 	return int(float64(offset) / float64(b.chunkSize))
 }
@@ -225,16 +340,8 @@ func (b *buffer) read(p []byte, currentSegmentIndex, beginReadAt int) (int, erro
 	n := 0
 
 	// Preload next segments
-	for j := 0; j < b.dc.maxDownloadWorkers; j++ {
-		nextSegmentIndex := currentSegmentIndex + j
-		if _, ok := b.segmentsBuffer.Load(nextSegmentIndex); !ok {
-			if nextSegment, hasMore := b.nzbReader.GetSegment(nextSegmentIndex); hasMore {
-				if _, loaded := b.currentDownloading.Load(nextSegment.Number); !loaded {
-					b.nextSegment <- nextSegment
-				}
-			}
-		}
-	}
+	lastSegmentIndex := b.calculateCurrentSegmentIndex(int64(currentSegmentIndex*b.chunkSize + beginReadAt + len(p) - 1))
+	b.preloadSegments(currentSegmentIndex, b.prefetchWindow(currentSegmentIndex, lastSegmentIndex))
 
 	i := 0
 
@@ -245,25 +352,38 @@ func (b *buffer) read(p []byte, currentSegmentIndex, beginReadAt int) (int, erro
 			return n, nil
 		}
 
-		segment, ok := b.segmentsBuffer.LoadAndDelete(currentSegmentIndex + i)
-		if !ok {
-			if nextSegment, hasMore := b.nzbReader.GetSegment(currentSegmentIndex + i); hasMore {
-				chunk := make([]byte, b.chunkSize)
-				err := b.downloadSegment(b.ctx, nextSegment, b.nzbGroups, chunk)
-				if err != nil {
-					return n, fmt.Errorf("error downloading segment: %w", err)
-				}
-
-				segment = chunk
-			} else {
+		// The memory of a buffered segment is reserved, the downloaded ones reserve it
+		// only when they are kept
+		segment, buffered := b.loadSegment(currentSegmentIndex + i)
+		if !buffered {
+			nextSegment, hasMore := b.nzb().GetSegment(currentSegmentIndex + i)
+			if !hasMore {
 				return n, io.EOF
 			}
+
+			segment = segmentBuffers.get(b.chunkSize)
+			err := b.downloadSegment(b.ctx, nextSegment, b.nzbGroups, segment.data, connectionpool.PriorityForeground)
+			if err != nil {
+				segment.release()
+				return n, fmt.Errorf("error downloading segment: %w", err)
+			}
 		}
 
-		chunk := segment.([]byte)
-		n += copy(p[n:], chunk[beginReadAt:])
-		if n < len(chunk[beginReadAt:]) {
-			b.segmentsBuffer.Store(currentSegmentIndex+i, chunk)
+		chunk := segment.data
+		read := copy(p[n:], chunk[beginReadAt:])
+		n += read
+		switch {
+		case read < len(chunk[beginReadAt:]) && !buffered:
+			// The rest of the segment is read by the next reads
+			b.budget.reserve(b, len(chunk))
+			b.storeSegment(currentSegmentIndex+i, segment)
+		case read < len(chunk[beginReadAt:]):
+			segment.release()
+		case buffered:
+			b.dropSegment(currentSegmentIndex + i)
+			segment.release()
+		default:
+			segment.release()
 		}
 
 		beginReadAt = 0
@@ -271,15 +391,100 @@ func (b *buffer) read(p []byte, currentSegmentIndex, beginReadAt int) (int, erro
 	}
 }
 
+// prefetchWindow returns the number of segments to prefetch for a read from the first to
+// the last segment
+func (b *buffer) prefetchWindow(first, last int) int {
+	if b.dc.maxDownloadWorkers <= 0 {
+		return 0
+	}
+
+	if b.readAhead == nil {
+		return b.dc.maxDownloadWorkers
+	}
+
+	return b.readAhead.update(first, last)
+}
+
+// preloadSegments queues the download of the next segments that are not buffered, being
+// downloaded or already queued. The queue fits the max read-ahead window, it does not wait
+// for busy workers if it is full.
+func (b *buffer) preloadSegments(currentSegmentIndex, window int) {
+	for j := 0; j < window; j++ {
+		nextSegmentIndex := currentSegmentIndex + j
+		if _, ok := b.segmentsBuffer.Load(nextSegmentIndex); ok {
+			continue
+		}
+
+		nextSegment, hasMore := b.nzb().GetSegment(nextSegmentIndex)
+		if !hasMore {
+			return
+		}
+
+		if _, loaded := b.currentDownloading.Load(nextSegment.Number); loaded {
+			continue
+		}
+
+		if _, loaded := b.queued.LoadOrStore(nextSegment.Number, true); loaded {
+			continue
+		}
+
+		select {
+		case b.nextSegment <- nextSegment:
+		default:
+			b.queued.Delete(nextSegment.Number)
+			return
+		}
+	}
+}
+
+// downloadSegment downloads a segment of the file, the segments that no provider has are
+// repaired from the par2 recovery slices of the file if it has them. The file is marked as
+// corrupted when the segment is missing or corrupted in every provider and can not be repaired.
 func (b *buffer) downloadSegment(
 	ctx context.Context,
 	segment nzb.NzbSegment,
 	groups []string,
 	chunk []byte,
+	priority connectionpool.Priority,
+) error {
+	err := b.downloadArticle(ctx, segment, groups, chunk, priority)
+	if err != nil && b.recoverySlices > 0 && errors.Is(err, ErrCorruptedNzb) {
+		if repairErr := b.repairSegment(ctx, segment, groups, chunk, priority); repairErr != nil {
+			err = errors.Join(err, repairErr)
+		} else {
+			err = nil
+		}
+	}
+
+	b.markCorrupted(err)
+
+	return err
+}
+
+// downloadArticle downloads an article from the cache or the providers
+func (b *buffer) downloadArticle(
+	ctx context.Context,
+	segment nzb.NzbSegment,
+	groups []string,
+	chunk []byte,
+	priority connectionpool.Priority,
 ) error {
+	if b.segmentCache != nil && b.segmentCache.Get(segment.Id, chunk) {
+		return nil
+	}
+
 	var conn connectionpool.Resource
+	// Providers that do not have the article, the next attempts will fail over to other providers or tiers
+	var missingOn []string
+	// Providers that served a corrupted article, they are used again only when no other provider is left
+	var corruptedOn []string
 	retryErr := retry.Do(func() error {
-		c, err := b.cp.GetDownloadConnection(ctx)
+		c, err := b.getDownloadConnection(ctx, priority, append(slices.Clone(missingOn), corruptedOn...))
+		if len(corruptedOn) > 0 &&
+			(errors.Is(err, connectionpool.ErrNoProviderAvailable) || errors.Is(err, connectionpool.ErrNoHealthyProvider)) {
+			corruptedOn = nil
+			c, err = b.getDownloadConnection(ctx, priority, missingOn)
+		}
 		if err != nil {
 			if conn != nil {
 				b.cp.Close(conn)
@@ -296,22 +501,54 @@ func (b *buffer) downloadSegment(
 		}
 		conn = c
 		nntpConn := conn.Value()
+		provider := nntpConn.Provider()
 
-		if nntpConn.Provider().JoinGroup {
+		if provider.JoinGroup {
 			err = usenet.JoinGroup(nntpConn, groups)
 			if err != nil {
 				return fmt.Errorf("error joining group: %w", err)
 			}
 		}
 
-		err = nntpConn.Body(segment.Id, chunk)
+		if priority == connectionpool.PriorityForeground && b.hedger != nil {
+			conn, provider, err = b.hedgedBody(ctx, conn, segment, groups, chunk, append(slices.Clone(missingOn), corruptedOn...))
+		} else {
+			_, err = nntpConn.Body(segment.Id, chunk)
+		}
 		if err != nil {
+			if nntpcli.IsArticleNotFoundError(err) {
+				// The connection is still usable, the article is just not in this provider
+				b.cp.Free(conn)
+				conn = nil
+				missingOn = append(missingOn, provider.Id)
+
+				return fmt.Errorf("error getting body from %s: %w", provider.Host, err)
+			}
+
+			if errors.Is(err, nntpcli.ErrCorruptedArticle) {
+				// The article was read up to its end, the connection is still usable
+				b.log.WarnContext(ctx, "Corrupted segment downloaded", "segment", segment.Id, "provider", provider.Host, "error", err)
+
+				b.cp.Free(conn)
+				conn = nil
+				corruptedOn = append(corruptedOn, provider.Id)
+
+				return fmt.Errorf("error getting body from %s: %w", provider.Host, err)
+			}
+
 			// Final segments has less bytes than chunkSize. Do not error if it's the case
 			if err != io.ErrUnexpectedEOF {
 				return fmt.Errorf("error getting body: %w", err)
 			}
 		}
 
+		b.log.DebugContext(ctx,
+			"Segment downloaded",
+			"segment", segment.Id,
+			"provider", provider.Host,
+			"tier", provider.Tier,
+		)
+
 		b.cp.Free(conn)
 		conn = nil
 		nntpConn = nil
@@ -322,9 +559,12 @@ func (b *buffer) downloadSegment(
 		retry.Attempts(uint(b.dc.maxDownloadRetries)),
 		retry.DelayType(retry.FixedDelay),
 		retry.RetryIf(func(err error) bool {
-			return nntpcli.IsRetryableError(err)
+			return nntpcli.IsRetryableError(err) ||
+				nntpcli.IsArticleNotFoundError(err) ||
+				errors.Is(err, nntpcli.ErrCorruptedArticle)
 		}),
 		retry.OnRetry(func(n uint, err error) {
+			metrics.DownloadRetries.Inc()
 			b.log.DebugContext(ctx,
 				"Retrying download",
 				"error", err,
@@ -360,8 +600,10 @@ func (b *buffer) downloadSegment(
 			err = errors.Join(e.WrappedErrors()...)
 		}
 
-		if nntpcli.IsRetryableError(err) || errors.Is(err, context.Canceled) {
-			// do not mark file as corrupted if it's a retryable error
+		if nntpcli.IsRetryableError(err) ||
+			errors.Is(err, context.Canceled) ||
+			errors.Is(err, connectionpool.ErrNoHealthyProvider) {
+			// do not mark file as corrupted if it's a retryable error or the providers are down
 			return err
 		}
 
@@ -374,15 +616,37 @@ func (b *buffer) downloadSegment(
 		return errors.Join(ErrCorruptedNzb, err)
 	}
 
+	b.cacheSegment(segment, chunk)
+
 	return nil
 }
 
-func (b *buffer) downloadWorker(ctx context.Context, cNzb corruptednzbsmanager.CorruptedNzbsManager) {
-	chunk := make([]byte, b.chunkSize)
-	defer func() {
-		chunk = nil
-	}()
+// getDownloadConnection acquires a download connection of a provider that is not excluded
+func (b *buffer) getDownloadConnection(
+	ctx context.Context,
+	priority connectionpool.Priority,
+	excluded []string,
+) (connectionpool.Resource, error) {
+	opts := []connectionpool.AcquireOption{connectionpool.WithPriority(priority)}
+	if len(excluded) > 0 {
+		opts = append(opts, connectionpool.WithExcludedProviders(excluded...))
+	}
+
+	return b.cp.GetDownloadConnection(ctx, opts...)
+}
+
+// cacheSegment adds a downloaded segment to the segment cache, if any
+func (b *buffer) cacheSegment(segment nzb.NzbSegment, chunk []byte) {
+	if b.segmentCache == nil {
+		return
+	}
+
+	if err := b.segmentCache.Put(segment.Id, chunk); err != nil {
+		b.log.Debug("Error caching segment", "segment", segment.Id, "error", err)
+	}
+}
 
+func (b *buffer) downloadWorker(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
@@ -391,31 +655,218 @@ func (b *buffer) downloadWorker(ctx context.Context, cNzb corruptednzbsmanager.C
 			if !ok {
 				return
 			}
+			b.queued.Delete(segment.Number)
 
 			if _, loaded := b.currentDownloading.LoadOrStore(segment.Number, true); loaded {
 				continue
 			}
 			segmentIndex := segmentIndexFromSegmentNumber(segment.Number)
 			if _, ok := b.segmentsBuffer.Load(segmentIndex); ok {
+				b.currentDownloading.Delete(segment.Number)
 				continue
 			}
 
-			err := b.downloadSegment(ctx, segment, b.nzbGroups, chunk)
-			if err != nil && !errors.Is(err, context.Canceled) {
-				if errors.Is(err, ErrCorruptedNzb) {
-					b.log.Error("Marking file as corrupted:", "error", err, "fileName", b.filePath)
-					err := cNzb.Add(b.ctx, b.filePath, err.Error())
-					if err != nil {
-						b.log.Error("Error adding corrupted nzb to the database:", "error", err)
-					}
+			// The segment is downloaded when it is read if the budget is exhausted
+			if !b.budget.tryReserve(b.chunkSize) {
+				b.currentDownloading.Delete(segment.Number)
+				continue
+			}
+
+			if b.dc.pipelineDepth > 1 {
+				segments := append([]nzb.NzbSegment{segment}, b.claimNextSegments(segmentIndex, b.dc.pipelineDepth-1)...)
+				if len(segments) > 1 {
+					b.prefetchSegments(ctx, segments)
+					continue
 				}
 			}
 
+			chunk := segmentBuffers.get(b.chunkSize)
+			err := b.downloadSegment(ctx, segment, b.nzbGroups, chunk.data, connectionpool.PriorityPrefetch)
+
 			if err == nil {
-				b.segmentsBuffer.Store(segmentIndex, chunk)
+				b.storeSegment(segmentIndex, chunk)
+			} else {
+				b.budget.release(b.chunkSize)
+				chunk.release()
 			}
 
 			b.currentDownloading.Delete(segment.Number)
 		}
 	}
 }
+
+// claimNextSegments marks as downloading up to n segments that follow the given index, it
+// stops at the first one that is already buffered, being downloaded or does not fit in the
+// budget.
+func (b *buffer) claimNextSegments(segmentIndex, n int) []nzb.NzbSegment {
+	var segments []nzb.NzbSegment
+	for i := 1; i <= n; i++ {
+		if _, ok := b.segmentsBuffer.Load(segmentIndex + i); ok {
+			break
+		}
+
+		segment, hasMore := b.nzb().GetSegment(segmentIndex + i)
+		if !hasMore {
+			break
+		}
+
+		if _, loaded := b.currentDownloading.LoadOrStore(segment.Number, true); loaded {
+			break
+		}
+
+		if !b.budget.tryReserve(b.chunkSize) {
+			b.currentDownloading.Delete(segment.Number)
+			break
+		}
+
+		segments = append(segments, segment)
+	}
+
+	return segments
+}
+
+// prefetchSegments downloads the segments pipelining their requests on one connection.
+// The segments that fail are downloaded again one by one, with retries and failover.
+func (b *buffer) prefetchSegments(
+	ctx context.Context,
+	segments []nzb.NzbSegment,
+) {
+	buffers := make([]*segmentBuffer, len(segments))
+	chunks := make([][]byte, len(segments))
+	for i := range chunks {
+		buffers[i] = segmentBuffers.get(b.chunkSize)
+		chunks[i] = buffers[i].data
+	}
+
+	// Only the segments that are not cached are requested
+	errs := make([]error, len(segments))
+	var missing []int
+	for i, segment := range segments {
+		if b.segmentCache == nil || !b.segmentCache.Get(segment.Id, chunks[i]) {
+			missing = append(missing, i)
+		}
+	}
+
+	if len(missing) > 0 {
+		missingSegments := make([]nzb.NzbSegment, len(missing))
+		missingChunks := make([][]byte, len(missing))
+		for j, i := range missing {
+			missingSegments[j] = segments[i]
+			missingChunks[j] = chunks[i]
+		}
+
+		for j, err := range b.downloadSegmentsPipelined(ctx, missingSegments, b.nzbGroups, missingChunks) {
+			if err == nil {
+				b.cacheSegment(missingSegments[j], missingChunks[j])
+			}
+
+			errs[missing[j]] = err
+		}
+	}
+
+	for i, segment := range segments {
+		err := errs[i]
+		if err != nil && !errors.Is(err, context.Canceled) {
+			b.log.DebugContext(ctx,
+				"Pipelined download failed, downloading the segment alone",
+				"error", err,
+				"segment", segment.Id,
+			)
+
+			err = b.downloadSegment(ctx, segment, b.nzbGroups, chunks[i], connectionpool.PriorityPrefetch)
+		}
+
+		if err == nil {
+			b.storeSegment(segmentIndexFromSegmentNumber(segment.Number), buffers[i])
+		} else {
+			b.budget.release(b.chunkSize)
+			buffers[i].release()
+		}
+
+		b.currentDownloading.Delete(segment.Number)
+	}
+}
+
+// downloadSegmentsPipelined downloads the segments in a single round of pipelined requests
+// to one provider, it returns one error for every segment.
+func (b *buffer) downloadSegmentsPipelined(
+	ctx context.Context,
+	segments []nzb.NzbSegment,
+	groups []string,
+	chunks [][]byte,
+) []error {
+	errs := make([]error, len(segments))
+	fail := func(err error) []error {
+		for i := range errs {
+			errs[i] = err
+		}
+
+		return errs
+	}
+
+	conn, err := b.cp.GetDownloadConnection(ctx, connectionpool.WithPriority(connectionpool.PriorityPrefetch))
+	if err != nil {
+		return fail(fmt.Errorf("error getting nntp connection: %w", err))
+	}
+
+	nntpConn := conn.Value()
+	provider := nntpConn.Provider()
+
+	if provider.JoinGroup {
+		err = usenet.JoinGroup(nntpConn, groups)
+		if err != nil {
+			b.cp.Close(conn)
+			return fail(fmt.Errorf("error joining group: %w", err))
+		}
+	}
+
+	requests := make([]nntpcli.BodyRequest, len(segments))
+	for i, segment := range segments {
+		requests[i] = nntpcli.BodyRequest{MsgId: segment.Id, Chunk: chunks[i]}
+	}
+
+	reusable := true
+	for i, err := range nntpConn.BodyPipelined(requests) {
+		// Final segments has less bytes than chunkSize. Do not error if it's the case
+		if err == nil || err == io.ErrUnexpectedEOF {
+			continue
+		}
+
+		// The connection is still usable when the article is just not in this provider or
+		// it was read up to its end
+		if !nntpcli.IsArticleNotFoundError(err) && !errors.Is(err, nntpcli.ErrCorruptedArticle) {
+			reusable = false
+		}
+
+		errs[i] = fmt.Errorf("error getting body from %s: %w", provider.Host, err)
+	}
+
+	if reusable {
+		b.cp.Free(conn)
+	} else {
+		b.cp.Close(conn)
+	}
+
+	b.log.DebugContext(ctx,
+		"Segments downloaded",
+		"segments", len(segments),
+		"provider", provider.Host,
+		"tier", provider.Tier,
+	)
+
+	return errs
+}
+
+// markCorrupted adds the nzb to the corrupted list when a segment is missing or corrupted in
+// every provider
+func (b *buffer) markCorrupted(err error) {
+	if b.cNzb == nil || err == nil || errors.Is(err, context.Canceled) || !errors.Is(err, ErrCorruptedNzb) {
+		return
+	}
+
+	b.log.Error("Marking file as corrupted:", "error", err, "fileName", b.filePath)
+	err = b.cNzb.Add(b.ctx, b.filePath, err.Error())
+	if err != nil {
+		b.log.Error("Error adding corrupted nzb to the database:", "error", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	nzbloader "github.com/javi11/usenet-drive/internal/usenet/nzbloader"
 )
 
 // MockBuffer is a mock of Buffer interface.
@@ -91,3 +92,15 @@ func (mr *MockBufferMockRecorder) Seek(offset, whence interface{}) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Seek", reflect.TypeOf((*MockBuffer)(nil).Seek), offset, whence)
 }
+
+// SetNzbReader mocks base method.
+func (m *MockBuffer) SetNzbReader(nzbReader nzbloader.NzbReader) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetNzbReader", nzbReader)
+}
+
+// SetNzbReader indicates an expected call of SetNzbReader.
+func (mr *MockBufferMockRecorder) SetNzbReader(nzbReader interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetNzbReader", reflect.TypeOf((*MockBuffer)(nil).SetNzbReader), nzbReader)
+}
@@ -3,6 +3,7 @@ package filereader
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/textproto"
@@ -14,7 +15,9 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
+	"github.com/javi11/usenet-drive/internal/usenet/corruptednzbsmanager"
 	"github.com/javi11/usenet-drive/internal/usenet/nzbloader"
+	"github.com/javi11/usenet-drive/internal/usenet/segmentcache"
 	"github.com/javi11/usenet-drive/pkg/nntpcli"
 	"github.com/javi11/usenet-drive/pkg/nzb"
 )
@@ -112,7 +115,7 @@ func TestBuffer_Read(t *testing.T) {
 		}
 
 		expectedBody := "body1"
-		segmentsBuffer.Store(0, []byte(expectedBody))
+		segmentsBuffer.Store(0, newTestSegment(expectedBody))
 
 		p := make([]byte, 5)
 		n, err := buf.Read(p)
@@ -157,14 +160,14 @@ func TestBuffer_Read(t *testing.T) {
 		mockResource := connectionpool.NewMockResource(ctrl)
 		mockResource.EXPECT().Value().Return(mockConn).Times(1)
 
-		mockPool.EXPECT().GetDownloadConnection(gomock.Any()).Return(mockResource, nil).Times(1)
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(mockResource, nil).Times(1)
 		mockPool.EXPECT().Free(mockResource).Times(1)
 		expectedBody := "body1"
 
 		mockConn.EXPECT().JoinGroup("group1").Return(nil).Times(1)
 		mockConn.EXPECT().Body("1", gomock.Any()).Do(func(_ any, chunk []byte) {
 			copy(chunk, []byte(expectedBody))
-		}).Return(nil).Times(1)
+		}).Return(5, nil).Times(1)
 
 		p := make([]byte, 5)
 		n, err := buf.Read(p)
@@ -206,8 +209,8 @@ func TestBuffer_Read(t *testing.T) {
 		expectedBody1 := "body1"
 		expectedBody2 := "body2"
 
-		segmentsBuffer.Store(0, []byte(expectedBody1))
-		segmentsBuffer.Store(1, []byte(expectedBody2))
+		segmentsBuffer.Store(0, newTestSegment(expectedBody1))
+		segmentsBuffer.Store(1, newTestSegment(expectedBody2))
 
 		p := make([]byte, 10)
 		n, err := buf.Read(p)
@@ -301,7 +304,7 @@ func TestBuffer_ReadAt(t *testing.T) {
 		}
 
 		expectedBody1 := "body1"
-		segmentsBuffer.Store(0, []byte(expectedBody1))
+		segmentsBuffer.Store(0, newTestSegment(expectedBody1))
 
 		p := make([]byte, 5)
 		n, err := buf.ReadAt(p, 0)
@@ -336,8 +339,8 @@ func TestBuffer_ReadAt(t *testing.T) {
 
 		expectedBody2 := "body3"
 
-		segmentsBuffer.Store(1, []byte(expectedBody1))
-		segmentsBuffer.Store(2, []byte(expectedBody2))
+		segmentsBuffer.Store(1, newTestSegment(expectedBody1))
+		segmentsBuffer.Store(2, newTestSegment(expectedBody2))
 
 		p := make([]byte, 9)
 		// Special attention to the offset, it will start reading from the second segment since chunkSize is 5
@@ -621,6 +624,7 @@ func TestBuffer_downloadSegment(t *testing.T) {
 	defer ctrl.Finish()
 
 	mockPool := connectionpool.NewMockUsenetConnectionPool(ctrl)
+	cNzb := corruptednzbsmanager.NewMockCorruptedNzbsManager(ctrl)
 	segmentsBuffer := &sync.Map{}
 
 	segment := nzb.NzbSegment{Id: "1", Number: 1, Bytes: 5}
@@ -657,17 +661,17 @@ func TestBuffer_downloadSegment(t *testing.T) {
 		mockResource := connectionpool.NewMockResource(ctrl)
 		mockResource.EXPECT().Value().Return(mockConn).Times(1)
 
-		mockPool.EXPECT().GetDownloadConnection(gomock.Any()).Return(mockResource, nil).Times(1)
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(mockResource, nil).Times(1)
 		mockPool.EXPECT().Free(mockResource).Times(1)
 		expectedBody1 := "body1"
 
 		mockConn.EXPECT().JoinGroup("group1").Return(nil).Times(1)
 		mockConn.EXPECT().Body("1", gomock.Any()).Do(func(_ any, chunk []byte) {
 			copy(chunk, []byte(expectedBody1))
-		}).Return(nil).Times(1)
+		}).Return(5, nil).Times(1)
 
 		part := make([]byte, 5)
-		err := buf.downloadSegment(context.Background(), segment, groups, part)
+		err := buf.downloadSegment(context.Background(), segment, groups, part, connectionpool.PriorityForeground)
 		assert.NoError(t, err)
 		assert.Equal(t, []byte("body1"), part)
 	})
@@ -698,10 +702,10 @@ func TestBuffer_downloadSegment(t *testing.T) {
 			currentDownloading:     &sync.Map{},
 			downloadRetryTimeoutMs: 1000,
 		}
-		mockPool.EXPECT().GetDownloadConnection(gomock.Any()).Return(nil, errors.New("error")).Times(1)
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(nil, errors.New("error")).Times(1)
 
 		part := make([]byte, 5)
-		err := buf.downloadSegment(context.Background(), segment, groups, part)
+		err := buf.downloadSegment(context.Background(), segment, groups, part, connectionpool.PriorityForeground)
 		assert.Error(t, err)
 	})
 
@@ -735,12 +739,12 @@ func TestBuffer_downloadSegment(t *testing.T) {
 		mockResource := connectionpool.NewMockResource(ctrl)
 		mockResource.EXPECT().Value().Return(mockConn).Times(1)
 
-		mockPool.EXPECT().GetDownloadConnection(gomock.Any()).Return(mockResource, nil).Times(1)
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(mockResource, nil).Times(1)
 		mockPool.EXPECT().Close(mockResource).Times(1)
 		mockConn.EXPECT().JoinGroup("group1").Return(errors.New("error")).Times(1)
 
 		part := make([]byte, 5)
-		err := buf.downloadSegment(context.Background(), segment, groups, part)
+		err := buf.downloadSegment(context.Background(), segment, groups, part, connectionpool.PriorityForeground)
 		assert.Error(t, err)
 	})
 
@@ -775,14 +779,14 @@ func TestBuffer_downloadSegment(t *testing.T) {
 		mockResource := connectionpool.NewMockResource(ctrl)
 		mockResource.EXPECT().Value().Return(mockConn).Times(1)
 
-		mockPool.EXPECT().GetDownloadConnection(gomock.Any()).Return(mockResource, nil).Times(1)
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(mockResource, nil).Times(1)
 		mockPool.EXPECT().Close(mockResource).Times(1)
 		mockConn.EXPECT().JoinGroup("group1").Return(nil).Times(1)
 
-		mockConn.EXPECT().Body("1", gomock.Any()).Return(errors.New("some error")).Times(1)
+		mockConn.EXPECT().Body("1", gomock.Any()).Return(0, errors.New("some error")).Times(1)
 
 		part := make([]byte, 5)
-		err := buf.downloadSegment(context.Background(), segment, groups, part)
+		err := buf.downloadSegment(context.Background(), segment, groups, part, connectionpool.PriorityForeground)
 		assert.ErrorIs(t, err, ErrCorruptedNzb)
 	})
 
@@ -821,25 +825,25 @@ func TestBuffer_downloadSegment(t *testing.T) {
 		mockResource2 := connectionpool.NewMockResource(ctrl)
 		mockResource2.EXPECT().Value().Return(mockConn2).Times(1)
 
-		mockPool.EXPECT().GetDownloadConnection(gomock.Any()).Return(mockResource, nil).Times(1)
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(mockResource, nil).Times(1)
 		mockPool.EXPECT().Close(mockResource).Times(1)
 
 		mockConn.EXPECT().JoinGroup("group1").Return(nil).Times(1)
-		mockConn.EXPECT().Body("1", gomock.Any()).Return(&textproto.Error{Code: nntpcli.SegmentAlreadyExistsErrCode}).Times(1)
+		mockConn.EXPECT().Body("1", gomock.Any()).Return(0, &textproto.Error{Code: nntpcli.SegmentAlreadyExistsErrCode}).Times(1)
 
-		mockPool.EXPECT().GetDownloadConnection(gomock.Any()).Return(mockResource2, nil).Times(1)
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(mockResource2, nil).Times(1)
 		mockPool.EXPECT().Free(mockResource2).Times(1)
 		mockConn2.EXPECT().JoinGroup("group1").Return(nil).Times(1)
 
 		expectedBody1 := "body1"
-		mockConn2.EXPECT().Body("1", gomock.Any()).DoAndReturn(func(_ any, chunk []byte) error {
+		mockConn2.EXPECT().Body("1", gomock.Any()).DoAndReturn(func(_ any, chunk []byte) (int, error) {
 			copy(chunk, []byte(expectedBody1))
 
-			return nil
+			return 5, nil
 		}).Times(1)
 
 		part := make([]byte, 5)
-		err := buf.downloadSegment(context.Background(), segment, groups, part)
+		err := buf.downloadSegment(context.Background(), segment, groups, part, connectionpool.PriorityForeground)
 		assert.NoError(t, err)
 		assert.NotNil(t, part)
 		assert.Equal(t, []byte("body1"), part)
@@ -881,24 +885,410 @@ func TestBuffer_downloadSegment(t *testing.T) {
 		mockResource2 := connectionpool.NewMockResource(ctrl)
 		mockResource2.EXPECT().Value().Return(mockConn2).Times(1)
 
-		mockPool.EXPECT().GetDownloadConnection(gomock.Any()).Return(mockResource, nil).Times(1)
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(mockResource, nil).Times(1)
 		mockPool.EXPECT().Close(mockResource).Times(1)
 		mockConn.EXPECT().JoinGroup("group1").Return(textproto.ProtocolError("some error")).Times(1)
 
-		mockPool.EXPECT().GetDownloadConnection(gomock.Any()).Return(mockResource2, nil).Times(1)
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(mockResource2, nil).Times(1)
 		mockPool.EXPECT().Free(mockResource2).Times(1)
 		mockConn2.EXPECT().JoinGroup("group1").Return(nil).Times(1)
 
 		expectedBody1 := "body1"
 		mockConn2.EXPECT().Body("1", gomock.Any()).Do(func(_ any, chunk []byte) {
 			copy(chunk, []byte(expectedBody1))
-		}).Return(nil).Times(1)
+		}).Return(5, nil).Times(1)
 
 		part := make([]byte, 5)
-		err := buf.downloadSegment(context.Background(), segment, groups, part)
+		err := buf.downloadSegment(context.Background(), segment, groups, part, connectionpool.PriorityForeground)
 
 		assert.NoError(t, err)
 		assert.NotNil(t, part)
 		assert.Equal(t, []byte("body1"), part)
 	})
+	t.Run("Test fail over to the next provider when the article is not found", func(t *testing.T) {
+		nzbReader := nzbloader.NewMockNzbReader(ctrl)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(func() {
+			cancel()
+		})
+		buf := &buffer{
+			ctx:            ctx,
+			fileSize:       3 * 100,
+			nzbReader:      nzbReader,
+			nzbGroups:      []string{"group1"},
+			ptr:            0,
+			segmentsBuffer: segmentsBuffer,
+			cp:             mockPool,
+			chunkSize:      5,
+			dc: downloadConfig{
+				maxDownloadRetries: 5,
+				maxDownloadWorkers: 0,
+				maxBufferSizeInMb:  30,
+			},
+			log:                    slog.Default(),
+			currentDownloading:     &sync.Map{},
+			downloadRetryTimeoutMs: 1000,
+		}
+		mockConn := nntpcli.NewMockConnection(ctrl)
+		mockConn.EXPECT().Provider().Return(nntpcli.Provider{Id: "primary", JoinGroup: true}).Times(1)
+		mockResource := connectionpool.NewMockResource(ctrl)
+		mockResource.EXPECT().Value().Return(mockConn).Times(1)
+
+		mockConn2 := nntpcli.NewMockConnection(ctrl)
+		mockConn2.EXPECT().Provider().Return(nntpcli.Provider{Id: "fill", Tier: 1, JoinGroup: true}).Times(1)
+		mockResource2 := connectionpool.NewMockResource(ctrl)
+		mockResource2.EXPECT().Value().Return(mockConn2).Times(1)
+
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(mockResource, nil).Times(1)
+		// The connection is healthy, it must be returned to the pool
+		mockPool.EXPECT().Free(mockResource).Times(1)
+
+		mockConn.EXPECT().JoinGroup("group1").Return(nil).Times(1)
+		mockConn.EXPECT().Body("1", gomock.Any()).Return(0, &textproto.Error{Code: nntpcli.ArticleNotFoundErrCode}).Times(1)
+
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(mockResource2, nil).Times(1)
+		mockPool.EXPECT().Free(mockResource2).Times(1)
+		mockConn2.EXPECT().JoinGroup("group1").Return(nil).Times(1)
+
+		expectedBody1 := "body1"
+		mockConn2.EXPECT().Body("1", gomock.Any()).DoAndReturn(func(_ any, chunk []byte) (int, error) {
+			copy(chunk, []byte(expectedBody1))
+
+			return 5, nil
+		}).Times(1)
+
+		part := make([]byte, 5)
+		err := buf.downloadSegment(context.Background(), segment, groups, part, connectionpool.PriorityForeground)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("body1"), part)
+	})
+
+	t.Run("Test mark as corrupted when the article is not found in any provider", func(t *testing.T) {
+		nzbReader := nzbloader.NewMockNzbReader(ctrl)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(func() {
+			cancel()
+		})
+		buf := &buffer{
+			ctx:            ctx,
+			fileSize:       3 * 100,
+			nzbReader:      nzbReader,
+			nzbGroups:      []string{"group1"},
+			ptr:            0,
+			segmentsBuffer: segmentsBuffer,
+			cp:             mockPool,
+			chunkSize:      5,
+			dc: downloadConfig{
+				maxDownloadRetries: 5,
+				maxDownloadWorkers: 0,
+				maxBufferSizeInMb:  30,
+			},
+			log:                    slog.Default(),
+			currentDownloading:     &sync.Map{},
+			downloadRetryTimeoutMs: 1000,
+			cNzb:                   cNzb,
+			filePath:               "file.nzb",
+		}
+		mockConn := nntpcli.NewMockConnection(ctrl)
+		mockConn.EXPECT().Provider().Return(nntpcli.Provider{Id: "primary", JoinGroup: true}).Times(1)
+		mockResource := connectionpool.NewMockResource(ctrl)
+		mockResource.EXPECT().Value().Return(mockConn).Times(1)
+
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(mockResource, nil).Times(1)
+		mockPool.EXPECT().Free(mockResource).Times(1)
+
+		mockConn.EXPECT().JoinGroup("group1").Return(nil).Times(1)
+		mockConn.EXPECT().Body("1", gomock.Any()).Return(0, &textproto.Error{Code: nntpcli.ArticleNotFoundErrCode}).Times(1)
+
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(nil, connectionpool.ErrNoProviderAvailable).Times(1)
+		cNzb.EXPECT().Add(ctx, "file.nzb", gomock.Any()).Return(nil).Times(1)
+
+		part := make([]byte, 5)
+		err := buf.downloadSegment(context.Background(), segment, groups, part, connectionpool.PriorityForeground)
+		assert.ErrorIs(t, err, ErrCorruptedNzb)
+	})
+
+	t.Run("Test fail over to the next provider when the article is corrupted", func(t *testing.T) {
+		buf := &buffer{
+			ctx:            context.Background(),
+			fileSize:       3 * 100,
+			nzbGroups:      []string{"group1"},
+			segmentsBuffer: segmentsBuffer,
+			cp:             mockPool,
+			chunkSize:      5,
+			dc: downloadConfig{
+				maxDownloadRetries: 5,
+			},
+			log:                    slog.Default(),
+			currentDownloading:     &sync.Map{},
+			downloadRetryTimeoutMs: 1000,
+		}
+		mockConn := nntpcli.NewMockConnection(ctrl)
+		mockConn.EXPECT().Provider().Return(nntpcli.Provider{Id: "primary"}).Times(1)
+		mockResource := connectionpool.NewMockResource(ctrl)
+		mockResource.EXPECT().Value().Return(mockConn).Times(1)
+
+		mockConn2 := nntpcli.NewMockConnection(ctrl)
+		mockConn2.EXPECT().Provider().Return(nntpcli.Provider{Id: "backup"}).Times(1)
+		mockResource2 := connectionpool.NewMockResource(ctrl)
+		mockResource2.EXPECT().Value().Return(mockConn2).Times(1)
+
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(mockResource, nil).Times(1)
+		// The article was read up to its end, the connection is returned to the pool
+		mockPool.EXPECT().Free(mockResource).Times(1)
+		mockConn.EXPECT().Body("1", gomock.Any()).Return(0, fmt.Errorf("%w: crc32 mismatch", nntpcli.ErrCorruptedArticle)).Times(1)
+
+		// The next attempt excludes the provider
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any(), gomock.Any()).Return(mockResource2, nil).Times(1)
+		mockPool.EXPECT().Free(mockResource2).Times(1)
+		mockConn2.EXPECT().Body("1", gomock.Any()).Do(func(_ any, chunk []byte) {
+			copy(chunk, []byte("body1"))
+		}).Return(5, nil).Times(1)
+
+		part := make([]byte, 5)
+		err := buf.downloadSegment(context.Background(), segment, groups, part, connectionpool.PriorityForeground)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("body1"), part)
+	})
+
+	t.Run("Test mark as corrupted when the only provider keeps serving a corrupted article", func(t *testing.T) {
+		buf := &buffer{
+			ctx:            context.Background(),
+			fileSize:       3 * 100,
+			nzbGroups:      []string{"group1"},
+			segmentsBuffer: segmentsBuffer,
+			cp:             mockPool,
+			chunkSize:      5,
+			dc: downloadConfig{
+				maxDownloadRetries: 2,
+			},
+			log:                    slog.Default(),
+			currentDownloading:     &sync.Map{},
+			downloadRetryTimeoutMs: 1000,
+			cNzb:                   cNzb,
+			filePath:               "file.nzb",
+		}
+		mockConn := nntpcli.NewMockConnection(ctrl)
+		mockConn.EXPECT().Provider().Return(nntpcli.Provider{Id: "primary"}).Times(2)
+		mockResource := connectionpool.NewMockResource(ctrl)
+		mockResource.EXPECT().Value().Return(mockConn).Times(2)
+
+		// No other provider is left, the same one is tried again
+		gomock.InOrder(
+			mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(mockResource, nil).Times(1),
+			mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, connectionpool.ErrNoProviderAvailable).Times(1),
+			mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(mockResource, nil).Times(1),
+		)
+		mockPool.EXPECT().Free(mockResource).Times(2)
+		mockConn.EXPECT().Body("1", gomock.Any()).Return(0, fmt.Errorf("%w: crc32 mismatch", nntpcli.ErrCorruptedArticle)).Times(2)
+		// Corrupted in every provider is marked like missing in every provider
+		cNzb.EXPECT().Add(gomock.Any(), "file.nzb", gomock.Any()).Return(nil).Times(1)
+
+		part := make([]byte, 5)
+		err := buf.downloadSegment(context.Background(), segment, groups, part, connectionpool.PriorityForeground)
+		assert.ErrorIs(t, err, ErrCorruptedNzb)
+		assert.ErrorIs(t, err, nntpcli.ErrCorruptedArticle)
+	})
+
+	t.Run("Test segment from the cache", func(t *testing.T) {
+		mockCache := segmentcache.NewMockSegmentCache(ctrl)
+		buf := &buffer{
+			ctx:            context.Background(),
+			fileSize:       3 * 100,
+			nzbGroups:      []string{"group1"},
+			segmentsBuffer: segmentsBuffer,
+			cp:             mockPool,
+			chunkSize:      5,
+			dc: downloadConfig{
+				maxDownloadRetries: 5,
+			},
+			log:                slog.Default(),
+			currentDownloading: &sync.Map{},
+			segmentCache:       mockCache,
+		}
+
+		// No connection is acquired
+		mockCache.EXPECT().Get("1", gomock.Any()).DoAndReturn(func(_ string, chunk []byte) bool {
+			copy(chunk, []byte("body1"))
+			return true
+		}).Times(1)
+
+		part := make([]byte, 5)
+		err := buf.downloadSegment(context.Background(), segment, groups, part, connectionpool.PriorityForeground)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("body1"), part)
+	})
+
+	t.Run("Test downloaded segment is cached", func(t *testing.T) {
+		mockCache := segmentcache.NewMockSegmentCache(ctrl)
+		buf := &buffer{
+			ctx:            context.Background(),
+			fileSize:       3 * 100,
+			nzbGroups:      []string{"group1"},
+			segmentsBuffer: segmentsBuffer,
+			cp:             mockPool,
+			chunkSize:      5,
+			dc: downloadConfig{
+				maxDownloadRetries: 5,
+			},
+			log:                slog.Default(),
+			currentDownloading: &sync.Map{},
+			segmentCache:       mockCache,
+		}
+
+		mockConn := nntpcli.NewMockConnection(ctrl)
+		mockConn.EXPECT().Provider().Return(nntpcli.Provider{}).Times(1)
+		mockResource := connectionpool.NewMockResource(ctrl)
+		mockResource.EXPECT().Value().Return(mockConn).Times(1)
+
+		mockCache.EXPECT().Get("1", gomock.Any()).Return(false).Times(1)
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(mockResource, nil).Times(1)
+		mockPool.EXPECT().Free(mockResource).Times(1)
+		mockConn.EXPECT().Body("1", gomock.Any()).Do(func(_ any, chunk []byte) {
+			copy(chunk, []byte("body1"))
+		}).Return(5, nil).Times(1)
+		mockCache.EXPECT().Put("1", []byte("body1")).Return(nil).Times(1)
+
+		part := make([]byte, 5)
+		err := buf.downloadSegment(context.Background(), segment, groups, part, connectionpool.PriorityForeground)
+		assert.NoError(t, err)
+	})
+}
+
+func TestBuffer_downloadSegmentsPipelined(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPool := connectionpool.NewMockUsenetConnectionPool(ctrl)
+
+	segments := []nzb.NzbSegment{
+		{Id: "1", Number: 1, Bytes: 5},
+		{Id: "2", Number: 2, Bytes: 5},
+	}
+	groups := []string{"group1"}
+
+	newBuffer := func() *buffer {
+		return &buffer{
+			ctx:            context.Background(),
+			fileSize:       3 * 100,
+			nzbReader:      nzbloader.NewMockNzbReader(ctrl),
+			nzbGroups:      groups,
+			segmentsBuffer: &sync.Map{},
+			cp:             mockPool,
+			chunkSize:      5,
+			dc: downloadConfig{
+				maxDownloadRetries: 5,
+				maxDownloadWorkers: 0,
+				maxBufferSizeInMb:  30,
+				pipelineDepth:      2,
+			},
+			log:                    slog.Default(),
+			currentDownloading:     &sync.Map{},
+			downloadRetryTimeoutMs: 1000,
+		}
+	}
+
+	t.Run("Test download segments pipelined", func(t *testing.T) {
+		buf := newBuffer()
+
+		mockConn := nntpcli.NewMockConnection(ctrl)
+		mockConn.EXPECT().Provider().Return(nntpcli.Provider{JoinGroup: true}).Times(1)
+		mockResource := connectionpool.NewMockResource(ctrl)
+		mockResource.EXPECT().Value().Return(mockConn).Times(1)
+
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(mockResource, nil).Times(1)
+		mockPool.EXPECT().Free(mockResource).Times(1)
+
+		mockConn.EXPECT().JoinGroup("group1").Return(nil).Times(1)
+		mockConn.EXPECT().BodyPipelined(gomock.Any()).DoAndReturn(func(requests []nntpcli.BodyRequest) []error {
+			assert.Equal(t, "1", requests[0].MsgId)
+			assert.Equal(t, "2", requests[1].MsgId)
+			copy(requests[0].Chunk, []byte("body1"))
+			copy(requests[1].Chunk, []byte("end"))
+
+			// The last segment is shorter than the chunk size
+			return []error{nil, io.ErrUnexpectedEOF}
+		}).Times(1)
+
+		chunks := [][]byte{make([]byte, 5), make([]byte, 5)}
+		errs := buf.downloadSegmentsPipelined(context.Background(), segments, groups, chunks)
+		assert.Equal(t, []error{nil, nil}, errs)
+		assert.Equal(t, []byte("body1"), chunks[0])
+		assert.Equal(t, []byte("end\x00\x00"), chunks[1])
+	})
+
+	t.Run("Test the connection is closed when the pipeline breaks", func(t *testing.T) {
+		buf := newBuffer()
+
+		mockConn := nntpcli.NewMockConnection(ctrl)
+		mockConn.EXPECT().Provider().Return(nntpcli.Provider{}).Times(1)
+		mockResource := connectionpool.NewMockResource(ctrl)
+		mockResource.EXPECT().Value().Return(mockConn).Times(1)
+
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(mockResource, nil).Times(1)
+		mockPool.EXPECT().Close(mockResource).Times(1)
+
+		mockConn.EXPECT().BodyPipelined(gomock.Any()).Return([]error{
+			&textproto.Error{Code: nntpcli.ArticleNotFoundErrCode},
+			io.EOF,
+		}).Times(1)
+
+		chunks := [][]byte{make([]byte, 5), make([]byte, 5)}
+		errs := buf.downloadSegmentsPipelined(context.Background(), segments, groups, chunks)
+		assert.True(t, nntpcli.IsArticleNotFoundError(errs[0]))
+		assert.ErrorIs(t, errs[1], io.EOF)
+	})
+
+	t.Run("Test prefetch falls back to single downloads for the failed segments", func(t *testing.T) {
+		buf := newBuffer()
+
+		mockConn := nntpcli.NewMockConnection(ctrl)
+		mockConn.EXPECT().Provider().Return(nntpcli.Provider{Id: "primary"}).Times(2)
+		mockResource := connectionpool.NewMockResource(ctrl)
+		mockResource.EXPECT().Value().Return(mockConn).Times(2)
+
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(mockResource, nil).Times(2)
+		mockPool.EXPECT().Free(mockResource).Times(2)
+
+		mockConn.EXPECT().BodyPipelined(gomock.Any()).DoAndReturn(func(requests []nntpcli.BodyRequest) []error {
+			copy(requests[0].Chunk, []byte("body1"))
+
+			return []error{nil, &textproto.Error{Code: nntpcli.ArticleNotFoundErrCode}}
+		}).Times(1)
+		mockConn.EXPECT().Body("2", gomock.Any()).Do(func(_ any, chunk []byte) {
+			copy(chunk, []byte("body2"))
+		}).Return(5, nil).Times(1)
+
+		for _, segment := range segments {
+			buf.currentDownloading.Store(segment.Number, true)
+		}
+
+		buf.prefetchSegments(context.Background(), segments)
+
+		chunk, ok := buf.segmentsBuffer.Load(0)
+		assert.True(t, ok)
+		assert.Equal(t, []byte("body1"), chunk.(*segmentBuffer).data)
+		chunk, ok = buf.segmentsBuffer.Load(1)
+		assert.True(t, ok)
+		assert.Equal(t, []byte("body2"), chunk.(*segmentBuffer).data)
+
+		_, downloading := buf.currentDownloading.Load(segments[1].Number)
+		assert.False(t, downloading)
+	})
+	t.Run("Test no more segments are claimed when the buffer budget is exhausted", func(t *testing.T) {
+		buf := newBuffer()
+		buf.budget = newBufferBudget(5)
+		assert.True(t, buf.budget.tryReserve(buf.chunkSize))
+
+		buf.nzbReader.(*nzbloader.MockNzbReader).EXPECT().GetSegment(1).Return(segments[1], true).Times(1)
+
+		claimed := buf.claimNextSegments(0, 1)
+		assert.Empty(t, claimed)
+
+		_, downloading := buf.currentDownloading.Load(segments[1].Number)
+		assert.False(t, downloading)
+		assert.Equal(t, int64(5), buf.budget.usage().UsedBytes)
+	})
 }
@@ -5,6 +5,8 @@ import (
 
 	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
 	"github.com/javi11/usenet-drive/internal/usenet/corruptednzbsmanager"
+	"github.com/javi11/usenet-drive/internal/usenet/nzbloader"
+	"github.com/javi11/usenet-drive/internal/usenet/segmentcache"
 	status "github.com/javi11/usenet-drive/internal/usenet/statusreporter"
 	"github.com/javi11/usenet-drive/pkg/osfs"
 )
@@ -13,26 +15,43 @@ type downloadConfig struct {
 	maxDownloadRetries int
 	maxDownloadWorkers int
 	maxBufferSizeInMb  int
+	pipelineDepth      int
+	// Max segments prefetched ahead of the reads of a file
+	maxReadAheadSegments int
+	// Latency percentile after which a read is requested on another provider, 0 disables it
+	hedgePercentile int
+	maxHedgePercent int
 }
 
 type Config struct {
-	cp                 connectionpool.UsenetConnectionPool
-	log                *slog.Logger
-	cNzb               corruptednzbsmanager.CorruptedNzbsManager
-	fs                 osfs.FileSystem
-	maxDownloadRetries int
-	maxDownloadWorkers int
-	maxBufferSizeInMb  int
-	segmentSize        int64
-	debug              bool
-	sr                 status.StatusReporter
+	cp                   connectionpool.UsenetConnectionPool
+	log                  *slog.Logger
+	cNzb                 corruptednzbsmanager.CorruptedNzbsManager
+	segmentCache         segmentcache.SegmentCache
+	fs                   osfs.FileSystem
+	maxDownloadRetries   int
+	maxDownloadWorkers   int
+	maxBufferSizeInMb    int
+	pipelineDepth        int
+	maxReadAheadSegments int
+	hedgePercentile      int
+	maxHedgePercent      int
+	segmentSize          int64
+	debug                bool
+	sr                   status.StatusReporter
+	// Optional, the nzbs are parsed up to the segments read without it
+	segmentIndexRepository nzbloader.SegmentIndexRepository
 }
 
 func (c *Config) getDownloadConfig() downloadConfig {
 	return downloadConfig{
-		maxDownloadRetries: c.maxDownloadRetries,
-		maxDownloadWorkers: c.maxDownloadWorkers,
-		maxBufferSizeInMb:  c.maxBufferSizeInMb,
+		maxDownloadRetries:   c.maxDownloadRetries,
+		maxDownloadWorkers:   c.maxDownloadWorkers,
+		maxBufferSizeInMb:    c.maxBufferSizeInMb,
+		pipelineDepth:        c.pipelineDepth,
+		maxReadAheadSegments: c.maxReadAheadSegments,
+		hedgePercentile:      c.hedgePercentile,
+		maxHedgePercent:      c.maxHedgePercent,
 	}
 }
 
@@ -40,11 +59,14 @@ type Option func(*Config)
 
 func defaultConfig() *Config {
 	return &Config{
-		debug:              false,
-		fs:                 osfs.New(),
-		maxDownloadRetries: 8,
-		maxDownloadWorkers: 3,
-		maxBufferSizeInMb:  30,
+		debug:                false,
+		fs:                   osfs.New(),
+		maxDownloadRetries:   8,
+		maxDownloadWorkers:   3,
+		maxBufferSizeInMb:    30,
+		pipelineDepth:        1,
+		maxReadAheadSegments: 16,
+		maxHedgePercent:      10,
 	}
 }
 
@@ -78,6 +100,39 @@ func WithMaxBufferSizeInMb(maxBufferSizeInMb int) Option {
 	}
 }
 
+// WithPipelineDepth sets how many sequential segments a download worker requests at once
+// on the same connection. A value of 1 or lower disables the pipelining.
+func WithPipelineDepth(pipelineDepth int) Option {
+	return func(c *Config) {
+		c.pipelineDepth = pipelineDepth
+	}
+}
+
+// WithMaxReadAheadSegments sets how many segments can be prefetched ahead of the reads of
+// a file. The window grows up to it while the file is read sequentially and drops to zero
+// on random reads.
+func WithMaxReadAheadSegments(maxReadAheadSegments int) Option {
+	return func(c *Config) {
+		c.maxReadAheadSegments = maxReadAheadSegments
+	}
+}
+
+// WithHedgePercentile requests again on another provider the segments of the reads that are
+// slower than the given percentile of the recent downloads. The first response is used and
+// the other request is cancelled. 0 disables the hedging.
+func WithHedgePercentile(hedgePercentile int) Option {
+	return func(c *Config) {
+		c.hedgePercentile = hedgePercentile
+	}
+}
+
+// WithMaxHedgePercent limits the hedged requests to the given percentage of the requests
+func WithMaxHedgePercent(maxHedgePercent int) Option {
+	return func(c *Config) {
+		c.maxHedgePercent = maxHedgePercent
+	}
+}
+
 func WithFileSystem(fs osfs.FileSystem) Option {
 	return func(c *Config) {
 		c.fs = fs
@@ -102,6 +157,22 @@ func WithCorruptedNzbsManager(cNzb corruptednzbsmanager.CorruptedNzbsManager) Op
 	}
 }
 
+// WithSegmentCache reads the segments from the cache before downloading them, the
+// downloaded segments are added to it.
+func WithSegmentCache(segmentCache segmentcache.SegmentCache) Option {
+	return func(c *Config) {
+		c.segmentCache = segmentCache
+	}
+}
+
+// WithSegmentIndexRepository finds the segments of the nzbs in a segment index, built the
+// first time an nzb is opened, instead of parsing the nzb up to them.
+func WithSegmentIndexRepository(repository nzbloader.SegmentIndexRepository) Option {
+	return func(c *Config) {
+		c.segmentIndexRepository = repository
+	}
+}
+
 func WithStatusReporter(sr status.StatusReporter) Option {
 	return func(c *Config) {
 		c.sr = sr
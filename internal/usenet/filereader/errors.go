@@ -4,4 +4,5 @@ import "errors"
 
 var (
 	ErrCorruptedNzb = errors.New("corrupted nzb")
+	ErrNzbChanged   = errors.New("the rewritten nzb is not the same file")
 )
@@ -17,6 +17,7 @@ import (
 	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
 	"github.com/javi11/usenet-drive/internal/usenet/corruptednzbsmanager"
 	"github.com/javi11/usenet-drive/internal/usenet/nzbloader"
+	"github.com/javi11/usenet-drive/internal/usenet/segmentcache"
 	status "github.com/javi11/usenet-drive/internal/usenet/statusreporter"
 	"github.com/javi11/usenet-drive/pkg/mmap"
 	"github.com/javi11/usenet-drive/pkg/osfs"
@@ -35,6 +36,18 @@ type file struct {
 	sr        status.StatusReporter
 	sessionId uuid.UUID
 	nzbReader nzbloader.NzbReader
+	// Path of the nzb, path is the name of the file it contains
+	nzbPath string
+	indexer *segmentIndexer
+	// Files open by the file reader, nil if the file is not tracked
+	open *openFiles
+	// Mmaps and readers of the previous versions of a rewritten nzb, a read can still use them
+	reloaded []reloadedNzb
+}
+
+type reloadedNzb struct {
+	mmapFile  mmap.MmapFileData
+	nzbReader nzbloader.NzbReader
 }
 
 func openFile(
@@ -44,8 +57,12 @@ func openFile(
 	log *slog.Logger,
 	onClose func() error,
 	cNzb corruptednzbsmanager.CorruptedNzbsManager,
+	sc segmentcache.SegmentCache,
 	fs osfs.FileSystem,
 	dc downloadConfig,
+	budget *bufferBudget,
+	hedger *hedger,
+	indexer *segmentIndexer,
 	sr status.StatusReporter,
 ) (bool, *file, error) {
 	var fileStat os.FileInfo
@@ -79,7 +96,7 @@ func openFile(
 		return true, nil, err
 	}
 
-	nzbReader := nzbloader.NewNzbReader(bytes.NewReader(m.Bytes()))
+	nzbReader := indexer.nzbReader(ctx, path, fileStat, bytes.NewReader(m.Bytes()))
 
 	metadata, err := nzbReader.GetMetadata()
 	if err != nil {
@@ -90,14 +107,24 @@ func openFile(
 		return true, nil, os.ErrNotExist
 	}
 
+	// The nzb can set its own max read-ahead, like a lower one for the files that are probed
+	if metadata.MaxReadAheadSegments != nil {
+		dc.maxReadAheadSegments = *metadata.MaxReadAheadSegments
+	}
+
 	buffer, err := NewBuffer(
 		ctx,
 		nzbReader,
 		int(metadata.FileSize),
 		int(metadata.ChunkSize),
+		metadata.RecoverySlices,
+		metadata.RecoverySetSize,
 		dc,
+		budget,
+		hedger,
 		cp,
 		cNzb,
+		sc,
 		path,
 		log,
 	)
@@ -112,6 +139,8 @@ func openFile(
 		sessionId: sessionId,
 		mmapFile:  m,
 		nzbReader: nzbReader,
+		nzbPath:   path,
+		indexer:   indexer,
 		buffer:    buffer,
 		metadata:  metadata,
 		path:      usenet.ReplaceFileExtension(path, metadata.FileExtension),
@@ -138,13 +167,23 @@ func (f *file) Chown(uid, gid int) error {
 func (f *file) Close() error {
 	defer f.sr.FinishDownload(f.sessionId)
 
+	// The nzb can not be reloaded once the file is removed
+	if f.open != nil {
+		f.open.remove(f)
+	}
+
 	err := f.mmapFile.Close()
 	err2 := f.buffer.Close()
 	f.nzbReader.Close()
+	for _, r := range f.reloaded {
+		err2 = errors.Join(err2, r.mmapFile.Close())
+		r.nzbReader.Close()
+	}
 
 	f.buffer = nil
 	f.mmapFile = nil
 	f.nzbReader = nil
+	f.reloaded = nil
 
 	err = errors.Join(err, err2)
 	if err != nil {
@@ -160,6 +199,42 @@ func (f *file) Close() error {
 	return nil
 }
 
+// reloadNzb reads again the nzb after it was rewritten, the segments not downloaded yet are
+// read with their new message ids
+func (f *file) reloadNzb(ctx context.Context) error {
+	fileStat, err := f.fs.Stat(f.nzbPath)
+	if err != nil {
+		return err
+	}
+
+	nf, err := f.fs.Open(f.nzbPath)
+	if err != nil {
+		return err
+	}
+
+	m, err := mmap.MmapFileWithSize(nf, int(fileStat.Size()))
+	if err != nil {
+		return err
+	}
+
+	nzbReader := f.indexer.nzbReader(ctx, f.nzbPath, fileStat, bytes.NewReader(m.Bytes()))
+
+	metadata, err := nzbReader.GetMetadata()
+	if err == nil && (metadata.FileSize != f.metadata.FileSize || metadata.ChunkSize != f.metadata.ChunkSize) {
+		err = ErrNzbChanged
+	}
+
+	if err != nil {
+		nzbReader.Close()
+		return errors.Join(err, m.Close())
+	}
+
+	f.buffer.SetNzbReader(nzbReader)
+	f.reloaded = append(f.reloaded, reloadedNzb{mmapFile: m, nzbReader: nzbReader})
+
+	return nil
+}
+
 func (f *file) Fd() uintptr {
 	return f.mmapFile.File().Fd()
 }
@@ -174,13 +249,8 @@ func (f *file) Read(b []byte) (int, error) {
 
 	n, err := f.buffer.Read(b)
 	if err != nil {
+		// The buffer marked the file as corrupted, it is reported as truncated
 		if errors.Is(err, ErrCorruptedNzb) {
-			f.log.Error("Marking file as corrupted:", "error", err, "fileName", f.path)
-			err := f.cNzb.Add(context.Background(), f.path, err.Error())
-			if err != nil {
-				f.log.Error("Error adding corrupted nzb to the database:", "error", err)
-			}
-
 			return n, io.ErrUnexpectedEOF
 		}
 
@@ -201,13 +271,8 @@ func (f *file) ReadAt(b []byte, off int64) (int, error) {
 
 	n, err := f.buffer.ReadAt(b, off)
 	if err != nil {
+		// The buffer marked the file as corrupted, it is reported as truncated
 		if errors.Is(err, ErrCorruptedNzb) {
-			f.log.Error("Marking file as corrupted:", "error", err, "fileName", f.path)
-			err := f.cNzb.Add(context.Background(), f.path, err.Error())
-			if err != nil {
-				f.log.Error("Error adding corrupted nzb to the database:", "error", err)
-			}
-
 			return n, io.ErrUnexpectedEOF
 		}
 
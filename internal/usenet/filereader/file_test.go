@@ -5,6 +5,8 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -46,12 +48,16 @@ func TestOpenFile(t *testing.T) {
 			log,
 			onClose,
 			mockCNzb,
+			nil,
 			fs,
 			downloadConfig{
 				maxDownloadRetries: 5,
 				maxDownloadWorkers: 1,
 				maxBufferSizeInMb:  30,
 			},
+			nil,
+			nil,
+			nil,
 			mockSr,
 		)
 		t.Cleanup(func() {
@@ -75,12 +81,16 @@ func TestOpenFile(t *testing.T) {
 			log,
 			onClose,
 			mockCNzb,
+			nil,
 			fs,
 			downloadConfig{
 				maxDownloadRetries: 5,
 				maxDownloadWorkers: 1,
 				maxBufferSizeInMb:  30,
 			},
+			nil,
+			nil,
+			nil,
 			mockSr,
 		)
 		t.Cleanup(func() {
@@ -116,12 +126,16 @@ func TestOpenFile(t *testing.T) {
 			log,
 			onClose,
 			mockCNzb,
+			nil,
 			fs,
 			downloadConfig{
 				maxDownloadRetries: 5,
 				maxDownloadWorkers: 0,
 				maxBufferSizeInMb:  30,
 			},
+			nil,
+			nil,
+			nil,
 			mockSr,
 		)
 		assert.NoError(t, err)
@@ -157,12 +171,16 @@ func TestOpenFile(t *testing.T) {
 			log,
 			onClose,
 			mockCNzb,
+			nil,
 			fs,
 			downloadConfig{
 				maxDownloadRetries: 5,
 				maxDownloadWorkers: 1,
 				maxBufferSizeInMb:  30,
 			},
+			nil,
+			nil,
+			nil,
 			mockSr,
 		)
 
@@ -196,12 +214,16 @@ func TestOpenFile(t *testing.T) {
 			log,
 			onClose,
 			mockCNzb,
+			nil,
 			fs,
 			downloadConfig{
 				maxDownloadRetries: 5,
 				maxDownloadWorkers: 1,
 				maxBufferSizeInMb:  30,
 			},
+			nil,
+			nil,
+			nil,
 			mockSr,
 		)
 
@@ -231,12 +253,16 @@ func TestOpenFile(t *testing.T) {
 			log,
 			onClose,
 			mockCNzb,
+			nil,
 			fs,
 			downloadConfig{
 				maxDownloadRetries: 5,
 				maxDownloadWorkers: 1,
 				maxBufferSizeInMb:  30,
 			},
+			nil,
+			nil,
+			nil,
 			mockSr,
 		)
 
@@ -251,6 +277,63 @@ func TestOpenFile(t *testing.T) {
 		assert.True(t, ok)
 	})
 
+	t.Run("Every file uses the max read-ahead of its nzb", func(t *testing.T) {
+		content, err := os.ReadFile("../../test/nzbmock.xml")
+		assert.NoError(t, err)
+
+		dir := t.TempDir()
+		defaultPath := filepath.Join(dir, "default.mkv.nzb")
+		assert.NoError(t, os.WriteFile(defaultPath, content, 0644))
+		// A file that is only probed does not need a deep read-ahead
+		probedPath := filepath.Join(dir, "probed.mkv.nzb")
+		assert.NoError(t, os.WriteFile(probedPath, []byte(strings.Replace(
+			string(content),
+			"</head>",
+			`<meta type="max_read_ahead_segments">2</meta></head>`,
+			1,
+		)), 0644))
+
+		mockSr.EXPECT().StartDownload(gomock.Any(), gomock.Any()).Times(2)
+		mockSr.EXPECT().FinishDownload(gomock.Any()).Times(2)
+
+		open := func(path string) *file {
+			ok, f, err := openFile(
+				context.Background(),
+				path,
+				cp,
+				log,
+				func() error { return nil },
+				mockCNzb,
+				nil,
+				osfs.New(),
+				downloadConfig{
+					maxDownloadRetries:   5,
+					maxDownloadWorkers:   0,
+					maxBufferSizeInMb:    30,
+					maxReadAheadSegments: 16,
+				},
+				nil,
+				nil,
+				nil,
+				mockSr,
+			)
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			t.Cleanup(func() {
+				f.Close()
+			})
+
+			return f
+		}
+
+		defaultFile := open(defaultPath)
+		probedFile := open(probedPath)
+
+		assert.Equal(t, 16, defaultFile.buffer.(*buffer).readAhead.maxWindow)
+		assert.Equal(t, 16, cap(defaultFile.buffer.(*buffer).nextSegment))
+		assert.Equal(t, 2, probedFile.buffer.(*buffer).readAhead.maxWindow)
+		assert.Equal(t, 2, cap(probedFile.buffer.(*buffer).nextSegment))
+	})
 }
 
 func TestCloseFile(t *testing.T) {
@@ -385,7 +468,7 @@ func TestRead(t *testing.T) {
 		assert.Equal(t, n, n2)
 	})
 
-	t.Run("Mark file as corrupted on read error", func(t *testing.T) {
+	t.Run("Corrupted file is reported as truncated on read error", func(t *testing.T) {
 		f := &file{
 			path:     "test.nzb",
 			buffer:   mockBuffer,
@@ -402,8 +485,8 @@ func TestRead(t *testing.T) {
 		b := []byte("test")
 		n := len(b)
 
+		// The buffer already marked the file as corrupted
 		mockBuffer.EXPECT().Read(b).Return(n, ErrCorruptedNzb)
-		mockCNzb.EXPECT().Add(context.Background(), "test.nzb", "corrupted nzb").Return(nil)
 
 		n2, err := f.Read(b)
 		assert.Equal(t, n, n2)
@@ -445,7 +528,7 @@ func TestReadAt(t *testing.T) {
 		assert.Equal(t, n, n2)
 	})
 
-	t.Run("Mark file as corrupted on read at error", func(t *testing.T) {
+	t.Run("Corrupted file is reported as truncated on read at error", func(t *testing.T) {
 		f := &file{
 			path:     "test.nzb",
 			buffer:   mockBuffer,
@@ -463,8 +546,8 @@ func TestReadAt(t *testing.T) {
 		n := len(b)
 		offset := int64(10)
 
+		// The buffer already marked the file as corrupted
 		mockBuffer.EXPECT().ReadAt(b, offset).Return(n, ErrCorruptedNzb)
-		mockCNzb.EXPECT().Add(context.Background(), "test.nzb", "corrupted nzb").Return(nil)
 
 		n2, err := f.ReadAt(b, offset)
 		assert.Equal(t, n, n2)
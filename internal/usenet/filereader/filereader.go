@@ -6,21 +6,31 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
 	"github.com/javi11/usenet-drive/internal/usenet/corruptednzbsmanager"
+	"github.com/javi11/usenet-drive/internal/usenet/segmentcache"
 	status "github.com/javi11/usenet-drive/internal/usenet/statusreporter"
 	"github.com/javi11/usenet-drive/pkg/osfs"
 	"golang.org/x/net/webdav"
 )
 
 type fileReader struct {
+	// Protects the download config that can be changed by Reload
+	mx   sync.RWMutex
 	cp   connectionpool.UsenetConnectionPool
 	log  *slog.Logger
 	cNzb corruptednzbsmanager.CorruptedNzbsManager
+	sc   segmentcache.SegmentCache
 	fs   osfs.FileSystem
 	dc   downloadConfig
 	sr   status.StatusReporter
+	// Shared by the buffers of all the open files
+	budget  *bufferBudget
+	hedger  *hedger
+	indexer *segmentIndexer
+	open    *openFiles
 }
 
 func NewFileReader(options ...Option) (*fileReader, error) {
@@ -30,27 +40,82 @@ func NewFileReader(options ...Option) (*fileReader, error) {
 	}
 
 	return &fileReader{
-		cp:   config.cp,
-		log:  config.log,
-		cNzb: config.cNzb,
-		fs:   config.fs,
-		dc:   config.getDownloadConfig(),
-		sr:   config.sr,
+		cp:      config.cp,
+		log:     config.log,
+		cNzb:    config.cNzb,
+		sc:      config.segmentCache,
+		fs:      config.fs,
+		dc:      config.getDownloadConfig(),
+		sr:      config.sr,
+		budget:  newBufferBudget(int64(config.maxBufferSizeInMb) * 1024 * 1024),
+		hedger:  newHedger(config.hedgePercentile, config.maxHedgePercent),
+		indexer: newSegmentIndexer(config.segmentIndexRepository, config.fs, config.log),
+		open:    newOpenFiles(),
 	}, nil
 }
 
 func (fr *fileReader) OpenFile(ctx context.Context, path string, onClose func() error) (bool, webdav.File, error) {
-	return openFile(
+	fr.mx.RLock()
+	dc := fr.dc
+	fr.mx.RUnlock()
+
+	ok, f, err := openFile(
 		ctx,
 		path,
 		fr.cp,
 		fr.log.With("filename", path),
 		onClose,
 		fr.cNzb,
+		fr.sc,
 		fr.fs,
-		fr.dc,
+		dc,
+		fr.budget,
+		fr.hedger,
+		fr.indexer,
 		fr.sr,
 	)
+	if f == nil {
+		return ok, nil, err
+	}
+
+	fr.open.add(f)
+
+	return ok, f, err
+}
+
+// InvalidateNzb makes the open files of the nzb read it again after it was rewritten, the
+// segments not downloaded yet are read with their new message ids
+func (fr *fileReader) InvalidateNzb(ctx context.Context, nzbPath string) {
+	fr.open.reload(ctx, nzbPath, fr.log)
+}
+
+// Reload applies the given options to the files opened from now on, the files being
+// read keep the previous settings. Only the download settings can be changed.
+func (fr *fileReader) Reload(options ...Option) {
+	fr.mx.Lock()
+	defer fr.mx.Unlock()
+
+	config := &Config{
+		maxDownloadRetries:   fr.dc.maxDownloadRetries,
+		maxDownloadWorkers:   fr.dc.maxDownloadWorkers,
+		maxBufferSizeInMb:    fr.dc.maxBufferSizeInMb,
+		pipelineDepth:        fr.dc.pipelineDepth,
+		maxReadAheadSegments: fr.dc.maxReadAheadSegments,
+		hedgePercentile:      fr.dc.hedgePercentile,
+		maxHedgePercent:      fr.dc.maxHedgePercent,
+	}
+	for _, option := range options {
+		option(config)
+	}
+
+	fr.dc = config.getDownloadConfig()
+	fr.budget.setMaxSize(int64(fr.dc.maxBufferSizeInMb) * 1024 * 1024)
+	fr.hedger.setConfig(fr.dc.hedgePercentile, fr.dc.maxHedgePercent)
+}
+
+// GetBufferUsage returns the memory used by the read buffers of all the open files
+func (fr *fileReader) GetBufferUsage() BufferUsage {
+	return fr.budget.usage()
 }
 
 func (fr *fileReader) Stat(path string) (bool, fs.FileInfo, error) {
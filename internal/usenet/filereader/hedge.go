@@ -0,0 +1,330 @@
+package filereader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/javi11/usenet-drive/internal/metrics"
+	"github.com/javi11/usenet-drive/internal/usenet"
+	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
+	"github.com/javi11/usenet-drive/pkg/nntpcli"
+	"github.com/javi11/usenet-drive/pkg/nzb"
+)
+
+const (
+	// Latencies kept to compute the hedge delay
+	hedgeLatencySamples = 256
+	// Latencies needed before the requests are hedged
+	minHedgeLatencySamples = 20
+	// The counters of the hedge rate are halved every this number of requests, so the rate
+	// follows the recent requests
+	hedgeRateWindow = 1000
+)
+
+// hedger decides when a foreground download is requested again on another provider. The
+// request is hedged when it is slower than the given percentile of the recent downloads of
+// all the open files, and only while the hedged requests are under the given percentage of
+// the requests.
+type hedger struct {
+	mx sync.Mutex
+	// 0 disables the hedging
+	percentile      int
+	maxHedgePercent int
+	latencies       []time.Duration
+	next            int
+	requests        int
+	hedges          int
+}
+
+func newHedger(percentile, maxHedgePercent int) *hedger {
+	return &hedger{
+		percentile:      percentile,
+		maxHedgePercent: maxHedgePercent,
+		latencies:       make([]time.Duration, 0, hedgeLatencySamples),
+	}
+}
+
+// setConfig changes the settings, the latencies observed are kept
+func (h *hedger) setConfig(percentile, maxHedgePercent int) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	h.percentile = percentile
+	h.maxHedgePercent = maxHedgePercent
+}
+
+// delay returns how long to wait for a request before hedging it, false if the request
+// must not be hedged
+func (h *hedger) delay() (time.Duration, bool) {
+	if h == nil {
+		return 0, false
+	}
+
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if h.percentile <= 0 || h.maxHedgePercent <= 0 {
+		return 0, false
+	}
+
+	h.requests++
+	if h.requests >= hedgeRateWindow {
+		h.requests /= 2
+		h.hedges /= 2
+	}
+
+	if len(h.latencies) < minHedgeLatencySamples {
+		return 0, false
+	}
+
+	sorted := slices.Clone(h.latencies)
+	slices.Sort(sorted)
+	index := min(len(sorted)*min(h.percentile, 100)/100, len(sorted)-1)
+
+	return sorted[index], true
+}
+
+// allow reports whether a request can be hedged without going over the max hedge rate
+func (h *hedger) allow() bool {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if (h.hedges+1)*100 > h.requests*h.maxHedgePercent {
+		return false
+	}
+
+	h.hedges++
+
+	return true
+}
+
+// observe adds the latency of a completed download
+func (h *hedger) observe(d time.Duration) {
+	if h == nil {
+		return
+	}
+
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if len(h.latencies) < hedgeLatencySamples {
+		h.latencies = append(h.latencies, d)
+		return
+	}
+
+	h.latencies[h.next] = d
+	h.next = (h.next + 1) % hedgeLatencySamples
+}
+
+type bodyResult struct {
+	conn     connectionpool.Resource
+	provider nntpcli.Provider
+	err      error
+}
+
+// hedgedBody downloads the article with the given connection. When the download is slower
+// than the hedge delay the article is also requested on another provider, the first complete
+// response wins and the connection of the other one is closed to cancel it. It returns the
+// connection and provider of the response, the connections of the other request are released.
+func (b *buffer) hedgedBody(
+	ctx context.Context,
+	conn connectionpool.Resource,
+	segment nzb.NzbSegment,
+	groups []string,
+	chunk []byte,
+	excluded []string,
+) (connectionpool.Resource, nntpcli.Provider, error) {
+	nntpConn := conn.Value()
+	provider := nntpConn.Provider()
+
+	start := time.Now()
+	delay, ok := b.hedger.delay()
+	if !ok {
+		_, err := nntpConn.Body(segment.Id, chunk)
+		if isCompleteBody(err) {
+			b.hedger.observe(time.Since(start))
+		}
+
+		return conn, provider, err
+	}
+
+	primaryDone := make(chan error, 1)
+	go func() {
+		_, err := nntpConn.Body(segment.Id, chunk)
+		primaryDone <- err
+	}()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case err := <-primaryDone:
+		if isCompleteBody(err) {
+			b.hedger.observe(time.Since(start))
+		}
+
+		return conn, provider, err
+	case <-timer.C:
+	}
+
+	if !b.hedger.allow() {
+		err := <-primaryDone
+		if isCompleteBody(err) {
+			b.hedger.observe(time.Since(start))
+		}
+
+		return conn, provider, err
+	}
+
+	b.log.DebugContext(ctx, "Hedging slow segment download", "segment", segment.Id, "provider", provider.Host)
+
+	hedgeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// The connection of the hedged request, it is interrupted when the hedge is cancelled and
+	// closed by the hedge goroutine once its body returns
+	hedgeMx := sync.Mutex{}
+	var hedgeConn connectionpool.Resource
+	hedgeCancelled := false
+	// The hedged request can not write into chunk while the primary one may still be writing
+	hedgeBuffer := segmentBuffers.get(len(chunk))
+	defer hedgeBuffer.release()
+	hedgeChunk := hedgeBuffer.data
+	hedgeDone := make(chan bodyResult, 1)
+
+	go func() {
+		c, err := b.getDownloadConnection(
+			hedgeCtx,
+			connectionpool.PriorityForeground,
+			append(slices.Clone(excluded), provider.Id),
+		)
+		if err != nil {
+			hedgeDone <- bodyResult{err: err}
+			return
+		}
+
+		hedgeMx.Lock()
+		if hedgeCancelled {
+			hedgeMx.Unlock()
+			b.cp.Free(c)
+			hedgeDone <- bodyResult{err: hedgeCtx.Err()}
+
+			return
+		}
+		hedgeConn = c
+		hedgeMx.Unlock()
+
+		metrics.HedgedRequests.WithLabelValues("sent").Inc()
+
+		hc := c.Value()
+		hp := hc.Provider()
+
+		if hp.JoinGroup {
+			err = usenet.JoinGroup(hc, groups)
+		}
+		if err == nil {
+			_, err = hc.Body(segment.Id, hedgeChunk)
+		}
+
+		hedgeMx.Lock()
+		defer hedgeMx.Unlock()
+
+		hedgeConn = nil
+		if hedgeCancelled {
+			// The connection was interrupted, nothing uses it anymore
+			b.cp.Close(c)
+			hedgeDone <- bodyResult{err: context.Canceled}
+
+			return
+		}
+
+		if !isCompleteBody(err) {
+			b.releaseConnection(c, err)
+			hedgeDone <- bodyResult{err: err}
+
+			return
+		}
+
+		hedgeDone <- bodyResult{conn: c, provider: hp, err: err}
+	}()
+
+	cancelHedge := func() {
+		cancel()
+
+		hedgeMx.Lock()
+		hedgeCancelled = true
+		if hedgeConn != nil {
+			_ = hedgeConn.Value().Interrupt()
+		}
+		hedgeMx.Unlock()
+
+		<-hedgeDone
+	}
+
+	var primaryErr error
+	primaryFinished := false
+	hedgeFinished := false
+	for {
+		select {
+		case err := <-primaryDone:
+			primaryFinished = true
+			primaryErr = err
+
+			if isCompleteBody(err) || hedgeFinished {
+				if !hedgeFinished {
+					cancelHedge()
+				}
+				if isCompleteBody(err) {
+					b.hedger.observe(time.Since(start))
+					metrics.HedgedRequests.WithLabelValues("lost").Inc()
+				}
+
+				return conn, provider, err
+			}
+		case r := <-hedgeDone:
+			hedgeFinished = true
+
+			if r.conn != nil {
+				if primaryFinished {
+					b.releaseConnection(conn, primaryErr)
+				} else {
+					// Cancel the slow request, its chunk is not written once it returns and
+					// the connection is closed when nothing uses it
+					_ = nntpConn.Interrupt()
+					<-primaryDone
+					b.cp.Close(conn)
+				}
+
+				copy(chunk, hedgeChunk)
+				b.hedger.observe(time.Since(start))
+				metrics.HedgedRequests.WithLabelValues("won").Inc()
+
+				return r.conn, r.provider, r.err
+			}
+
+			if primaryFinished {
+				return conn, provider, primaryErr
+			}
+		}
+	}
+}
+
+// releaseConnection frees a connection that is still usable after the error, or closes it
+func (b *buffer) releaseConnection(conn connectionpool.Resource, err error) {
+	if isCompleteBody(err) || nntpcli.IsArticleNotFoundError(err) || errors.Is(err, nntpcli.ErrCorruptedArticle) {
+		b.cp.Free(conn)
+		return
+	}
+
+	b.cp.Close(conn)
+}
+
+// isCompleteBody reports whether a body was downloaded, the last segment can be shorter
+// than the chunk
+func isCompleteBody(err error) bool {
+	return err == nil || errors.Is(err, io.ErrUnexpectedEOF)
+}
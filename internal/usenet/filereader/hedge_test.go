@@ -0,0 +1,315 @@
+package filereader
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log/slog"
+	"net/textproto"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
+	"github.com/javi11/usenet-drive/pkg/nntpcli"
+	"github.com/javi11/usenet-drive/pkg/nntpserver"
+	"github.com/javi11/usenet-drive/pkg/nzb"
+	"github.com/javi11/usenet-drive/pkg/yenc"
+)
+
+func TestHedger(t *testing.T) {
+	t.Run("delay is the percentile of the observed latencies", func(t *testing.T) {
+		h := newHedger(90, 10)
+		for i := 1; i <= 100; i++ {
+			h.observe(time.Duration(i) * time.Millisecond)
+		}
+
+		delay, ok := h.delay()
+		assert.True(t, ok)
+		assert.Equal(t, 91*time.Millisecond, delay)
+	})
+
+	t.Run("requests are not hedged until there are enough latencies", func(t *testing.T) {
+		h := newHedger(90, 10)
+		for i := 0; i < minHedgeLatencySamples-1; i++ {
+			h.observe(time.Millisecond)
+		}
+
+		_, ok := h.delay()
+		assert.False(t, ok)
+
+		h.observe(time.Millisecond)
+
+		_, ok = h.delay()
+		assert.True(t, ok)
+	})
+
+	t.Run("old latencies are replaced", func(t *testing.T) {
+		h := newHedger(50, 10)
+		for i := 0; i < hedgeLatencySamples; i++ {
+			h.observe(time.Second)
+		}
+		for i := 0; i < hedgeLatencySamples; i++ {
+			h.observe(time.Millisecond)
+		}
+
+		delay, ok := h.delay()
+		assert.True(t, ok)
+		assert.Equal(t, time.Millisecond, delay)
+	})
+
+	t.Run("hedged requests are bounded by the max percent", func(t *testing.T) {
+		h := newHedger(50, 10)
+		for i := 0; i < minHedgeLatencySamples; i++ {
+			h.observe(time.Millisecond)
+		}
+
+		hedges := 0
+		for i := 0; i < 100; i++ {
+			_, ok := h.delay()
+			assert.True(t, ok)
+
+			if h.allow() {
+				hedges++
+			}
+		}
+
+		assert.Equal(t, 10, hedges)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		h := newHedger(0, 10)
+		for i := 0; i < minHedgeLatencySamples; i++ {
+			h.observe(time.Millisecond)
+		}
+
+		_, ok := h.delay()
+		assert.False(t, ok)
+
+		h.setConfig(90, 0)
+		_, ok = h.delay()
+		assert.False(t, ok)
+
+		h.setConfig(90, 10)
+		_, ok = h.delay()
+		assert.True(t, ok)
+
+		var nilHedger *hedger
+		nilHedger.observe(time.Millisecond)
+		_, ok = nilHedger.delay()
+		assert.False(t, ok)
+	})
+
+	t.Run("concurrent use of the hedger", func(t *testing.T) {
+		h := newHedger(50, 10)
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					h.observe(time.Millisecond)
+					if _, ok := h.delay(); ok {
+						h.allow()
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		_, ok := h.delay()
+		assert.True(t, ok)
+	})
+}
+
+func TestBuffer_hedgedBody(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	segment := nzb.NzbSegment{Id: "1", Number: 1, Bytes: 5}
+
+	newHedgedBuffer := func(cp connectionpool.UsenetConnectionPool) *buffer {
+		h := newHedger(50, 100)
+		for i := 0; i < minHedgeLatencySamples; i++ {
+			h.observe(time.Millisecond)
+		}
+
+		return &buffer{
+			cp:     cp,
+			log:    slog.Default(),
+			hedger: h,
+		}
+	}
+
+	newResource := func(providerId string) (*connectionpool.MockResource, *nntpcli.MockConnection) {
+		conn := nntpcli.NewMockConnection(ctrl)
+		conn.EXPECT().Provider().Return(nntpcli.Provider{Id: providerId}).AnyTimes()
+		resource := connectionpool.NewMockResource(ctrl)
+		resource.EXPECT().Value().Return(conn).AnyTimes()
+
+		return resource, conn
+	}
+
+	t.Run("the hedged request wins when the primary is slow", func(t *testing.T) {
+		mockPool := connectionpool.NewMockUsenetConnectionPool(ctrl)
+		buf := newHedgedBuffer(mockPool)
+
+		primary, primaryConn := newResource("primary")
+		hedge, hedgeConn := newResource("backup")
+
+		interrupted := make(chan struct{})
+		primaryConn.EXPECT().Body("1", gomock.Any()).DoAndReturn(func(_ string, _ []byte) (int, error) {
+			<-interrupted
+			return 0, errors.New("use of closed network connection")
+		}).Times(1)
+		// The connection is closed once its body returns
+		primaryConn.EXPECT().Interrupt().DoAndReturn(func() error {
+			close(interrupted)
+			return nil
+		}).Times(1)
+		mockPool.EXPECT().Close(primary).Times(1)
+
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(hedge, nil).Times(1)
+		hedgeConn.EXPECT().Body("1", gomock.Any()).DoAndReturn(func(_ string, chunk []byte) (int, error) {
+			copy(chunk, "hedge")
+			return 5, nil
+		}).Times(1)
+
+		chunk := make([]byte, 5)
+		conn, provider, err := buf.hedgedBody(context.Background(), primary, segment, nil, chunk, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, hedge, conn)
+		assert.Equal(t, "backup", provider.Id)
+		assert.Equal(t, []byte("hedge"), chunk)
+	})
+
+	t.Run("the primary is used when the hedged request fails", func(t *testing.T) {
+		mockPool := connectionpool.NewMockUsenetConnectionPool(ctrl)
+		buf := newHedgedBuffer(mockPool)
+
+		primary, primaryConn := newResource("primary")
+		hedge, hedgeConn := newResource("backup")
+
+		hedgeFailed := make(chan struct{})
+		primaryConn.EXPECT().Body("1", gomock.Any()).DoAndReturn(func(_ string, chunk []byte) (int, error) {
+			<-hedgeFailed
+			copy(chunk, "body1")
+			return 5, nil
+		}).Times(1)
+
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(hedge, nil).Times(1)
+		hedgeConn.EXPECT().Body("1", gomock.Any()).
+			Return(0, &textproto.Error{Code: nntpcli.ArticleNotFoundErrCode, Msg: "No Such Article"}).
+			Times(1)
+		mockPool.EXPECT().Free(hedge).Do(func(_ connectionpool.Resource) {
+			close(hedgeFailed)
+		}).Times(1)
+
+		chunk := make([]byte, 5)
+		conn, provider, err := buf.hedgedBody(context.Background(), primary, segment, nil, chunk, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, primary, conn)
+		assert.Equal(t, "primary", provider.Id)
+		assert.Equal(t, []byte("body1"), chunk)
+	})
+
+	t.Run("fast requests are not hedged", func(t *testing.T) {
+		mockPool := connectionpool.NewMockUsenetConnectionPool(ctrl)
+		buf := newHedgedBuffer(mockPool)
+
+		// Slow enough latencies so the request is never hedged
+		for i := 0; i < hedgeLatencySamples; i++ {
+			buf.hedger.observe(time.Hour)
+		}
+
+		primary, primaryConn := newResource("primary")
+		primaryConn.EXPECT().Body("1", gomock.Any()).DoAndReturn(func(_ string, chunk []byte) (int, error) {
+			copy(chunk, "body1")
+			return 5, nil
+		}).Times(1)
+
+		chunk := make([]byte, 5)
+		conn, _, err := buf.hedgedBody(context.Background(), primary, segment, nil, chunk, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, primary, conn)
+		assert.Equal(t, []byte("body1"), chunk)
+	})
+}
+
+func TestBuffer_hedgedBody_realConnections(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	server, err := nntpserver.New()
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		server.Close()
+	})
+
+	data := make([]byte, 200000)
+	_, err = rand.Read(data)
+	assert.NoError(t, err)
+
+	article := bytes.NewBufferString(fmt.Sprintf(
+		"From: poster@example.com\r\nNewsgroups: alt.binaries.test\r\nMessage-ID: <1@test>\r\nSubject: test\r\n\r\n"+
+			"=ybegin part=1 total=1 line=128 size=%d name=test.bin\r\n=ypart begin=1 end=%d\r\n",
+		len(data),
+		len(data),
+	))
+	assert.NoError(t, yenc.Encode(data, article))
+	article.WriteString(fmt.Sprintf("=yend size=%d part=1 pcrc32=%08X\r\n", len(data), crc32.ChecksumIEEE(data)))
+	assert.NoError(t, server.AddArticle(article.Bytes()))
+
+	// The primary request is left in the middle of the body
+	server.InjectFault(nntpserver.Fault{Kind: nntpserver.FaultStalledBody, Command: "BODY", Times: 1, Delay: 500 * time.Millisecond})
+
+	dial := func(providerId string) *connectionpool.MockResource {
+		conn, err := nntpcli.New(nntpcli.WithTimeout(5*time.Second)).Dial(context.Background(), nntpcli.Provider{
+			Host: server.Host(),
+			Port: server.Port(),
+			Id:   providerId,
+		}, time.Now().Add(time.Hour))
+		assert.NoError(t, err)
+
+		resource := connectionpool.NewMockResource(ctrl)
+		resource.EXPECT().Value().Return(conn).AnyTimes()
+
+		return resource
+	}
+
+	primary := dial("primary")
+	hedge := dial("backup")
+	t.Cleanup(func() {
+		hedge.Value().Close()
+	})
+
+	mockPool := connectionpool.NewMockUsenetConnectionPool(ctrl)
+	mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(hedge, nil).Times(1)
+	// Like the destructor of the pool, the connection is closed while nothing else uses it
+	mockPool.EXPECT().Close(primary).Do(func(r connectionpool.Resource) {
+		r.Value().Close()
+	}).Times(1)
+
+	h := newHedger(50, 100)
+	for i := 0; i < minHedgeLatencySamples; i++ {
+		h.observe(time.Millisecond)
+	}
+	buf := &buffer{
+		cp:     mockPool,
+		log:    slog.Default(),
+		hedger: h,
+	}
+
+	chunk := make([]byte, len(data))
+	conn, provider, err := buf.hedgedBody(context.Background(), primary, nzb.NzbSegment{Id: "1@test", Number: 1}, nil, chunk, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, hedge, conn)
+	assert.Equal(t, "backup", provider.Id)
+	assert.Equal(t, data, chunk)
+}
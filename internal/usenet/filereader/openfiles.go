@@ -0,0 +1,61 @@
+package filereader
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"sync"
+)
+
+// openFiles are the files being read by nzb path, they read again their nzb when it is
+// rewritten
+type openFiles struct {
+	mx    sync.Mutex
+	files map[string]map[*file]struct{}
+}
+
+func newOpenFiles() *openFiles {
+	return &openFiles{
+		files: map[string]map[*file]struct{}{},
+	}
+}
+
+func (o *openFiles) add(f *file) {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	path := filepath.Clean(f.nzbPath)
+	if o.files[path] == nil {
+		o.files[path] = map[*file]struct{}{}
+	}
+
+	o.files[path][f] = struct{}{}
+	f.open = o
+}
+
+func (o *openFiles) remove(f *file) {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	path := filepath.Clean(f.nzbPath)
+	delete(o.files[path], f)
+	if len(o.files[path]) == 0 {
+		delete(o.files, path)
+	}
+}
+
+// reload reads again the nzb in all the files that have it open. The lock is kept so a file
+// is not closed while its nzb is reloaded.
+func (o *openFiles) reload(ctx context.Context, nzbPath string, log *slog.Logger) {
+	o.mx.Lock()
+	defer o.mx.Unlock()
+
+	for f := range o.files[filepath.Clean(nzbPath)] {
+		if err := f.reloadNzb(ctx); err != nil {
+			log.ErrorContext(ctx, "Error reloading the rewritten nzb", "path", nzbPath, "error", err)
+			continue
+		}
+
+		log.DebugContext(ctx, "Nzb reloaded by an open file", "path", nzbPath)
+	}
+}
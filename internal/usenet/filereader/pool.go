@@ -0,0 +1,73 @@
+package filereader
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// segmentBuffers reuses the memory of the segments of all the open files
+var segmentBuffers = &segmentPool{}
+
+// segmentPool reuses segment buffers, they are grouped by size since the chunk size
+// depends on the file.
+type segmentPool struct {
+	pools sync.Map
+}
+
+// segmentBuffer is the memory of a downloaded segment. It is reference counted, every owner
+// of the buffer, the segments buffer of a file or a read that is copying it, holds one
+// reference and the memory is reused only once all of them are released.
+type segmentBuffer struct {
+	pool *segmentPool
+	data []byte
+	refs atomic.Int32
+}
+
+// get returns a zeroed buffer of the given size with one reference, owned by the caller
+func (sp *segmentPool) get(size int) *segmentBuffer {
+	p, _ := sp.pools.LoadOrStore(size, &sync.Pool{})
+
+	s, ok := p.(*sync.Pool).Get().(*segmentBuffer)
+	if !ok {
+		s = &segmentBuffer{pool: sp, data: make([]byte, size)}
+	} else {
+		// The last segment of a file is shorter than the chunk, its padding must be zeroes
+		clear(s.data)
+	}
+	s.refs.Store(1)
+
+	return s
+}
+
+func (sp *segmentPool) put(s *segmentBuffer) {
+	if p, ok := sp.pools.Load(len(s.data)); ok {
+		p.(*sync.Pool).Put(s)
+	}
+}
+
+// tryRetain adds a reference to a buffer that is still owned, it reports false when the
+// buffer was already released.
+func (s *segmentBuffer) tryRetain() bool {
+	for {
+		refs := s.refs.Load()
+		if refs <= 0 {
+			return false
+		}
+
+		if s.refs.CompareAndSwap(refs, refs+1) {
+			return true
+		}
+	}
+}
+
+// release drops a reference, the buffer returns to the pool with the last one
+func (s *segmentBuffer) release() {
+	refs := s.refs.Add(-1)
+	if refs < 0 {
+		panic("filereader: segment buffer released more times than retained")
+	}
+
+	if refs == 0 {
+		s.pool.put(s)
+	}
+}
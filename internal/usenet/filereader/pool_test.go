@@ -0,0 +1,116 @@
+package filereader
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/javi11/usenet-drive/pkg/nzb"
+)
+
+func newTestSegment(data string) *segmentBuffer {
+	segment := segmentBuffers.get(len(data))
+	copy(segment.data, data)
+
+	return segment
+}
+
+func TestSegmentPool(t *testing.T) {
+	t.Run("buffers are zeroed when they are reused", func(t *testing.T) {
+		pool := &segmentPool{}
+
+		segment := pool.get(5)
+		copy(segment.data, "body1")
+		segment.release()
+
+		segment = pool.get(5)
+		assert.Equal(t, make([]byte, 5), segment.data)
+		assert.Equal(t, int32(1), segment.refs.Load())
+	})
+
+	t.Run("released buffers can not be retained", func(t *testing.T) {
+		segment := (&segmentPool{}).get(5)
+
+		assert.True(t, segment.tryRetain())
+		segment.release()
+		segment.release()
+
+		assert.False(t, segment.tryRetain())
+		assert.Panics(t, segment.release)
+	})
+
+	t.Run("buffers are grouped by size", func(t *testing.T) {
+		pool := &segmentPool{}
+
+		pool.get(5).release()
+
+		assert.Len(t, pool.get(10).data, 10)
+		assert.Len(t, pool.get(5).data, 5)
+	})
+}
+
+func TestBuffer_segmentOwnership(t *testing.T) {
+	newBuffer := func() *buffer {
+		budget := newBufferBudget(0)
+		b := &buffer{segmentsBuffer: &sync.Map{}, chunkSize: 5, budget: budget}
+		budget.register(b)
+
+		return b
+	}
+
+	t.Run("a segment removed while it is read is not reused", func(t *testing.T) {
+		pool := &segmentPool{}
+		b := newBuffer()
+
+		stored := pool.get(5)
+		copy(stored.data, "body1")
+		b.budget.reserve(b, 5)
+		b.storeSegment(0, stored)
+
+		segment, ok := b.loadSegment(0)
+		assert.True(t, ok)
+
+		// Evicted by a seek or by the reads of another file
+		b.dropSegment(0)
+		_, ok = b.loadSegment(0)
+		assert.False(t, ok)
+
+		for i := 0; i < 10; i++ {
+			assert.NotSame(t, segment, pool.get(5))
+		}
+		assert.Equal(t, []byte("body1"), segment.data)
+		assert.Equal(t, int64(0), b.budget.usage().UsedBytes)
+
+		segment.release()
+		assert.False(t, segment.tryRetain())
+	})
+
+	t.Run("the duplicated segments are released", func(t *testing.T) {
+		b := newBuffer()
+
+		b.budget.reserve(b, 5)
+		b.storeSegment(0, newTestSegment("body1"))
+
+		duplicated := newTestSegment("body1")
+		b.budget.reserve(b, 5)
+		b.storeSegment(0, duplicated)
+
+		assert.False(t, duplicated.tryRetain())
+		assert.Equal(t, int64(5), b.budget.usage().UsedBytes)
+	})
+
+	t.Run("closing the buffer releases its segments", func(t *testing.T) {
+		b := newBuffer()
+		b.nextSegment = make(chan nzb.NzbSegment)
+		b.wg = &sync.WaitGroup{}
+
+		segment := newTestSegment("body1")
+		b.budget.reserve(b, 5)
+		b.storeSegment(0, segment)
+
+		assert.NoError(t, b.Close())
+		assert.False(t, segment.tryRetain())
+		assert.Equal(t, int64(0), b.budget.usage().UsedBytes)
+	})
+}
@@ -0,0 +1,42 @@
+package filereader
+
+import "sync"
+
+// readAhead sizes the prefetch window of a file from its access pattern. Sequential reads
+// double the window up to the max, a random access disables the prefetch until the reads
+// are sequential again.
+type readAhead struct {
+	mx        sync.Mutex
+	window    int
+	maxWindow int
+	// Last segment read, -1 before the first read
+	lastSegment int
+}
+
+func newReadAhead(initialWindow, maxWindow int) *readAhead {
+	return &readAhead{
+		window:      max(min(initialWindow, maxWindow), 0),
+		maxWindow:   max(maxWindow, 0),
+		lastSegment: -1,
+	}
+}
+
+// update records a read from the first to the last segment and returns the number of
+// segments to prefetch from the first one
+func (ra *readAhead) update(first, last int) int {
+	ra.mx.Lock()
+	defer ra.mx.Unlock()
+
+	switch {
+	case ra.lastSegment == -1 || first == ra.lastSegment:
+		// First read or still reading the same segment
+	case first == ra.lastSegment+1:
+		ra.window = min(max(ra.window*2, 1), ra.maxWindow)
+	default:
+		ra.window = 0
+	}
+
+	ra.lastSegment = last
+
+	return ra.window
+}
@@ -0,0 +1,143 @@
+package filereader
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/javi11/usenet-drive/internal/usenet/nzbloader"
+	"github.com/javi11/usenet-drive/pkg/nzb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadAhead(t *testing.T) {
+	t.Run("sequential reads grow the window up to the max", func(t *testing.T) {
+		ra := newReadAhead(2, 8)
+
+		assert.Equal(t, 2, ra.update(0, 0))
+		// Reads within the same segment keep the window
+		assert.Equal(t, 2, ra.update(0, 0))
+		assert.Equal(t, 4, ra.update(1, 1))
+		assert.Equal(t, 8, ra.update(2, 3))
+		assert.Equal(t, 8, ra.update(4, 4))
+	})
+
+	t.Run("random reads disable the prefetch", func(t *testing.T) {
+		ra := newReadAhead(2, 8)
+
+		assert.Equal(t, 2, ra.update(0, 0))
+		assert.Equal(t, 0, ra.update(40, 40))
+		assert.Equal(t, 0, ra.update(10, 10))
+
+		// It grows again once the reads are sequential
+		assert.Equal(t, 1, ra.update(11, 11))
+		assert.Equal(t, 2, ra.update(12, 12))
+	})
+
+	t.Run("the initial window is capped by the max", func(t *testing.T) {
+		ra := newReadAhead(5, 3)
+
+		assert.Equal(t, 3, ra.update(0, 0))
+	})
+}
+
+func TestBuffer_preloadSegments(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	newBuffer := func(queueSize int) *buffer {
+		nzbReader := nzbloader.NewMockNzbReader(ctrl)
+		nzbReader.EXPECT().GetSegment(gomock.Any()).DoAndReturn(func(index int) (nzb.NzbSegment, bool) {
+			return nzb.NzbSegment{Id: fmt.Sprint(index + 1), Number: int64(index + 1)}, index < 10
+		}).AnyTimes()
+
+		return &buffer{
+			nzbReader:          nzbReader,
+			segmentsBuffer:     &sync.Map{},
+			chunkSize:          5,
+			dc:                 downloadConfig{maxDownloadWorkers: 1, maxReadAheadSegments: 4},
+			log:                slog.Default(),
+			nextSegment:        make(chan nzb.NzbSegment, queueSize),
+			currentDownloading: &sync.Map{},
+		}
+	}
+
+	queuedIds := func(buf *buffer) []string {
+		var ids []string
+		for len(buf.nextSegment) > 0 {
+			ids = append(ids, (<-buf.nextSegment).Id)
+		}
+
+		return ids
+	}
+
+	t.Run("the whole window is in flight", func(t *testing.T) {
+		buf := newBuffer(4)
+		buf.segmentsBuffer.Store(0, segmentBuffers.get(5))
+		buf.currentDownloading.Store(int64(3), true)
+
+		buf.preloadSegments(0, 4)
+		// The next read does not queue them again
+		buf.preloadSegments(1, 4)
+
+		// The buffered and downloading segments are skipped
+		assert.Equal(t, []string{"2", "4", "5"}, queuedIds(buf))
+	})
+
+	t.Run("the segments taken by a worker can be queued again", func(t *testing.T) {
+		buf := newBuffer(4)
+
+		buf.preloadSegments(0, 2)
+		assert.Equal(t, []string{"1", "2"}, queuedIds(buf))
+		buf.queued.Delete(int64(1))
+		buf.queued.Delete(int64(2))
+
+		buf.preloadSegments(0, 2)
+		assert.Equal(t, []string{"1", "2"}, queuedIds(buf))
+	})
+
+	t.Run("a full queue does not wait for the workers", func(t *testing.T) {
+		buf := newBuffer(1)
+
+		buf.preloadSegments(0, 4)
+		assert.Equal(t, []string{"1"}, queuedIds(buf))
+
+		// The segments that did not fit are queued by the next read
+		buf.queued.Delete(int64(1))
+		buf.preloadSegments(1, 4)
+		assert.Equal(t, []string{"2"}, queuedIds(buf))
+	})
+}
+
+func TestNewBuffer_readAheadQueue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	nzbReader := nzbloader.NewMockNzbReader(ctrl)
+	nzbReader.EXPECT().GetGroups().Return([]string{"alt.binaries.test"}, nil).Times(1)
+
+	b, err := NewBuffer(
+		context.Background(),
+		nzbReader,
+		100,
+		5,
+		0,
+		20,
+		downloadConfig{maxDownloadWorkers: 2, maxReadAheadSegments: 16},
+		newBufferBudget(1024),
+		nil,
+		nil,
+		nil,
+		nil,
+		"file.nzb",
+		slog.Default(),
+	)
+	assert.NoError(t, err)
+	defer b.Close()
+
+	// The whole read-ahead window fits in the queue of the workers
+	assert.Equal(t, 16, cap(b.(*buffer).nextSegment))
+}
@@ -0,0 +1,276 @@
+package filereader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
+	"github.com/javi11/usenet-drive/pkg/nzb"
+	"github.com/javi11/usenet-drive/pkg/par2"
+)
+
+// Recovery slices downloaded on top of the missing segments, the other segments of the file
+// can be found missing while it is repaired
+const extraRecoverySlices = 4
+
+// segmentRepair reconstructs the segments that no provider has from the par2 recovery slices
+// of their recovery set. A repair downloads all the other segments of the set, so the repairs
+// are done one at a time and the repaired segments are kept until the file is closed.
+type segmentRepair struct {
+	mx       sync.Mutex
+	repaired map[int][]byte
+	// The sets are not repaired again once there were not enough recovery slices
+	errs map[int]error
+}
+
+func (b *buffer) repairSegment(
+	ctx context.Context,
+	segment nzb.NzbSegment,
+	groups []string,
+	chunk []byte,
+	priority connectionpool.Priority,
+) error {
+	index := segmentIndexFromSegmentNumber(segment.Number)
+
+	b.repair.mx.Lock()
+	defer b.repair.mx.Unlock()
+
+	if data, ok := b.repair.repaired[index]; ok {
+		copy(chunk, data)
+		return nil
+	}
+
+	set := index / b.recoverySetSize
+	if err := b.repair.errs[set]; err != nil {
+		return err
+	}
+
+	b.log.InfoContext(ctx, "Repairing missing segment with par2", "segment", segment.Id, "set", set)
+
+	repaired, err := b.reconstructSegments(ctx, set, index, groups, priority)
+	if err != nil {
+		if errors.Is(err, par2.ErrNotEnoughBlocks) {
+			if b.repair.errs == nil {
+				b.repair.errs = map[int]error{}
+			}
+			b.repair.errs[set] = err
+		}
+
+		return err
+	}
+
+	if b.repair.repaired == nil {
+		b.repair.repaired = map[int][]byte{}
+	}
+	for i, data := range repaired {
+		b.repair.repaired[i] = data
+	}
+	copy(chunk, repaired[index])
+
+	return nil
+}
+
+// reconstructSegments repairs the segment and any other missing segment of its recovery set.
+// The segments are numbered from the first one of the set for the repairer.
+func (b *buffer) reconstructSegments(
+	ctx context.Context,
+	set int,
+	index int,
+	groups []string,
+	priority connectionpool.Priority,
+) (map[int][]byte, error) {
+	sliceSize := par2.SliceSize(b.chunkSize)
+	first := set * b.recoverySetSize
+	segments := min(b.recoverySetSize, (b.fileSize+b.chunkSize-1)/b.chunkSize-first)
+
+	missing := []int{index - first}
+	k := min(b.recoverySlices, len(missing)+extraRecoverySlices)
+	for {
+		recovery, err := b.downloadRecoverySlices(ctx, set, k, sliceSize, groups, priority)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(recovery) >= len(missing) {
+			exponents := make([]int, 0, len(recovery))
+			for exponent := range recovery {
+				exponents = append(exponents, exponent)
+			}
+			sort.Ints(exponents)
+
+			repairer, err := par2.NewRepairer(sliceSize, segments, exponents)
+			if err != nil {
+				return nil, err
+			}
+
+			missing, err = b.addAvailableSegments(ctx, repairer, first, index, segments, groups, priority)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(missing) <= len(recovery) {
+				repaired, err := repairer.Reconstruct(missing, recovery)
+				if err != nil {
+					return nil, err
+				}
+
+				segmentsRepaired := make(map[int][]byte, len(repaired))
+				for i, data := range repaired {
+					segmentsRepaired[first+i] = data[:b.chunkSize]
+					if s, ok := b.nzb().GetSegment(first + i); ok {
+						b.cacheSegment(s, segmentsRepaired[first+i])
+					}
+				}
+
+				b.log.InfoContext(ctx, "Segments repaired with par2", "segments", len(missing), "set", set)
+
+				return segmentsRepaired, nil
+			}
+		}
+
+		// Some recovery slices or other segments are missing too, try again with more slices
+		next := min(b.recoverySlices, k+max(len(missing)-len(recovery), extraRecoverySlices))
+		if next <= k {
+			return nil, fmt.Errorf(
+				"%d segments missing, %d recovery slices available: %w",
+				len(missing),
+				len(recovery),
+				par2.ErrNotEnoughBlocks,
+			)
+		}
+		k = next
+	}
+}
+
+// downloadRecoverySlices downloads the first n recovery slices of the set, the ones missing
+// or corrupted are skipped. They are returned by exponent.
+func (b *buffer) downloadRecoverySlices(
+	ctx context.Context,
+	set int,
+	n int,
+	sliceSize int,
+	groups []string,
+	priority connectionpool.Priority,
+) (map[int][]byte, error) {
+	mx := sync.Mutex{}
+	recovery := map[int][]byte{}
+
+	err := b.forEachSegment(ctx, n, func(ctx context.Context, i int) error {
+		segment, ok := b.nzb().GetRecoverySegment(set*b.recoverySlices + i)
+		if !ok {
+			return nil
+		}
+
+		packet := make([]byte, sliceSize+par2.RecoveryPacketOverhead)
+		err := b.downloadArticle(ctx, segment, groups, packet, priority)
+		if err != nil {
+			if errors.Is(err, ErrCorruptedNzb) {
+				b.log.WarnContext(ctx, "Missing par2 recovery slice", "segment", segment.Id, "error", err)
+				return nil
+			}
+
+			return err
+		}
+
+		exponent, data, err := par2.ParseRecoveryPacket(packet)
+		if err != nil {
+			b.log.WarnContext(ctx, "Invalid par2 recovery slice", "segment", segment.Id, "error", err)
+			return nil
+		}
+
+		mx.Lock()
+		defer mx.Unlock()
+		recovery[exponent] = data
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return recovery, nil
+}
+
+// addAvailableSegments downloads the segments of the set that starts at first, but the one
+// being repaired, and adds them to the repairer. It returns the segments of the set that are
+// missing.
+func (b *buffer) addAvailableSegments(
+	ctx context.Context,
+	repairer *par2.Repairer,
+	first int,
+	index int,
+	segments int,
+	groups []string,
+	priority connectionpool.Priority,
+) ([]int, error) {
+	mx := sync.Mutex{}
+	missing := []int{index - first}
+
+	err := b.forEachSegment(ctx, segments, func(ctx context.Context, i int) error {
+		if first+i == index {
+			return nil
+		}
+
+		segment, ok := b.nzb().GetSegment(first + i)
+		if ok {
+			chunk := make([]byte, b.chunkSize)
+			err := b.downloadArticle(ctx, segment, groups, chunk, priority)
+			if err == nil {
+				return repairer.AddSlice(i, chunk)
+			}
+
+			if !errors.Is(err, ErrCorruptedNzb) {
+				return err
+			}
+		}
+
+		mx.Lock()
+		defer mx.Unlock()
+		missing = append(missing, i)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Ints(missing)
+
+	return missing, nil
+}
+
+// forEachSegment calls fn for the indexes from 0 to n, with as many goroutines as download
+// workers. It stops on the first error.
+func (b *buffer) forEachSegment(ctx context.Context, n int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < max(b.dc.maxDownloadWorkers, 1); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				if err := fn(ctx, i); err != nil {
+					cancel(err)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	return context.Cause(ctx)
+}
@@ -0,0 +1,136 @@
+package filereader
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
+	"github.com/javi11/usenet-drive/internal/usenet/nzbloader"
+	"github.com/javi11/usenet-drive/internal/usenet/segmentcache"
+	"github.com/javi11/usenet-drive/pkg/nzb"
+	"github.com/javi11/usenet-drive/pkg/par2"
+)
+
+func TestBuffer_repairSegment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	chunkSize := 10
+	data := []byte("0123456789abcdefghijklmnopqrst")
+	segments := []nzb.NzbSegment{{Id: "s1", Number: 1}, {Id: "s2", Number: 2}, {Id: "s3", Number: 3}}
+
+	encoder, err := par2.NewEncoder(par2.SliceSize(chunkSize), 1)
+	require.NoError(t, err)
+	for i := 0; i < len(data); i += chunkSize {
+		require.NoError(t, encoder.Add(data[i:i+chunkSize]))
+	}
+	packet := encoder.Volume("test").RecoveryPackets[0]
+
+	newBuffer := func(nzbReader nzbloader.NzbReader, sc segmentcache.SegmentCache, recoverySetSize int) *buffer {
+		// No provider has the articles that are not cached
+		mockPool := connectionpool.NewMockUsenetConnectionPool(ctrl)
+		mockPool.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).
+			Return(nil, connectionpool.ErrNoProviderAvailable).AnyTimes()
+
+		for i, s := range segments {
+			nzbReader.(*nzbloader.MockNzbReader).EXPECT().GetSegment(i).Return(s, true).AnyTimes()
+		}
+
+		return &buffer{
+			ctx:             context.Background(),
+			fileSize:        len(data),
+			nzbReader:       nzbReader,
+			nzbGroups:       []string{"group1"},
+			segmentsBuffer:  &sync.Map{},
+			cp:              mockPool,
+			chunkSize:       chunkSize,
+			recoverySlices:  1,
+			recoverySetSize: recoverySetSize,
+			dc: downloadConfig{
+				maxDownloadRetries: 1,
+				maxDownloadWorkers: 2,
+			},
+			log:                slog.Default(),
+			currentDownloading: &sync.Map{},
+			segmentCache:       sc,
+		}
+	}
+
+	cached := func(b []byte) func(string, []byte) bool {
+		return func(_ string, chunk []byte) bool {
+			copy(chunk, b)
+			return true
+		}
+	}
+
+	t.Run("Missing segment repaired from the recovery slices", func(t *testing.T) {
+		nzbReader := nzbloader.NewMockNzbReader(ctrl)
+		sc := segmentcache.NewMockSegmentCache(ctrl)
+		buf := newBuffer(nzbReader, sc, len(segments))
+
+		nzbReader.EXPECT().GetRecoverySegment(0).Return(nzb.NzbSegment{Id: "r1", Number: 1}, true).Times(1)
+		sc.EXPECT().Get("r1", gomock.Any()).DoAndReturn(cached(packet)).Times(1)
+		sc.EXPECT().Get("s1", gomock.Any()).DoAndReturn(cached(data[0:10])).Times(1)
+		sc.EXPECT().Get("s3", gomock.Any()).DoAndReturn(cached(data[20:30])).Times(1)
+		sc.EXPECT().Get("s2", gomock.Any()).Return(false).Times(2)
+		// The repaired segment is cached
+		sc.EXPECT().Put("s2", data[10:20]).Return(nil).Times(1)
+
+		chunk := make([]byte, chunkSize)
+		err := buf.downloadSegment(context.Background(), segments[1], buf.nzbGroups, chunk, connectionpool.PriorityForeground)
+		require.NoError(t, err)
+		assert.Equal(t, data[10:20], chunk)
+
+		// The repaired segment is kept
+		chunk = make([]byte, chunkSize)
+		err = buf.downloadSegment(context.Background(), segments[1], buf.nzbGroups, chunk, connectionpool.PriorityForeground)
+		require.NoError(t, err)
+		assert.Equal(t, data[10:20], chunk)
+	})
+
+	t.Run("Only the recovery set of the segment is downloaded", func(t *testing.T) {
+		nzbReader := nzbloader.NewMockNzbReader(ctrl)
+		sc := segmentcache.NewMockSegmentCache(ctrl)
+		buf := newBuffer(nzbReader, sc, 2)
+
+		// The sets are s1 and s2, and s3
+		setEncoder, err := par2.NewEncoder(par2.SliceSize(chunkSize), 1)
+		require.NoError(t, err)
+		require.NoError(t, setEncoder.Add(data[20:30]))
+		setPacket := setEncoder.Volume("test.1").RecoveryPackets[0]
+
+		nzbReader.EXPECT().GetRecoverySegment(1).Return(nzb.NzbSegment{Id: "r2", Number: 2}, true).Times(1)
+		sc.EXPECT().Get("r2", gomock.Any()).DoAndReturn(cached(setPacket)).Times(1)
+		sc.EXPECT().Get("s3", gomock.Any()).Return(false).Times(1)
+		sc.EXPECT().Put("s3", data[20:30]).Return(nil).Times(1)
+
+		chunk := make([]byte, chunkSize)
+		err = buf.downloadSegment(context.Background(), segments[2], buf.nzbGroups, chunk, connectionpool.PriorityForeground)
+		require.NoError(t, err)
+		assert.Equal(t, data[20:30], chunk)
+	})
+
+	t.Run("Not enough recovery slices", func(t *testing.T) {
+		nzbReader := nzbloader.NewMockNzbReader(ctrl)
+		sc := segmentcache.NewMockSegmentCache(ctrl)
+		buf := newBuffer(nzbReader, sc, len(segments))
+
+		nzbReader.EXPECT().GetRecoverySegment(0).Return(nzb.NzbSegment{}, false).Times(1)
+		sc.EXPECT().Get("s2", gomock.Any()).Return(false).Times(2)
+
+		chunk := make([]byte, chunkSize)
+		err := buf.downloadSegment(context.Background(), segments[1], buf.nzbGroups, chunk, connectionpool.PriorityForeground)
+		assert.ErrorIs(t, err, ErrCorruptedNzb)
+		assert.ErrorIs(t, err, par2.ErrNotEnoughBlocks)
+
+		// The file is not repaired again
+		err = buf.downloadSegment(context.Background(), segments[1], buf.nzbGroups, chunk, connectionpool.PriorityForeground)
+		assert.ErrorIs(t, err, par2.ErrNotEnoughBlocks)
+	})
+}
@@ -0,0 +1,92 @@
+package filereader
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/javi11/usenet-drive/internal/usenet/nzbloader"
+	"github.com/javi11/usenet-drive/pkg/osfs"
+)
+
+// segmentIndexer finds the segments of the opened nzbs in their segment index, so a seek does
+// not parse the nzb up to the segment. The index of an nzb is built in the background the
+// first time it is opened, and again when the nzb changes.
+type segmentIndexer struct {
+	repository nzbloader.SegmentIndexRepository
+	fs         osfs.FileSystem
+	log        *slog.Logger
+	// Paths of the nzbs whose index is being built
+	building sync.Map
+}
+
+func newSegmentIndexer(repository nzbloader.SegmentIndexRepository, fs osfs.FileSystem, log *slog.Logger) *segmentIndexer {
+	if repository == nil {
+		return nil
+	}
+
+	return &segmentIndexer{
+		repository: repository,
+		fs:         fs,
+		log:        log,
+	}
+}
+
+// nzbReader returns a reader of the nzb that uses its index, if it is up to date
+func (si *segmentIndexer) nzbReader(ctx context.Context, path string, info os.FileInfo, reader io.Reader) nzbloader.NzbReader {
+	if si == nil {
+		return nzbloader.NewNzbReader(reader)
+	}
+
+	index, err := si.repository.Get(ctx, path, info)
+	if err != nil {
+		si.log.WarnContext(ctx, "Error getting the segment index, it will be built again", "path", path, "error", err)
+	}
+
+	if index != nil {
+		return nzbloader.NewIndexedNzbReader(reader, index)
+	}
+
+	si.build(ctx, path, info)
+
+	return nzbloader.NewNzbReader(reader)
+}
+
+// build builds the index of the nzb in the background, it is used by the next opens
+func (si *segmentIndexer) build(ctx context.Context, path string, info os.FileInfo) {
+	if _, loaded := si.building.LoadOrStore(path, struct{}{}); loaded {
+		return
+	}
+
+	// The index outlives the request that opened the file
+	ctx = context.WithoutCancel(ctx)
+
+	go func() {
+		defer si.building.Delete(path)
+
+		f, err := si.fs.Open(path)
+		if err != nil {
+			si.log.WarnContext(ctx, "Error opening the nzb to build its segment index", "path", path, "error", err)
+			return
+		}
+		defer f.Close()
+
+		// A change of the nzb while it is read is detected by the next open, it is saved
+		// with the previous modification time
+		index, err := nzbloader.BuildSegmentIndex(bufio.NewReader(f))
+		if err != nil {
+			si.log.WarnContext(ctx, "Error building the segment index", "path", path, "error", err)
+			return
+		}
+
+		if err := si.repository.Save(ctx, path, info, index); err != nil {
+			si.log.ErrorContext(ctx, "Error saving the segment index", "path", path, "error", err)
+			return
+		}
+
+		si.log.DebugContext(ctx, "Segment index built", "path", path)
+	}()
+}
@@ -0,0 +1,104 @@
+package filereader
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javi11/usenet-drive/internal/usenet/nzbloader"
+	"github.com/javi11/usenet-drive/pkg/osfs"
+)
+
+const segmentIndexNzb = `<?xml version="1.0" encoding="UTF-8"?>
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <head>
+    <meta type="file_size">6</meta>
+    <meta type="file_name">test.bin</meta>
+    <meta type="mod_time">2023-09-22 20:06:09</meta>
+    <meta type="file_extension">.bin</meta>
+    <meta type="chunk_size">3</meta>
+  </head>
+  <file poster="poster" date="1695410374" subject="[1/1] - test.bin">
+    <groups>
+      <group>alt.binaries.test</group>
+    </groups>
+    <segments>
+      <segment bytes="3" number="1">data-1@test</segment>
+      <segment bytes="3" number="2">data-2@test</segment>
+    </segments>
+  </file>
+</nzb>`
+
+func TestSegmentIndexer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	path := filepath.Join(t.TempDir(), "test.nzb")
+	require.NoError(t, os.WriteFile(path, []byte(segmentIndexNzb), 0644))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	t.Run("The index is built the first time the nzb is opened", func(t *testing.T) {
+		repository := nzbloader.NewMockSegmentIndexRepository(ctrl)
+		indexer := newSegmentIndexer(repository, osfs.New(), slog.Default())
+
+		saved := make(chan *nzbloader.SegmentIndex, 1)
+		repository.EXPECT().Get(gomock.Any(), path, info).Return(nil, nil).Times(1)
+		repository.EXPECT().Save(gomock.Any(), path, info, gomock.Any()).
+			DoAndReturn(func(_ context.Context, _ string, _ os.FileInfo, index *nzbloader.SegmentIndex) error {
+				saved <- index
+				return nil
+			}).Times(1)
+
+		reader := indexer.nzbReader(context.Background(), path, info, strings.NewReader(segmentIndexNzb))
+		s, ok := reader.GetSegment(1)
+		require.True(t, ok)
+		assert.Equal(t, "data-2@test", s.Id)
+
+		select {
+		case index := <-saved:
+			s, ok := index.Segment(1)
+			require.True(t, ok)
+			assert.Equal(t, "data-2@test", s.Id)
+		case <-time.After(time.Second):
+			t.Fatal("the segment index was not saved")
+		}
+	})
+
+	t.Run("The segments are found in the index", func(t *testing.T) {
+		repository := nzbloader.NewMockSegmentIndexRepository(ctrl)
+		indexer := newSegmentIndexer(repository, osfs.New(), slog.Default())
+
+		index, err := nzbloader.BuildSegmentIndex(strings.NewReader(segmentIndexNzb))
+		require.NoError(t, err)
+		repository.EXPECT().Get(gomock.Any(), path, info).Return(index, nil).Times(1)
+
+		// The segments are not parsed from the nzb
+		head := segmentIndexNzb[:strings.Index(segmentIndexNzb, "<segments>")]
+		reader := indexer.nzbReader(context.Background(), path, info, strings.NewReader(head))
+
+		_, err = reader.GetMetadata()
+		require.NoError(t, err)
+
+		s, ok := reader.GetSegment(1)
+		require.True(t, ok)
+		assert.Equal(t, "data-2@test", s.Id)
+	})
+
+	t.Run("Without repository the nzb is parsed", func(t *testing.T) {
+		var indexer *segmentIndexer
+
+		reader := indexer.nzbReader(context.Background(), path, info, strings.NewReader(segmentIndexNzb))
+		s, ok := reader.GetSegment(0)
+		require.True(t, ok)
+		assert.Equal(t, "data-1@test", s.Id)
+	})
+}
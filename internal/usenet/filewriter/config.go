@@ -1,11 +1,13 @@
 package filewriter
 
 import (
+	"context"
 	"log/slog"
 
 	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
 	"github.com/javi11/usenet-drive/internal/usenet/corruptednzbsmanager"
 	"github.com/javi11/usenet-drive/internal/usenet/nzbloader"
+	"github.com/javi11/usenet-drive/internal/usenet/segmentcache"
 	status "github.com/javi11/usenet-drive/internal/usenet/statusreporter"
 	"github.com/javi11/usenet-drive/pkg/osfs"
 )
@@ -22,6 +24,17 @@ type Config struct {
 	fs               osfs.FileSystem
 	maxUploadRetries int
 	sr               status.StatusReporter
+	// Percentage of par2 recovery data posted with each file, 0 disables it
+	par2Redundancy int
+	segmentCache   segmentcache.SegmentCache
+	nzbInvalidator NzbInvalidator
+	segmentIndex   nzbloader.SegmentIndexRepository
+}
+
+// NzbInvalidator is notified when a nzb is rewritten, so the readers that have it open use
+// the new segments
+type NzbInvalidator interface {
+	InvalidateNzb(ctx context.Context, nzbPath string)
 }
 
 type Option func(*Config)
@@ -100,3 +113,34 @@ func WithStatusReporter(sr status.StatusReporter) Option {
 		c.sr = sr
 	}
 }
+
+// WithPar2Redundancy posts par2 recovery slices of the given percentage of the segments of
+// each file, so the missing segments can be repaired when the file is read
+func WithPar2Redundancy(par2Redundancy int) Option {
+	return func(c *Config) {
+		c.par2Redundancy = par2Redundancy
+	}
+}
+
+// WithSegmentCache restores from the cache the segments that no provider has when a nzb is
+// repaired
+func WithSegmentCache(segmentCache segmentcache.SegmentCache) Option {
+	return func(c *Config) {
+		c.segmentCache = segmentCache
+	}
+}
+
+// WithNzbInvalidator notifies the open readers of a nzb when it is rewritten by a repair
+func WithNzbInvalidator(nzbInvalidator NzbInvalidator) Option {
+	return func(c *Config) {
+		c.nzbInvalidator = nzbInvalidator
+	}
+}
+
+// WithSegmentIndexRepository deletes or moves the segment index of the removed, renamed and
+// repaired nzbs
+func WithSegmentIndexRepository(segmentIndex nzbloader.SegmentIndexRepository) Option {
+	return func(c *Config) {
+		c.segmentIndex = segmentIndex
+	}
+}
@@ -3,5 +3,7 @@ package filewriter
 import "errors"
 
 var (
-	ErrRetryable = errors.New("retryable error")
+	ErrRetryable             = errors.New("retryable error")
+	ErrSegmentNotRetrievable = errors.New("segment not found in any provider or in the segment cache")
+	ErrRepairRunning         = errors.New("the nzb is already being repaired")
 )
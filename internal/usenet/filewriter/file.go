@@ -16,16 +16,22 @@ import (
 	"github.com/avast/retry-go"
 	"github.com/google/uuid"
 	"github.com/hashicorp/go-multierror"
+	"github.com/javi11/usenet-drive/internal/metrics"
 	"github.com/javi11/usenet-drive/internal/usenet"
 	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
 	status "github.com/javi11/usenet-drive/internal/usenet/statusreporter"
 	"github.com/javi11/usenet-drive/pkg/nntpcli"
 	"github.com/javi11/usenet-drive/pkg/nzb"
 	"github.com/javi11/usenet-drive/pkg/osfs"
+	"github.com/javi11/usenet-drive/pkg/par2"
 )
 
 var ErrUnexpectedFileSize = errors.New("file size does not match the expected size")
 
+// Max segments of a par2 recovery set. The recovery slices of a set are kept in memory until
+// it is posted, and a missing segment is repaired downloading only the segments of its set.
+const maxRecoverySetSize = 256
+
 type nzbMetadata struct {
 	fileNameHash     string
 	filePath         string
@@ -33,6 +39,19 @@ type nzbMetadata struct {
 	group            string
 	poster           string
 	expectedFileSize int64
+	// Number of par2 recovery slices of each recovery set, 0 if the recovery data is disabled
+	recoverySlices int
+	// Number of segments of each par2 recovery set, the last one can be shorter
+	recoverySetSize int
+}
+
+// recoverySets returns the number of par2 recovery sets of the file
+func (m nzbMetadata) recoverySets() int {
+	if m.recoverySlices == 0 {
+		return 0
+	}
+
+	return int((m.parts + int64(m.recoverySetSize) - 1) / int64(m.recoverySetSize))
 }
 
 type file struct {
@@ -51,6 +70,10 @@ type file struct {
 	uploadErr        error
 	sr               status.StatusReporter
 	sessionId        uuid.UUID
+	// Encoder of the par2 recovery set being read, nil until its first segment is read
+	par2 *par2.Encoder
+	// Critical packets of the par2 recovery sets already posted
+	par2Critical []byte
 }
 
 func openFile(
@@ -65,6 +88,7 @@ func openFile(
 	log *slog.Logger,
 	maxUploadRetries int,
 	dryRun bool,
+	par2Redundancy int,
 	onClose func(err error) error,
 	fs osfs.FileSystem,
 	sr status.StatusReporter,
@@ -81,6 +105,13 @@ func openFile(
 
 	fileName := filepath.Base(filePath)
 
+	recoverySlices := 0
+	recoverySetSize := 0
+	if par2Redundancy > 0 && parts > 0 {
+		recoverySetSize = int(min(parts, maxRecoverySetSize))
+		recoverySlices = max((recoverySetSize*par2Redundancy+99)/100, 1)
+	}
+
 	fileNameHash := uuid.New().String()
 
 	poster := generateRandomPoster()
@@ -105,6 +136,8 @@ func openFile(
 			group:            randomGroup,
 			poster:           poster,
 			expectedFileSize: fileSize,
+			recoverySlices:   recoverySlices,
+			recoverySetSize:  recoverySetSize,
 		},
 		metadata: &usenet.Metadata{
 			FileName:      fileName,
@@ -122,8 +155,11 @@ func (f *file) ReadFrom(src io.Reader) (int64, error) {
 	var bytesWritten int64
 	wg := &multierror.Group{}
 	segments := make([]*nzb.NzbSegment, f.nzbMetadata.parts)
+	recoverySegments := make([]*nzb.NzbSegment, f.recoveryFileParts())
 
 	ctx, cancel := context.WithCancelCause(f.ctx)
+	defer cancel(nil)
+
 	for i := 0; ; i++ {
 		select {
 		case <-ctx.Done():
@@ -165,6 +201,14 @@ func (f *file) ReadFrom(src io.Reader) (int64, error) {
 					continue
 				}
 
+				if f.nzbMetadata.recoverySlices > 0 {
+					if err := f.addRecoverySlice(ctx, wg, recoverySegments, i, buf[0:bytesRead]); err != nil {
+						cancel(err)
+
+						continue
+					}
+				}
+
 				i := i
 				retryErr := retry.Do(func() error {
 					conn, err := f.cp.GetUploadConnection(ctx)
@@ -178,7 +222,9 @@ func (f *file) ReadFrom(src io.Reader) (int64, error) {
 					}
 
 					wg.Go(func() error {
-						return f.addSegment(ctx, conn, segments, buf[0:bytesRead], i)
+						return f.addSegment(ctx, conn, segments, buf[0:bytesRead], i, func() (ArticleData, error) {
+							return f.buildArticleData(int64(i))
+						})
 					})
 
 					return nil
@@ -247,7 +293,17 @@ func (f *file) ReadFrom(src io.Reader) (int64, error) {
 					return bytesWritten, err
 				}
 
-				err := f.writeFinalNzb(segments)
+				if f.nzbMetadata.recoverySlices > 0 {
+					if err := f.uploadRecoveryFile(ctx, recoverySegments); err != nil {
+						f.log.Error("Error uploading the par2 recovery file. The file will not be written.", "error", err)
+						f.sr.FinishUpload(f.sessionId)
+						f.uploadErr = err
+
+						return bytesWritten, err
+					}
+				}
+
+				err := f.writeFinalNzb(segments, recoverySegments)
 				if err != nil {
 					f.log.Error("Error writing the nzb file. The file will not be written.", "error", err)
 					f.sr.FinishUpload(f.sessionId)
@@ -353,11 +409,18 @@ func (f *file) getMetadata() usenet.Metadata {
 	return *f.metadata
 }
 
-func (f *file) addSegment(ctx context.Context, conn connectionpool.Resource, segments []*nzb.NzbSegment, b []byte, segmentIndex int) error {
+func (f *file) addSegment(
+	ctx context.Context,
+	conn connectionpool.Resource,
+	segments []*nzb.NzbSegment,
+	b []byte,
+	segmentIndex int,
+	buildArticleData func() (ArticleData, error),
+) error {
 	log := f.log.With("segment_number", segmentIndex+1)
 
 	err := retry.Do(func() error {
-		a, err := f.buildArticleData(int64(segmentIndex))
+		a, err := buildArticleData()
 		if err != nil {
 			f.cp.Free(conn)
 			conn = nil
@@ -430,6 +493,7 @@ func (f *file) addSegment(ctx context.Context, conn connectionpool.Resource, seg
 		retry.Delay(1*time.Second),
 		retry.DelayType(retry.BackOffDelay),
 		retry.OnRetry(func(n uint, err error) {
+			metrics.UploadRetries.Inc()
 			l := log.With("retry", n)
 			l.DebugContext(ctx, "Retrying upload", "error", err, "retry", n)
 
@@ -486,7 +550,7 @@ func (f *file) buildArticleData(segmentIndex int64) (ArticleData, error) {
 		partBegin: start,
 		partEnd:   end,
 		fileNum:   1,
-		fileTotal: 1,
+		fileTotal: f.fileTotal(),
 		fileSize:  f.nzbMetadata.expectedFileSize,
 		fileName:  f.nzbMetadata.fileNameHash,
 		poster:    f.nzbMetadata.poster,
@@ -495,8 +559,191 @@ func (f *file) buildArticleData(segmentIndex int64) (ArticleData, error) {
 	}, nil
 }
 
-func (f *file) writeFinalNzb(segments []*nzb.NzbSegment) error {
-	for _, segment := range segments {
+// fileTotal is the number of files posted, the par2 recovery file is the second one
+func (f *file) fileTotal() int {
+	if f.nzbMetadata.recoverySlices > 0 {
+		return 2
+	}
+
+	return 1
+}
+
+// recoveryFileName is the name of the par2 volume with all the recovery slices
+func (f *file) recoveryFileName() string {
+	return fmt.Sprintf(
+		"%s.vol00+%02d.par2",
+		f.nzbMetadata.fileNameHash,
+		f.nzbMetadata.recoverySlices*f.nzbMetadata.recoverySets(),
+	)
+}
+
+// recoverySetName is the name of the file protected by a par2 recovery set
+func (f *file) recoverySetName(set int) string {
+	return fmt.Sprintf("%s.%d", f.nzbMetadata.fileNameHash, set)
+}
+
+// recoveryPacketSize is the size of the packet of a recovery slice, every slice is posted in
+// its own article
+func (f *file) recoveryPacketSize() int64 {
+	return int64(par2.SliceSize(int(f.metadata.ChunkSize)) + par2.RecoveryPacketOverhead)
+}
+
+// criticalPacketsSize is the size of the critical packets of all the recovery sets
+func (f *file) criticalPacketsSize() int64 {
+	var size int64
+	for set := 0; set < f.nzbMetadata.recoverySets(); set++ {
+		slices := min(int64(f.nzbMetadata.recoverySetSize), f.nzbMetadata.parts-int64(set*f.nzbMetadata.recoverySetSize))
+		size += int64(par2.CriticalPacketsSize(f.recoverySetName(set), int(slices)))
+	}
+
+	return size
+}
+
+// recoveryFileParts is the number of articles of the par2 volume, the recovery slices of
+// every set in order followed by the critical packets of all the sets
+func (f *file) recoveryFileParts() int {
+	packets := f.nzbMetadata.recoverySlices * f.nzbMetadata.recoverySets()
+	critical := (f.criticalPacketsSize() + f.metadata.ChunkSize - 1) / f.metadata.ChunkSize
+
+	return packets + int(critical)
+}
+
+func (f *file) recoveryFileSize() int64 {
+	packets := int64(f.nzbMetadata.recoverySlices * f.nzbMetadata.recoverySets())
+
+	return packets*f.recoveryPacketSize() + f.criticalPacketsSize()
+}
+
+// addRecoverySlice adds the segment to the par2 encoder of its recovery set. Once the last
+// segment of the set is added its recovery slices are posted, so only the slices of one set
+// are in memory.
+func (f *file) addRecoverySlice(
+	ctx context.Context,
+	wg *multierror.Group,
+	recoverySegments []*nzb.NzbSegment,
+	segmentIndex int,
+	data []byte,
+) error {
+	if f.par2 == nil {
+		e, err := par2.NewEncoder(par2.SliceSize(int(f.metadata.ChunkSize)), f.nzbMetadata.recoverySlices)
+		if err != nil {
+			return err
+		}
+		f.par2 = e
+	}
+
+	if err := f.par2.Add(data); err != nil {
+		return err
+	}
+
+	if (segmentIndex+1)%f.nzbMetadata.recoverySetSize != 0 && int64(segmentIndex+1) != f.nzbMetadata.parts {
+		return nil
+	}
+
+	set := segmentIndex / f.nzbMetadata.recoverySetSize
+	volume := f.par2.Volume(f.recoverySetName(set))
+	f.par2 = nil
+	f.par2Critical = append(f.par2Critical, volume.CriticalPackets...)
+
+	for i, p := range volume.RecoveryPackets {
+		index := set*f.nzbMetadata.recoverySlices + i
+		if err := f.postRecoveryPart(ctx, wg, recoverySegments, index, int64(index)*f.recoveryPacketSize(), p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// uploadRecoveryFile posts the critical packets of the recovery sets at the end of the par2
+// volume, the recovery slices were posted with their sets.
+func (f *file) uploadRecoveryFile(ctx context.Context, recoverySegments []*nzb.NzbSegment) error {
+	wg := &multierror.Group{}
+
+	index := f.nzbMetadata.recoverySlices * f.nzbMetadata.recoverySets()
+	begin := int64(index) * f.recoveryPacketSize()
+	for critical := f.par2Critical; len(critical) > 0; index++ {
+		n := min(len(critical), int(f.metadata.ChunkSize))
+		if err := f.postRecoveryPart(ctx, wg, recoverySegments, index, begin, critical[:n]); err != nil {
+			return errors.Join(err, wg.Wait().ErrorOrNil())
+		}
+
+		begin += int64(n)
+		critical = critical[n:]
+	}
+	f.par2Critical = nil
+
+	return wg.Wait().ErrorOrNil()
+}
+
+// postRecoveryPart posts a part of the par2 volume in the background
+func (f *file) postRecoveryPart(
+	ctx context.Context,
+	wg *multierror.Group,
+	recoverySegments []*nzb.NzbSegment,
+	index int,
+	begin int64,
+	p []byte,
+) error {
+	return retry.Do(func() error {
+		conn, err := f.cp.GetUploadConnection(ctx)
+		if err != nil {
+			if conn != nil {
+				f.cp.Close(conn)
+			}
+
+			return fmt.Errorf("error getting nntp connection: %w", err)
+		}
+
+		wg.Go(func() error {
+			return f.addSegment(ctx, conn, recoverySegments, p, index, func() (ArticleData, error) {
+				return f.buildRecoveryArticleData(
+					int64(index),
+					int64(len(recoverySegments)),
+					begin,
+					int64(len(p)),
+					f.recoveryFileSize(),
+				)
+			})
+		})
+
+		return nil
+	},
+		retry.Context(ctx),
+		retry.Attempts(uint(f.maxUploadRetries)),
+		retry.Delay(1*time.Second),
+		retry.DelayType(retry.FixedDelay),
+		retry.RetryIf(func(err error) bool {
+			return nntpcli.IsRetryableError(err)
+		}),
+	)
+}
+
+func (f *file) buildRecoveryArticleData(segmentIndex, parts, begin, size, fileSize int64) (ArticleData, error) {
+	msgId, err := generateMessageId()
+	if err != nil {
+		f.log.Error("Error generating message id.", "error", err)
+		return ArticleData{}, err
+	}
+
+	return ArticleData{
+		partNum:   segmentIndex + 1,
+		partTotal: parts,
+		partSize:  size,
+		partBegin: begin,
+		partEnd:   begin + size,
+		fileNum:   2,
+		fileTotal: 2,
+		fileSize:  fileSize,
+		fileName:  f.recoveryFileName(),
+		poster:    f.nzbMetadata.poster,
+		group:     f.nzbMetadata.group,
+		msgId:     msgId,
+	}, nil
+}
+
+func (f *file) writeFinalNzb(segments, recoverySegments []*nzb.NzbSegment) error {
+	for _, segment := range append(segments, recoverySegments...) {
 		if segment.Bytes == 0 {
 			f.log.Warn("Upload was canceled. The file will not be written.")
 
@@ -505,17 +752,28 @@ func (f *file) writeFinalNzb(segments []*nzb.NzbSegment) error {
 	}
 
 	// Create and upload the nzb file
-	subject := fmt.Sprintf("[1/1] - \"%s\" yEnc (1/%d)", f.nzbMetadata.fileNameHash, f.nzbMetadata.parts)
-	nzb := &nzb.Nzb{
-		Files: []*nzb.NzbFile{
-			{
-				Segments: segments,
-				Subject:  subject,
-				Groups:   []string{f.nzbMetadata.group},
-				Poster:   f.nzbMetadata.group,
-				Date:     time.Now().UnixMilli(),
-			},
+	subject := fmt.Sprintf("[1/%d] - \"%s\" yEnc (1/%d)", f.fileTotal(), f.nzbMetadata.fileNameHash, f.nzbMetadata.parts)
+	files := []*nzb.NzbFile{
+		{
+			Segments: segments,
+			Subject:  subject,
+			Groups:   []string{f.nzbMetadata.group},
+			Poster:   f.nzbMetadata.group,
+			Date:     time.Now().UnixMilli(),
 		},
+	}
+	if len(recoverySegments) > 0 {
+		files = append(files, &nzb.NzbFile{
+			Segments: recoverySegments,
+			Subject:  fmt.Sprintf("[2/2] - \"%s\" yEnc (1/%d)", f.recoveryFileName(), len(recoverySegments)),
+			Groups:   []string{f.nzbMetadata.group},
+			Poster:   f.nzbMetadata.group,
+			Date:     time.Now().UnixMilli(),
+		})
+	}
+
+	nzb := &nzb.Nzb{
+		Files: files,
 		Meta: map[string]string{
 			"file_size":      strconv.FormatInt(f.metadata.FileSize, 10),
 			"mod_time":       f.metadata.ModTime.Format(time.DateTime),
@@ -525,6 +783,11 @@ func (f *file) writeFinalNzb(segments []*nzb.NzbSegment) error {
 		},
 	}
 
+	if len(recoverySegments) > 0 {
+		nzb.Meta["par2_recovery_slices"] = strconv.Itoa(f.nzbMetadata.recoverySlices)
+		nzb.Meta["par2_recovery_set_size"] = strconv.Itoa(f.nzbMetadata.recoverySetSize)
+	}
+
 	// Write and close the tmp nzb file
 	nzbFilePath := usenet.ReplaceFileExtension(f.nzbMetadata.filePath, ".nzb")
 	b, err := nzb.ToBytes()
@@ -1,6 +1,7 @@
 package filewriter
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"io"
@@ -23,7 +24,9 @@ import (
 	"github.com/javi11/usenet-drive/pkg/nntpcli"
 	"github.com/javi11/usenet-drive/pkg/nzb"
 	"github.com/javi11/usenet-drive/pkg/osfs"
+	"github.com/javi11/usenet-drive/pkg/par2"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestOpenFile(t *testing.T) {
@@ -56,6 +59,7 @@ func TestOpenFile(t *testing.T) {
 		log,
 		5,
 		dryRun,
+		0,
 		onClose,
 		fs,
 		mockSr,
@@ -342,6 +346,169 @@ func TestReadFrom(t *testing.T) {
 		assert.Equal(t, metadata.FileSize, n)
 	})
 
+	t.Run("File uploaded with par2 recovery data", func(t *testing.T) {
+		fs := osfs.NewMockFileSystem(ctrl)
+		cp := connectionpool.NewMockUsenetConnectionPool(ctrl)
+		mockSr := status.NewMockStatusReporter(ctrl)
+
+		openedFile := &file{
+			ctx:              context.Background(),
+			maxUploadRetries: maxUploadRetries,
+			dryRun:           dryRun,
+			cp:               cp,
+			fs:               fs,
+			log:              log,
+			flag:             os.O_WRONLY,
+			perm:             os.FileMode(0644),
+			nzbMetadata: nzbMetadata{
+				fileNameHash:     fileNameHash,
+				filePath:         filePath,
+				parts:            parts,
+				group:            randomGroup,
+				poster:           poster,
+				expectedFileSize: fileSize,
+				recoverySlices:   2,
+				recoverySetSize:  10,
+			},
+			metadata: &usenet.Metadata{
+				FileName:      fileName,
+				ModTime:       time.Now(),
+				FileSize:      0,
+				FileExtension: filepath.Ext(fileName),
+				ChunkSize:     segmentSize,
+			},
+			sr: mockSr,
+		}
+
+		src := strings.NewReader("Et dignissimos incidunt ipsam molestiae occaecati. Fugit quo autem corporis occaecati sint. lorem it")
+
+		mockConn := nntpcli.NewMockConnection(ctrl)
+		mockResource := connectionpool.NewMockResource(ctrl)
+		mockResource.EXPECT().Value().Return(mockConn).AnyTimes()
+
+		// The data segments, the recovery slices and the critical packets
+		mx := sync.Mutex{}
+		var articles []string
+		mockConn.EXPECT().Post(gomock.Any()).DoAndReturn(func(r io.Reader) error {
+			b, err := io.ReadAll(r)
+			require.NoError(t, err)
+
+			mx.Lock()
+			defer mx.Unlock()
+			articles = append(articles, string(b))
+
+			return nil
+		}).AnyTimes()
+		cp.EXPECT().GetUploadConnection(gomock.Any()).Return(mockResource, nil).AnyTimes()
+		cp.EXPECT().Free(mockResource).AnyTimes()
+		mockSr.EXPECT().AddTimeData(gomock.Any(), gomock.Any()).Times(10)
+		mockSr.EXPECT().FinishUpload(gomock.Any()).Times(1)
+
+		var nzbFile []byte
+		fs.EXPECT().WriteFile("test.nzb", gomock.Any(), os.FileMode(0644)).DoAndReturn(func(_ string, b []byte, _ os.FileMode) error {
+			nzbFile = b
+
+			return nil
+		})
+
+		n, e := openedFile.ReadFrom(src)
+		assert.NoError(t, e)
+		assert.Equal(t, int64(100), n)
+
+		written, err := nzb.ParseFromBuffer(bytes.NewReader(nzbFile))
+		require.NoError(t, err)
+		assert.Equal(t, "2", written.Meta["par2_recovery_slices"])
+		require.Len(t, written.Files, 2)
+		assert.Len(t, written.Files[0].Segments, 10)
+		assert.Contains(t, written.Files[1].Subject, "test.vol00+02.par2")
+
+		// The first segments of the recovery file are the recovery slices
+		recoveryFile := written.Files[1]
+		assert.Len(t, articles, 10+len(recoveryFile.Segments))
+		assert.Equal(t, int64(1), recoveryFile.Segments[0].Number)
+		assert.Equal(t, int64(par2.SliceSize(int(segmentSize))+par2.RecoveryPacketOverhead), recoveryFile.Segments[0].Bytes)
+		assert.Equal(t, int64(par2.SliceSize(int(segmentSize))+par2.RecoveryPacketOverhead), recoveryFile.Segments[1].Bytes)
+		for _, a := range articles {
+			if strings.Contains(a, "[2/2]") {
+				assert.Contains(t, a, "name=test.vol00+02.par2")
+			} else {
+				assert.Contains(t, a, "[1/2]")
+			}
+		}
+	})
+
+	t.Run("File uploaded with several par2 recovery sets", func(t *testing.T) {
+		fs := osfs.NewMockFileSystem(ctrl)
+		cp := connectionpool.NewMockUsenetConnectionPool(ctrl)
+		mockSr := status.NewMockStatusReporter(ctrl)
+
+		openedFile := &file{
+			ctx:              context.Background(),
+			maxUploadRetries: maxUploadRetries,
+			dryRun:           dryRun,
+			cp:               cp,
+			fs:               fs,
+			log:              log,
+			flag:             os.O_WRONLY,
+			perm:             os.FileMode(0644),
+			nzbMetadata: nzbMetadata{
+				fileNameHash:     fileNameHash,
+				filePath:         filePath,
+				parts:            parts,
+				group:            randomGroup,
+				poster:           poster,
+				expectedFileSize: fileSize,
+				recoverySlices:   1,
+				recoverySetSize:  4,
+			},
+			metadata: &usenet.Metadata{
+				FileName:      fileName,
+				ModTime:       time.Now(),
+				FileSize:      0,
+				FileExtension: filepath.Ext(fileName),
+				ChunkSize:     segmentSize,
+			},
+			sr: mockSr,
+		}
+
+		src := strings.NewReader("Et dignissimos incidunt ipsam molestiae occaecati. Fugit quo autem corporis occaecati sint. lorem it")
+
+		mockConn := nntpcli.NewMockConnection(ctrl)
+		mockResource := connectionpool.NewMockResource(ctrl)
+		mockResource.EXPECT().Value().Return(mockConn).AnyTimes()
+		mockConn.EXPECT().Post(gomock.Any()).Return(nil).AnyTimes()
+		cp.EXPECT().GetUploadConnection(gomock.Any()).Return(mockResource, nil).AnyTimes()
+		cp.EXPECT().Free(mockResource).AnyTimes()
+		mockSr.EXPECT().AddTimeData(gomock.Any(), gomock.Any()).Times(10)
+		mockSr.EXPECT().FinishUpload(gomock.Any()).Times(1)
+
+		var nzbFile []byte
+		fs.EXPECT().WriteFile("test.nzb", gomock.Any(), os.FileMode(0644)).DoAndReturn(func(_ string, b []byte, _ os.FileMode) error {
+			nzbFile = b
+
+			return nil
+		})
+
+		n, e := openedFile.ReadFrom(src)
+		assert.NoError(t, e)
+		assert.Equal(t, int64(100), n)
+
+		written, err := nzb.ParseFromBuffer(bytes.NewReader(nzbFile))
+		require.NoError(t, err)
+		assert.Equal(t, "1", written.Meta["par2_recovery_slices"])
+		assert.Equal(t, "4", written.Meta["par2_recovery_set_size"])
+		require.Len(t, written.Files, 2)
+		assert.Contains(t, written.Files[1].Subject, "test.vol00+03.par2")
+
+		// One recovery slice for each set of 4, 4 and 2 segments followed by the critical packets
+		critical := par2.CriticalPacketsSize("test.0", 4) + par2.CriticalPacketsSize("test.1", 4) + par2.CriticalPacketsSize("test.2", 2)
+		recoveryFile := written.Files[1]
+		assert.Len(t, recoveryFile.Segments, 3+(critical+int(segmentSize)-1)/int(segmentSize))
+		for _, s := range recoveryFile.Segments[:3] {
+			assert.Equal(t, int64(par2.SliceSize(int(segmentSize))+par2.RecoveryPacketOverhead), s.Bytes)
+		}
+	})
+
 	t.Run("Wrong expected file size", func(t *testing.T) {
 		fs := osfs.NewMockFileSystem(ctrl)
 		cp := connectionpool.NewMockUsenetConnectionPool(ctrl)
@@ -7,11 +7,13 @@ import (
 	"math/rand"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/javi11/usenet-drive/internal/usenet"
 	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
 	"github.com/javi11/usenet-drive/internal/usenet/corruptednzbsmanager"
 	"github.com/javi11/usenet-drive/internal/usenet/nzbloader"
+	"github.com/javi11/usenet-drive/internal/usenet/segmentcache"
 	status "github.com/javi11/usenet-drive/internal/usenet/statusreporter"
 	"github.com/javi11/usenet-drive/pkg/nzb"
 	"github.com/javi11/usenet-drive/pkg/osfs"
@@ -19,6 +21,8 @@ import (
 )
 
 type fileWriter struct {
+	// Protects the settings that can be changed by Reload
+	mx               sync.RWMutex
 	segmentSize      int64
 	cp               connectionpool.UsenetConnectionPool
 	postGroups       []string
@@ -30,6 +34,13 @@ type fileWriter struct {
 	fs               osfs.FileSystem
 	maxUploadRetries int
 	sr               status.StatusReporter
+	par2Redundancy   int
+	segmentCache     segmentcache.SegmentCache
+	nzbInvalidator   NzbInvalidator
+	segmentIndex     nzbloader.SegmentIndexRepository
+	// Repairs started with StartRepair by nzb path
+	repairsMx sync.Mutex
+	repairs   map[string]*RepairStatus
 }
 
 func NewFileWriter(options ...Option) *fileWriter {
@@ -50,6 +61,11 @@ func NewFileWriter(options ...Option) *fileWriter {
 		fs:               config.fs,
 		maxUploadRetries: config.maxUploadRetries,
 		sr:               config.sr,
+		par2Redundancy:   config.par2Redundancy,
+		segmentCache:     config.segmentCache,
+		nzbInvalidator:   config.nzbInvalidator,
+		segmentIndex:     config.segmentIndex,
+		repairs:          map[string]*RepairStatus{},
 	}
 }
 
@@ -61,7 +77,12 @@ func (u *fileWriter) OpenFile(
 	perm fs.FileMode,
 	onClose func(err error) error,
 ) (webdav.File, error) {
+	u.mx.RLock()
 	randomGroup := u.postGroups[rand.Intn(len(u.postGroups))]
+	maxUploadRetries := u.maxUploadRetries
+	dryRun := u.dryRun
+	par2Redundancy := u.par2Redundancy
+	u.mx.RUnlock()
 
 	return openFile(
 		ctx,
@@ -73,15 +94,44 @@ func (u *fileWriter) OpenFile(
 		u.cp,
 		randomGroup,
 		u.log,
-		u.maxUploadRetries,
-		u.dryRun,
+		maxUploadRetries,
+		dryRun,
+		par2Redundancy,
 		onClose,
 		u.fs,
 		u.sr,
 	)
 }
 
+// Reload applies the given options to the files opened from now on, the files being
+// uploaded keep the previous settings. Only the post groups, file allow list, dry run,
+// max upload retries and par2 redundancy can be changed.
+func (u *fileWriter) Reload(options ...Option) {
+	u.mx.Lock()
+	defer u.mx.Unlock()
+
+	config := &Config{
+		postGroups:       u.postGroups,
+		fileAllowlist:    u.fileAllowlist,
+		dryRun:           u.dryRun,
+		maxUploadRetries: u.maxUploadRetries,
+		par2Redundancy:   u.par2Redundancy,
+	}
+	for _, option := range options {
+		option(config)
+	}
+
+	u.postGroups = config.postGroups
+	u.fileAllowlist = config.fileAllowlist
+	u.dryRun = config.dryRun
+	u.maxUploadRetries = config.maxUploadRetries
+	u.par2Redundancy = config.par2Redundancy
+}
+
 func (u *fileWriter) HasAllowedFileExtension(fileName string) bool {
+	u.mx.RLock()
+	defer u.mx.RUnlock()
+
 	if len(u.fileAllowlist) == 0 {
 		return true
 	}
@@ -102,6 +152,12 @@ func (u *fileWriter) RemoveFile(ctx context.Context, fileName string) (bool, err
 			return false, err
 		}
 
+		if u.segmentIndex != nil {
+			if err := u.segmentIndex.Delete(ctx, maskFile); err != nil {
+				u.log.ErrorContext(ctx, "Error deleting the segment index", "path", maskFile, "error", err)
+			}
+		}
+
 		_, err = u.cNzb.DiscardByPath(ctx, maskFile)
 		if err != nil {
 			u.log.ErrorContext(ctx, "Error removing corrupted nzb from list", "error", err)
@@ -144,6 +200,12 @@ func (u *fileWriter) RenameFile(ctx context.Context, fileName string, newFileNam
 		return false, err
 	}
 
+	if u.segmentIndex != nil {
+		if err := u.segmentIndex.Rename(ctx, fileName, newFileName); err != nil {
+			u.log.ErrorContext(ctx, "Error moving the segment index", "path", fileName, "error", err)
+		}
+	}
+
 	err = u.cNzb.Update(ctx, fileName, newFileName)
 	if err != nil {
 		u.log.ErrorContext(ctx, "Error updating corrupted nzb", "error", err)
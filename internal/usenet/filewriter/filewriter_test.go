@@ -0,0 +1,79 @@
+package filewriter
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/javi11/usenet-drive/internal/usenet/corruptednzbsmanager"
+	"github.com/javi11/usenet-drive/internal/usenet/nzbloader"
+	"github.com/javi11/usenet-drive/pkg/osfs"
+)
+
+func TestFileWriter_RemoveFile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fs := osfs.NewMockFileSystem(ctrl)
+	cNzb := corruptednzbsmanager.NewMockCorruptedNzbsManager(ctrl)
+	segmentIndex := nzbloader.NewMockSegmentIndexRepository(ctrl)
+	fw := NewFileWriter(
+		WithLogger(slog.Default()),
+		WithFileSystem(fs),
+		WithCorruptedNzbsManager(cNzb),
+		WithSegmentIndexRepository(segmentIndex),
+	)
+
+	t.Run("The segment index of the nzb is deleted", func(t *testing.T) {
+		fs.EXPECT().Stat("/nzbs/file.nzb").Return(nil, nil).Times(1)
+		fs.EXPECT().IsNotExist(nil).Return(false).Times(1)
+		fs.EXPECT().RemoveAll("/nzbs/file.nzb").Return(nil).Times(1)
+		segmentIndex.EXPECT().Delete(gomock.Any(), "/nzbs/file.nzb").Return(nil).Times(1)
+		cNzb.EXPECT().DiscardByPath(gomock.Any(), "/nzbs/file.nzb").Return(nil, nil).Times(1)
+
+		ok, err := fw.RemoveFile(context.Background(), "/nzbs/file.mkv")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("The segment index is kept when the nzb can not be removed", func(t *testing.T) {
+		fs.EXPECT().Stat("/nzbs/file.nzb").Return(nil, nil).Times(1)
+		fs.EXPECT().IsNotExist(nil).Return(false).Times(1)
+		fs.EXPECT().RemoveAll("/nzbs/file.nzb").Return(os.ErrPermission).Times(1)
+
+		ok, err := fw.RemoveFile(context.Background(), "/nzbs/file.mkv")
+		assert.ErrorIs(t, err, os.ErrPermission)
+		assert.False(t, ok)
+	})
+}
+
+func TestFileWriter_RenameFile(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	fs := osfs.NewMockFileSystem(ctrl)
+	cNzb := corruptednzbsmanager.NewMockCorruptedNzbsManager(ctrl)
+	segmentIndex := nzbloader.NewMockSegmentIndexRepository(ctrl)
+	fw := NewFileWriter(
+		WithLogger(slog.Default()),
+		WithFileSystem(fs),
+		WithCorruptedNzbsManager(cNzb),
+		WithSegmentIndexRepository(segmentIndex),
+	)
+
+	t.Run("The segment index of the nzb is moved", func(t *testing.T) {
+		fs.EXPECT().Stat("/nzbs/file.nzb").Return(nil, nil).Times(1)
+		fs.EXPECT().IsNotExist(nil).Return(false).Times(1)
+		fs.EXPECT().Rename("/nzbs/file.nzb", "/nzbs/renamed.nzb").Return(nil).Times(1)
+		segmentIndex.EXPECT().Rename(gomock.Any(), "/nzbs/file.nzb", "/nzbs/renamed.nzb").Return(nil).Times(1)
+		cNzb.EXPECT().Update(gomock.Any(), "/nzbs/file.nzb", "/nzbs/renamed.nzb").Return(nil).Times(1)
+
+		ok, err := fw.RenameFile(context.Background(), "/nzbs/file.mkv", "/nzbs/renamed.mkv")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
@@ -0,0 +1,695 @@
+package filewriter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/javi11/usenet-drive/internal/usenet"
+	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
+	"github.com/javi11/usenet-drive/pkg/nntpcli"
+	"github.com/javi11/usenet-drive/pkg/nzb"
+	"github.com/javi11/usenet-drive/pkg/par2"
+)
+
+// Segments checked and re-posted at the same time by a repair
+const repairWorkers = 10
+
+// Recovery slices downloaded on top of the missing segments of a set, some of them can be
+// missing too
+const extraRecoverySlices = 4
+
+var subjectFileNameRegex = regexp.MustCompile(`"([^"]+)"`)
+
+// RepairResult is the outcome of the repair of an nzb
+type RepairResult struct {
+	// Segments re-posted with new message ids, the reconstructed ones included
+	Reposted int `json:"reposted_segments"`
+	// Segments rebuilt from the par2 recovery slices of the nzb
+	Reconstructed int `json:"reconstructed_segments"`
+	// Numbers of the segments that could not be retrieved nor reconstructed
+	Unrepaired []int64 `json:"unrepaired_segments,omitempty"`
+}
+
+// RepairStatus is the state of the last repair of an nzb started with StartRepair
+type RepairStatus struct {
+	Running    bool         `json:"running"`
+	StartedAt  time.Time    `json:"started_at"`
+	FinishedAt *time.Time   `json:"finished_at,omitempty"`
+	Result     RepairResult `json:"result"`
+	Error      string       `json:"error,omitempty"`
+}
+
+// nzbRepair is the state of the repair of the first file of an nzb
+type nzbRepair struct {
+	nzb      *nzb.Nzb
+	metadata usenet.Metadata
+	uploader *file
+	fileName string
+	group    string
+	mx       sync.Mutex
+	// New segments by index, nil for the segments that were not re-posted
+	segments      []*nzb.NzbSegment
+	reposted      int
+	reconstructed int
+}
+
+// StartRepair repairs the nzb in the background, done is called with the result once the
+// repair finishes. ErrRepairRunning is returned when the nzb is already being repaired.
+func (u *fileWriter) StartRepair(ctx context.Context, nzbPath string, done func(ctx context.Context, result RepairResult, err error)) error {
+	u.repairsMx.Lock()
+	defer u.repairsMx.Unlock()
+
+	if status, ok := u.repairs[nzbPath]; ok && status.Running {
+		return ErrRepairRunning
+	}
+
+	// The repair outlives the request that started it
+	ctx = context.WithoutCancel(ctx)
+	u.repairs[nzbPath] = &RepairStatus{Running: true, StartedAt: time.Now()}
+
+	go func() {
+		result, err := u.RepairNzb(ctx, nzbPath)
+		if err != nil {
+			u.log.ErrorContext(ctx, "Error repairing the nzb", "path", nzbPath, "error", err)
+		}
+
+		if done != nil {
+			done(ctx, result, err)
+		}
+
+		u.repairsMx.Lock()
+		defer u.repairsMx.Unlock()
+
+		finishedAt := time.Now()
+		status := u.repairs[nzbPath]
+		status.Running = false
+		status.FinishedAt = &finishedAt
+		status.Result = result
+		if err != nil {
+			status.Error = err.Error()
+		}
+	}()
+
+	return nil
+}
+
+// GetRepairStatus returns the state of the running or last repair of the nzb
+func (u *fileWriter) GetRepairStatus(nzbPath string) (RepairStatus, bool) {
+	u.repairsMx.Lock()
+	defer u.repairsMx.Unlock()
+
+	status, ok := u.repairs[nzbPath]
+	if !ok {
+		return RepairStatus{}, false
+	}
+
+	return *status, true
+}
+
+// RepairNzb re-posts with new message ids the segments of the nzb that are missing in any of
+// the download providers and rewrites the nzb with them. The segments are downloaded from the
+// providers that still have them or restored from the segment cache, the ones that no provider
+// has are reconstructed from the par2 recovery slices of the nzb.
+//
+// The nzb is rewritten with the segments re-posted even when some of them can not be repaired,
+// they are returned in the result with ErrSegmentNotRetrievable.
+func (u *fileWriter) RepairNzb(ctx context.Context, nzbPath string) (RepairResult, error) {
+	u.mx.RLock()
+	maxUploadRetries := u.maxUploadRetries
+	dryRun := u.dryRun
+	u.mx.RUnlock()
+
+	log := u.log.With("path", nzbPath)
+
+	f, err := u.fs.Open(nzbPath)
+	if err != nil {
+		return RepairResult{}, err
+	}
+
+	n, err := nzb.ParseFromBuffer(f)
+	f.Close()
+	if err != nil {
+		return RepairResult{}, err
+	}
+
+	if len(n.Files) == 0 {
+		return RepairResult{}, fmt.Errorf("corrupted nzb file, no files found")
+	}
+
+	// Only the segments of the file are repaired, the par2 recovery file is optional
+	nzbFile := n.Files[0]
+
+	meta := maps.Clone(n.Meta)
+	meta["subject"] = nzbFile.Subject
+	metadata, err := usenet.LoadMetadataFromMap(meta)
+	if err != nil {
+		return RepairResult{}, err
+	}
+
+	fileName := uuid.New().String()
+	if m := subjectFileNameRegex.FindStringSubmatch(nzbFile.Subject); m != nil {
+		fileName = m[1]
+	}
+
+	group := ""
+	if len(nzbFile.Groups) > 0 {
+		group = nzbFile.Groups[0]
+	}
+
+	r := &nzbRepair{
+		nzb:      n,
+		metadata: metadata,
+		uploader: &file{
+			cp:               u.cp,
+			log:              log,
+			maxUploadRetries: maxUploadRetries,
+			dryRun:           dryRun,
+		},
+		fileName: fileName,
+		group:    group,
+		segments: make([]*nzb.NzbSegment, len(nzbFile.Segments)),
+	}
+
+	missing, err := u.repostMissingSegments(ctx, r)
+	if err == nil && len(missing) > 0 {
+		missing, err = u.reconstructMissingSegments(ctx, r, missing)
+	}
+
+	result := RepairResult{Reposted: r.reposted, Reconstructed: r.reconstructed}
+	for _, i := range missing {
+		result.Unrepaired = append(result.Unrepaired, nzbFile.Segments[i].Number)
+	}
+
+	// The segments already re-posted are kept even when the repair fails
+	if result.Reposted > 0 {
+		if dryRun {
+			log.InfoContext(ctx, "Dry run. Skipping nzb rewrite", "segments", result.Reposted)
+		} else {
+			for i, segment := range r.segments {
+				if segment != nil {
+					nzbFile.Segments[i] = segment
+				}
+			}
+
+			if rewriteErr := u.rewriteNzb(nzbPath, n); rewriteErr != nil {
+				return RepairResult{}, errors.Join(err, rewriteErr)
+			}
+
+			// The index of the previous segments is built again by the next open
+			if u.segmentIndex != nil {
+				if deleteErr := u.segmentIndex.Delete(ctx, nzbPath); deleteErr != nil {
+					log.ErrorContext(ctx, "Error deleting the segment index", "error", deleteErr)
+				}
+			}
+
+			if u.nzbInvalidator != nil {
+				u.nzbInvalidator.InvalidateNzb(ctx, nzbPath)
+			}
+		}
+	}
+
+	if err != nil {
+		return result, err
+	}
+
+	if len(result.Unrepaired) > 0 {
+		return result, fmt.Errorf("%d segments can not be repaired: %w", len(result.Unrepaired), ErrSegmentNotRetrievable)
+	}
+
+	if result.Reposted == 0 {
+		log.InfoContext(ctx, "No missing segments found")
+	} else {
+		log.InfoContext(ctx, "Nzb repaired", "segments", result.Reposted, "reconstructed", result.Reconstructed)
+	}
+
+	return result, nil
+}
+
+// repostMissingSegments re-posts the segments missing in any provider that can be retrieved.
+// It returns the indexes of the segments that no provider has.
+func (u *fileWriter) repostMissingSegments(ctx context.Context, r *nzbRepair) ([]int, error) {
+	nzbFile := r.nzb.Files[0]
+
+	mx := sync.Mutex{}
+	var missing []int
+
+	err := forEachIndex(ctx, len(nzbFile.Segments), func(ctx context.Context, i int) error {
+		segment := nzbFile.Segments[i]
+		chunk := make([]byte, r.segmentSize(segment))
+
+		ok, err := u.retrieveMissingSegment(ctx, segment, nzbFile.Groups, chunk)
+		if err != nil {
+			if errors.Is(err, ErrSegmentNotRetrievable) {
+				mx.Lock()
+				defer mx.Unlock()
+				missing = append(missing, i)
+
+				return nil
+			}
+
+			return fmt.Errorf("segment %d: %w", segment.Number, err)
+		}
+
+		if !ok {
+			return nil
+		}
+
+		return r.repost(ctx, i, chunk)
+	})
+
+	sort.Ints(missing)
+
+	return missing, err
+}
+
+// reconstructMissingSegments rebuilds the missing segments from the par2 recovery slices of
+// their recovery set and re-posts them. It returns the indexes of the segments that can not
+// be reconstructed.
+func (u *fileWriter) reconstructMissingSegments(ctx context.Context, r *nzbRepair, missing []int) ([]int, error) {
+	if r.metadata.RecoverySlices == 0 || len(r.nzb.Files) < 2 {
+		return missing, nil
+	}
+
+	setSize := r.metadata.RecoverySetSize
+	sets := map[int][]int{}
+	for _, i := range missing {
+		sets[i/setSize] = append(sets[i/setSize], i)
+	}
+
+	var unrepaired []int
+	for _, i := range missing {
+		set := i / setSize
+		indexes, ok := sets[set]
+		if !ok {
+			// The set was already reconstructed
+			continue
+		}
+		delete(sets, set)
+
+		repaired, err := u.reconstructSet(ctx, r, set, indexes)
+		if err != nil {
+			if errors.Is(err, par2.ErrNotEnoughBlocks) || errors.Is(err, ErrSegmentNotRetrievable) {
+				r.uploader.log.WarnContext(ctx, "Segments can not be reconstructed with par2", "set", set, "segments", len(indexes), "error", err)
+				unrepaired = append(unrepaired, indexes...)
+
+				continue
+			}
+
+			for _, indexes := range sets {
+				unrepaired = append(unrepaired, indexes...)
+			}
+			sort.Ints(unrepaired)
+
+			return append(unrepaired, indexes...), err
+		}
+
+		for _, i := range indexes {
+			if err := r.repost(ctx, i, repaired[i]); err != nil {
+				return append(unrepaired, i), err
+			}
+
+			r.mx.Lock()
+			r.reconstructed++
+			r.mx.Unlock()
+		}
+	}
+
+	sort.Ints(unrepaired)
+
+	return unrepaired, nil
+}
+
+// reconstructSet rebuilds the missing segments of the recovery set from its recovery slices
+// and the other segments of the set. The segments are returned by index.
+func (u *fileWriter) reconstructSet(ctx context.Context, r *nzbRepair, set int, missing []int) (map[int][]byte, error) {
+	chunkSize := int(r.metadata.ChunkSize)
+	sliceSize := par2.SliceSize(chunkSize)
+	setSize := r.metadata.RecoverySetSize
+	first := set * setSize
+	segments := min(setSize, len(r.nzb.Files[0].Segments)-first)
+
+	recovery, err := u.downloadRecoverySlices(ctx, r, set, len(missing), sliceSize)
+	if err != nil {
+		return nil, err
+	}
+
+	exponents := make([]int, 0, len(recovery))
+	for exponent := range recovery {
+		exponents = append(exponents, exponent)
+	}
+	sort.Ints(exponents)
+
+	repairer, err := par2.NewRepairer(sliceSize, segments, exponents)
+	if err != nil {
+		return nil, err
+	}
+
+	isMissing := map[int]bool{}
+	relative := make([]int, len(missing))
+	for j, i := range missing {
+		isMissing[i] = true
+		relative[j] = i - first
+	}
+
+	nzbFile := r.nzb.Files[0]
+	err = forEachIndex(ctx, segments, func(ctx context.Context, i int) error {
+		if isMissing[first+i] {
+			return nil
+		}
+
+		// The last segment is padded with zeros like when the recovery slices were computed
+		chunk := make([]byte, chunkSize)
+		if err := u.readSegment(ctx, nzbFile.Segments[first+i], nzbFile.Groups, chunk[:r.segmentSize(nzbFile.Segments[first+i])]); err != nil {
+			return err
+		}
+
+		return repairer.AddSlice(i, chunk)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	repaired, err := repairer.Reconstruct(relative, recovery)
+	if err != nil {
+		return nil, err
+	}
+
+	segmentsRepaired := make(map[int][]byte, len(repaired))
+	for i, data := range repaired {
+		segmentsRepaired[first+i] = data[:r.segmentSize(nzbFile.Segments[first+i])]
+	}
+
+	return segmentsRepaired, nil
+}
+
+// downloadRecoverySlices downloads the recovery slices of the set until there are as many as
+// the missing segments, the missing or invalid ones are skipped. They are returned by exponent.
+func (u *fileWriter) downloadRecoverySlices(
+	ctx context.Context,
+	r *nzbRepair,
+	set int,
+	missing int,
+	sliceSize int,
+) (map[int][]byte, error) {
+	recoveryFile := r.nzb.Files[1]
+	recoverySegments := make(map[int64]*nzb.NzbSegment, len(recoveryFile.Segments))
+	for _, segment := range recoveryFile.Segments {
+		recoverySegments[segment.Number] = segment
+	}
+
+	mx := sync.Mutex{}
+	recovery := map[int][]byte{}
+
+	from := 0
+	to := min(r.metadata.RecoverySlices, missing+extraRecoverySlices)
+	for {
+		err := forEachIndex(ctx, to-from, func(ctx context.Context, i int) error {
+			segment, ok := recoverySegments[int64(set*r.metadata.RecoverySlices+from+i+1)]
+			if !ok {
+				return nil
+			}
+
+			packet := make([]byte, sliceSize+par2.RecoveryPacketOverhead)
+			if err := u.downloadSegment(ctx, segment.Id, recoveryFile.Groups, packet, nil); err != nil {
+				if errors.Is(err, ErrSegmentNotRetrievable) {
+					return nil
+				}
+
+				return err
+			}
+
+			exponent, data, err := par2.ParseRecoveryPacket(packet)
+			if err != nil {
+				r.uploader.log.WarnContext(ctx, "Invalid par2 recovery slice", "segment", segment.Id, "error", err)
+				return nil
+			}
+
+			mx.Lock()
+			defer mx.Unlock()
+			recovery[exponent] = data
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(recovery) >= missing {
+			return recovery, nil
+		}
+
+		// Some recovery slices are missing too, try with the next ones
+		from, to = to, min(r.metadata.RecoverySlices, to+missing-len(recovery))
+		if from == to {
+			return nil, fmt.Errorf(
+				"%d segments missing, %d recovery slices available: %w",
+				missing,
+				len(recovery),
+				par2.ErrNotEnoughBlocks,
+			)
+		}
+	}
+}
+
+// segmentSize returns the size of the data of the segment, the last one can be shorter
+func (r *nzbRepair) segmentSize(segment *nzb.NzbSegment) int {
+	begin := (segment.Number - 1) * r.metadata.ChunkSize
+
+	return int(max(min(r.metadata.ChunkSize, r.metadata.FileSize-begin), 0))
+}
+
+// repost posts the data of the segment with a new message id
+func (r *nzbRepair) repost(ctx context.Context, i int, chunk []byte) error {
+	segment := r.nzb.Files[0].Segments[i]
+	begin := (segment.Number - 1) * r.metadata.ChunkSize
+
+	err := r.uploader.addSegment(ctx, nil, r.segments, chunk, i, func() (ArticleData, error) {
+		msgId, err := generateMessageId()
+		if err != nil {
+			return ArticleData{}, err
+		}
+
+		return ArticleData{
+			partNum:   segment.Number,
+			partTotal: int64(len(r.nzb.Files[0].Segments)),
+			partSize:  int64(len(chunk)),
+			partBegin: begin,
+			partEnd:   begin + int64(len(chunk)),
+			fileNum:   1,
+			fileTotal: len(r.nzb.Files),
+			fileSize:  r.metadata.FileSize,
+			fileName:  r.fileName,
+			poster:    generateRandomPoster(),
+			group:     r.group,
+			msgId:     msgId,
+		}, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.reposted++
+
+	return nil
+}
+
+// rewriteNzb replaces the nzb file, the new content is written to a temporary file that is
+// renamed over the original one
+func (u *fileWriter) rewriteNzb(nzbPath string, n *nzb.Nzb) error {
+	info, err := u.fs.Stat(nzbPath)
+	if err != nil {
+		return err
+	}
+
+	b, err := n.ToBytes()
+	if err != nil {
+		return err
+	}
+
+	tmpPath := nzbPath + ".tmp"
+	if err := u.fs.WriteFile(tmpPath, b, info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	if err := u.fs.Rename(tmpPath, nzbPath); err != nil {
+		return errors.Join(err, u.fs.Remove(tmpPath))
+	}
+
+	return nil
+}
+
+// retrieveMissingSegment asks every download provider for the segment. When any of them does
+// not have it, the segment is downloaded into chunk from another provider or the segment cache
+// and true is returned.
+func (u *fileWriter) retrieveMissingSegment(
+	ctx context.Context,
+	segment *nzb.NzbSegment,
+	groups []string,
+	chunk []byte,
+) (bool, error) {
+	missingOn, available, err := u.statSegment(ctx, segment.Id)
+	if err != nil {
+		return false, err
+	}
+
+	if len(missingOn) == 0 {
+		return false, nil
+	}
+
+	if u.segmentCache != nil && u.segmentCache.Get(segment.Id, chunk) {
+		return true, nil
+	}
+
+	if available {
+		err := u.downloadSegment(ctx, segment.Id, groups, chunk, missingOn)
+		if err == nil {
+			return true, nil
+		}
+
+		if !errors.Is(err, ErrSegmentNotRetrievable) {
+			return false, err
+		}
+	}
+
+	return false, ErrSegmentNotRetrievable
+}
+
+// readSegment reads the segment from the segment cache or downloads it from any provider
+func (u *fileWriter) readSegment(ctx context.Context, segment *nzb.NzbSegment, groups []string, chunk []byte) error {
+	if u.segmentCache != nil && u.segmentCache.Get(segment.Id, chunk) {
+		return nil
+	}
+
+	return u.downloadSegment(ctx, segment.Id, groups, chunk, nil)
+}
+
+// statSegment sends a STAT to every download provider, it returns the providers that do not
+// have the article and whether any provider has it
+func (u *fileWriter) statSegment(ctx context.Context, msgId string) ([]string, bool, error) {
+	var missingOn, checked []string
+	available := false
+	for {
+		conn, err := u.cp.GetDownloadConnection(
+			ctx,
+			connectionpool.WithPriority(connectionpool.PriorityMaintenance),
+			connectionpool.WithExcludedProviders(checked...),
+		)
+		if err != nil {
+			if len(checked) > 0 &&
+				(errors.Is(err, connectionpool.ErrNoProviderAvailable) || errors.Is(err, connectionpool.ErrNoHealthyProvider)) {
+				return missingOn, available, nil
+			}
+
+			return nil, false, fmt.Errorf("error getting nntp connection: %w", err)
+		}
+
+		nntpConn := conn.Value()
+		provider := nntpConn.Provider()
+
+		err = nntpConn.Stat(msgId)
+		if err != nil && !nntpcli.IsArticleNotFoundError(err) {
+			u.cp.Close(conn)
+			return nil, false, fmt.Errorf("error checking article on %s: %w", provider.Host, err)
+		}
+		u.cp.Free(conn)
+
+		checked = append(checked, provider.Id)
+		if err != nil {
+			missingOn = append(missingOn, provider.Id)
+		} else {
+			available = true
+		}
+	}
+}
+
+// downloadSegment downloads the article from the providers that were not excluded
+func (u *fileWriter) downloadSegment(
+	ctx context.Context,
+	msgId string,
+	groups []string,
+	chunk []byte,
+	excluded []string,
+) error {
+	for {
+		conn, err := u.cp.GetDownloadConnection(
+			ctx,
+			connectionpool.WithPriority(connectionpool.PriorityMaintenance),
+			connectionpool.WithExcludedProviders(excluded...),
+		)
+		if err != nil {
+			if errors.Is(err, connectionpool.ErrNoProviderAvailable) || errors.Is(err, connectionpool.ErrNoHealthyProvider) {
+				return ErrSegmentNotRetrievable
+			}
+
+			return fmt.Errorf("error getting nntp connection: %w", err)
+		}
+
+		nntpConn := conn.Value()
+		provider := nntpConn.Provider()
+
+		if provider.JoinGroup {
+			if err := usenet.JoinGroup(nntpConn, groups); err != nil {
+				u.cp.Close(conn)
+				return fmt.Errorf("error joining group: %w", err)
+			}
+		}
+
+		_, err = nntpConn.Body(msgId, chunk)
+		if err == nil || errors.Is(err, io.ErrUnexpectedEOF) {
+			u.cp.Free(conn)
+			return nil
+		}
+
+		if !nntpcli.IsArticleNotFoundError(err) && !errors.Is(err, nntpcli.ErrCorruptedArticle) {
+			u.cp.Close(conn)
+			return fmt.Errorf("error getting body from %s: %w", provider.Host, err)
+		}
+
+		// The connection is still usable, try the next provider
+		u.cp.Free(conn)
+		excluded = append(excluded, provider.Id)
+	}
+}
+
+// forEachIndex calls fn for the indexes from 0 to n, with up to repairWorkers goroutines.
+// It stops on the first error.
+func forEachIndex(ctx context.Context, n int, fn func(ctx context.Context, i int) error) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	indexes := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < min(repairWorkers, n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range indexes {
+				if err := fn(ctx, i); err != nil {
+					cancel(err)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	return context.Cause(ctx)
+}
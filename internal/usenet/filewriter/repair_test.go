@@ -0,0 +1,263 @@
+package filewriter
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/javi11/usenet-drive/internal/usenet/connectionpool"
+	"github.com/javi11/usenet-drive/internal/usenet/nzbloader"
+	"github.com/javi11/usenet-drive/internal/usenet/segmentcache"
+	"github.com/javi11/usenet-drive/pkg/nntpcli"
+	"github.com/javi11/usenet-drive/pkg/nzb"
+	"github.com/javi11/usenet-drive/pkg/osfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const repairNzb = `<?xml version="1.0" encoding="utf-8"?>
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+	<head>
+		<meta type="file_size">5</meta>
+		<meta type="file_name">file.bin</meta>
+		<meta type="file_extension">.bin</meta>
+		<meta type="mod_time">2023-09-22 20:06:09</meta>
+		<meta type="chunk_size">10</meta>
+	</head>
+	<file poster="poster" date="1695410374" subject="[1/1] - &quot;hash&quot; yEnc (1/1)">
+		<groups>
+			<group>alt.binaries.test</group>
+		</groups>
+		<segments>
+			<segment bytes="5" number="1">a1@test</segment>
+		</segments>
+	</file>
+</nzb>`
+
+type fakeNzbInvalidator struct {
+	invalidated []string
+}
+
+func (f *fakeNzbInvalidator) InvalidateNzb(_ context.Context, nzbPath string) {
+	f.invalidated = append(f.invalidated, nzbPath)
+}
+
+func TestFileWriter_RepairNzb(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	notFound := &textproto.Error{Code: nntpcli.ArticleNotFoundErrCode, Msg: "No such article"}
+
+	newNzb := func(t *testing.T) string {
+		path := filepath.Join(t.TempDir(), "file.nzb")
+		require.NoError(t, os.WriteFile(path, []byte(repairNzb), 0644))
+
+		return path
+	}
+
+	readNzb := func(t *testing.T, path string) *nzb.Nzb {
+		f, err := os.Open(path)
+		require.NoError(t, err)
+		defer f.Close()
+
+		n, err := nzb.ParseFromBuffer(f)
+		require.NoError(t, err)
+
+		return n
+	}
+
+	newResource := func(provider nntpcli.Provider, statErr error) *connectionpool.MockResource {
+		mockConn := nntpcli.NewMockConnection(ctrl)
+		mockConn.EXPECT().Provider().Return(provider).AnyTimes()
+		mockConn.EXPECT().Stat("a1@test").Return(statErr).AnyTimes()
+		mockResource := connectionpool.NewMockResource(ctrl)
+		mockResource.EXPECT().Value().Return(mockConn).AnyTimes()
+
+		return mockResource
+	}
+
+	newFileWriter := func(cp connectionpool.UsenetConnectionPool, sc segmentcache.SegmentCache, options ...Option) *fileWriter {
+		return NewFileWriter(append([]Option{
+			WithConnectionPool(cp),
+			WithLogger(slog.Default()),
+			WithFileSystem(osfs.New()),
+			WithMaxUploadRetries(1),
+			WithSegmentCache(sc),
+		}, options...)...)
+	}
+
+	t.Run("Segment missing in all the providers is restored from the cache", func(t *testing.T) {
+		path := newNzb(t)
+		cp := connectionpool.NewMockUsenetConnectionPool(ctrl)
+		sc := segmentcache.NewMockSegmentCache(ctrl)
+		invalidator := &fakeNzbInvalidator{}
+		segmentIndex := nzbloader.NewMockSegmentIndexRepository(ctrl)
+		fw := newFileWriter(cp, sc, WithNzbInvalidator(invalidator), WithSegmentIndexRepository(segmentIndex))
+
+		download := newResource(nntpcli.Provider{Id: "p1"}, notFound)
+		gomock.InOrder(
+			cp.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(download, nil).Times(1),
+			cp.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).
+				Return(nil, connectionpool.ErrNoProviderAvailable).Times(1),
+		)
+		cp.EXPECT().Free(download).Times(1)
+
+		sc.EXPECT().Get("a1@test", gomock.Any()).DoAndReturn(func(_ string, chunk []byte) bool {
+			assert.Len(t, chunk, 5)
+			copy(chunk, "hello")
+			return true
+		}).Times(1)
+
+		uploadConn := nntpcli.NewMockConnection(ctrl)
+		upload := connectionpool.NewMockResource(ctrl)
+		upload.EXPECT().Value().Return(uploadConn).Times(1)
+		cp.EXPECT().GetUploadConnection(gomock.Any()).Return(upload, nil).Times(1)
+		cp.EXPECT().Free(upload).Times(1)
+		uploadConn.EXPECT().Post(gomock.Any()).DoAndReturn(func(r io.Reader) error {
+			b, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Contains(t, string(b), `Subject: [1/1] - "hash" yEnc (1/1)`)
+			assert.Contains(t, string(b), "=ypart begin=1 end=5")
+			return nil
+		}).Times(1)
+
+		// The index of the previous segments is deleted
+		segmentIndex.EXPECT().Delete(gomock.Any(), path).Return(nil).Times(1)
+
+		result, err := fw.RepairNzb(context.Background(), path)
+		require.NoError(t, err)
+		assert.Equal(t, RepairResult{Reposted: 1}, result)
+
+		n := readNzb(t, path)
+		require.Len(t, n.Files[0].Segments, 1)
+		segment := n.Files[0].Segments[0]
+		assert.NotEqual(t, "a1@test", segment.Id)
+		assert.Equal(t, int64(1), segment.Number)
+		assert.Equal(t, int64(5), segment.Bytes)
+		assert.Equal(t, "file.bin", n.Meta["file_name"])
+		assert.NoFileExists(t, path+".tmp")
+		// The open readers of the nzb are notified
+		assert.Equal(t, []string{path}, invalidator.invalidated)
+	})
+
+	t.Run("Segment available in all the providers is not re-posted", func(t *testing.T) {
+		path := newNzb(t)
+		cp := connectionpool.NewMockUsenetConnectionPool(ctrl)
+		fw := newFileWriter(cp, nil)
+
+		p1 := newResource(nntpcli.Provider{Id: "p1"}, nil)
+		p2 := newResource(nntpcli.Provider{Id: "p2"}, nil)
+		gomock.InOrder(
+			cp.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(p1, nil).Times(1),
+			cp.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(p2, nil).Times(1),
+			cp.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).
+				Return(nil, connectionpool.ErrNoProviderAvailable).Times(1),
+		)
+		cp.EXPECT().Free(p1).Times(1)
+		cp.EXPECT().Free(p2).Times(1)
+
+		result, err := fw.RepairNzb(context.Background(), path)
+		require.NoError(t, err)
+		assert.Equal(t, RepairResult{}, result)
+		assert.Equal(t, "a1@test", readNzb(t, path).Files[0].Segments[0].Id)
+	})
+
+	t.Run("Segment not retrievable", func(t *testing.T) {
+		path := newNzb(t)
+		cp := connectionpool.NewMockUsenetConnectionPool(ctrl)
+		fw := newFileWriter(cp, nil)
+
+		download := newResource(nntpcli.Provider{Id: "p1"}, notFound)
+		gomock.InOrder(
+			cp.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).Return(download, nil).Times(1),
+			cp.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).
+				Return(nil, connectionpool.ErrNoProviderAvailable).Times(1),
+		)
+		cp.EXPECT().Free(download).Times(1)
+
+		result, err := fw.RepairNzb(context.Background(), path)
+		assert.ErrorIs(t, err, ErrSegmentNotRetrievable)
+		assert.Equal(t, []int64{1}, result.Unrepaired)
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, repairNzb, string(content))
+	})
+}
+
+func TestFileWriter_StartRepair(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	path := filepath.Join(t.TempDir(), "file.nzb")
+	require.NoError(t, os.WriteFile(path, []byte(repairNzb), 0644))
+
+	cp := connectionpool.NewMockUsenetConnectionPool(ctrl)
+	fw := NewFileWriter(
+		WithConnectionPool(cp),
+		WithLogger(slog.Default()),
+		WithFileSystem(osfs.New()),
+	)
+
+	// The repair is blocked on the first connection until the test releases it
+	release := make(chan struct{})
+	mockConn := nntpcli.NewMockConnection(ctrl)
+	mockConn.EXPECT().Provider().Return(nntpcli.Provider{Id: "p1"}).AnyTimes()
+	mockConn.EXPECT().Stat("a1@test").Return(nil).Times(1)
+	download := connectionpool.NewMockResource(ctrl)
+	download.EXPECT().Value().Return(mockConn).AnyTimes()
+	gomock.InOrder(
+		cp.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _ ...connectionpool.AcquireOption) (connectionpool.Resource, error) {
+				<-release
+				return download, nil
+			},
+		).Times(1),
+		cp.EXPECT().GetDownloadConnection(gomock.Any(), gomock.Any()).
+			Return(nil, connectionpool.ErrNoProviderAvailable).Times(1),
+	)
+	cp.EXPECT().Free(download).Times(1)
+
+	_, ok := fw.GetRepairStatus(path)
+	assert.False(t, ok)
+
+	done := make(chan error, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	err := fw.StartRepair(ctx, path, func(_ context.Context, _ RepairResult, err error) {
+		done <- err
+	})
+	require.NoError(t, err)
+	// The repair is not bound to the request that started it
+	cancel()
+
+	status, ok := fw.GetRepairStatus(path)
+	assert.True(t, ok)
+	assert.True(t, status.Running)
+
+	err = fw.StartRepair(context.Background(), path, nil)
+	assert.ErrorIs(t, err, ErrRepairRunning)
+
+	close(release)
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the repair did not finish")
+	}
+
+	assert.Eventually(t, func() bool {
+		status, _ := fw.GetRepairStatus(path)
+		return !status.Running
+	}, 5*time.Second, 10*time.Millisecond)
+
+	status, _ = fw.GetRepairStatus(path)
+	assert.NotNil(t, status.FinishedAt)
+	assert.Empty(t, status.Error)
+	assert.Equal(t, RepairResult{}, status.Result)
+}
@@ -13,6 +13,14 @@ type Metadata struct {
 	FileSize      int64     `json:"file_size"`
 	ModTime       time.Time `json:"mod_time"`
 	ChunkSize     int64     `json:"chunk_size"`
+	// Number of par2 recovery slices posted for each recovery set, 0 if it has no recovery data
+	RecoverySlices int `json:"recovery_slices"`
+	// Number of segments of each par2 recovery set, the last one can be shorter. 0 if it has no
+	// recovery data
+	RecoverySetSize int `json:"recovery_set_size"`
+	// Max segments prefetched ahead of the reads of the file, it replaces the global max. Nil
+	// when the nzb does not set it.
+	MaxReadAheadSegments *int `json:"max_read_ahead_segments,omitempty"`
 }
 
 func LoadMetadataFromMap(metadata map[string]string) (Metadata, error) {
@@ -47,6 +55,32 @@ func LoadMetadataFromMap(metadata map[string]string) (Metadata, error) {
 		}
 	}
 
+	recoverySlices := 0
+	if rs := metadata["par2_recovery_slices"]; rs != "" {
+		recoverySlices, err = strconv.Atoi(rs)
+		if err != nil {
+			return Metadata{}, err
+		}
+	}
+
+	recoverySetSize := 0
+	if recoverySlices > 0 {
+		recoverySetSize, err = strconv.Atoi(metadata["par2_recovery_set_size"])
+		if err != nil || recoverySetSize <= 0 {
+			return Metadata{}, fmt.Errorf("corrupted nzb file, par2 recovery set size not found")
+		}
+	}
+
+	var maxReadAheadSegments *int
+	if rs := metadata["max_read_ahead_segments"]; rs != "" {
+		v, err := strconv.Atoi(rs)
+		if err != nil {
+			return Metadata{}, err
+		}
+
+		maxReadAheadSegments = &v
+	}
+
 	modTime, err := time.Parse(time.DateTime, metadata["mod_time"])
 	if err != nil {
 		return Metadata{}, err
@@ -57,14 +91,26 @@ func LoadMetadataFromMap(metadata map[string]string) (Metadata, error) {
 	}
 
 	return Metadata{
-		FileName:      metadata["file_name"],
-		FileExtension: metadata["file_extension"],
-		FileSize:      fileSize,
-		ChunkSize:     chunkSize,
-		ModTime:       modTime,
+		FileName:             metadata["file_name"],
+		FileExtension:        metadata["file_extension"],
+		FileSize:             fileSize,
+		ChunkSize:            chunkSize,
+		ModTime:              modTime,
+		RecoverySlices:       recoverySlices,
+		RecoverySetSize:      recoverySetSize,
+		MaxReadAheadSegments: maxReadAheadSegments,
 	}, nil
 }
 
+// Segments returns the number of segments of the file
+func (m Metadata) Segments() int {
+	if m.ChunkSize <= 0 {
+		return 0
+	}
+
+	return int((m.FileSize + m.ChunkSize - 1) / m.ChunkSize)
+}
+
 func getChunkSizeFromSubject(s string) (int64, error) {
 	re := regexp.MustCompile(`size=(\d+)`)
 	matches := re.FindStringSubmatch(s)
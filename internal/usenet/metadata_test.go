@@ -32,6 +32,64 @@ func TestLoadMetadataFromMap(t *testing.T) {
 		}
 	})
 
+	t.Run("Par2 recovery slices without the recovery set size", func(t *testing.T) {
+		input := map[string]string{
+			"file_name":            "test_file",
+			"file_size":            "100",
+			"mod_time":             "2006-01-02 15:04:05",
+			"file_extension":       "txt",
+			"chunk_size":           "10",
+			"subject":              "test_file [10/10] size=10",
+			"par2_recovery_slices": "2",
+		}
+		_, err := LoadMetadataFromMap(input)
+		if err == nil {
+			t.Errorf("expected error, but got nil")
+		}
+	})
+
+	t.Run("Valid nzb file with par2 recovery sets", func(t *testing.T) {
+		input := map[string]string{
+			"file_name":              "test_file",
+			"file_size":              "100",
+			"mod_time":               "2006-01-02 15:04:05",
+			"file_extension":         "txt",
+			"chunk_size":             "10",
+			"subject":                "test_file [10/10] size=10",
+			"par2_recovery_slices":   "1",
+			"par2_recovery_set_size": "4",
+		}
+		metadata, err := LoadMetadataFromMap(input)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if metadata.RecoverySlices != 1 {
+			t.Errorf("unexpected recovery slices: got %v, want 1", metadata.RecoverySlices)
+		}
+		if metadata.RecoverySetSize != 4 {
+			t.Errorf("unexpected recovery set size: got %v, want 4", metadata.RecoverySetSize)
+		}
+	})
+
+	t.Run("Valid nzb file with its own max read-ahead", func(t *testing.T) {
+		input := map[string]string{
+			"file_name":               "test_file",
+			"file_size":               "100",
+			"mod_time":                "2006-01-02 15:04:05",
+			"file_extension":          "txt",
+			"chunk_size":              "10",
+			"subject":                 "test_file [10/10] size=10",
+			"max_read_ahead_segments": "0",
+		}
+		metadata, err := LoadMetadataFromMap(input)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if metadata.MaxReadAheadSegments == nil || *metadata.MaxReadAheadSegments != 0 {
+			t.Errorf("unexpected max read-ahead segments: got %v, want 0", metadata.MaxReadAheadSegments)
+		}
+	})
+
 	// Test case 2: Missing required metadata
 	t.Run("Missing required metadata", func(t *testing.T) {
 		input := map[string]string{
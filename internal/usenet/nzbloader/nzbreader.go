@@ -6,6 +6,7 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"sync"
 
 	"github.com/javi11/usenet-drive/internal/usenet"
 	"github.com/javi11/usenet-drive/pkg/nzb"
@@ -15,29 +16,54 @@ type NzbReader interface {
 	GetMetadata() (usenet.Metadata, error)
 	GetGroups() ([]string, error)
 	GetSegment(segmentIndex int) (nzb.NzbSegment, bool)
+	// GetRecoverySegment returns a segment of the par2 recovery file, the second file of the nzb
+	GetRecoverySegment(segmentIndex int) (nzb.NzbSegment, bool)
 	Close()
 }
 
 type nzbReader struct {
+	// Protects the segments, they are read by the download workers at the same time
+	mx       sync.Mutex
 	decoder  *xml.Decoder
 	metadata usenet.Metadata
 	groups   []string
 	segments map[int64]nzb.NzbSegment
-	close    chan struct{}
+	// Segments of the par2 recovery file
+	recoverySegments map[int64]nzb.NzbSegment
+	// Number of file elements read from the XML stream
+	files int
+	close chan struct{}
+	// Optional, the segments are looked up in it instead of the XML stream
+	index *SegmentIndex
 }
 
 func NewNzbReader(reader io.Reader) NzbReader {
 	return &nzbReader{
-		decoder:  xml.NewDecoder(reader),
-		segments: map[int64]nzb.NzbSegment{},
-		close:    make(chan struct{}),
+		decoder:          xml.NewDecoder(reader),
+		segments:         map[int64]nzb.NzbSegment{},
+		recoverySegments: map[int64]nzb.NzbSegment{},
+		close:            make(chan struct{}),
 	}
 }
 
+// NewIndexedNzbReader returns a reader that finds the segments in the index, the XML stream
+// is only read for the metadata and the groups.
+func NewIndexedNzbReader(reader io.Reader, index *SegmentIndex) NzbReader {
+	r := NewNzbReader(reader).(*nzbReader)
+	r.index = index
+
+	return r
+}
+
 func (r *nzbReader) Close() {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
 	close(r.close)
 	clear(r.segments)
 	r.segments = nil
+	clear(r.recoverySegments)
+	r.recoverySegments = nil
 	clear(r.groups)
 	r.groups = nil
 }
@@ -79,6 +105,8 @@ func (r *nzbReader) GetMetadata() (usenet.Metadata, error) {
 					metadata[key] = value
 				}
 				if se.Name.Local == "file" {
+					r.files++
+
 					var value string
 					for _, attr := range se.Attr {
 						if attr.Name.Local == "subject" {
@@ -165,44 +193,83 @@ func (r *nzbReader) GetGroups() ([]string, error) {
 }
 
 func (r *nzbReader) GetSegment(segmentIndex int) (nzb.NzbSegment, bool) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	return r.getSegment(segmentIndex, false)
+}
+
+func (r *nzbReader) GetRecoverySegment(segmentIndex int) (nzb.NzbSegment, bool) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	return r.getSegment(segmentIndex, true)
+}
+
+func (r *nzbReader) getSegment(segmentIndex int, recovery bool) (nzb.NzbSegment, bool) {
+	if r.index != nil {
+		if recovery {
+			return r.index.RecoverySegment(segmentIndex)
+		}
+
+		return r.index.Segment(segmentIndex)
+	}
+
 	segmentNumber := int64(segmentIndex + 1)
-	// Check if the segment is already in the cache
-	if s, ok := r.segments[segmentNumber]; ok {
-		return s, true
+	for {
+		segments := r.segments
+		if recovery {
+			segments = r.recoverySegments
+		}
+
+		// Check if the segment is already in the cache
+		if s, ok := segments[segmentNumber]; ok {
+			return s, true
+		}
+
+		// Check if there are more segments to read from the XML stream
+		if !r.readSegment() {
+			return nzb.NzbSegment{}, false
+		}
 	}
+}
 
-	// Check if there are more segments to read from the XML stream
+// readSegment reads the next segment from the XML stream and caches it with the segments
+// of its file. It reports false at the end of the stream.
+func (r *nzbReader) readSegment() bool {
 	for {
 		select {
 		case <-r.close:
-			return nzb.NzbSegment{}, false
+			return false
 		default:
 			token, err := r.decoder.Token()
 			if err != nil {
-				return nzb.NzbSegment{}, false
+				return false
+			}
+
+			se, ok := token.(xml.StartElement)
+			if !ok {
+				continue
 			}
 
-			if se, ok := token.(xml.StartElement); ok && se.Name.Local == "segment" {
-				// Read the next segment from the XML stream
+			switch se.Name.Local {
+			case "file":
+				r.files++
+			case "segment":
 				var segment nzb.NzbSegment
 				err := r.decoder.DecodeElement(&segment, &se)
-				if err != nil {
-					return nzb.NzbSegment{}, false
-				}
-
-				if r.segments == nil {
-					break
+				if err != nil || r.segments == nil {
+					return false
 				}
 
-				r.segments[segmentNumber] = segment
-
-				if segment.Number == segmentNumber {
-					return segment, true
+				if r.files <= 1 {
+					r.segments[segment.Number] = segment
+				} else if r.files == 2 {
+					r.recoverySegments[segment.Number] = segment
 				}
 
-				continue
+				return true
 			}
 		}
 	}
-
 }
@@ -77,6 +77,21 @@ func (mr *MockNzbReaderMockRecorder) GetMetadata() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMetadata", reflect.TypeOf((*MockNzbReader)(nil).GetMetadata))
 }
 
+// GetRecoverySegment mocks base method.
+func (m *MockNzbReader) GetRecoverySegment(segmentIndex int) (nzb.NzbSegment, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRecoverySegment", segmentIndex)
+	ret0, _ := ret[0].(nzb.NzbSegment)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// GetRecoverySegment indicates an expected call of GetRecoverySegment.
+func (mr *MockNzbReaderMockRecorder) GetRecoverySegment(segmentIndex interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRecoverySegment", reflect.TypeOf((*MockNzbReader)(nil).GetRecoverySegment), segmentIndex)
+}
+
 // GetSegment mocks base method.
 func (m *MockNzbReader) GetSegment(segmentIndex int) (nzb.NzbSegment, bool) {
 	m.ctrl.T.Helper()
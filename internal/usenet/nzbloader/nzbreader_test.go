@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/javi11/usenet-drive/pkg/mmap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var segments = []struct {
@@ -96,3 +99,63 @@ func BenchmarkGetSegmentWithoutMMap(b *testing.B) {
 		})
 	}
 }
+
+func TestNzbReader_GetRecoverySegment(t *testing.T) {
+	nzbFile := `<?xml version="1.0" encoding="UTF-8"?>
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <head>
+    <meta type="file_size">6</meta>
+    <meta type="file_name">test.bin</meta>
+    <meta type="mod_time">2023-09-22 20:06:09</meta>
+    <meta type="file_extension">.bin</meta>
+    <meta type="chunk_size">3</meta>
+    <meta type="par2_recovery_slices">1</meta>
+    <meta type="par2_recovery_set_size">2</meta>
+  </head>
+  <file poster="poster" date="1695410374" subject="[1/2] - test.bin">
+    <groups>
+      <group>alt.binaries.test</group>
+    </groups>
+    <segments>
+      <segment bytes="3" number="1">data-1@test</segment>
+      <segment bytes="3" number="2">data-2@test</segment>
+    </segments>
+  </file>
+  <file poster="poster" date="1695410374" subject="[2/2] - test.bin.vol00+01.par2">
+    <groups>
+      <group>alt.binaries.test</group>
+    </groups>
+    <segments>
+      <segment bytes="72" number="1">par2-1@test</segment>
+    </segments>
+  </file>
+</nzb>`
+
+	t.Run("Segments of the data and the recovery file", func(t *testing.T) {
+		reader := NewNzbReader(strings.NewReader(nzbFile))
+		defer reader.Close()
+
+		metadata, err := reader.GetMetadata()
+		require.NoError(t, err)
+		assert.Equal(t, 1, metadata.RecoverySlices)
+
+		// The recovery segment is read before the data segments
+		s, ok := reader.GetRecoverySegment(0)
+		require.True(t, ok)
+		assert.Equal(t, "par2-1@test", s.Id)
+
+		s, ok = reader.GetSegment(1)
+		require.True(t, ok)
+		assert.Equal(t, "data-2@test", s.Id)
+
+		s, ok = reader.GetSegment(0)
+		require.True(t, ok)
+		assert.Equal(t, "data-1@test", s.Id)
+
+		_, ok = reader.GetSegment(2)
+		assert.False(t, ok)
+
+		_, ok = reader.GetRecoverySegment(1)
+		assert.False(t, ok)
+	})
+}
@@ -0,0 +1,236 @@
+package nzbloader
+
+import (
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+
+	"github.com/javi11/usenet-drive/pkg/nzb"
+)
+
+const (
+	segmentIndexMagic   = "UDSI"
+	segmentIndexVersion = 1
+	// magic, version, number of segments and number of recovery segments
+	segmentIndexHeaderSize = len(segmentIndexMagic) + 1 + 4 + 4
+	// end of the message id and size of the article
+	segmentIndexEntrySize = 4 + 4
+	// Segments that can be missing in the nzb on top of half of them
+	maxMissingSegments = 16
+)
+
+var ErrInvalidSegmentIndex = errors.New("invalid segment index")
+
+// SegmentIndex maps the segment numbers of an nzb to their message ids, so a segment is found
+// without parsing the nzb up to it. The byte offset of a segment in the file is its index
+// multiplied by the chunk size of the file.
+//
+// The binary format is little endian: the header with the number of segments and recovery
+// segments, a table with an entry for every segment number with the end of its message id
+// and the size of its article, and the message ids one after the other. The segments missing
+// in the nzb have an empty message id.
+type SegmentIndex struct {
+	data             []byte
+	segments         int
+	recoverySegments int
+}
+
+// BuildSegmentIndex parses the segments of the nzb, the ones of the first file and of the
+// par2 recovery file, the second one.
+func BuildSegmentIndex(reader io.Reader) (*SegmentIndex, error) {
+	segments := map[int64]nzb.NzbSegment{}
+	recoverySegments := map[int64]nzb.NzbSegment{}
+
+	files := 0
+	decoder := xml.NewDecoder(reader)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+
+			return nil, err
+		}
+
+		se, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch se.Name.Local {
+		case "file":
+			files++
+		case "segment":
+			var segment nzb.NzbSegment
+			if err := decoder.DecodeElement(&segment, &se); err != nil {
+				return nil, err
+			}
+
+			// The last segment with a number wins, like in the nzb reader
+			if files <= 1 {
+				segments[segment.Number] = segment
+			} else if files == 2 {
+				recoverySegments[segment.Number] = segment
+			}
+		}
+	}
+
+	s, err := sortSegments(segments)
+	if err != nil {
+		return nil, err
+	}
+
+	rs, err := sortSegments(recoverySegments)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSegmentIndex(s, rs)
+}
+
+// sortSegments returns the segments by number, the missing ones are left empty
+func sortSegments(segments map[int64]nzb.NzbSegment) ([]nzb.NzbSegment, error) {
+	var last int64
+	for number := range segments {
+		if number < 1 {
+			return nil, fmt.Errorf("invalid segment number %d", number)
+		}
+		last = max(last, number)
+	}
+
+	// A few segments can be missing, not most of them
+	if last > int64(2*len(segments)+maxMissingSegments) {
+		return nil, fmt.Errorf("too many missing segments, %d of %d", last-int64(len(segments)), last)
+	}
+
+	sorted := make([]nzb.NzbSegment, last)
+	for number, segment := range segments {
+		sorted[number-1] = segment
+	}
+
+	return sorted, nil
+}
+
+func newSegmentIndex(segments, recoverySegments []nzb.NzbSegment) (*SegmentIndex, error) {
+	all := append(slices.Clip(segments), recoverySegments...)
+	size := segmentIndexHeaderSize + len(all)*segmentIndexEntrySize
+	for _, s := range all {
+		size += len(s.Id)
+	}
+
+	if size > math.MaxUint32 {
+		return nil, fmt.Errorf("segment index too big: %d bytes", size)
+	}
+
+	data := make([]byte, segmentIndexHeaderSize, size)
+	copy(data, segmentIndexMagic)
+	data[len(segmentIndexMagic)] = segmentIndexVersion
+	binary.LittleEndian.PutUint32(data[len(segmentIndexMagic)+1:], uint32(len(segments)))
+	binary.LittleEndian.PutUint32(data[len(segmentIndexMagic)+5:], uint32(len(recoverySegments)))
+
+	end := 0
+	for _, s := range all {
+		end += len(s.Id)
+		data = binary.LittleEndian.AppendUint32(data, uint32(end))
+		data = binary.LittleEndian.AppendUint32(data, uint32(min(max(s.Bytes, 0), math.MaxUint32)))
+	}
+
+	for _, s := range all {
+		data = append(data, s.Id...)
+	}
+
+	return &SegmentIndex{
+		data:             data,
+		segments:         len(segments),
+		recoverySegments: len(recoverySegments),
+	}, nil
+}
+
+// Segment returns the segment of the file by index, starting at 0
+func (si *SegmentIndex) Segment(segmentIndex int) (nzb.NzbSegment, bool) {
+	if segmentIndex < 0 || segmentIndex >= si.segments {
+		return nzb.NzbSegment{}, false
+	}
+
+	return si.entry(segmentIndex)
+}
+
+// RecoverySegment returns the segment of the par2 recovery file by index, starting at 0
+func (si *SegmentIndex) RecoverySegment(segmentIndex int) (nzb.NzbSegment, bool) {
+	if segmentIndex < 0 || segmentIndex >= si.recoverySegments {
+		return nzb.NzbSegment{}, false
+	}
+
+	s, ok := si.entry(si.segments + segmentIndex)
+	if !ok {
+		return nzb.NzbSegment{}, false
+	}
+	s.Number -= int64(si.segments)
+
+	return s, true
+}
+
+func (si *SegmentIndex) entry(i int) (nzb.NzbSegment, bool) {
+	ids := segmentIndexHeaderSize + (si.segments+si.recoverySegments)*segmentIndexEntrySize
+	offset := segmentIndexHeaderSize + i*segmentIndexEntrySize
+
+	begin := 0
+	if i > 0 {
+		begin = int(binary.LittleEndian.Uint32(si.data[offset-segmentIndexEntrySize:]))
+	}
+	end := int(binary.LittleEndian.Uint32(si.data[offset:]))
+
+	if begin == end {
+		return nzb.NzbSegment{}, false
+	}
+
+	return nzb.NzbSegment{
+		Bytes:  int64(binary.LittleEndian.Uint32(si.data[offset+4:])),
+		Number: int64(i + 1),
+		Id:     string(si.data[ids+begin : ids+end]),
+	}, true
+}
+
+func (si *SegmentIndex) MarshalBinary() ([]byte, error) {
+	return si.data, nil
+}
+
+// UnmarshalBinary loads an index, the data is validated so the lookups never fail
+func (si *SegmentIndex) UnmarshalBinary(data []byte) error {
+	if len(data) < segmentIndexHeaderSize ||
+		string(data[:len(segmentIndexMagic)]) != segmentIndexMagic ||
+		data[len(segmentIndexMagic)] != segmentIndexVersion {
+		return ErrInvalidSegmentIndex
+	}
+
+	segments := int(binary.LittleEndian.Uint32(data[len(segmentIndexMagic)+1:]))
+	recoverySegments := int(binary.LittleEndian.Uint32(data[len(segmentIndexMagic)+5:]))
+	ids := segmentIndexHeaderSize + (segments+recoverySegments)*segmentIndexEntrySize
+	if ids > len(data) {
+		return ErrInvalidSegmentIndex
+	}
+
+	// The ends of the message ids must grow up to the end of the data
+	end := 0
+	for i := 0; i < segments+recoverySegments; i++ {
+		e := int(binary.LittleEndian.Uint32(data[segmentIndexHeaderSize+i*segmentIndexEntrySize:]))
+		if e < end {
+			return ErrInvalidSegmentIndex
+		}
+		end = e
+	}
+	if ids+end != len(data) {
+		return ErrInvalidSegmentIndex
+	}
+
+	si.data = data
+	si.segments = segments
+	si.recoverySegments = recoverySegments
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package nzbloader
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javi11/usenet-drive/pkg/nzb"
+)
+
+const indexedNzbFile = `<?xml version="1.0" encoding="UTF-8"?>
+<nzb xmlns="http://www.newzbin.com/DTD/2003/nzb">
+  <head>
+    <meta type="file_size">9</meta>
+    <meta type="file_name">test.bin</meta>
+    <meta type="mod_time">2023-09-22 20:06:09</meta>
+    <meta type="file_extension">.bin</meta>
+    <meta type="chunk_size">3</meta>
+    <meta type="par2_recovery_slices">1</meta>
+    <meta type="par2_recovery_set_size">3</meta>
+  </head>
+  <file poster="poster" date="1695410374" subject="[1/2] - test.bin">
+    <groups>
+      <group>alt.binaries.test</group>
+    </groups>
+    <segments>
+      <segment bytes="3" number="1">data-1@test</segment>
+      <segment bytes="4" number="3">data-3@test</segment>
+    </segments>
+  </file>
+  <file poster="poster" date="1695410374" subject="[2/2] - test.bin.vol00+01.par2">
+    <groups>
+      <group>alt.binaries.test</group>
+    </groups>
+    <segments>
+      <segment bytes="72" number="1">par2-1@test</segment>
+    </segments>
+  </file>
+</nzb>`
+
+func TestSegmentIndex(t *testing.T) {
+	t.Run("Segments of the data and the recovery file", func(t *testing.T) {
+		index, err := BuildSegmentIndex(strings.NewReader(indexedNzbFile))
+		require.NoError(t, err)
+
+		s, ok := index.Segment(2)
+		require.True(t, ok)
+		assert.Equal(t, nzb.NzbSegment{Bytes: 4, Number: 3, Id: "data-3@test"}, s)
+
+		s, ok = index.Segment(0)
+		require.True(t, ok)
+		assert.Equal(t, nzb.NzbSegment{Bytes: 3, Number: 1, Id: "data-1@test"}, s)
+
+		// Missing in the nzb
+		_, ok = index.Segment(1)
+		assert.False(t, ok)
+		_, ok = index.Segment(3)
+		assert.False(t, ok)
+
+		s, ok = index.RecoverySegment(0)
+		require.True(t, ok)
+		assert.Equal(t, nzb.NzbSegment{Bytes: 72, Number: 1, Id: "par2-1@test"}, s)
+
+		_, ok = index.RecoverySegment(1)
+		assert.False(t, ok)
+	})
+
+	t.Run("Marshal and unmarshal", func(t *testing.T) {
+		index, err := BuildSegmentIndex(strings.NewReader(indexedNzbFile))
+		require.NoError(t, err)
+
+		data, err := index.MarshalBinary()
+		require.NoError(t, err)
+
+		loaded := &SegmentIndex{}
+		require.NoError(t, loaded.UnmarshalBinary(data))
+		assert.Equal(t, index, loaded)
+	})
+
+	t.Run("Invalid data", func(t *testing.T) {
+		index, err := BuildSegmentIndex(strings.NewReader(indexedNzbFile))
+		require.NoError(t, err)
+
+		data, err := index.MarshalBinary()
+		require.NoError(t, err)
+
+		for _, invalid := range [][]byte{
+			nil,
+			[]byte("nzb"),
+			append([]byte("XXXX"), data[4:]...),
+			data[:len(data)-1],
+			append(data, 'x'),
+		} {
+			assert.ErrorIs(t, (&SegmentIndex{}).UnmarshalBinary(invalid), ErrInvalidSegmentIndex)
+		}
+	})
+
+	t.Run("Nzb with most of the segments missing", func(t *testing.T) {
+		nzbFile := strings.Replace(indexedNzbFile, `number="3"`, `number="3000000000"`, 1)
+
+		_, err := BuildSegmentIndex(strings.NewReader(nzbFile))
+		assert.Error(t, err)
+	})
+}
+
+func TestNzbReader_Indexed(t *testing.T) {
+	index, err := BuildSegmentIndex(strings.NewReader(indexedNzbFile))
+	require.NoError(t, err)
+
+	reader := NewIndexedNzbReader(strings.NewReader(indexedNzbFile), index)
+
+	metadata, err := reader.GetMetadata()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), metadata.ChunkSize)
+
+	groups, err := reader.GetGroups()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alt.binaries.test"}, groups)
+
+	// The segments are found backwards, even after the reader is closed
+	reader.Close()
+
+	s, ok := reader.GetSegment(2)
+	require.True(t, ok)
+	assert.Equal(t, "data-3@test", s.Id)
+
+	s, ok = reader.GetSegment(0)
+	require.True(t, ok)
+	assert.Equal(t, "data-1@test", s.Id)
+
+	s, ok = reader.GetRecoverySegment(0)
+	require.True(t, ok)
+	assert.Equal(t, "par2-1@test", s.Id)
+}
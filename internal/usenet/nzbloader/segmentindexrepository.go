@@ -0,0 +1,116 @@
+package nzbloader
+
+//go:generate mockgen -source=./segmentindexrepository.go -destination=./segmentindexrepository_mock.go -package=nzbloader SegmentIndexRepository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+)
+
+// SegmentIndexRepository persists the segment indexes of the nzbs. An index is valid while
+// the size and modification time of its nzb do not change.
+type SegmentIndexRepository interface {
+	// Get returns the index of the nzb, nil if it was never built or the nzb changed since then
+	Get(ctx context.Context, path string, info os.FileInfo) (*SegmentIndex, error)
+	Save(ctx context.Context, path string, info os.FileInfo, index *SegmentIndex) error
+	// Delete removes the index of the nzb, or the indexes of the nzbs of a directory
+	Delete(ctx context.Context, path string) error
+	// Rename moves the index of the nzb, or the indexes of the nzbs of a directory, to the new path
+	Rename(ctx context.Context, oldPath, newPath string) error
+}
+
+type segmentIndexRepository struct {
+	db *sql.DB
+}
+
+func NewSegmentIndexRepository(db *sql.DB) SegmentIndexRepository {
+	return &segmentIndexRepository{db: db}
+}
+
+func (r *segmentIndexRepository) Get(ctx context.Context, path string, info os.FileInfo) (*SegmentIndex, error) {
+	var data []byte
+	err := r.db.QueryRowContext(
+		ctx,
+		"SELECT data FROM segment_index WHERE path = ? AND nzb_size = ? AND nzb_mod_time = ?",
+		path,
+		info.Size(),
+		info.ModTime().UnixNano(),
+	).Scan(&data)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	index := &SegmentIndex{}
+	if err := index.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	return index, nil
+}
+
+func (r *segmentIndexRepository) Save(ctx context.Context, path string, info os.FileInfo, index *SegmentIndex) error {
+	data, err := index.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(
+		ctx,
+		`INSERT INTO segment_index (path, nzb_size, nzb_mod_time, data) VALUES (?, ?, ?, ?)
+		ON CONFLICT (path) DO UPDATE SET nzb_size = excluded.nzb_size, nzb_mod_time = excluded.nzb_mod_time,
+		data = excluded.data`,
+		path,
+		info.Size(),
+		info.ModTime().UnixNano(),
+		data,
+	)
+
+	return err
+}
+
+func (r *segmentIndexRepository) Delete(ctx context.Context, path string) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		"DELETE FROM segment_index WHERE path = ?1 OR substr(path, 1, length(?1) + 1) = ?1 || '/'",
+		path,
+	)
+
+	return err
+}
+
+func (r *segmentIndexRepository) Rename(ctx context.Context, oldPath, newPath string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The indexes of the replaced nzbs are not valid anymore
+	_, err = tx.ExecContext(
+		ctx,
+		"DELETE FROM segment_index WHERE path = ?1 OR substr(path, 1, length(?1) + 1) = ?1 || '/'",
+		newPath,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`UPDATE segment_index SET path = ?2 || substr(path, length(?1) + 1)
+		WHERE path = ?1 OR substr(path, 1, length(?1) + 1) = ?1 || '/'`,
+		oldPath,
+		newPath,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
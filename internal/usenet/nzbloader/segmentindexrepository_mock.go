@@ -0,0 +1,93 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./segmentindexrepository.go
+
+// Package nzbloader is a generated GoMock package.
+package nzbloader
+
+import (
+	context "context"
+	os "os"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockSegmentIndexRepository is a mock of SegmentIndexRepository interface.
+type MockSegmentIndexRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockSegmentIndexRepositoryMockRecorder
+}
+
+// MockSegmentIndexRepositoryMockRecorder is the mock recorder for MockSegmentIndexRepository.
+type MockSegmentIndexRepositoryMockRecorder struct {
+	mock *MockSegmentIndexRepository
+}
+
+// NewMockSegmentIndexRepository creates a new mock instance.
+func NewMockSegmentIndexRepository(ctrl *gomock.Controller) *MockSegmentIndexRepository {
+	mock := &MockSegmentIndexRepository{ctrl: ctrl}
+	mock.recorder = &MockSegmentIndexRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSegmentIndexRepository) EXPECT() *MockSegmentIndexRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockSegmentIndexRepository) Delete(ctx context.Context, path string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, path)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockSegmentIndexRepositoryMockRecorder) Delete(ctx, path interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockSegmentIndexRepository)(nil).Delete), ctx, path)
+}
+
+// Get mocks base method.
+func (m *MockSegmentIndexRepository) Get(ctx context.Context, path string, info os.FileInfo) (*SegmentIndex, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, path, info)
+	ret0, _ := ret[0].(*SegmentIndex)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockSegmentIndexRepositoryMockRecorder) Get(ctx, path, info interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockSegmentIndexRepository)(nil).Get), ctx, path, info)
+}
+
+// Rename mocks base method.
+func (m *MockSegmentIndexRepository) Rename(ctx context.Context, oldPath, newPath string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Rename", ctx, oldPath, newPath)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Rename indicates an expected call of Rename.
+func (mr *MockSegmentIndexRepositoryMockRecorder) Rename(ctx, oldPath, newPath interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rename", reflect.TypeOf((*MockSegmentIndexRepository)(nil).Rename), ctx, oldPath, newPath)
+}
+
+// Save mocks base method.
+func (m *MockSegmentIndexRepository) Save(ctx context.Context, path string, info os.FileInfo, index *SegmentIndex) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, path, info, index)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockSegmentIndexRepositoryMockRecorder) Save(ctx, path, info, index interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockSegmentIndexRepository)(nil).Save), ctx, path, info, index)
+}
@@ -0,0 +1,119 @@
+package nzbloader
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/javi11/usenet-drive/pkg/osfs"
+)
+
+func TestSegmentIndexRepository(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	repo := NewSegmentIndexRepository(db)
+	ctx := context.Background()
+	modTime := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	info := osfs.NewMockFileInfo(ctrl)
+	info.EXPECT().Size().Return(int64(100)).AnyTimes()
+	info.EXPECT().ModTime().Return(modTime).AnyTimes()
+
+	index, err := BuildSegmentIndex(strings.NewReader(indexedNzbFile))
+	require.NoError(t, err)
+	data, err := index.MarshalBinary()
+	require.NoError(t, err)
+
+	t.Run("Save", func(t *testing.T) {
+		mock.ExpectExec("INSERT INTO segment_index").
+			WithArgs("/nzbs/file.nzb", int64(100), modTime.UnixNano(), data).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		err := repo.Save(ctx, "/nzbs/file.nzb", info, index)
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		mock.ExpectQuery("SELECT data FROM segment_index").
+			WithArgs("/nzbs/file.nzb", int64(100), modTime.UnixNano()).
+			WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow(data))
+
+		loaded, err := repo.Get(ctx, "/nzbs/file.nzb", info)
+		assert.NoError(t, err)
+		assert.Equal(t, index, loaded)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("The nzb changed since the index was built", func(t *testing.T) {
+		mock.ExpectQuery("SELECT data FROM segment_index").
+			WithArgs("/nzbs/file.nzb", int64(100), modTime.UnixNano()).
+			WillReturnRows(sqlmock.NewRows([]string{"data"}))
+
+		loaded, err := repo.Get(ctx, "/nzbs/file.nzb", info)
+		assert.NoError(t, err)
+		assert.Nil(t, loaded)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Invalid index", func(t *testing.T) {
+		mock.ExpectQuery("SELECT data FROM segment_index").
+			WithArgs("/nzbs/file.nzb", int64(100), modTime.UnixNano()).
+			WillReturnRows(sqlmock.NewRows([]string{"data"}).AddRow([]byte("invalid")))
+
+		_, err := repo.Get(ctx, "/nzbs/file.nzb", info)
+		assert.ErrorIs(t, err, ErrInvalidSegmentIndex)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		mock.ExpectExec("DELETE FROM segment_index").
+			WithArgs("/nzbs").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+
+		err := repo.Delete(ctx, "/nzbs")
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Rename", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM segment_index").
+			WithArgs("/renamed").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("UPDATE segment_index SET path").
+			WithArgs("/nzbs", "/renamed").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		err := repo.Rename(ctx, "/nzbs", "/renamed")
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("Rename is rolled back on error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM segment_index").
+			WithArgs("/renamed").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("UPDATE segment_index SET path").
+			WithArgs("/nzbs", "/renamed").
+			WillReturnError(assert.AnError)
+		mock.ExpectRollback()
+
+		err := repo.Rename(ctx, "/nzbs", "/renamed")
+		assert.ErrorIs(t, err, assert.AnError)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,63 @@
+package providerusage
+
+//go:generate mockgen -source=./repository.go -destination=./repository_mock.go -package=providerusage UsageRepository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type Usage struct {
+	Bytes       int64
+	PeriodStart time.Time
+}
+
+// UsageRepository persists the bytes transferred by each provider, so quotas survive restarts.
+type UsageRepository interface {
+	// Get returns the usage of the provider, an empty usage if it was never saved.
+	Get(ctx context.Context, provider, providerType string) (Usage, error)
+	Save(ctx context.Context, provider, providerType string, usage Usage) error
+}
+
+type usageRepository struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) UsageRepository {
+	return &usageRepository{db: db}
+}
+
+func (r *usageRepository) Get(ctx context.Context, provider, providerType string) (Usage, error) {
+	var usage Usage
+	err := r.db.QueryRowContext(
+		ctx,
+		"SELECT bytes, period_start FROM provider_usage WHERE provider = ? AND type = ?",
+		provider,
+		providerType,
+	).Scan(&usage.Bytes, &usage.PeriodStart)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Usage{}, nil
+		}
+
+		return Usage{}, err
+	}
+
+	return usage, nil
+}
+
+func (r *usageRepository) Save(ctx context.Context, provider, providerType string, usage Usage) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`INSERT INTO provider_usage (provider, type, bytes, period_start, updated_at) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (provider, type) DO UPDATE SET bytes = excluded.bytes, period_start = excluded.period_start, updated_at = CURRENT_TIMESTAMP`,
+		provider,
+		providerType,
+		usage.Bytes,
+		usage.PeriodStart,
+	)
+
+	return err
+}
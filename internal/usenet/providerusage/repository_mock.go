@@ -0,0 +1,64 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./repository.go
+
+// Package providerusage is a generated GoMock package.
+package providerusage
+
+import (
+	context "context"
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockUsageRepository is a mock of UsageRepository interface.
+type MockUsageRepository struct {
+	ctrl     *gomock.Controller
+	recorder *MockUsageRepositoryMockRecorder
+}
+
+// MockUsageRepositoryMockRecorder is the mock recorder for MockUsageRepository.
+type MockUsageRepositoryMockRecorder struct {
+	mock *MockUsageRepository
+}
+
+// NewMockUsageRepository creates a new mock instance.
+func NewMockUsageRepository(ctrl *gomock.Controller) *MockUsageRepository {
+	mock := &MockUsageRepository{ctrl: ctrl}
+	mock.recorder = &MockUsageRepositoryMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUsageRepository) EXPECT() *MockUsageRepositoryMockRecorder {
+	return m.recorder
+}
+
+// Get mocks base method.
+func (m *MockUsageRepository) Get(ctx context.Context, provider, providerType string) (Usage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, provider, providerType)
+	ret0, _ := ret[0].(Usage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockUsageRepositoryMockRecorder) Get(ctx, provider, providerType interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockUsageRepository)(nil).Get), ctx, provider, providerType)
+}
+
+// Save mocks base method.
+func (m *MockUsageRepository) Save(ctx context.Context, provider, providerType string, usage Usage) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Save", ctx, provider, providerType, usage)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Save indicates an expected call of Save.
+func (mr *MockUsageRepositoryMockRecorder) Save(ctx, provider, providerType, usage interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Save", reflect.TypeOf((*MockUsageRepository)(nil).Save), ctx, provider, providerType, usage)
+}
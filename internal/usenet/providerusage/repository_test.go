@@ -0,0 +1,52 @@
+package providerusage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsageRepository_Get(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := New(db)
+	ctx := context.Background()
+	periodStart := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery("SELECT bytes, period_start FROM provider_usage").
+		WithArgs("user@block", "download").
+		WillReturnRows(sqlmock.NewRows([]string{"bytes", "period_start"}).AddRow(1024, periodStart))
+
+	usage, err := repo.Get(ctx, "user@block", "download")
+	assert.NoError(t, err)
+	assert.Equal(t, Usage{Bytes: 1024, PeriodStart: periodStart}, usage)
+
+	mock.ExpectQuery("SELECT bytes, period_start FROM provider_usage").
+		WithArgs("user@other", "download").
+		WillReturnRows(sqlmock.NewRows([]string{"bytes", "period_start"}))
+
+	usage, err = repo.Get(ctx, "user@other", "download")
+	assert.NoError(t, err)
+	assert.Equal(t, Usage{}, usage)
+}
+
+func TestUsageRepository_Save(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := New(db)
+	periodStart := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec("INSERT INTO provider_usage").
+		WithArgs("user@block", "upload", int64(2048), periodStart).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = repo.Save(context.Background(), "user@block", "upload", Usage{Bytes: 2048, PeriodStart: periodStart})
+	assert.NoError(t, err)
+}
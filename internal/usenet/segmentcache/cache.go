@@ -0,0 +1,273 @@
+package segmentcache
+
+//go:generate mockgen -source=./cache.go -destination=./cache_mock.go -package=segmentcache SegmentCache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/javi11/usenet-drive/internal/metrics"
+)
+
+// SegmentCache keeps the decoded segments on disk, so the files that are opened again
+// do not download the same segments. The least recently used segments are evicted
+// when the cache is full.
+type SegmentCache interface {
+	// Get copies the segment into chunk, it reports whether the segment was cached
+	Get(msgId string, chunk []byte) bool
+	Put(msgId string, data []byte) error
+}
+
+type entry struct {
+	key  string
+	size int64
+}
+
+type segmentCache struct {
+	mx      sync.Mutex
+	dir     string
+	maxSize int64
+	size    int64
+	// Most recently used first
+	lru     *list.List
+	entries map[string]*list.Element
+	log     *slog.Logger
+}
+
+// NewSegmentCache uses dir to store up to maxSizeInBytes of segments. The segments
+// already in dir are kept, the oldest ones are evicted if they do not fit.
+func NewSegmentCache(dir string, maxSizeInBytes int64, log *slog.Logger) (SegmentCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating the segment cache dir: %w", err)
+	}
+
+	c := &segmentCache{
+		dir:     dir,
+		maxSize: maxSizeInBytes,
+		lru:     list.New(),
+		entries: map[string]*list.Element{},
+		log:     log,
+	}
+
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *segmentCache) Get(msgId string, chunk []byte) bool {
+	key := cacheKey(msgId)
+
+	c.mx.Lock()
+	el, ok := c.entries[key]
+	if ok {
+		c.lru.MoveToFront(el)
+	}
+	c.mx.Unlock()
+
+	if !ok {
+		metrics.SegmentCacheMisses.Inc()
+		return false
+	}
+
+	// Read without the lock, the segment may be evicted in the meantime
+	err := c.read(key, chunk)
+	if err != nil {
+		c.log.Debug("error reading cached segment", "segment", msgId, "error", err)
+
+		c.mx.Lock()
+		if el, ok := c.entries[key]; ok {
+			c.remove(el)
+		}
+		c.mx.Unlock()
+
+		metrics.SegmentCacheMisses.Inc()
+		return false
+	}
+
+	// The order is restored from the modification time on restart
+	now := time.Now()
+	_ = os.Chtimes(c.path(key), now, now)
+
+	metrics.SegmentCacheHits.Inc()
+
+	return true
+}
+
+func (c *segmentCache) Put(msgId string, data []byte) error {
+	size := int64(len(data))
+	if size > c.maxSize {
+		return nil
+	}
+
+	key := cacheKey(msgId)
+
+	c.mx.Lock()
+	_, ok := c.entries[key]
+	c.mx.Unlock()
+	if ok {
+		return nil
+	}
+
+	// Written to a temp file first so a partial segment is never read
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if _, ok := c.entries[key]; ok {
+		return nil
+	}
+
+	if err := os.Rename(tmp.Name(), c.path(key)); err != nil {
+		return err
+	}
+
+	c.entries[key] = c.lru.PushFront(&entry{key: key, size: size})
+	c.size += size
+	c.evict()
+	metrics.SegmentCacheBytes.Set(float64(c.size))
+
+	return nil
+}
+
+// load adds the segments stored by a previous run, the last modified first
+func (c *segmentCache) load() error {
+	files, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	type storedSegment struct {
+		entry
+		modTime int64
+	}
+
+	var stored []storedSegment
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+
+		if !isCacheKey(f.Name()) {
+			// Temp files of an interrupted put
+			_ = os.Remove(filepath.Join(c.dir, f.Name()))
+			continue
+		}
+
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+
+		stored = append(stored, storedSegment{
+			entry:   entry{key: f.Name(), size: info.Size()},
+			modTime: info.ModTime().UnixNano(),
+		})
+	}
+
+	sort.Slice(stored, func(i, j int) bool {
+		return stored[i].modTime > stored[j].modTime
+	})
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	for _, s := range stored {
+		e := s.entry
+		c.entries[e.key] = c.lru.PushBack(&e)
+		c.size += e.size
+	}
+	c.evict()
+	metrics.SegmentCacheBytes.Set(float64(c.size))
+
+	return nil
+}
+
+func (c *segmentCache) read(key string, chunk []byte) error {
+	f, err := os.Open(c.path(key))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.ReadFull(f, chunk)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		// The final segment has less bytes than chunkSize
+		return nil
+	}
+
+	return err
+}
+
+// evict removes the least recently used segments until the cache fits, the lock must be held
+func (c *segmentCache) evict() {
+	for c.size > c.maxSize {
+		el := c.lru.Back()
+		if el == nil {
+			return
+		}
+
+		c.remove(el)
+		metrics.SegmentCacheEvictions.Inc()
+	}
+}
+
+// remove deletes the segment from the cache and the disk, the lock must be held
+func (c *segmentCache) remove(el *list.Element) {
+	e := el.Value.(*entry)
+
+	c.lru.Remove(el)
+	delete(c.entries, e.key)
+	c.size -= e.size
+
+	if err := os.Remove(c.path(e.key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		c.log.Debug("error removing cached segment", "error", err)
+	}
+	metrics.SegmentCacheBytes.Set(float64(c.size))
+}
+
+func (c *segmentCache) path(key string) string {
+	return filepath.Join(c.dir, key)
+}
+
+// cacheKey is the file name of a segment, message ids can have characters that are
+// not valid in file names
+func cacheKey(msgId string) string {
+	sum := sha256.Sum256([]byte(msgId))
+
+	return hex.EncodeToString(sum[:])
+}
+
+func isCacheKey(name string) bool {
+	if len(name) != sha256.Size*2 {
+		return false
+	}
+
+	_, err := hex.DecodeString(name)
+
+	return err == nil
+}
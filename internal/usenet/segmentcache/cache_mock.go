@@ -0,0 +1,62 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: ./cache.go
+
+// Package segmentcache is a generated GoMock package.
+package segmentcache
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockSegmentCache is a mock of SegmentCache interface.
+type MockSegmentCache struct {
+	ctrl     *gomock.Controller
+	recorder *MockSegmentCacheMockRecorder
+}
+
+// MockSegmentCacheMockRecorder is the mock recorder for MockSegmentCache.
+type MockSegmentCacheMockRecorder struct {
+	mock *MockSegmentCache
+}
+
+// NewMockSegmentCache creates a new mock instance.
+func NewMockSegmentCache(ctrl *gomock.Controller) *MockSegmentCache {
+	mock := &MockSegmentCache{ctrl: ctrl}
+	mock.recorder = &MockSegmentCacheMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSegmentCache) EXPECT() *MockSegmentCacheMockRecorder {
+	return m.recorder
+}
+
+// Get mocks base method.
+func (m *MockSegmentCache) Get(msgId string, chunk []byte) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", msgId, chunk)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockSegmentCacheMockRecorder) Get(msgId, chunk interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockSegmentCache)(nil).Get), msgId, chunk)
+}
+
+// Put mocks base method.
+func (m *MockSegmentCache) Put(msgId string, data []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Put", msgId, data)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Put indicates an expected call of Put.
+func (mr *MockSegmentCacheMockRecorder) Put(msgId, data interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockSegmentCache)(nil).Put), msgId, data)
+}
@@ -0,0 +1,108 @@
+package segmentcache
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSegmentCache(t *testing.T) {
+	log := slog.Default()
+
+	t.Run("put and get", func(t *testing.T) {
+		c, err := NewSegmentCache(t.TempDir(), 100, log)
+		assert.NoError(t, err)
+
+		assert.NoError(t, c.Put("<1@test>", []byte("body1")))
+
+		chunk := make([]byte, 5)
+		assert.True(t, c.Get("<1@test>", chunk))
+		assert.Equal(t, []byte("body1"), chunk)
+	})
+
+	t.Run("unknown segment", func(t *testing.T) {
+		c, err := NewSegmentCache(t.TempDir(), 100, log)
+		assert.NoError(t, err)
+
+		assert.False(t, c.Get("<1@test>", make([]byte, 5)))
+	})
+
+	t.Run("segment shorter than the chunk", func(t *testing.T) {
+		c, err := NewSegmentCache(t.TempDir(), 100, log)
+		assert.NoError(t, err)
+
+		assert.NoError(t, c.Put("<1@test>", []byte("abc")))
+
+		chunk := make([]byte, 5)
+		assert.True(t, c.Get("<1@test>", chunk))
+		assert.Equal(t, []byte("abc\x00\x00"), chunk)
+	})
+
+	t.Run("segment larger than the cache", func(t *testing.T) {
+		dir := t.TempDir()
+		c, err := NewSegmentCache(dir, 4, log)
+		assert.NoError(t, err)
+
+		assert.NoError(t, c.Put("<1@test>", []byte("body1")))
+		assert.False(t, c.Get("<1@test>", make([]byte, 5)))
+
+		files, err := os.ReadDir(dir)
+		assert.NoError(t, err)
+		assert.Empty(t, files)
+	})
+
+	t.Run("evicts the least recently used", func(t *testing.T) {
+		c, err := NewSegmentCache(t.TempDir(), 10, log)
+		assert.NoError(t, err)
+
+		assert.NoError(t, c.Put("<1@test>", []byte("body1")))
+		assert.NoError(t, c.Put("<2@test>", []byte("body2")))
+
+		// The first segment is now the most recently used
+		assert.True(t, c.Get("<1@test>", make([]byte, 5)))
+
+		assert.NoError(t, c.Put("<3@test>", []byte("body3")))
+
+		assert.True(t, c.Get("<1@test>", make([]byte, 5)))
+		assert.False(t, c.Get("<2@test>", make([]byte, 5)))
+		assert.True(t, c.Get("<3@test>", make([]byte, 5)))
+	})
+
+	t.Run("keeps the segments across restarts", func(t *testing.T) {
+		dir := t.TempDir()
+		c, err := NewSegmentCache(dir, 100, log)
+		assert.NoError(t, err)
+		assert.NoError(t, c.Put("<1@test>", []byte("body1")))
+
+		// Temp file of an interrupted put
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, ".tmp-123"), []byte("bo"), 0644))
+
+		c, err = NewSegmentCache(dir, 100, log)
+		assert.NoError(t, err)
+
+		chunk := make([]byte, 5)
+		assert.True(t, c.Get("<1@test>", chunk))
+		assert.Equal(t, []byte("body1"), chunk)
+
+		_, err = os.Stat(filepath.Join(dir, ".tmp-123"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("evicts on restart when the size is smaller", func(t *testing.T) {
+		dir := t.TempDir()
+		c, err := NewSegmentCache(dir, 100, log)
+		assert.NoError(t, err)
+		assert.NoError(t, c.Put("<1@test>", []byte("body1")))
+		assert.NoError(t, c.Put("<2@test>", []byte("body2")))
+
+		c, err = NewSegmentCache(dir, 5, log)
+		assert.NoError(t, err)
+
+		files, err := os.ReadDir(dir)
+		assert.NoError(t, err)
+		assert.Len(t, files, 1)
+	})
+}
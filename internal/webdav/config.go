@@ -13,6 +13,7 @@ type Config struct {
 	fileReader         RemoteFileReader
 	rcloneCli          rclonecli.RcloneRcClient
 	refreshRcloneCache bool
+	segmentIndex       SegmentIndexRepository
 }
 
 type Option func(*Config)
@@ -51,3 +52,11 @@ func WithRootPath(rootPath string) Option {
 		c.rootPath = rootPath
 	}
 }
+
+// WithSegmentIndexRepository deletes or moves the segment indexes of the nzbs of the removed
+// and renamed directories
+func WithSegmentIndexRepository(segmentIndex SegmentIndexRepository) Option {
+	return func(c *Config) {
+		c.segmentIndex = segmentIndex
+	}
+}
@@ -21,6 +21,7 @@ type remoteFilesystem struct {
 	forceRefreshRclone bool
 	fileWriter         RemoteFileWriter
 	fileReader         RemoteFileReader
+	segmentIndex       SegmentIndexRepository
 }
 
 func NewRemoteFilesystem(
@@ -29,6 +30,7 @@ func NewRemoteFilesystem(
 	fileReader RemoteFileReader,
 	rcloneCli rclonecli.RcloneRcClient,
 	forceRefreshRclone bool,
+	segmentIndex SegmentIndexRepository,
 	log *slog.Logger,
 ) webdav.FileSystem {
 	return &remoteFilesystem{
@@ -38,6 +40,7 @@ func NewRemoteFilesystem(
 		fileReader:         fileReader,
 		forceRefreshRclone: forceRefreshRclone,
 		rcloneCli:          rcloneCli,
+		segmentIndex:       segmentIndex,
 	}
 }
 
@@ -130,6 +133,12 @@ func (fs *remoteFilesystem) RemoveAll(ctx context.Context, name string) error {
 		return err
 	}
 
+	if fs.segmentIndex != nil {
+		if err := fs.segmentIndex.Delete(ctx, name); err != nil {
+			fs.log.ErrorContext(ctx, "Error deleting the segment indexes", "path", name, "error", err)
+		}
+	}
+
 	fs.refreshRcloneCache(ctx, name)
 
 	return nil
@@ -166,6 +175,12 @@ func (fs *remoteFilesystem) Rename(ctx context.Context, oldName, newName string)
 		return err
 	}
 
+	if fs.segmentIndex != nil {
+		if err := fs.segmentIndex.Rename(ctx, oldName, newName); err != nil {
+			fs.log.ErrorContext(ctx, "Error moving the segment indexes", "path", oldName, "error", err)
+		}
+	}
+
 	fs.refreshRcloneCache(ctx, newName)
 
 	return nil
@@ -18,3 +18,8 @@ type RemoteFileReader interface {
 	OpenFile(ctx context.Context, name string, onClose func() error) (bool, webdav.File, error)
 	Stat(fileName string) (bool, fs.FileInfo, error)
 }
+
+type SegmentIndexRepository interface {
+	Delete(ctx context.Context, path string) error
+	Rename(ctx context.Context, oldPath, newPath string) error
+}
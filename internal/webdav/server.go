@@ -31,6 +31,7 @@ func NewServer(options ...Option) (*webdavServer, error) {
 			config.fileReader,
 			config.rcloneCli,
 			config.refreshRcloneCache,
+			config.segmentIndex,
 			config.log,
 		),
 		LockSystem: webdav.NewMemLS(),
@@ -0,0 +1,295 @@
+package nntpcli
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Capabilities asks the server for its capabilities and keeps them for HasCapability.
+// Servers that do not implement the command are considered to have no capabilities.
+func (c *connection) Capabilities() ([]string, error) {
+	lines, err := c.sendMultilineCmd("CAPABILITIES", 101)
+	if err != nil {
+		if !isResponseError(err) {
+			return nil, err
+		}
+
+		lines = []string{}
+	}
+
+	c.capabilities = lines
+
+	return lines, nil
+}
+
+// HasCapability reports whether the server advertised the capability, the name is not
+// case sensitive. It returns ErrCapabilitiesUnpopulated when they were not discovered.
+func (c *connection) HasCapability(capability string) (bool, error) {
+	_, err := c.CapabilityArguments(capability)
+	if errors.Is(err, ErrNoSuchCapability) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// CapabilityArguments returns the arguments of an advertised capability, like the
+// supported LIST keywords. It returns ErrNoSuchCapability when it is not advertised.
+func (c *connection) CapabilityArguments(capability string) ([]string, error) {
+	if c.capabilities == nil {
+		return nil, ErrCapabilitiesUnpopulated
+	}
+
+	for _, line := range c.capabilities {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && strings.EqualFold(fields[0], capability) {
+			return fields[1:], nil
+		}
+	}
+
+	return nil, ErrNoSuchCapability
+}
+
+// Stat checks that the server has the article without transferring it
+func (c *connection) Stat(msgId string) error {
+	_, _, err := c.sendCmd(fmt.Sprintf("STAT <%s>", msgId), 223)
+
+	return err
+}
+
+// Head gets the headers of an article, the returned article has no body
+func (c *connection) Head(msgId string) (*Article, error) {
+	lines, err := c.sendMultilineCmd(fmt.Sprintf("HEAD <%s>", msgId), 221)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := parseHeader(strings.NewReader(strings.Join(lines, "\n") + "\n\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Article{Header: header}, nil
+}
+
+// Article gets the headers and the dot decoded body of an article
+func (c *connection) Article(msgId string) (*Article, error) {
+	c.startCommand()
+
+	id, err := c.conn.Cmd("ARTICLE <%s>", msgId)
+	if err != nil {
+		c.broken = true
+		return nil, err
+	}
+
+	c.conn.StartResponse(id)
+	defer c.conn.EndResponse(id)
+
+	_, _, err = c.conn.ReadCodeLine(220)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := c.conn.ReadDotBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(bytes.NewReader(data))
+	header, err := parseHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Article{
+		Header: header,
+		Body:   bytes.NewReader(body),
+		Bytes:  len(body),
+		Lines:  bytes.Count(body, []byte("\n")),
+	}, nil
+}
+
+// Date returns the current time of the server
+func (c *connection) Date() (time.Time, error) {
+	_, msg, err := c.sendCmd("DATE", 111)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	t, err := time.Parse("20060102150405", strings.TrimSpace(msg))
+	if err != nil {
+		return time.Time{}, textproto.ProtocolError(fmt.Sprintf("invalid DATE response: %s", msg))
+	}
+
+	return t, nil
+}
+
+// Over returns the overview of the articles from low to high of the joined group, a high
+// lower than low means all the articles from low. XOVER is used when the server does not
+// advertise OVER.
+func (c *connection) Over(low, high int64) ([]MessageOverview, error) {
+	command := "XOVER"
+	if ok, _ := c.HasCapability("OVER"); ok {
+		command = "OVER"
+	}
+
+	articleRange := fmt.Sprintf("%d-", low)
+	if high >= low {
+		articleRange = fmt.Sprintf("%d-%d", low, high)
+	}
+
+	lines, err := c.sendMultilineCmd(fmt.Sprintf("%s %s", command, articleRange), 224)
+	if err != nil {
+		return nil, err
+	}
+
+	overviews := make([]MessageOverview, 0, len(lines))
+	for _, line := range lines {
+		overview, err := parseOverview(line)
+		if err != nil {
+			return nil, err
+		}
+
+		overviews = append(overviews, overview)
+	}
+
+	return overviews, nil
+}
+
+// ListActive returns the groups that match the wildmat, all of them if it is empty
+func (c *connection) ListActive(wildmat string) ([]Group, error) {
+	command := "LIST ACTIVE"
+	if wildmat != "" {
+		command = fmt.Sprintf("%s %s", command, wildmat)
+	}
+
+	lines, err := c.sendMultilineCmd(command, 215)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]Group, 0, len(lines))
+	for _, line := range lines {
+		group, err := parseActiveGroup(line)
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, group)
+	}
+
+	return groups, nil
+}
+
+func (c *connection) sendMultilineCmd(cmd string, expectCode int) ([]string, error) {
+	c.startCommand()
+
+	id, err := c.conn.Cmd("%s", cmd)
+	if err != nil {
+		c.broken = true
+		return nil, err
+	}
+
+	c.conn.StartResponse(id)
+	defer c.conn.EndResponse(id)
+
+	_, _, err = c.conn.ReadCodeLine(expectCode)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.isCompressedResponse() {
+		return c.readCompressedDotLines()
+	}
+
+	return c.conn.ReadDotLines()
+}
+
+func parseHeader(r io.Reader) (textproto.MIMEHeader, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+
+	header, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	return header, nil
+}
+
+// parseOverview parses an OVER line: number, subject, from, date, message-id, references,
+// bytes, lines and the optional extra fields, separated by tabs.
+func parseOverview(line string) (MessageOverview, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) < 8 {
+		return MessageOverview{}, textproto.ProtocolError(fmt.Sprintf("invalid overview line: %s", line))
+	}
+
+	number, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return MessageOverview{}, textproto.ProtocolError(fmt.Sprintf("invalid overview article number: %s", fields[0]))
+	}
+
+	// Some servers do not fill the metadata fields
+	size, _ := strconv.Atoi(fields[6])
+	lineCount, _ := strconv.Atoi(fields[7])
+	date, _ := mail.ParseDate(fields[3])
+
+	return MessageOverview{
+		MessageNumber: number,
+		Subject:       fields[1],
+		From:          fields[2],
+		Date:          date,
+		MessageId:     fields[4],
+		References:    strings.Fields(fields[5]),
+		Bytes:         size,
+		Lines:         lineCount,
+		Extra:         fields[8:],
+	}, nil
+}
+
+// parseActiveGroup parses a LIST ACTIVE line: name, high, low and posting status
+func parseActiveGroup(line string) (Group, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 {
+		return Group{}, textproto.ProtocolError(fmt.Sprintf("invalid active group line: %s", line))
+	}
+
+	high, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return Group{}, textproto.ProtocolError(fmt.Sprintf("invalid active group high: %s", fields[1]))
+	}
+
+	low, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return Group{}, textproto.ProtocolError(fmt.Sprintf("invalid active group low: %s", fields[2]))
+	}
+
+	count := int64(0)
+	if high >= low {
+		count = high - low + 1
+	}
+
+	return Group{
+		Name:    fields[0],
+		High:    high,
+		Low:     low,
+		Count:   count,
+		Posting: PostingStatus(fields[3][0]),
+	}, nil
+}
@@ -0,0 +1,153 @@
+package nntpcli
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// reply answers every command with the response of the same position
+func reply(t *testing.T, commands []string, responses []string) func(r *bufio.Reader, w net.Conn) {
+	return func(r *bufio.Reader, w net.Conn) {
+		for i, response := range responses {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			assert.Equal(t, commands[i]+"\r\n", line)
+
+			_, _ = w.Write([]byte(response))
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	t.Run("capabilities are discovered at connect time", func(t *testing.T) {
+		conn := newTestConnection(t, reply(t, nil, nil))
+
+		ok, err := conn.HasCapability("over")
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = conn.HasCapability("POST")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		args, err := conn.CapabilityArguments("LIST")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"ACTIVE", "NEWSGROUPS"}, args)
+
+		_, err = conn.CapabilityArguments("STARTTLS")
+		assert.ErrorIs(t, err, ErrNoSuchCapability)
+	})
+
+	t.Run("capabilities not discovered", func(t *testing.T) {
+		conn := &connection{}
+
+		_, err := conn.HasCapability("OVER")
+		assert.ErrorIs(t, err, ErrCapabilitiesUnpopulated)
+	})
+
+	t.Run("stat", func(t *testing.T) {
+		conn := newTestConnection(t, reply(t,
+			[]string{"STAT <1@test>", "STAT <2@test>"},
+			[]string{"223 0 <1@test>\r\n", "430 no such article\r\n"},
+		))
+
+		assert.NoError(t, conn.Stat("1@test"))
+		assert.True(t, IsArticleNotFoundError(conn.Stat("2@test")))
+	})
+
+	t.Run("head", func(t *testing.T) {
+		conn := newTestConnection(t, reply(t,
+			[]string{"HEAD <1@test>"},
+			[]string{"221 0 <1@test>\r\nMessage-Id: <1@test>\r\nSubject: test\r\n.\r\n"},
+		))
+
+		article, err := conn.Head("1@test")
+		assert.NoError(t, err)
+		assert.Equal(t, "<1@test>", article.MessageID())
+		assert.Equal(t, "test", article.Header.Get("Subject"))
+		assert.Nil(t, article.Body)
+	})
+
+	t.Run("article", func(t *testing.T) {
+		conn := newTestConnection(t, reply(t,
+			[]string{"ARTICLE <1@test>"},
+			[]string{"220 0 <1@test>\r\nMessage-Id: <1@test>\r\n\r\nline 1\r\n..line 2\r\n.\r\n"},
+		))
+
+		article, err := conn.Article("1@test")
+		assert.NoError(t, err)
+		assert.Equal(t, "<1@test>", article.MessageID())
+		assert.Equal(t, 2, article.Lines)
+
+		body, err := io.ReadAll(article.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, "line 1\n.line 2\n", string(body))
+	})
+
+	t.Run("date", func(t *testing.T) {
+		conn := newTestConnection(t, reply(t,
+			[]string{"DATE"},
+			[]string{"111 20261016120102\r\n"},
+		))
+
+		date, err := conn.Date()
+		assert.NoError(t, err)
+		assert.Equal(t, time.Date(2026, 10, 16, 12, 1, 2, 0, time.UTC), date)
+	})
+
+	t.Run("over", func(t *testing.T) {
+		conn := newTestConnection(t, reply(t,
+			[]string{"OVER 10-11", "OVER 12-"},
+			[]string{
+				"224 overview follows\r\n" +
+					"10\tsubject\tposter@test\tFri, 16 Oct 2026 12:01:02 +0000\t<10@test>\t<9@test>\t750000\t5000\tXref: test\r\n" +
+					"11\tsubject 2\tposter@test\t\t<11@test>\t\t\t\r\n" +
+					".\r\n",
+				"224 overview follows\r\n.\r\n",
+			},
+		))
+
+		overviews, err := conn.Over(10, 11)
+		assert.NoError(t, err)
+		assert.Len(t, overviews, 2)
+		assert.True(t, time.Date(2026, 10, 16, 12, 1, 2, 0, time.UTC).Equal(overviews[0].Date))
+		assert.Equal(t, MessageOverview{
+			MessageNumber: 10,
+			Subject:       "subject",
+			From:          "poster@test",
+			Date:          overviews[0].Date,
+			MessageId:     "<10@test>",
+			References:    []string{"<9@test>"},
+			Bytes:         750000,
+			Lines:         5000,
+			Extra:         []string{"Xref: test"},
+		}, overviews[0])
+		assert.Equal(t, "<11@test>", overviews[1].MessageId)
+		assert.True(t, overviews[1].Date.IsZero())
+
+		overviews, err = conn.Over(12, 0)
+		assert.NoError(t, err)
+		assert.Empty(t, overviews)
+	})
+
+	t.Run("list active", func(t *testing.T) {
+		conn := newTestConnection(t, reply(t,
+			[]string{"LIST ACTIVE alt.binaries.*"},
+			[]string{"215 list follows\r\nalt.binaries.test 200 101 y\r\nalt.binaries.empty 0 1 n\r\n.\r\n"},
+		))
+
+		groups, err := conn.ListActive("alt.binaries.*")
+		assert.NoError(t, err)
+		assert.Equal(t, []Group{
+			{Name: "alt.binaries.test", High: 200, Low: 101, Count: 100, Posting: PostingPermitted},
+			{Name: "alt.binaries.empty", High: 0, Low: 1, Count: 0, Posting: PostingNotPermitted},
+		}, groups)
+	})
+}
@@ -0,0 +1,188 @@
+package nntpcli
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/textproto"
+	"slices"
+	"strings"
+)
+
+// Compression negotiated with the server
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	// RFC 8054, the whole session is compressed in both directions
+	CompressionDeflate Compression = "deflate"
+	// Only the multi-line responses are compressed by the server
+	CompressionGzip Compression = "gzip"
+)
+
+// EnableCompression negotiates COMPRESS DEFLATE when the server advertises it, otherwise
+// it tries XFEATURE COMPRESS GZIP. It must be called after the authentication and returns
+// ErrCompressionUnavailable when the server accepts none of them.
+func (c *connection) EnableCompression() error {
+	if c.compression != CompressionNone {
+		return nil
+	}
+
+	args, err := c.CapabilityArguments("COMPRESS")
+	if err == nil && slices.ContainsFunc(args, func(arg string) bool { return strings.EqualFold(arg, "DEFLATE") }) {
+		_, _, err = c.sendCmd("COMPRESS DEFLATE", 206)
+		if err == nil {
+			c.enableDeflate()
+			return nil
+		}
+
+		if !isResponseError(err) {
+			return err
+		}
+	}
+
+	_, _, err = c.sendCmd("XFEATURE COMPRESS GZIP TERMINATOR", 290)
+	if err != nil {
+		if isResponseError(err) {
+			return ErrCompressionUnavailable
+		}
+
+		return err
+	}
+
+	c.compression = CompressionGzip
+
+	return nil
+}
+
+func (c *connection) Compression() Compression {
+	return c.compression
+}
+
+// enableDeflate wraps the connection, what the server sends after the 206 response is
+// already compressed and may be buffered in the current reader
+func (c *connection) enableDeflate() {
+	fw, _ := flate.NewWriter(c.netconn, flate.DefaultCompression)
+
+	c.conn = textproto.NewConn(&deflateConn{
+		r:      flate.NewReader(c.conn.R),
+		w:      fw,
+		closer: c.netconn,
+	})
+	c.compression = CompressionDeflate
+}
+
+// readCompressedDotLines reads a multi-line response compressed with XFEATURE COMPRESS GZIP
+func (c *connection) readCompressedDotLines() ([]string, error) {
+	data, _, err := c.readCompressedBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	return textproto.NewReader(bufio.NewReader(bytes.NewReader(data))).ReadDotLines()
+}
+
+// readCompressedBlock reads a zlib block followed by the terminating line. The data is
+// returned dot encoded and always ends with the terminator, n is the bytes read from the
+// connection.
+func (c *connection) readCompressedBlock() (data []byte, n int, err error) {
+	// The counter is an io.ByteReader so zlib does not read past the compressed block
+	cr := &countingReader{r: c.conn.R}
+	zr, err := zlib.NewReader(cr)
+	if err != nil {
+		return nil, cr.n, err
+	}
+	defer zr.Close()
+
+	data, err = io.ReadAll(zr)
+	if err != nil {
+		return nil, cr.n, err
+	}
+
+	line, err := c.conn.ReadLine()
+	if err != nil {
+		return nil, cr.n, err
+	}
+	n = cr.n + len(line) + len("\r\n")
+
+	if line != "." {
+		return nil, n, textproto.ProtocolError("missing terminator after compressed response: " + line)
+	}
+
+	// Some servers do not include the terminator in the compressed data
+	if !bytes.Equal(data, []byte(".\r\n")) && !bytes.HasSuffix(data, []byte("\r\n.\r\n")) {
+		data = append(data, ".\r\n"...)
+	}
+
+	return data, n, nil
+}
+
+// isCompressedResponse reports whether the response data starts with a zlib header with
+// the default window size and no preset dictionary. The only text matching it is "x^".
+func (c *connection) isCompressedResponse() bool {
+	if c.compression != CompressionGzip {
+		return false
+	}
+
+	header, err := c.conn.R.Peek(2)
+	if err != nil {
+		return false
+	}
+
+	return header[0] == 0x78 && header[1]&0x20 == 0 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0
+}
+
+// countingReader counts the bytes read from the connection
+type countingReader struct {
+	r *bufio.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+
+	return b, err
+}
+
+func isResponseError(err error) bool {
+	var nntpErr *textproto.Error
+
+	return errors.As(err, &nntpErr)
+}
+
+type deflateConn struct {
+	r      io.Reader
+	w      *flate.Writer
+	closer io.Closer
+}
+
+func (c *deflateConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// Write flushes every write, textproto buffers the commands and writes them at once
+func (c *deflateConn) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	return n, c.w.Flush()
+}
+
+func (c *deflateConn) Close() error {
+	return c.closer.Close()
+}
@@ -0,0 +1,91 @@
+package nntpcli
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnableCompression(t *testing.T) {
+	t.Run("deflate compresses the whole session", func(t *testing.T) {
+		capabilities := []string{"VERSION 2", "READER", "COMPRESS DEFLATE"}
+		conn := newTestConnectionWithCapabilities(t, capabilities, func(r *bufio.Reader, w net.Conn) {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			assert.Equal(t, "COMPRESS DEFLATE\r\n", line)
+			_, _ = w.Write([]byte("206 compression active\r\n"))
+
+			fr := bufio.NewReader(flate.NewReader(r))
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+
+			line, err = fr.ReadString('\n')
+			if err != nil {
+				return
+			}
+			assert.Equal(t, "DATE\r\n", line)
+
+			_, _ = fw.Write([]byte("111 20261016120102\r\n"))
+			_ = fw.Flush()
+		})
+
+		err := conn.EnableCompression()
+		assert.NoError(t, err)
+		assert.Equal(t, CompressionDeflate, conn.Compression())
+
+		date, err := conn.Date()
+		assert.NoError(t, err)
+		assert.Equal(t, time.Date(2026, 10, 16, 12, 1, 2, 0, time.UTC), date)
+	})
+
+	t.Run("gzip compresses the multi-line responses", func(t *testing.T) {
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		_, _ = zw.Write([]byte("1\tsubject\tposter@test\t\t<1@test>\t\t750000\t5000\r\n.\r\n"))
+		_ = zw.Close()
+
+		conn := newTestConnection(t, reply(t,
+			[]string{"XFEATURE COMPRESS GZIP TERMINATOR", "OVER 1-1", "LIST ACTIVE"},
+			[]string{
+				"290 feature enabled\r\n",
+				"224 overview follows\r\n" + compressed.String() + ".\r\n",
+				"215 list follows\r\nalt.binaries.test 200 101 y\r\n.\r\n",
+			},
+		))
+
+		err := conn.EnableCompression()
+		assert.NoError(t, err)
+		assert.Equal(t, CompressionGzip, conn.Compression())
+
+		overviews, err := conn.Over(1, 1)
+		assert.NoError(t, err)
+		assert.Len(t, overviews, 1)
+		assert.Equal(t, "<1@test>", overviews[0].MessageId)
+
+		// Responses the server did not compress are read as usual
+		groups, err := conn.ListActive("")
+		assert.NoError(t, err)
+		assert.Len(t, groups, 1)
+	})
+
+	t.Run("servers without compression", func(t *testing.T) {
+		conn := newTestConnection(t, reply(t,
+			[]string{"XFEATURE COMPRESS GZIP TERMINATOR", "DATE"},
+			[]string{"500 unknown command\r\n", "111 20261016120102\r\n"},
+		))
+
+		err := conn.EnableCompression()
+		assert.ErrorIs(t, err, ErrCompressionUnavailable)
+		assert.Equal(t, CompressionNone, conn.Compression())
+
+		_, err = conn.Date()
+		assert.NoError(t, err)
+	})
+}
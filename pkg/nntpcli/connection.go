@@ -3,10 +3,13 @@ package nntpcli
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/textproto"
+	"sync/atomic"
 	"time"
 
 	"github.com/mnightingale/rapidyenc"
@@ -22,14 +25,52 @@ type Provider struct {
 	JoinGroup      bool
 	MaxConnections int
 	Id             string
+	Tier           int
+	Compression    bool
+	// socks5:// or http:// proxy to connect through
+	ProxyURL string
+	// Max time to connect, the client timeout is used when it is 0
+	DialTimeout time.Duration
+	// Max time to complete a command, 0 means no limit
+	CommandTimeout time.Duration
+	// Max time waiting for data from the server, 0 means no limit
+	IdleTimeout time.Duration
+	// Min bytes per second of a transfer before it is considered stalled, 0 disables it
+	MinThroughput int
+	TLS           TLSOptions
+}
+
+// BodyRequest asks for the body of an article, it is decoded into Chunk.
+type BodyRequest struct {
+	MsgId string
+	Chunk []byte
+	// Bytes of the article read from the connection, set by BodyPipelined
+	Read int
 }
 
 type Connection interface {
 	io.Closer
+	// Interrupt makes the command in progress fail, it can be called from another goroutine.
+	// The connection can not be used anymore, it must be closed once the command returns.
+	Interrupt() error
 	Authenticate() (err error)
 	JoinGroup(name string) error
-	Body(msgId string, chunk []byte) error
+	// Body decodes the article into chunk, it returns the bytes of the article read from
+	// the connection, the ones accounted by the provider.
+	Body(msgId string, chunk []byte) (int, error)
+	BodyPipelined(requests []BodyRequest) []error
 	Post(r io.Reader) error
+	EnableCompression() error
+	Compression() Compression
+	Capabilities() ([]string, error)
+	HasCapability(capability string) (bool, error)
+	CapabilityArguments(capability string) ([]string, error)
+	Stat(msgId string) error
+	Head(msgId string) (*Article, error)
+	Article(msgId string) (*Article, error)
+	Date() (time.Time, error)
+	Over(low, high int64) ([]MessageOverview, error)
+	ListActive(wildmat string) ([]Group, error)
 	Provider() Provider
 	CurrentJoinedGroup() string
 	MaxAgeTime() time.Time
@@ -38,39 +79,46 @@ type Connection interface {
 type connection struct {
 	conn               *textproto.Conn
 	netconn            net.Conn
+	deadlines          *deadlineConn
 	provider           Provider
 	currentJoinedGroup string
 	decoder            *rapidyenc.Decoder
 	maxAgeTime         time.Time
+	// nil until the capabilities are discovered
+	capabilities []string
+	compression  Compression
+	// The connection failed in the middle of a command, the pending responses
+	// will never be read so it can only be closed
+	broken bool
+	// Set by another goroutine to abort the command in progress
+	interrupted atomic.Bool
 }
 
 func newConnection(netconn net.Conn, provider Provider, maxAgeTime time.Time) (Connection, error) {
-	conn := textproto.NewConn(netconn)
+	deadlines := newDeadlineConn(netconn, provider)
+	deadlines.startCommand()
+	conn := textproto.NewConn(deadlines)
 
-	_, _, err := conn.ReadCodeLine(200)
+	// 200 posting allowed or 201 download only server
+	_, _, err := conn.ReadCodeLine(20)
 	if err != nil {
-		// Download only server
-		_, _, err = conn.ReadCodeLine(201)
-		if err == nil {
-			return &connection{
-				conn:       conn,
-				netconn:    netconn,
-				provider:   provider,
-				decoder:    rapidyenc.NewDecoder(defaultBufSize),
-				maxAgeTime: maxAgeTime,
-			}, nil
-		}
 		conn.Close()
 		return nil, err
 	}
 
-	return &connection{
+	c := &connection{
 		conn:       conn,
-		netconn:    netconn,
+		netconn:    deadlines,
+		deadlines:  deadlines,
 		provider:   provider,
 		decoder:    rapidyenc.NewDecoder(defaultBufSize),
 		maxAgeTime: maxAgeTime,
-	}, nil
+	}
+
+	// The discovery is best effort, HasCapability reports when it is not done
+	_, _ = c.Capabilities()
+
+	return c, nil
 }
 
 // Close this client.
@@ -78,7 +126,10 @@ func (c *connection) Close() error {
 	c.decoder.Reset()
 	c.decoder = nil
 
-	_, _, err := c.sendCmd("QUIT", 205)
+	var err error
+	if !c.broken && !c.interrupted.Load() {
+		_, _, err = c.sendCmd("QUIT", 205)
+	}
 	e := c.conn.Close()
 	if err == nil {
 		return err
@@ -87,6 +138,24 @@ func (c *connection) Close() error {
 	return e
 }
 
+// Interrupt closes the socket, so the blocked reads and writes of the command fail. The
+// decoder and the textproto connection are left to the goroutine running the command.
+func (c *connection) Interrupt() error {
+	c.interrupted.Store(true)
+
+	return c.deadlines.Conn.Close()
+}
+
+// interruptedError marks the errors of a command cut by Interrupt, the connection was closed
+// on purpose
+func (c *connection) interruptedError(err error) error {
+	if err != nil && c.interrupted.Load() {
+		return fmt.Errorf("%w: %w", ErrInterrupted, err)
+	}
+
+	return err
+}
+
 // Authenticate against an NNTP server using authinfo user/pass
 func (c *connection) Authenticate() (err error) {
 	code, _, err := c.sendCmd(fmt.Sprintf("AUTHINFO USER %s", c.provider.Username), 381)
@@ -113,6 +182,9 @@ func (c *connection) Authenticate() (err error) {
 		return err
 	}
 
+	// Servers can advertise other capabilities once authenticated
+	_, _ = c.Capabilities()
+
 	return nil
 }
 
@@ -138,18 +210,108 @@ func (c *connection) CurrentJoinedGroup() string {
 }
 
 // Body gets the decoded body of an article
-func (c *connection) Body(msgId string, chunk []byte) error {
+func (c *connection) Body(msgId string, chunk []byte) (int, error) {
 	_, _, err := c.sendCmd(fmt.Sprintf("BODY <%s>", msgId), 222)
 	if err != nil {
-		return err
+		return 0, c.interruptedError(err)
 	}
 
+	n, err, _ := c.decodeBody(chunk)
+
+	return n, c.interruptedError(err)
+}
+
+// BodyPipelined sends the BODY commands of all the requests before reading the responses,
+// so the round trip to the server is paid once per batch instead of once per article.
+// The responses are decoded in order and there is one error for every request. When the
+// connection breaks, the error is returned for that request and all the following ones.
+func (c *connection) BodyPipelined(requests []BodyRequest) []error {
+	errs := make([]error, len(requests))
+	ids := make([]uint, len(requests))
+
+	c.startCommand()
+
+	for i, req := range requests {
+		id, err := c.conn.Cmd("BODY <%s>", req.MsgId)
+		if err != nil {
+			c.broken = true
+			fillErrors(errs, c.interruptedError(err))
+			return errs
+		}
+
+		ids[i] = id
+	}
+
+	for i := range requests {
+		n, err, broken := c.readBody(ids[i], requests[i].Chunk)
+		requests[i].Read = n
+		if broken {
+			c.broken = true
+			fillErrors(errs[i:], c.interruptedError(err))
+			return errs
+		}
+
+		errs[i] = err
+	}
+
+	return errs
+}
+
+// readBody reads the response of a pipelined BODY command, broken is true when the
+// connection can not be used anymore.
+func (c *connection) readBody(id uint, chunk []byte) (n int, err error, broken bool) {
+	c.conn.StartResponse(id)
+	defer c.conn.EndResponse(id)
+
+	// Every response has the full command timeout
+	c.startCommand()
+
+	_, _, err = c.conn.ReadCodeLine(222)
+	if err != nil {
+		return 0, err, !isResponseError(err)
+	}
+
+	return c.decodeBody(chunk)
+}
+
+// decodeBody decodes the article that follows a BODY response into chunk. The article is
+// read up to its end even when the chunk is full, so the connection can be reused.
+// N is the bytes of the article read. Broken is true when the connection failed, the
+// error is the one of the connection instead of the one of the decoder.
+func (c *connection) decodeBody(chunk []byte) (n int, err error, broken bool) {
+	if c.isCompressedResponse() {
+		return c.decodeCompressedBody(chunk)
+	}
+
+	ar := &articleReader{r: c.conn.R, lineStart: true}
 	defer c.decoder.Reset()
-	c.decoder.SetReader(bufio.NewReader(c.conn.R))
 
-	_, err = io.ReadFull(c.decoder, chunk)
+	err = decodeYenc(c.decoder, ar, chunk)
 
-	return err
+	// The rest of the article must be consumed before reading the next response
+	_, _ = io.Copy(io.Discard, ar)
+	if ar.err != nil {
+		return ar.n, ar.err, true
+	}
+
+	return ar.n, err, false
+}
+
+// decodeCompressedBody decodes a BODY response compressed with XFEATURE COMPRESS GZIP. The
+// connection can not be reused when the compressed block is not valid, the end of the
+// response is unknown.
+func (c *connection) decodeCompressedBody(chunk []byte) (n int, err error, broken bool) {
+	data, n, err := c.readCompressedBlock()
+	if err != nil {
+		return n, err, true
+	}
+
+	ar := &articleReader{r: bufio.NewReader(bytes.NewReader(data)), lineStart: true}
+	defer c.decoder.Reset()
+
+	err = decodeYenc(c.decoder, ar, chunk)
+
+	return n, err, false
 }
 
 // Post a new article
@@ -180,12 +342,66 @@ func (c *connection) MaxAgeTime() time.Time {
 	return c.maxAgeTime
 }
 
+func (c *connection) startCommand() {
+	if c.deadlines != nil {
+		c.deadlines.startCommand()
+	}
+}
+
 func (c *connection) sendCmd(cmd string, expectCode int) (int, string, error) {
-	id, err := c.conn.Cmd(cmd)
+	c.startCommand()
+
+	id, err := c.conn.Cmd("%s", cmd)
 	if err != nil {
+		c.broken = true
 		return 0, "", err
 	}
 	c.conn.StartResponse(id)
 	defer c.conn.EndResponse(id)
 	return c.conn.ReadCodeLine(expectCode)
 }
+
+func fillErrors(errs []error, err error) {
+	for i := range errs {
+		errs[i] = err
+	}
+}
+
+// articleReader reads the raw lines of a multi-line response up to its terminating ".\r\n"
+// line included, and not a byte more, so the following pipelined responses are left in
+// the connection reader.
+type articleReader struct {
+	r         *bufio.Reader
+	line      []byte
+	lineStart bool
+	done      bool
+	// Bytes read from the connection
+	n int
+	// Error reading from the connection
+	err error
+}
+
+func (a *articleReader) Read(p []byte) (int, error) {
+	if len(a.line) == 0 {
+		if a.done {
+			return 0, io.EOF
+		}
+
+		line, err := a.r.ReadSlice('\n')
+		if err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+			a.err = err
+
+			return 0, err
+		}
+
+		a.done = a.lineStart && string(line) == ".\r\n"
+		a.lineStart = line[len(line)-1] == '\n'
+		a.line = line
+	}
+
+	n := copy(p, a.line)
+	a.line = a.line[n:]
+	a.n += n
+
+	return n, nil
+}
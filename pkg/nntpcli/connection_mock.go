@@ -35,6 +35,21 @@ func (m *MockConnection) EXPECT() *MockConnectionMockRecorder {
 	return m.recorder
 }
 
+// Article mocks base method.
+func (m *MockConnection) Article(msgId string) (*Article, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Article", msgId)
+	ret0, _ := ret[0].(*Article)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Article indicates an expected call of Article.
+func (mr *MockConnectionMockRecorder) Article(msgId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Article", reflect.TypeOf((*MockConnection)(nil).Article), msgId)
+}
+
 // Authenticate mocks base method.
 func (m *MockConnection) Authenticate() error {
 	m.ctrl.T.Helper()
@@ -50,11 +65,12 @@ func (mr *MockConnectionMockRecorder) Authenticate() *gomock.Call {
 }
 
 // Body mocks base method.
-func (m *MockConnection) Body(msgId string, chunk []byte) error {
+func (m *MockConnection) Body(msgId string, chunk []byte) (int, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Body", msgId, chunk)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // Body indicates an expected call of Body.
@@ -63,6 +79,50 @@ func (mr *MockConnectionMockRecorder) Body(msgId, chunk interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Body", reflect.TypeOf((*MockConnection)(nil).Body), msgId, chunk)
 }
 
+// BodyPipelined mocks base method.
+func (m *MockConnection) BodyPipelined(requests []BodyRequest) []error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BodyPipelined", requests)
+	ret0, _ := ret[0].([]error)
+	return ret0
+}
+
+// BodyPipelined indicates an expected call of BodyPipelined.
+func (mr *MockConnectionMockRecorder) BodyPipelined(requests interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BodyPipelined", reflect.TypeOf((*MockConnection)(nil).BodyPipelined), requests)
+}
+
+// Capabilities mocks base method.
+func (m *MockConnection) Capabilities() ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Capabilities")
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Capabilities indicates an expected call of Capabilities.
+func (mr *MockConnectionMockRecorder) Capabilities() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Capabilities", reflect.TypeOf((*MockConnection)(nil).Capabilities))
+}
+
+// CapabilityArguments mocks base method.
+func (m *MockConnection) CapabilityArguments(capability string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CapabilityArguments", capability)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CapabilityArguments indicates an expected call of CapabilityArguments.
+func (mr *MockConnectionMockRecorder) CapabilityArguments(capability interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CapabilityArguments", reflect.TypeOf((*MockConnection)(nil).CapabilityArguments), capability)
+}
+
 // Close mocks base method.
 func (m *MockConnection) Close() error {
 	m.ctrl.T.Helper()
@@ -77,6 +137,20 @@ func (mr *MockConnectionMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockConnection)(nil).Close))
 }
 
+// Compression mocks base method.
+func (m *MockConnection) Compression() Compression {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Compression")
+	ret0, _ := ret[0].(Compression)
+	return ret0
+}
+
+// Compression indicates an expected call of Compression.
+func (mr *MockConnectionMockRecorder) Compression() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Compression", reflect.TypeOf((*MockConnection)(nil).Compression))
+}
+
 // CurrentJoinedGroup mocks base method.
 func (m *MockConnection) CurrentJoinedGroup() string {
 	m.ctrl.T.Helper()
@@ -91,6 +165,79 @@ func (mr *MockConnectionMockRecorder) CurrentJoinedGroup() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CurrentJoinedGroup", reflect.TypeOf((*MockConnection)(nil).CurrentJoinedGroup))
 }
 
+// Date mocks base method.
+func (m *MockConnection) Date() (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Date")
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Date indicates an expected call of Date.
+func (mr *MockConnectionMockRecorder) Date() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Date", reflect.TypeOf((*MockConnection)(nil).Date))
+}
+
+// EnableCompression mocks base method.
+func (m *MockConnection) EnableCompression() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnableCompression")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnableCompression indicates an expected call of EnableCompression.
+func (mr *MockConnectionMockRecorder) EnableCompression() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnableCompression", reflect.TypeOf((*MockConnection)(nil).EnableCompression))
+}
+
+// HasCapability mocks base method.
+func (m *MockConnection) HasCapability(capability string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "HasCapability", capability)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// HasCapability indicates an expected call of HasCapability.
+func (mr *MockConnectionMockRecorder) HasCapability(capability interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HasCapability", reflect.TypeOf((*MockConnection)(nil).HasCapability), capability)
+}
+
+// Head mocks base method.
+func (m *MockConnection) Head(msgId string) (*Article, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Head", msgId)
+	ret0, _ := ret[0].(*Article)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Head indicates an expected call of Head.
+func (mr *MockConnectionMockRecorder) Head(msgId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Head", reflect.TypeOf((*MockConnection)(nil).Head), msgId)
+}
+
+// Interrupt mocks base method.
+func (m *MockConnection) Interrupt() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Interrupt")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Interrupt indicates an expected call of Interrupt.
+func (mr *MockConnectionMockRecorder) Interrupt() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Interrupt", reflect.TypeOf((*MockConnection)(nil).Interrupt))
+}
+
 // JoinGroup mocks base method.
 func (m *MockConnection) JoinGroup(name string) error {
 	m.ctrl.T.Helper()
@@ -105,6 +252,21 @@ func (mr *MockConnectionMockRecorder) JoinGroup(name interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "JoinGroup", reflect.TypeOf((*MockConnection)(nil).JoinGroup), name)
 }
 
+// ListActive mocks base method.
+func (m *MockConnection) ListActive(wildmat string) ([]Group, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListActive", wildmat)
+	ret0, _ := ret[0].([]Group)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListActive indicates an expected call of ListActive.
+func (mr *MockConnectionMockRecorder) ListActive(wildmat interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListActive", reflect.TypeOf((*MockConnection)(nil).ListActive), wildmat)
+}
+
 // MaxAgeTime mocks base method.
 func (m *MockConnection) MaxAgeTime() time.Time {
 	m.ctrl.T.Helper()
@@ -119,6 +281,21 @@ func (mr *MockConnectionMockRecorder) MaxAgeTime() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MaxAgeTime", reflect.TypeOf((*MockConnection)(nil).MaxAgeTime))
 }
 
+// Over mocks base method.
+func (m *MockConnection) Over(low, high int64) ([]MessageOverview, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Over", low, high)
+	ret0, _ := ret[0].([]MessageOverview)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Over indicates an expected call of Over.
+func (mr *MockConnectionMockRecorder) Over(low, high interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Over", reflect.TypeOf((*MockConnection)(nil).Over), low, high)
+}
+
 // Post mocks base method.
 func (m *MockConnection) Post(r io.Reader) error {
 	m.ctrl.T.Helper()
@@ -146,3 +323,17 @@ func (mr *MockConnectionMockRecorder) Provider() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Provider", reflect.TypeOf((*MockConnection)(nil).Provider))
 }
+
+// Stat mocks base method.
+func (m *MockConnection) Stat(msgId string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stat", msgId)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Stat indicates an expected call of Stat.
+func (mr *MockConnectionMockRecorder) Stat(msgId interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stat", reflect.TypeOf((*MockConnection)(nil).Stat), msgId)
+}
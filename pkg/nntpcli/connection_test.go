@@ -0,0 +1,210 @@
+package nntpcli
+
+import (
+	"bufio"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// yencArticle returns a single part yEnc article and its decoded data
+func yencArticle(encoded string) (string, []byte) {
+	decoded := make([]byte, len(encoded))
+	for i := range encoded {
+		decoded[i] = encoded[i] - 42
+	}
+
+	article := "=ybegin line=128 size=" + strconv.Itoa(len(decoded)) + " name=test\r\n" +
+		encoded + "\r\n" +
+		"=yend size=" + strconv.Itoa(len(decoded)) + "\r\n" +
+		".\r\n"
+
+	return article, decoded
+}
+
+// newTestConnection connects to a fake server that answers the capabilities discovery,
+// serve handles the rest of the session.
+func newTestConnection(t *testing.T, serve func(r *bufio.Reader, w net.Conn)) Connection {
+	return newTestConnectionWithCapabilities(t, []string{"VERSION 2", "READER", "OVER", "LIST ACTIVE NEWSGROUPS"}, serve)
+}
+
+func newTestConnectionWithCapabilities(
+	t *testing.T,
+	capabilities []string,
+	serve func(r *bufio.Reader, w net.Conn),
+) Connection {
+	client, server := net.Pipe()
+	t.Cleanup(func() {
+		client.Close()
+	})
+
+	go func() {
+		defer server.Close()
+
+		_, _ = server.Write([]byte("200 mock server ready\r\n"))
+
+		r := bufio.NewReader(server)
+		if _, err := r.ReadString('\n'); err != nil {
+			return
+		}
+		_, _ = server.Write([]byte("101 capability list follows\r\n" + strings.Join(capabilities, "\r\n") + "\r\n.\r\n"))
+
+		serve(r, server)
+	}()
+
+	conn, err := newConnection(client, Provider{}, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+
+	return conn
+}
+
+func TestBodyPipelined(t *testing.T) {
+	article1, body1 := yencArticle("abcdef")
+	article3, body3 := yencArticle("ghi")
+
+	t.Run("responses are decoded in order", func(t *testing.T) {
+		commands := make(chan []string, 1)
+		conn := newTestConnection(t, func(r *bufio.Reader, server net.Conn) {
+			// All the commands are sent before any response is written
+			var received []string
+			for i := 0; i < 3; i++ {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				received = append(received, line)
+			}
+			commands <- received
+
+			_, _ = server.Write([]byte(
+				"222 0 <1> body\r\n" + article1 +
+					"430 no such article\r\n" +
+					"222 0 <3> body\r\n" + article3,
+			))
+		})
+
+		requests := []BodyRequest{
+			{MsgId: "1", Chunk: make([]byte, len(body1))},
+			{MsgId: "2", Chunk: make([]byte, 6)},
+			{MsgId: "3", Chunk: make([]byte, 6)},
+		}
+		errs := conn.BodyPipelined(requests)
+
+		assert.Equal(t, []string{"BODY <1>\r\n", "BODY <2>\r\n", "BODY <3>\r\n"}, <-commands)
+		assert.NoError(t, errs[0])
+		assert.Equal(t, body1, requests[0].Chunk)
+		assert.Equal(t, len(article1), requests[0].Read)
+		assert.True(t, IsArticleNotFoundError(errs[1]))
+		assert.Equal(t, 0, requests[1].Read)
+		// The article is shorter than the chunk
+		assert.ErrorIs(t, errs[2], io.ErrUnexpectedEOF)
+		assert.Equal(t, body3, requests[2].Chunk[:len(body3)])
+		assert.Equal(t, len(article3), requests[2].Read)
+	})
+
+	t.Run("a broken connection fails the remaining requests", func(t *testing.T) {
+		conn := newTestConnection(t, func(r *bufio.Reader, server net.Conn) {
+			for i := 0; i < 2; i++ {
+				if _, err := r.ReadString('\n'); err != nil {
+					return
+				}
+			}
+
+			_, _ = server.Write([]byte("222 0 <1> body\r\n=ybegin line=128 size=6 name=test\r\nabc"))
+			server.Close()
+		})
+
+		requests := []BodyRequest{
+			{MsgId: "1", Chunk: make([]byte, 6)},
+			{MsgId: "2", Chunk: make([]byte, 6)},
+		}
+		errs := conn.BodyPipelined(requests)
+
+		assert.ErrorIs(t, errs[0], io.EOF)
+		// The lines read before the connection broke
+		assert.Equal(t, len("=ybegin line=128 size=6 name=test\r\n"), requests[0].Read)
+		assert.ErrorIs(t, errs[1], io.EOF)
+		assert.True(t, IsRetryableError(errs[0]))
+
+		// The pending responses will never arrive, closing must not wait for them
+		done := make(chan struct{})
+		go func() {
+			_ = conn.Close()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("close blocked on the pending responses")
+		}
+	})
+}
+
+func TestBody(t *testing.T) {
+	// withTrailer replaces the =yend line of the article
+	withTrailer := func(article, trailer string) string {
+		start := strings.Index(article, "=yend")
+		return article[:start] + trailer + "\r\n.\r\n"
+	}
+
+	article, body := yencArticle("abcdef")
+	crc := crc32.ChecksumIEEE(body)
+
+	tests := []struct {
+		name    string
+		article string
+		err     error
+	}{
+		{
+			name:    "valid crc32",
+			article: withTrailer(article, fmt.Sprintf("=yend size=6 crc32=%08x", crc)),
+		},
+		{
+			name:    "crc32 mismatch",
+			article: withTrailer(article, fmt.Sprintf("=yend size=6 crc32=%08x", crc+1)),
+			err:     ErrCorruptedArticle,
+		},
+		{
+			name:    "size mismatch",
+			article: withTrailer(article, "=yend size=7"),
+			err:     ErrCorruptedArticle,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := newTestConnection(t, func(r *bufio.Reader, server net.Conn) {
+				for _, response := range []string{"222 0 <1> body\r\n" + tt.article, "223 0 <2>\r\n"} {
+					if _, err := r.ReadString('\n'); err != nil {
+						return
+					}
+					_, _ = server.Write([]byte(response))
+				}
+			})
+
+			chunk := make([]byte, len(body))
+			n, err := conn.Body("1", chunk)
+			// The whole article is read, even when it is corrupted
+			assert.Equal(t, len(tt.article), n)
+			if tt.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.err)
+				assert.False(t, IsRetryableError(err))
+			}
+			assert.Equal(t, body, chunk)
+
+			// The article was read up to its end, the connection can be reused
+			err = conn.Stat("2")
+			assert.NoError(t, err)
+		})
+	}
+}
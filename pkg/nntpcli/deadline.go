@@ -0,0 +1,91 @@
+package nntpcli
+
+import (
+	"net"
+	"time"
+)
+
+// Window in which a transfer must reach the min throughput
+const stallWindow = 10 * time.Second
+
+// deadlineConn sets the read and write deadlines of the connection for every command and
+// fails the transfers that are slower than the min throughput, so a stalled provider does
+// not block the connection until TCP gives up.
+type deadlineConn struct {
+	net.Conn
+	commandTimeout time.Duration
+	idleTimeout    time.Duration
+	// Bytes per second, 0 disables the stall detection
+	minThroughput   int
+	stallWindow     time.Duration
+	commandDeadline time.Time
+	windowStart     time.Time
+	windowBytes     int
+}
+
+func newDeadlineConn(conn net.Conn, provider Provider) *deadlineConn {
+	return &deadlineConn{
+		Conn:           conn,
+		commandTimeout: provider.CommandTimeout,
+		idleTimeout:    provider.IdleTimeout,
+		minThroughput:  provider.MinThroughput,
+		stallWindow:    stallWindow,
+	}
+}
+
+// startCommand starts the deadline and the throughput window of a new command
+func (c *deadlineConn) startCommand() {
+	now := time.Now()
+
+	c.commandDeadline = time.Time{}
+	if c.commandTimeout > 0 {
+		c.commandDeadline = now.Add(c.commandTimeout)
+	}
+
+	c.windowStart = now
+	c.windowBytes = 0
+}
+
+func (c *deadlineConn) Read(p []byte) (int, error) {
+	// It only fails on closed connections, the read reports it
+	_ = c.Conn.SetReadDeadline(c.deadline(c.idleTimeout))
+
+	n, err := c.Conn.Read(p)
+	if n > 0 && c.minThroughput > 0 && !c.windowStart.IsZero() {
+		c.windowBytes += n
+
+		elapsed := time.Since(c.windowStart)
+		if elapsed >= c.stallWindow {
+			if float64(c.windowBytes) < float64(c.minThroughput)*elapsed.Seconds() {
+				return n, ErrTransferStalled
+			}
+
+			c.windowStart = time.Now()
+			c.windowBytes = 0
+		}
+	}
+
+	return n, err
+}
+
+func (c *deadlineConn) Write(p []byte) (int, error) {
+	// It only fails on closed connections, the write reports it
+	_ = c.Conn.SetWriteDeadline(c.deadline(0))
+
+	return c.Conn.Write(p)
+}
+
+// deadline returns the earliest of the command deadline and the given timeout from now,
+// the zero time means no deadline
+func (c *deadlineConn) deadline(timeout time.Duration) time.Time {
+	if timeout <= 0 {
+		return c.commandDeadline
+	}
+
+	d := time.Now().Add(timeout)
+	if !c.commandDeadline.IsZero() && c.commandDeadline.Before(d) {
+		return c.commandDeadline
+	}
+
+	return d
+}
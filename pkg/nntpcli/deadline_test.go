@@ -0,0 +1,96 @@
+package nntpcli
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadlineConn(t *testing.T) {
+	isTimeout := func(err error) bool {
+		var netErr net.Error
+		return errors.As(err, &netErr) && netErr.Timeout()
+	}
+
+	// trickle writes a byte every interval until the connection is closed
+	trickle := func(server net.Conn, interval time.Duration) {
+		for {
+			time.Sleep(interval)
+			if _, err := server.Write([]byte("a")); err != nil {
+				return
+			}
+		}
+	}
+
+	t.Run("idle timeout", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer server.Close()
+
+		dc := newDeadlineConn(client, Provider{IdleTimeout: 20 * time.Millisecond})
+		dc.startCommand()
+
+		_, err := dc.Read(make([]byte, 1))
+		assert.True(t, isTimeout(err))
+		assert.True(t, IsRetryableError(err))
+	})
+
+	t.Run("command timeout", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		go trickle(server, 5*time.Millisecond)
+
+		dc := newDeadlineConn(client, Provider{
+			CommandTimeout: 50 * time.Millisecond,
+			IdleTimeout:    time.Second,
+		})
+		dc.startCommand()
+
+		start := time.Now()
+		var err error
+		for err == nil {
+			_, err = dc.Read(make([]byte, 1))
+		}
+
+		assert.True(t, isTimeout(err))
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("stalled transfer", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		go trickle(server, 5*time.Millisecond)
+
+		dc := newDeadlineConn(client, Provider{MinThroughput: 1000})
+		dc.stallWindow = 50 * time.Millisecond
+		dc.startCommand()
+
+		var err error
+		for err == nil {
+			_, err = dc.Read(make([]byte, 1))
+		}
+
+		assert.ErrorIs(t, err, ErrTransferStalled)
+		assert.True(t, IsRetryableError(err))
+	})
+
+	t.Run("a new command restarts the deadline", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		defer server.Close()
+
+		dc := newDeadlineConn(client, Provider{CommandTimeout: 20 * time.Millisecond})
+		dc.startCommand()
+		time.Sleep(30 * time.Millisecond)
+		dc.startCommand()
+
+		go func() {
+			_, _ = server.Write([]byte("a"))
+		}()
+
+		_, err := dc.Read(make([]byte, 1))
+		assert.NoError(t, err)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/textproto"
+	"time"
 )
 
 // PostingStatus type for groups.
@@ -48,3 +49,19 @@ type Article struct {
 func (a *Article) MessageID() string {
 	return a.Header.Get("Message-Id")
 }
+
+// MessageOverview of an article returned by OVER/XOVER.
+type MessageOverview struct {
+	MessageNumber int64
+	Subject       string
+	From          string
+	Date          time.Time
+	MessageId     string
+	References    []string
+	// Number of bytes in the article
+	Bytes int
+	// Number of lines in the article body
+	Lines int
+	// Additional fields advertised by LIST OVERVIEW.FMT
+	Extra []string
+}
@@ -11,10 +11,18 @@ import (
 var (
 	ErrCapabilitiesUnpopulated = errors.New("capabilities unpopulated")
 	ErrNoSuchCapability        = errors.New("no such capability")
+	ErrCompressionUnavailable  = errors.New("compression not available")
+	ErrUnsupportedProxyScheme  = errors.New("unsupported proxy scheme, use socks5 or http")
+	ErrTransferStalled         = errors.New("transfer stalled below the min throughput")
+	ErrInvalidTLSVersion       = errors.New("invalid tls version, use 1.0, 1.1, 1.2 or 1.3")
+	ErrFingerprintMismatch     = errors.New("server certificate does not match the pinned fingerprint")
+	ErrCorruptedArticle        = errors.New("decoded article does not match the size or crc32 of its yenc trailer")
+	ErrInterrupted             = errors.New("command interrupted")
 )
 
 const SegmentAlreadyExistsErrCode = 441
 const ToManyConnectionsErrCode = 502
+const ArticleNotFoundErrCode = 430
 
 var retirableErrors = []int{
 	SegmentAlreadyExistsErrCode,
@@ -27,7 +35,8 @@ func IsRetryableError(err error) bool {
 		errors.Is(err, syscall.ETIMEDOUT) ||
 		errors.Is(err, io.EOF) ||
 		errors.Is(err, net.ErrClosed) ||
-		errors.Is(err, io.ErrUnexpectedEOF) {
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, ErrTransferStalled) {
 		return true
 	}
 
@@ -52,3 +61,14 @@ func IsRetryableError(err error) bool {
 
 	return false
 }
+
+// IsArticleNotFoundError reports whether the provider answered that it does not
+// have the requested article. Other providers may still have it.
+func IsArticleNotFoundError(err error) bool {
+	var nntpErr *textproto.Error
+	if ok := errors.As(err, &nntpErr); ok {
+		return nntpErr.Code == ArticleNotFoundErrCode
+	}
+
+	return false
+}
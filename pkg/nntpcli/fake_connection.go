@@ -1,20 +1,38 @@
 package nntpcli
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
+
+	"github.com/mnightingale/rapidyenc"
 )
 
 type fakeConnection struct {
 	tls          bool
 	provider     Provider
 	currentGroup string
+	// Directory where the posted articles are stored, empty to discard them
+	articlesDir string
 }
 
-func NewFakeConnection(provider Provider) Connection {
+// NewFakeConnection returns a connection that does not talk to any server. The posted
+// articles are stored in articlesDir, keyed by message id, and read back from it. When
+// articlesDir is empty the articles are discarded and every body is read as zeros.
+func NewFakeConnection(provider Provider, articlesDir string) Connection {
 	return &fakeConnection{
-		tls:      false,
-		provider: provider,
+		tls:         false,
+		provider:    provider,
+		articlesDir: articlesDir,
 	}
 }
 
@@ -38,14 +56,214 @@ func (c *fakeConnection) Close() error {
 	return nil
 }
 
-func (c *fakeConnection) Body(msgId string, chunk []byte) error {
+func (c *fakeConnection) Interrupt() error {
 	return nil
 }
 
-func (c *fakeConnection) Post(r io.Reader) error {
+func (c *fakeConnection) Body(msgId string, chunk []byte) (int, error) {
+	if c.articlesDir == "" {
+		return len(chunk), nil
+	}
+
+	f, r, err := c.openArticle(msgId)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if _, err := textproto.NewReader(r).ReadMIMEHeader(); err != nil {
+		return 0, err
+	}
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(body), decodeYenc(rapidyenc.NewDecoder(defaultBufSize), bytes.NewReader(body), chunk)
+}
+
+func (c *fakeConnection) BodyPipelined(requests []BodyRequest) []error {
+	errs := make([]error, len(requests))
+	for i, req := range requests {
+		requests[i].Read, errs[i] = c.Body(req.MsgId, req.Chunk)
+	}
+
+	return errs
+}
+
+func (c *fakeConnection) EnableCompression() error {
 	return nil
 }
 
+func (c *fakeConnection) Compression() Compression {
+	return CompressionNone
+}
+
+func (c *fakeConnection) Capabilities() ([]string, error) {
+	return []string{"VERSION 2", "READER", "OVER"}, nil
+}
+
+func (c *fakeConnection) HasCapability(capability string) (bool, error) {
+	return true, nil
+}
+
+func (c *fakeConnection) CapabilityArguments(capability string) ([]string, error) {
+	return []string{}, nil
+}
+
+func (c *fakeConnection) Stat(msgId string) error {
+	if c.articlesDir == "" {
+		return nil
+	}
+
+	f, _, err := c.openArticle(msgId)
+	if err != nil {
+		return err
+	}
+
+	return f.Close()
+}
+
+func (c *fakeConnection) Head(msgId string) (*Article, error) {
+	if c.articlesDir == "" {
+		return &Article{Header: textproto.MIMEHeader{"Message-Id": {"<" + msgId + ">"}}}, nil
+	}
+
+	f, r, err := c.openArticle(msgId)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Article{Header: header}, nil
+}
+
+func (c *fakeConnection) Article(msgId string) (*Article, error) {
+	if c.articlesDir == "" {
+		return &Article{
+			Header: textproto.MIMEHeader{"Message-Id": {"<" + msgId + ">"}},
+			Body:   strings.NewReader(""),
+		}, nil
+	}
+
+	f, r, err := c.openArticle(msgId)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tr := textproto.NewReader(r)
+	header, err := tr.ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := tr.ReadDotBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Article{
+		Header: header,
+		Body:   bytes.NewReader(body),
+		Bytes:  len(body),
+		Lines:  bytes.Count(body, []byte("\n")),
+	}, nil
+}
+
+func (c *fakeConnection) Date() (time.Time, error) {
+	return time.Now().UTC(), nil
+}
+
+func (c *fakeConnection) Over(low, high int64) ([]MessageOverview, error) {
+	return []MessageOverview{}, nil
+}
+
+func (c *fakeConnection) ListActive(wildmat string) ([]Group, error) {
+	return []Group{}, nil
+}
+
+// Post stores the article as it would be sent by a server after a BODY or ARTICLE
+// response, dot stuffed and ended by the "." line, so it is decoded the same way.
+func (c *fakeConnection) Post(r io.Reader) error {
+	if c.articlesDir == "" {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	w := textproto.NewWriter(bw).DotWriter()
+	if _, err := io.Copy(w, r); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	header, err := textproto.NewReader(bufio.NewReader(bytes.NewReader(buf.Bytes()))).ReadMIMEHeader()
+	if err != nil {
+		return err
+	}
+
+	msgId := strings.Trim(header.Get("Message-Id"), "<> ")
+	if msgId == "" {
+		return &textproto.Error{Code: 441, Msg: "article without message id"}
+	}
+
+	if err := os.MkdirAll(c.articlesDir, 0755); err != nil {
+		return err
+	}
+
+	path := c.articlePath(msgId)
+	if _, err := os.Stat(path); err == nil {
+		return &textproto.Error{Code: SegmentAlreadyExistsErrCode, Msg: fmt.Sprintf("article <%s> already exists", msgId)}
+	}
+
+	// Written to a temp file first so a partial article is never read
+	tmp, err := os.CreateTemp(c.articlesDir, ".post-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (c *fakeConnection) articlePath(msgId string) string {
+	return filepath.Join(c.articlesDir, url.PathEscape(strings.Trim(msgId, "<>")))
+}
+
+// openArticle returns the stored article, a missing article is reported as a 430 response
+func (c *fakeConnection) openArticle(msgId string) (*os.File, *bufio.Reader, error) {
+	f, err := os.Open(c.articlePath(msgId))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, &textproto.Error{Code: ArticleNotFoundErrCode, Msg: "no such article"}
+		}
+
+		return nil, nil, err
+	}
+
+	return f, bufio.NewReader(f), nil
+}
+
 func (c *fakeConnection) MaxAgeTime() time.Time {
 	return time.Now().Add(1 * time.Hour)
 }
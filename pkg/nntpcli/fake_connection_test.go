@@ -0,0 +1,71 @@
+package nntpcli
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeConnection(t *testing.T) {
+	// The leading dot must survive the dot stuffing
+	article, body := yencArticle(".abcdef")
+	raw := "Message-ID: <1@test>\r\nSubject: test\r\n\r\n" + strings.TrimSuffix(article, ".\r\n")
+
+	t.Run("posted articles are read back", func(t *testing.T) {
+		c := NewFakeConnection(Provider{}, t.TempDir())
+
+		assert.NoError(t, c.Post(strings.NewReader(raw)))
+		assert.NoError(t, c.Stat("1@test"))
+
+		head, err := c.Head("1@test")
+		assert.NoError(t, err)
+		assert.Equal(t, "<1@test>", head.Header.Get("Message-Id"))
+
+		chunk := make([]byte, len(body))
+		n, err := c.Body("1@test", chunk)
+		assert.NoError(t, err)
+		assert.Equal(t, body, chunk)
+		// The article is read like it is sent, with the leading dot stuffed
+		assert.Equal(t, len(article)+1, n)
+
+		errs := c.BodyPipelined([]BodyRequest{{MsgId: "1@test", Chunk: make([]byte, len(body)+1)}})
+		assert.ErrorIs(t, errs[0], io.ErrUnexpectedEOF)
+
+		a, err := c.Article("1@test")
+		assert.NoError(t, err)
+		b, err := io.ReadAll(a.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, strings.ReplaceAll(strings.TrimSuffix(article, ".\r\n"), "\r\n", "\n"), string(b))
+		assert.Equal(t, 3, a.Lines)
+	})
+
+	t.Run("duplicated and missing articles", func(t *testing.T) {
+		c := NewFakeConnection(Provider{}, t.TempDir())
+
+		assert.NoError(t, c.Post(strings.NewReader(raw)))
+		err := c.Post(strings.NewReader(raw))
+		assert.Error(t, err)
+		assert.True(t, IsRetryableError(err))
+
+		assert.True(t, IsArticleNotFoundError(c.Stat("2@test")))
+		_, err = c.Body("2@test", make([]byte, 1))
+		assert.True(t, IsArticleNotFoundError(err))
+		_, err = c.Head("2@test")
+		assert.True(t, IsArticleNotFoundError(err))
+	})
+
+	t.Run("without a directory the articles are discarded", func(t *testing.T) {
+		c := NewFakeConnection(Provider{}, "")
+
+		assert.NoError(t, c.Post(strings.NewReader(raw)))
+		assert.NoError(t, c.Stat("2@test"))
+
+		chunk := make([]byte, 4)
+		n, err := c.Body("2@test", chunk)
+		assert.NoError(t, err)
+		assert.Equal(t, 4, n)
+		assert.Equal(t, make([]byte, 4), chunk)
+	})
+}
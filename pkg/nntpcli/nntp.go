@@ -52,26 +52,14 @@ func (c *client) Dial(
 	provider Provider,
 	maxAgeTime time.Time,
 ) (Connection, error) {
-	var d net.Dialer
+	ctx, cancel := c.dialContext(ctx, provider)
+	defer cancel()
 
-	conn, err := d.DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", provider.Host, provider.Port))
+	conn, err := dial(ctx, provider, maxAgeTime)
 	if err != nil {
 		return nil, err
 	}
 
-	err = conn.(*net.TCPConn).SetKeepAlive(true)
-	if err != nil {
-		return nil, err
-	}
-
-	duration := time.Until(maxAgeTime)
-
-	err = conn.(*net.TCPConn).SetKeepAlivePeriod(duration)
-	if err != nil {
-		fmt.Println(err)
-		return nil, err
-	}
-
 	return newConnection(conn, provider, maxAgeTime)
 }
 
@@ -81,31 +69,51 @@ func (c *client) DialTLS(
 	insecureSSL bool,
 	maxAgeTime time.Time,
 ) (Connection, error) {
-	var d net.Dialer
+	ctx, cancel := c.dialContext(ctx, provider)
+	defer cancel()
 
-	conn, err := d.DialContext(ctx, "tcp", fmt.Sprintf("%s:%d", provider.Host, provider.Port))
+	conn, err := dial(ctx, provider, maxAgeTime)
 	if err != nil {
 		return nil, err
 	}
 
-	err = conn.(*net.TCPConn).SetKeepAlive(true)
+	tlsConfig, err := newTLSConfig(provider, insecureSSL)
 	if err != nil {
+		conn.Close()
 		return nil, err
 	}
 
-	duration := time.Until(maxAgeTime)
-
-	err = conn.(*net.TCPConn).SetKeepAlivePeriod(duration)
+	tlsConn := tls.Client(conn, tlsConfig)
+	err = tlsConn.HandshakeContext(ctx)
 	if err != nil {
-		fmt.Println(err)
-		return nil, err
+		conn.Close()
+		return nil, newTLSHandshakeError(provider.Host, err)
 	}
 
-	tlsConn := tls.Client(conn, &tls.Config{ServerName: provider.Host, InsecureSkipVerify: insecureSSL})
-	err = tlsConn.Handshake()
-	if err != nil {
-		return nil, err
+	return newConnection(tlsConn, provider, maxAgeTime)
+}
+
+// dialContext limits the time to connect and do the TLS handshake
+func (c *client) dialContext(ctx context.Context, provider Provider) (context.Context, context.CancelFunc) {
+	timeout := provider.DialTimeout
+	if timeout <= 0 {
+		timeout = c.timeout
 	}
 
-	return newConnection(tlsConn, provider, maxAgeTime)
+	return context.WithTimeout(ctx, timeout)
+}
+
+// dial opens the TCP connection to the provider, through its proxy if it has one
+func dial(ctx context.Context, provider Provider, maxAgeTime time.Time) (net.Conn, error) {
+	d := &net.Dialer{
+		// Keep the connection alive until it reaches its max age
+		KeepAlive: time.Until(maxAgeTime),
+	}
+	addr := fmt.Sprintf("%s:%d", provider.Host, provider.Port)
+
+	if provider.ProxyURL != "" {
+		return dialProxy(ctx, d, provider.ProxyURL, addr)
+	}
+
+	return d.DialContext(ctx, "tcp", addr)
 }
@@ -0,0 +1,150 @@
+package nntpcli
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newFakeProxy accepts one connection and runs handshake before acting as the NNTP server
+func newFakeProxy(t *testing.T, handshake func(r *bufio.Reader, w net.Conn) bool) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		l.Close()
+	})
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		if !handshake(r, conn) {
+			return
+		}
+
+		// Capabilities discovery
+		if _, err := r.ReadString('\n'); err != nil {
+			return
+		}
+		_, _ = conn.Write([]byte("500 unknown command\r\n"))
+	}()
+
+	return l.Addr().String()
+}
+
+func TestDialProxy(t *testing.T) {
+	c := &client{timeout: 5 * time.Second}
+	maxAgeTime := time.Now().Add(time.Hour)
+
+	t.Run("http connect", func(t *testing.T) {
+		addr := newFakeProxy(t, func(r *bufio.Reader, w net.Conn) bool {
+			req, err := http.ReadRequest(r)
+			if err != nil {
+				return false
+			}
+			assert.Equal(t, http.MethodConnect, req.Method)
+			assert.Equal(t, "news.example:119", req.Host)
+			assert.Equal(t, "Basic dXNlcjpwYXNz", req.Header.Get("Proxy-Authorization"))
+
+			// The greeting is sent together with the proxy response
+			_, _ = w.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n200 mock server ready\r\n"))
+
+			return true
+		})
+
+		conn, err := c.Dial(context.Background(), Provider{
+			Host:     "news.example",
+			Port:     119,
+			ProxyURL: "http://user:pass@" + addr,
+		}, maxAgeTime)
+		assert.NoError(t, err)
+		assert.NotNil(t, conn)
+	})
+
+	t.Run("http connect refused", func(t *testing.T) {
+		addr := newFakeProxy(t, func(r *bufio.Reader, w net.Conn) bool {
+			if _, err := http.ReadRequest(r); err != nil {
+				return false
+			}
+			_, _ = w.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\nContent-Length: 0\r\n\r\n"))
+
+			return false
+		})
+
+		_, err := c.Dial(context.Background(), Provider{
+			Host:     "news.example",
+			Port:     119,
+			ProxyURL: "http://" + addr,
+		}, maxAgeTime)
+		assert.ErrorContains(t, err, "407")
+	})
+
+	t.Run("socks5", func(t *testing.T) {
+		addr := newFakeProxy(t, func(r *bufio.Reader, w net.Conn) bool {
+			// Greeting with the auth methods, user/password is chosen
+			header := make([]byte, 2)
+			if _, err := io.ReadFull(r, header); err != nil {
+				return false
+			}
+			if _, err := io.ReadFull(r, make([]byte, header[1])); err != nil {
+				return false
+			}
+			_, _ = w.Write([]byte{5, 2})
+
+			// User/password negotiation
+			version, _ := r.ReadByte()
+			assert.Equal(t, byte(1), version)
+			userLen, _ := r.ReadByte()
+			user := make([]byte, userLen)
+			_, _ = io.ReadFull(r, user)
+			passwordLen, _ := r.ReadByte()
+			password := make([]byte, passwordLen)
+			_, _ = io.ReadFull(r, password)
+			assert.Equal(t, "user", string(user))
+			assert.Equal(t, "pass", string(password))
+			_, _ = w.Write([]byte{1, 0})
+
+			// Connect request to a domain name
+			request := make([]byte, 5)
+			if _, err := io.ReadFull(r, request); err != nil {
+				return false
+			}
+			host := make([]byte, request[4])
+			_, _ = io.ReadFull(r, host)
+			_, _ = io.ReadFull(r, make([]byte, 2))
+			assert.Equal(t, "news.example", string(host))
+
+			_, _ = w.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 119})
+			_, _ = w.Write([]byte("200 mock server ready\r\n"))
+
+			return true
+		})
+
+		conn, err := c.Dial(context.Background(), Provider{
+			Host:     "news.example",
+			Port:     119,
+			ProxyURL: "socks5://user:pass@" + addr,
+		}, maxAgeTime)
+		assert.NoError(t, err)
+		assert.NotNil(t, conn)
+	})
+
+	t.Run("unsupported scheme", func(t *testing.T) {
+		_, err := c.Dial(context.Background(), Provider{
+			Host:     "news.example",
+			Port:     119,
+			ProxyURL: "ftp://127.0.0.1:21",
+		}, maxAgeTime)
+		assert.ErrorIs(t, err, ErrUnsupportedProxyScheme)
+	})
+}
@@ -0,0 +1,161 @@
+package nntpcli
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TLSOptions customizes the TLS connection to a provider
+type TLSOptions struct {
+	// PEM file with the CA certificates that sign the server certificate, the system roots
+	// are used when it is empty
+	CAFile string
+	// SHA-256 fingerprint of the server certificate in hex, colons are optional
+	Fingerprint string
+	// PEM files of the client certificate and its key
+	CertFile string
+	KeyFile  string
+	// Min TLS version: 1.0, 1.1, 1.2 or 1.3
+	MinVersion string
+	// Name used for SNI and to verify the server certificate, the host by default
+	ServerName string
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSHandshakeError explains why the TLS handshake with a provider failed and how to fix it
+type TLSHandshakeError struct {
+	Host string
+	Hint string
+	Err  error
+}
+
+func (e *TLSHandshakeError) Error() string {
+	if e.Hint == "" {
+		return fmt.Sprintf("tls handshake with %s failed: %v", e.Host, e.Err)
+	}
+
+	return fmt.Sprintf("tls handshake with %s failed: %v (%s)", e.Host, e.Err, e.Hint)
+}
+
+func (e *TLSHandshakeError) Unwrap() error {
+	return e.Err
+}
+
+func newTLSConfig(provider Provider, insecureSSL bool) (*tls.Config, error) {
+	opts := provider.TLS
+
+	config := &tls.Config{
+		ServerName:         provider.Host,
+		InsecureSkipVerify: insecureSSL,
+	}
+
+	if opts.ServerName != "" {
+		config.ServerName = opts.ServerName
+	}
+
+	if opts.MinVersion != "" {
+		version, ok := tlsVersions[opts.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidTLSVersion, opts.MinVersion)
+		}
+
+		config.MinVersion = version
+	}
+
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the tls ca file: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in the tls ca file %s", opts.CAFile)
+		}
+
+		config.RootCAs = pool
+	}
+
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading the tls client certificate: %w", err)
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if opts.Fingerprint != "" {
+		expected := normalizeFingerprint(opts.Fingerprint)
+
+		// It runs even when the verification is skipped, so self signed certificates
+		// can be trusted by their fingerprint alone
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return ErrFingerprintMismatch
+			}
+
+			actual := Fingerprint(cs.PeerCertificates[0])
+			if actual != expected {
+				return fmt.Errorf("%w: the server certificate is %s", ErrFingerprintMismatch, actual)
+			}
+
+			return nil
+		}
+	}
+
+	return config, nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of the certificate in hex
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.ReplaceAll(fingerprint, ":", ""))
+}
+
+// newTLSHandshakeError adds a hint to fix the most common handshake failures
+func newTLSHandshakeError(host string, err error) error {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostnameErr      x509.HostnameError
+		invalidCert      x509.CertificateInvalidError
+		recordHeaderErr  tls.RecordHeaderError
+	)
+
+	hint := ""
+	switch {
+	case errors.Is(err, ErrFingerprintMismatch):
+		hint = "update tls_fingerprint if the provider changed its certificate"
+	case errors.As(err, &unknownAuthority):
+		hint = "set tls_ca_file with the CA of the provider or pin its certificate with tls_fingerprint"
+	case errors.As(err, &hostnameErr):
+		hint = "set tls_server_name with a name of the certificate"
+	case errors.As(err, &invalidCert) && invalidCert.Reason == x509.Expired:
+		hint = "the certificate expired or is not valid yet, check the system clock"
+	case errors.As(err, &recordHeaderErr):
+		hint = "the server did not answer with TLS, check the port or disable tls"
+	case strings.Contains(err.Error(), "protocol version"):
+		hint = "the server does not support the tls_min_version"
+	case strings.Contains(err.Error(), "certificate required") || strings.Contains(err.Error(), "bad certificate"):
+		hint = "the server rejected the client certificate, check tls_cert_file and tls_key_file"
+	}
+
+	return &TLSHandshakeError{Host: host, Hint: hint, Err: err}
+}
@@ -0,0 +1,190 @@
+package nntpcli
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newSelfSignedCert returns a certificate for news.test and writes it and its key as PEM files
+func newSelfSignedCert(t *testing.T) (tls.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "news.test"},
+		DNSNames:              []string{"news.test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	assert.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	assert.NoError(t, err)
+
+	return cert, certFile, keyFile
+}
+
+// newTLSServer serves the greeting and the capabilities discovery over TLS
+func newTLSServer(t *testing.T, config *tls.Config) (string, int) {
+	l, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		l.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				if _, err := conn.Write([]byte("200 mock server ready\r\n")); err != nil {
+					return
+				}
+				if _, err := bufio.NewReader(conn).ReadString('\n'); err != nil {
+					return
+				}
+				_, _ = conn.Write([]byte("500 unknown command\r\n"))
+			}()
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(l.Addr().String())
+	assert.NoError(t, err)
+	p, err := strconv.Atoi(port)
+	assert.NoError(t, err)
+
+	return host, p
+}
+
+func TestDialTLS(t *testing.T) {
+	c := &client{timeout: 5 * time.Second}
+	ctx := context.Background()
+	maxAgeTime := time.Now().Add(time.Hour)
+
+	cert, certFile, keyFile := newSelfSignedCert(t)
+	host, port := newTLSServer(t, &tls.Config{Certificates: []tls.Certificate{cert}})
+
+	t.Run("trust the provider ca", func(t *testing.T) {
+		conn, err := c.DialTLS(ctx, Provider{
+			Host: host,
+			Port: port,
+			TLS:  TLSOptions{CAFile: certFile, ServerName: "news.test", MinVersion: "1.2"},
+		}, false, maxAgeTime)
+		assert.NoError(t, err)
+		assert.NotNil(t, conn)
+	})
+
+	t.Run("unknown authority", func(t *testing.T) {
+		_, err := c.DialTLS(ctx, Provider{
+			Host: host,
+			Port: port,
+			TLS:  TLSOptions{ServerName: "news.test"},
+		}, false, maxAgeTime)
+
+		var tlsErr *TLSHandshakeError
+		assert.ErrorAs(t, err, &tlsErr)
+		assert.ErrorContains(t, err, "tls_ca_file")
+	})
+
+	t.Run("certificate for another name", func(t *testing.T) {
+		_, err := c.DialTLS(ctx, Provider{
+			Host: host,
+			Port: port,
+			TLS:  TLSOptions{CAFile: certFile},
+		}, false, maxAgeTime)
+		assert.ErrorContains(t, err, "tls_server_name")
+	})
+
+	t.Run("pinned fingerprint", func(t *testing.T) {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		assert.NoError(t, err)
+		fingerprint := Fingerprint(leaf)
+
+		conn, err := c.DialTLS(ctx, Provider{
+			Host: host,
+			Port: port,
+			TLS:  TLSOptions{Fingerprint: fingerprint},
+		}, true, maxAgeTime)
+		assert.NoError(t, err)
+		assert.NotNil(t, conn)
+
+		_, err = c.DialTLS(ctx, Provider{
+			Host: host,
+			Port: port,
+			TLS:  TLSOptions{Fingerprint: "00:11:22"},
+		}, true, maxAgeTime)
+		assert.ErrorIs(t, err, ErrFingerprintMismatch)
+		assert.ErrorContains(t, err, fingerprint)
+	})
+
+	t.Run("client certificate", func(t *testing.T) {
+		clientCAs := x509.NewCertPool()
+		pemData, err := os.ReadFile(certFile)
+		assert.NoError(t, err)
+		clientCAs.AppendCertsFromPEM(pemData)
+
+		host, port := newTLSServer(t, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    clientCAs,
+		})
+
+		conn, err := c.DialTLS(ctx, Provider{
+			Host: host,
+			Port: port,
+			TLS: TLSOptions{
+				CAFile:     certFile,
+				ServerName: "news.test",
+				CertFile:   certFile,
+				KeyFile:    keyFile,
+			},
+		}, false, maxAgeTime)
+		assert.NoError(t, err)
+		assert.NotNil(t, conn)
+	})
+
+	t.Run("invalid min version", func(t *testing.T) {
+		_, err := c.DialTLS(ctx, Provider{
+			Host: host,
+			Port: port,
+			TLS:  TLSOptions{MinVersion: "1.4"},
+		}, false, maxAgeTime)
+		assert.ErrorIs(t, err, ErrInvalidTLSVersion)
+	})
+}
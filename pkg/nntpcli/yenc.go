@@ -0,0 +1,113 @@
+package nntpcli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/mnightingale/rapidyenc"
+)
+
+var yendPrefix = []byte("=yend ")
+
+// decodeYenc decodes the article read from r into chunk and checks the decoded size and
+// CRC32 against the yEnc trailer of the article.
+func decodeYenc(decoder *rapidyenc.Decoder, r io.Reader, chunk []byte) error {
+	tr := &trailerReader{r: r, lineStart: true}
+	decoder.SetReader(tr)
+
+	_, err := io.ReadFull(decoder, chunk)
+	if err == nil {
+		// The trailer is only checked once the whole article is decoded
+		_, err = io.Copy(io.Discard, decoder)
+	}
+
+	// Final segments has less bytes than chunkSize, the article was decoded up to its end too
+	if err == nil || errors.Is(err, io.ErrUnexpectedEOF) {
+		if crcErr := checkCRC(tr.trailer, decoder.Meta().Hash); crcErr != nil {
+			return crcErr
+		}
+	}
+
+	if errors.Is(err, rapidyenc.ErrCrcMismatch) || errors.Is(err, rapidyenc.ErrDataCorruption) {
+		return fmt.Errorf("%w: %w", ErrCorruptedArticle, err)
+	}
+
+	return err
+}
+
+// checkCRC compares the CRC32 of the decoded data with the one of the trailer. The decoder
+// does not check the CRC32 at the end of the line, the way most encoders write it.
+func checkCRC(trailer []byte, hash uint32) error {
+	key := []byte(" crc32=")
+	if bytes.Contains(trailer, []byte(" pcrc32=")) {
+		key = []byte(" pcrc32=")
+	}
+
+	start := bytes.Index(trailer, key)
+	if start == -1 {
+		// The articles without a CRC32 can not be checked
+		return nil
+	}
+
+	value := trailer[start+len(key):]
+	if end := bytes.IndexAny(value, " \r\n"); end != -1 {
+		value = value[:end]
+	}
+
+	expected, err := strconv.ParseUint(string(value), 16, 32)
+	if err != nil {
+		return nil
+	}
+
+	if uint32(expected) != hash {
+		return fmt.Errorf("%w: expected crc32 %08x but got %08x", ErrCorruptedArticle, expected, hash)
+	}
+
+	return nil
+}
+
+// trailerReader keeps the =yend line of the article that is read through it
+type trailerReader struct {
+	r io.Reader
+	// Start of the current line while it can still be the trailer
+	line      []byte
+	lineStart bool
+	trailer   []byte
+}
+
+func (t *trailerReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+
+	data := p[:n]
+	for len(data) > 0 {
+		part := data
+		end := bytes.IndexByte(data, '\n')
+		if end != -1 {
+			part = data[:end+1]
+		}
+
+		if t.lineStart {
+			t.line = append(t.line, part...)
+			if !bytes.HasPrefix(t.line, yendPrefix) && !bytes.HasPrefix(yendPrefix, t.line) {
+				t.line = t.line[:0]
+				t.lineStart = false
+			}
+		}
+
+		if end != -1 {
+			if bytes.HasPrefix(t.line, yendPrefix) {
+				t.trailer = append(t.trailer[:0], t.line...)
+			}
+
+			t.line = t.line[:0]
+			t.lineStart = true
+		}
+
+		data = data[len(part):]
+	}
+
+	return n, err
+}
@@ -0,0 +1,47 @@
+package nntpcli
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/mnightingale/rapidyenc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeYenc(t *testing.T) {
+	// Part written the way the file writer does it, with the CRC32 at the end of the trailer
+	part := func(crc uint32) string {
+		return "=ybegin part=1 total=1 line=128 size=3 name=test\r\n" +
+			"=ypart begin=1 end=3\r\n" +
+			"\x8b\x8c\x8d\r\n" +
+			fmt.Sprintf("=yend size=3 part=1 pcrc32=%08X\r\n", crc) +
+			".\r\n"
+	}
+	crc := crc32.ChecksumIEEE([]byte("abc"))
+
+	t.Run("valid part read a byte at a time", func(t *testing.T) {
+		chunk := make([]byte, 3)
+		err := decodeYenc(rapidyenc.NewDecoder(defaultBufSize), iotest.OneByteReader(strings.NewReader(part(crc))), chunk)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("abc"), chunk)
+	})
+
+	t.Run("crc32 mismatch", func(t *testing.T) {
+		chunk := make([]byte, 3)
+		err := decodeYenc(rapidyenc.NewDecoder(defaultBufSize), strings.NewReader(part(crc+1)), chunk)
+		assert.ErrorIs(t, err, ErrCorruptedArticle)
+	})
+
+	t.Run("part shorter than the chunk", func(t *testing.T) {
+		chunk := make([]byte, 5)
+		err := decodeYenc(rapidyenc.NewDecoder(defaultBufSize), strings.NewReader(part(crc+1)), chunk)
+		assert.ErrorIs(t, err, ErrCorruptedArticle)
+
+		err = decodeYenc(rapidyenc.NewDecoder(defaultBufSize), strings.NewReader(part(crc)), chunk)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+}
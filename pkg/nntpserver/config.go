@@ -0,0 +1,53 @@
+package nntpserver
+
+import (
+	"io"
+	"log/slog"
+)
+
+type Config struct {
+	addr     string
+	username string
+	password string
+	log      *slog.Logger
+	gzip     bool
+}
+
+type Option func(*Config)
+
+func defaultConfig() *Config {
+	return &Config{
+		addr: "127.0.0.1:0",
+		log:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+// WithAddr sets the address to listen on, a random local port by default
+func WithAddr(addr string) Option {
+	return func(c *Config) {
+		c.addr = addr
+	}
+}
+
+// WithCredentials requires the clients to authenticate with AUTHINFO USER/PASS
+// before sending any other command
+func WithCredentials(username, password string) Option {
+	return func(c *Config) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// WithGzip accepts XFEATURE COMPRESS GZIP, the BODY responses of the sessions that enable it
+// are compressed
+func WithGzip() Option {
+	return func(c *Config) {
+		c.gzip = true
+	}
+}
+
+func WithLogger(log *slog.Logger) Option {
+	return func(c *Config) {
+		c.log = log
+	}
+}
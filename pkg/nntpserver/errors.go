@@ -0,0 +1,7 @@
+package nntpserver
+
+import "errors"
+
+var (
+	ErrMissingMessageId = errors.New("article without message id")
+)
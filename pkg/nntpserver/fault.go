@@ -0,0 +1,80 @@
+package nntpserver
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+type FaultKind int
+
+const (
+	// The article is answered with 430 no such article
+	FaultArticleNotFound FaultKind = iota
+	// The server answers 502 too many connections and closes the socket
+	FaultTooManyConnections
+	// The socket is closed without answering, or in the middle of the body
+	// for the commands that send an article
+	FaultDropConnection
+	// The response is sent after the fault delay
+	FaultSlowResponse
+	// The first half of the body is sent and the rest after the fault delay, only for BODY
+	FaultStalledBody
+)
+
+// CommandConnect matches the new connections, the fault replaces the greeting
+const CommandConnect = "CONNECT"
+
+// Fault makes the server misbehave the next times a command is received
+type Fault struct {
+	Kind FaultKind
+	// Command the fault applies to, like BODY or POST. Empty matches all of them
+	Command string
+	// Times the fault is triggered, 0 means until the faults are cleared
+	Times int
+	// Delay of FaultSlowResponse and FaultStalledBody
+	Delay time.Duration
+}
+
+type faults struct {
+	mx     sync.Mutex
+	faults []*Fault
+}
+
+func (f *faults) add(fault Fault) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	fault.Command = strings.ToUpper(fault.Command)
+	f.faults = append(f.faults, &fault)
+}
+
+func (f *faults) clear() {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	f.faults = nil
+}
+
+// next returns the first fault that matches the command and consumes one of its times
+func (f *faults) next(command string) (Fault, bool) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	for i, fault := range f.faults {
+		if fault.Command != "" && fault.Command != command {
+			continue
+		}
+
+		if fault.Times > 0 {
+			fault.Times--
+			if fault.Times == 0 {
+				f.faults = append(f.faults[:i], f.faults[i+1:]...)
+			}
+		}
+
+		return *fault, true
+	}
+
+	return Fault{}, false
+}
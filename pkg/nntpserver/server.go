@@ -0,0 +1,169 @@
+// Package nntpserver is an in-process NNTP server that keeps the articles in memory.
+// It supports the commands used to upload and download articles and it can inject
+// faults, so the NNTP clients can be tested end to end.
+package nntpserver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Server struct {
+	listener net.Listener
+	store    *store
+	faults   faults
+	config   *Config
+	mx       sync.Mutex
+	conns    map[net.Conn]struct{}
+	commands map[string]int
+	wg       sync.WaitGroup
+}
+
+// New starts a server that listens until it is closed
+func New(options ...Option) (*Server, error) {
+	config := defaultConfig()
+	for _, option := range options {
+		option(config)
+	}
+
+	l, err := net.Listen("tcp", config.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener: l,
+		store:    newStore(),
+		config:   config,
+		conns:    map[net.Conn]struct{}{},
+		commands: map[string]int{},
+	}
+
+	s.wg.Add(1)
+	go s.acceptLoop()
+
+	return s, nil
+}
+
+// Addr returns the host:port the server listens on
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr())
+
+	return host
+}
+
+func (s *Server) Port() int {
+	_, port, _ := net.SplitHostPort(s.Addr())
+	p, _ := strconv.Atoi(port)
+
+	return p
+}
+
+// Close stops listening and closes all the connections
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mx.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mx.Unlock()
+
+	s.wg.Wait()
+
+	return err
+}
+
+// AddArticle stores a raw article, headers and body, as if it was posted
+func (s *Server) AddArticle(raw []byte) error {
+	msgId, a, err := parseArticle(raw)
+	if err != nil {
+		return err
+	}
+
+	if !s.store.add(msgId, a) {
+		return fmt.Errorf("article <%s> already exists", msgId)
+	}
+
+	return nil
+}
+
+func (s *Server) HasArticle(msgId string) bool {
+	_, ok := s.store.get(trimMessageId(msgId))
+
+	return ok
+}
+
+func (s *Server) RemoveArticle(msgId string) {
+	s.store.remove(trimMessageId(msgId))
+}
+
+func (s *Server) ArticleCount() int {
+	return s.store.len()
+}
+
+// InjectFault adds a fault, when several faults match a command the first one added wins
+func (s *Server) InjectFault(fault Fault) {
+	s.faults.add(fault)
+}
+
+func (s *Server) ClearFaults() {
+	s.faults.clear()
+}
+
+// CommandCount returns how many times the command was received, CommandConnect
+// counts the connections
+func (s *Server) CommandCount(command string) int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	return s.commands[strings.ToUpper(command)]
+}
+
+func (s *Server) countCommand(command string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	s.commands[command]++
+}
+
+func (s *Server) acceptLoop() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.config.log.Error("error accepting connection", "error", err)
+			}
+
+			return
+		}
+
+		s.mx.Lock()
+		s.conns[conn] = struct{}{}
+		s.mx.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mx.Lock()
+				delete(s.conns, conn)
+				s.mx.Unlock()
+
+				conn.Close()
+			}()
+
+			newSession(s, conn).serve()
+		}()
+	}
+}
@@ -0,0 +1,236 @@
+package nntpserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"hash/crc32"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/javi11/usenet-drive/pkg/nntpcli"
+	"github.com/javi11/usenet-drive/pkg/yenc"
+	"github.com/stretchr/testify/assert"
+)
+
+// newArticle builds a yEnc article with the given data as its only part
+func newArticle(t *testing.T, msgId string, data []byte) []byte {
+	buf := bytes.NewBufferString(fmt.Sprintf(
+		"From: poster@example.com\r\nNewsgroups: alt.binaries.test\r\nMessage-ID: <%s>\r\nSubject: test\r\n\r\n"+
+			"=ybegin part=1 total=1 line=128 size=%d name=test.bin\r\n=ypart begin=1 end=%d\r\n",
+		msgId,
+		len(data),
+		len(data),
+	))
+	assert.NoError(t, yenc.Encode(data, buf))
+	buf.WriteString(fmt.Sprintf("=yend size=%d part=1 pcrc32=%08X\r\n", len(data), crc32.ChecksumIEEE(data)))
+
+	return buf.Bytes()
+}
+
+func newData(t *testing.T, size int) []byte {
+	data := make([]byte, size)
+	_, err := rand.Read(data)
+	assert.NoError(t, err)
+
+	return data
+}
+
+func newTestServer(t *testing.T, options ...Option) *Server {
+	s, err := New(options...)
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		s.Close()
+	})
+
+	return s
+}
+
+func dial(t *testing.T, s *Server, username, password string) (nntpcli.Connection, error) {
+	conn, err := nntpcli.New(nntpcli.WithTimeout(5*time.Second)).Dial(context.Background(), nntpcli.Provider{
+		Host:     s.Host(),
+		Port:     s.Port(),
+		Username: username,
+		Password: password,
+	}, time.Now().Add(time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	return conn, nil
+}
+
+func TestServer(t *testing.T) {
+	t.Run("post and read back the body", func(t *testing.T) {
+		s := newTestServer(t)
+		conn, err := dial(t, s, "", "")
+		assert.NoError(t, err)
+
+		first := newData(t, 20000)
+		second := newData(t, 300)
+		assert.NoError(t, conn.Post(bytes.NewReader(newArticle(t, "first@test", first))))
+		assert.NoError(t, conn.Post(bytes.NewReader(newArticle(t, "second@test", second))))
+		assert.Equal(t, 2, s.ArticleCount())
+		assert.True(t, s.HasArticle("<first@test>"))
+
+		assert.NoError(t, conn.JoinGroup("alt.binaries.test"))
+
+		chunk := make([]byte, len(first))
+		_, err = conn.Body("first@test", chunk)
+		assert.NoError(t, err)
+		assert.Equal(t, first, chunk)
+
+		chunk = make([]byte, len(second))
+		_, err = conn.Body("second@test", chunk)
+		assert.NoError(t, err)
+		assert.Equal(t, second, chunk)
+
+		assert.NoError(t, conn.Stat("second@test"))
+		assert.True(t, nntpcli.IsArticleNotFoundError(conn.Stat("missing@test")))
+		_, err = conn.Body("missing@test", chunk)
+		assert.True(t, nntpcli.IsArticleNotFoundError(err))
+	})
+
+	t.Run("duplicated article", func(t *testing.T) {
+		s := newTestServer(t)
+		conn, err := dial(t, s, "", "")
+		assert.NoError(t, err)
+
+		article := newArticle(t, "dup@test", newData(t, 10))
+		assert.NoError(t, conn.Post(bytes.NewReader(article)))
+
+		err = conn.Post(bytes.NewReader(article))
+		var nntpErr *textproto.Error
+		assert.ErrorAs(t, err, &nntpErr)
+		assert.Equal(t, nntpcli.SegmentAlreadyExistsErrCode, nntpErr.Code)
+	})
+
+	t.Run("authentication", func(t *testing.T) {
+		s := newTestServer(t, WithCredentials("user", "pass"))
+
+		conn, err := dial(t, s, "user", "wrong")
+		assert.NoError(t, err)
+		assert.Error(t, conn.Authenticate())
+
+		conn, err = dial(t, s, "user", "pass")
+		assert.NoError(t, err)
+		assert.ErrorContains(t, conn.Stat("missing@test"), "480")
+		assert.NoError(t, conn.Authenticate())
+		assert.True(t, nntpcli.IsArticleNotFoundError(conn.Stat("missing@test")))
+	})
+
+	t.Run("download the body with gzip enabled", func(t *testing.T) {
+		s := newTestServer(t, WithGzip())
+		conn, err := dial(t, s, "", "")
+		assert.NoError(t, err)
+
+		first := newData(t, 200000)
+		second := newData(t, 300)
+		assert.NoError(t, conn.Post(bytes.NewReader(newArticle(t, "first@test", first))))
+		assert.NoError(t, conn.Post(bytes.NewReader(newArticle(t, "second@test", second))))
+
+		assert.NoError(t, conn.EnableCompression())
+		assert.Equal(t, nntpcli.CompressionGzip, conn.Compression())
+
+		chunk := make([]byte, len(first))
+		n, err := conn.Body("first@test", chunk)
+		assert.NoError(t, err)
+		assert.Equal(t, first, chunk)
+		// The compressed bytes are read from the connection
+		assert.Greater(t, n, 0)
+
+		requests := []nntpcli.BodyRequest{
+			{MsgId: "second@test", Chunk: make([]byte, len(second))},
+			{MsgId: "missing@test", Chunk: make([]byte, len(second))},
+			{MsgId: "first@test", Chunk: make([]byte, len(first))},
+		}
+		errs := conn.BodyPipelined(requests)
+		assert.NoError(t, errs[0])
+		assert.Equal(t, second, requests[0].Chunk)
+		assert.True(t, nntpcli.IsArticleNotFoundError(errs[1]))
+		assert.NoError(t, errs[2])
+		assert.Equal(t, first, requests[2].Chunk)
+
+		// The connection can still be used
+		assert.NoError(t, conn.Stat("second@test"))
+	})
+}
+
+func TestServer_Faults(t *testing.T) {
+	t.Run("article not found", func(t *testing.T) {
+		s := newTestServer(t)
+		assert.NoError(t, s.AddArticle(newArticle(t, "a@test", newData(t, 10))))
+		s.InjectFault(Fault{Kind: FaultArticleNotFound, Command: "body", Times: 1})
+
+		conn, err := dial(t, s, "", "")
+		assert.NoError(t, err)
+
+		chunk := make([]byte, 10)
+		_, err = conn.Body("a@test", chunk)
+		assert.True(t, nntpcli.IsArticleNotFoundError(err))
+		_, err = conn.Body("a@test", chunk)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, s.CommandCount("BODY"))
+	})
+
+	t.Run("too many connections", func(t *testing.T) {
+		s := newTestServer(t)
+		s.InjectFault(Fault{Kind: FaultTooManyConnections, Command: CommandConnect})
+
+		_, err := dial(t, s, "", "")
+		var nntpErr *textproto.Error
+		assert.ErrorAs(t, err, &nntpErr)
+		assert.Equal(t, nntpcli.ToManyConnectionsErrCode, nntpErr.Code)
+		assert.True(t, nntpcli.IsRetryableError(err))
+
+		s.ClearFaults()
+		_, err = dial(t, s, "", "")
+		assert.NoError(t, err)
+	})
+
+	t.Run("dropped connection in the middle of the body", func(t *testing.T) {
+		s := newTestServer(t)
+		assert.NoError(t, s.AddArticle(newArticle(t, "a@test", newData(t, 20000))))
+		s.InjectFault(Fault{Kind: FaultDropConnection, Command: "BODY", Times: 1})
+
+		conn, err := dial(t, s, "", "")
+		assert.NoError(t, err)
+
+		_, err = conn.Body("a@test", make([]byte, 20000))
+		assert.True(t, nntpcli.IsRetryableError(err))
+	})
+
+	t.Run("slow response", func(t *testing.T) {
+		s := newTestServer(t)
+		s.InjectFault(Fault{Kind: FaultSlowResponse, Command: "STAT", Delay: 50 * time.Millisecond})
+
+		conn, err := dial(t, s, "", "")
+		assert.NoError(t, err)
+
+		start := time.Now()
+		assert.True(t, nntpcli.IsArticleNotFoundError(conn.Stat("missing@test")))
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("stalled body", func(t *testing.T) {
+		s := newTestServer(t)
+		data := newData(t, 20000)
+		assert.NoError(t, s.AddArticle(newArticle(t, "a@test", data)))
+		s.InjectFault(Fault{Kind: FaultStalledBody, Command: "BODY", Times: 1, Delay: 50 * time.Millisecond})
+
+		conn, err := dial(t, s, "", "")
+		assert.NoError(t, err)
+
+		start := time.Now()
+		chunk := make([]byte, len(data))
+		_, err = conn.Body("a@test", chunk)
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+		assert.Equal(t, data, chunk)
+	})
+}
@@ -0,0 +1,369 @@
+package nntpserver
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// errCloseSession ends the session after the response was sent
+var errCloseSession = errors.New("close session")
+
+type session struct {
+	s             *Server
+	conn          net.Conn
+	r             *textproto.Reader
+	w             *textproto.Writer
+	authenticated bool
+	username      string
+	// XFEATURE COMPRESS GZIP was enabled
+	gzip bool
+}
+
+func newSession(s *Server, conn net.Conn) *session {
+	return &session{
+		s:             s,
+		conn:          conn,
+		r:             textproto.NewReader(bufio.NewReader(conn)),
+		w:             textproto.NewWriter(bufio.NewWriter(conn)),
+		authenticated: s.config.username == "",
+	}
+}
+
+func (ss *session) serve() {
+	ss.s.countCommand(CommandConnect)
+
+	if fault, ok := ss.s.faults.next(CommandConnect); ok {
+		switch fault.Kind {
+		case FaultTooManyConnections:
+			_ = ss.w.PrintfLine("502 too many connections")
+			return
+		case FaultDropConnection:
+			return
+		case FaultSlowResponse:
+			time.Sleep(fault.Delay)
+		}
+	}
+
+	if err := ss.w.PrintfLine("200 nntpserver ready, posting allowed"); err != nil {
+		return
+	}
+
+	for {
+		line, err := ss.r.ReadLine()
+		if err != nil {
+			return
+		}
+
+		command, args := parseCommand(line)
+		ss.s.countCommand(command)
+
+		err = ss.handle(command, args)
+		if err != nil {
+			if !errors.Is(err, errCloseSession) {
+				ss.s.config.log.Debug("error handling command", "command", command, "error", err)
+			}
+
+			return
+		}
+	}
+}
+
+func (ss *session) handle(command string, args []string) error {
+	if fault, ok := ss.s.faults.next(command); ok {
+		switch fault.Kind {
+		case FaultArticleNotFound:
+			return ss.w.PrintfLine("430 no such article")
+		case FaultTooManyConnections:
+			_ = ss.w.PrintfLine("502 too many connections")
+			return errCloseSession
+		case FaultDropConnection:
+			return ss.drop(command, args)
+		case FaultSlowResponse:
+			time.Sleep(fault.Delay)
+		case FaultStalledBody:
+			if command == "BODY" {
+				return ss.stalledBody(args, fault.Delay)
+			}
+		}
+	}
+
+	switch command {
+	case "CAPABILITIES":
+		return ss.capabilities()
+	case "MODE":
+		return ss.w.PrintfLine("200 posting allowed")
+	case "AUTHINFO":
+		return ss.authInfo(args)
+	case "QUIT":
+		_ = ss.w.PrintfLine("205 closing connection")
+		return errCloseSession
+	}
+
+	if !ss.authenticated {
+		return ss.w.PrintfLine("480 authentication required")
+	}
+
+	switch command {
+	case "GROUP":
+		return ss.group(args)
+	case "POST":
+		return ss.post()
+	case "BODY":
+		return ss.body(args)
+	case "STAT":
+		return ss.stat(args)
+	case "XFEATURE":
+		return ss.xfeature(args)
+	default:
+		return ss.w.PrintfLine("500 unknown command")
+	}
+}
+
+func (ss *session) capabilities() error {
+	caps := []string{"VERSION 2", "READER", "POST"}
+	if !ss.authenticated {
+		caps = append(caps, "AUTHINFO USER")
+	}
+
+	if err := ss.w.PrintfLine("101 capability list follows"); err != nil {
+		return err
+	}
+
+	w := ss.w.DotWriter()
+	for _, c := range caps {
+		if _, err := w.Write([]byte(c + "\r\n")); err != nil {
+			return err
+		}
+	}
+
+	return w.Close()
+}
+
+func (ss *session) authInfo(args []string) error {
+	if len(args) != 2 {
+		return ss.w.PrintfLine("501 syntax error")
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "USER":
+		if ss.authenticated {
+			return ss.w.PrintfLine("281 authentication accepted")
+		}
+
+		ss.username = args[1]
+		return ss.w.PrintfLine("381 password required")
+	case "PASS":
+		if ss.authenticated {
+			return ss.w.PrintfLine("502 already authenticated")
+		}
+
+		if ss.username == "" {
+			return ss.w.PrintfLine("482 authentication commands issued out of sequence")
+		}
+
+		if ss.username != ss.s.config.username || args[1] != ss.s.config.password {
+			ss.username = ""
+			return ss.w.PrintfLine("481 authentication failed")
+		}
+
+		ss.authenticated = true
+		return ss.w.PrintfLine("281 authentication accepted")
+	default:
+		return ss.w.PrintfLine("501 syntax error")
+	}
+}
+
+func (ss *session) group(args []string) error {
+	if len(args) != 1 {
+		return ss.w.PrintfLine("501 syntax error")
+	}
+
+	count := ss.s.store.len()
+
+	return ss.w.PrintfLine("211 %d 1 %d %s", count, count, args[0])
+}
+
+func (ss *session) post() error {
+	if err := ss.w.PrintfLine("340 send article"); err != nil {
+		return err
+	}
+
+	raw, err := ss.readDotBytes()
+	if err != nil {
+		return err
+	}
+
+	msgId, a, err := parseArticle(raw)
+	if err != nil {
+		return ss.w.PrintfLine("441 posting failed: %v", err)
+	}
+
+	if !ss.s.store.add(msgId, a) {
+		return ss.w.PrintfLine("441 duplicate article <%s>", msgId)
+	}
+
+	return ss.w.PrintfLine("240 article <%s> received", msgId)
+}
+
+func (ss *session) body(args []string) error {
+	a, msgId, found, err := ss.findArticle(args)
+	if err != nil || !found {
+		return err
+	}
+
+	if err := ss.w.PrintfLine("222 0 <%s>", msgId); err != nil {
+		return err
+	}
+
+	if ss.gzip {
+		return ss.compressedBody(a.body)
+	}
+
+	w := ss.w.DotWriter()
+	if _, err := w.Write(a.body); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+func (ss *session) xfeature(args []string) error {
+	if !ss.s.config.gzip || len(args) < 2 || !strings.EqualFold(args[0], "COMPRESS") || !strings.EqualFold(args[1], "GZIP") {
+		return ss.w.PrintfLine("500 unknown command")
+	}
+
+	ss.gzip = true
+
+	return ss.w.PrintfLine("290 feature enabled")
+}
+
+// compressedBody sends the dot encoded body with its terminator in a zlib block, followed
+// by the terminating line
+func (ss *session) compressedBody(body []byte) error {
+	var encoded bytes.Buffer
+	ew := textproto.NewWriter(bufio.NewWriter(&encoded))
+	dw := ew.DotWriter()
+	if _, err := dw.Write(body); err != nil {
+		return err
+	}
+	if err := dw.Close(); err != nil {
+		return err
+	}
+
+	zw := zlib.NewWriter(ss.w.W)
+	if _, err := zw.Write(encoded.Bytes()); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	return ss.w.PrintfLine(".")
+}
+
+func (ss *session) stat(args []string) error {
+	_, msgId, found, err := ss.findArticle(args)
+	if err != nil || !found {
+		return err
+	}
+
+	return ss.w.PrintfLine("223 0 <%s>", msgId)
+}
+
+// findArticle answers the client when the article does not exist
+func (ss *session) findArticle(args []string) (*article, string, bool, error) {
+	if len(args) != 1 {
+		return nil, "", false, ss.w.PrintfLine("420 no current article selected")
+	}
+
+	msgId := trimMessageId(args[0])
+	a, ok := ss.s.store.get(msgId)
+	if !ok {
+		return nil, "", false, ss.w.PrintfLine("430 no such article")
+	}
+
+	return a, msgId, true, nil
+}
+
+// drop closes the connection, the commands that send an article are cut in the middle
+// of the body
+func (ss *session) drop(command string, args []string) error {
+	if command != "BODY" || len(args) != 1 {
+		return errCloseSession
+	}
+
+	a, ok := ss.s.store.get(trimMessageId(args[0]))
+	if !ok {
+		return errCloseSession
+	}
+
+	if err := ss.w.PrintfLine("222 0 %s", args[0]); err != nil {
+		return err
+	}
+
+	_, _ = ss.w.W.Write(a.body[:len(a.body)/2])
+	_ = ss.w.W.Flush()
+
+	return errCloseSession
+}
+
+// stalledBody sends the first half of the body, and the rest once the delay is over
+func (ss *session) stalledBody(args []string, delay time.Duration) error {
+	a, msgId, found, err := ss.findArticle(args)
+	if err != nil || !found {
+		return err
+	}
+
+	if err := ss.w.PrintfLine("222 0 <%s>", msgId); err != nil {
+		return err
+	}
+
+	w := ss.w.DotWriter()
+	if _, err := w.Write(a.body[:len(a.body)/2]); err != nil {
+		return err
+	}
+	if err := ss.w.W.Flush(); err != nil {
+		return err
+	}
+
+	time.Sleep(delay)
+
+	if _, err := w.Write(a.body[len(a.body)/2:]); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+// readDotBytes reads a multi-line block up to the terminating ".\r\n" line. Unlike
+// textproto the line endings are kept as they were sent, only the dot stuffing is undone.
+func (ss *session) readDotBytes() ([]byte, error) {
+	var buf bytes.Buffer
+	for {
+		line, err := ss.r.R.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		if string(line) == ".\r\n" || string(line) == ".\n" {
+			return buf.Bytes(), nil
+		}
+
+		buf.Write(bytes.TrimPrefix(line, []byte(".")))
+	}
+}
+
+func parseCommand(line string) (string, []string) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	return strings.ToUpper(fields[0]), fields[1:]
+}
@@ -0,0 +1,90 @@
+package nntpserver
+
+import (
+	"bufio"
+	"bytes"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+type article struct {
+	header textproto.MIMEHeader
+	// Raw body lines with CRLF endings and without dot stuffing
+	body []byte
+}
+
+// store keeps the articles in memory by message id
+type store struct {
+	mx       sync.RWMutex
+	articles map[string]*article
+}
+
+func newStore() *store {
+	return &store{
+		articles: map[string]*article{},
+	}
+}
+
+func (s *store) add(msgId string, a *article) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	if _, ok := s.articles[msgId]; ok {
+		return false
+	}
+
+	s.articles[msgId] = a
+
+	return true
+}
+
+func (s *store) get(msgId string) (*article, bool) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	a, ok := s.articles[msgId]
+
+	return a, ok
+}
+
+func (s *store) remove(msgId string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	delete(s.articles, msgId)
+}
+
+func (s *store) len() int {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+
+	return len(s.articles)
+}
+
+// parseArticle splits a raw article in its header and body, the message id
+// is returned without the angle brackets
+func parseArticle(raw []byte) (string, *article, error) {
+	r := textproto.NewReader(bufio.NewReader(bytes.NewReader(raw)))
+
+	header, err := r.ReadMIMEHeader()
+	if err != nil {
+		return "", nil, err
+	}
+
+	msgId := trimMessageId(header.Get("Message-Id"))
+	if msgId == "" {
+		return "", nil, ErrMissingMessageId
+	}
+
+	body := []byte{}
+	if i := bytes.Index(raw, []byte("\r\n\r\n")); i >= 0 {
+		body = raw[i+4:]
+	}
+
+	return msgId, &article{header: header, body: body}, nil
+}
+
+func trimMessageId(msgId string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(msgId), "<"), ">")
+}
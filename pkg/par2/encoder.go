@@ -0,0 +1,166 @@
+package par2
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"hash"
+	"hash/crc32"
+	"runtime"
+	"sync"
+)
+
+const (
+	// Max number of input slices, the number of exponents coprime with 65535
+	MaxSlices = 32768
+	hash16k   = 16 * 1024
+	creator   = "usenet-drive"
+)
+
+// Encoder computes the recovery slices of a single file. The slices of the file are
+// added in order and the recovery slices are kept in memory, recoverySlices * sliceSize.
+// Big files are split in several files, each one with its own encoder, to bound the memory
+// and the work per slice.
+type Encoder struct {
+	sliceSize int
+	recovery  [][]byte
+	// Exponent of the last input slice
+	exponent  int
+	slices    int
+	length    int64
+	fileHash  hash.Hash
+	head      []byte
+	checksums []byte
+	padded    []byte
+}
+
+// Volume is a par2 volume of a file, the recovery packets followed by the critical packets
+// make a valid par2 file
+type Volume struct {
+	RecoveryPackets [][]byte
+	// Main, file description, slice checksums and creator packets
+	CriticalPackets []byte
+}
+
+func NewEncoder(sliceSize, recoverySlices int) (*Encoder, error) {
+	if sliceSize <= 0 || sliceSize%4 != 0 {
+		return nil, ErrInvalidSliceSize
+	}
+
+	recovery := make([][]byte, recoverySlices)
+	for i := range recovery {
+		recovery[i] = make([]byte, sliceSize)
+	}
+
+	return &Encoder{
+		sliceSize: sliceSize,
+		recovery:  recovery,
+		fileHash:  md5.New(),
+		padded:    make([]byte, sliceSize),
+	}, nil
+}
+
+// SliceSize returns the size of the slices rounded up to a multiple of 4 as par2 requires
+func SliceSize(size int) int {
+	return (size + 3) / 4 * 4
+}
+
+// Add adds the next slice of the file, only the last one can be shorter than the slice size
+func (e *Encoder) Add(data []byte) error {
+	if len(data) > e.sliceSize {
+		return ErrSliceTooLarge
+	}
+
+	if e.slices == MaxSlices {
+		return ErrTooManySlices
+	}
+
+	e.fileHash.Write(data)
+	if len(e.head) < hash16k {
+		e.head = append(e.head, data[:min(len(data), hash16k-len(e.head))]...)
+	}
+	e.length += int64(len(data))
+
+	slice := data
+	if len(data) < e.sliceSize {
+		slice = e.padded
+		copy(slice, data)
+		clear(slice[len(data):])
+	}
+
+	sum := md5.Sum(slice)
+	e.checksums = append(e.checksums, sum[:]...)
+	e.checksums = binary.LittleEndian.AppendUint32(e.checksums, crc32.ChecksumIEEE(slice))
+
+	e.exponent = nextInputExponent(e.exponent)
+	e.slices++
+
+	c := gfExp[e.exponent]
+	workers := min(runtime.NumCPU(), len(e.recovery))
+
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for r := w; r < len(e.recovery); r += workers {
+				mulAdd(e.recovery[r], slice, gfPow(c, r))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// CriticalPacketsSize returns the size of the critical packets of the volume of a file with
+// the given name and number of slices, it is known before the slices are added
+func CriticalPacketsSize(fileName string, slices int) int {
+	mainBody := 8 + 4 + 16
+	fileDescBody := 16 + 16 + 16 + 8 + len(padTo4(fileName))
+	ifscBody := 16 + slices*(md5.Size+4)
+
+	return 4*headerSize + mainBody + fileDescBody + ifscBody + len(padTo4(creator))
+}
+
+// Volume builds the par2 volume of the slices added so far. The exponent of each recovery
+// slice is its index in RecoveryPackets.
+func (e *Encoder) Volume(fileName string) Volume {
+	md516k := md5.Sum(e.head)
+	length := binary.LittleEndian.AppendUint64(nil, uint64(e.length))
+
+	fileIDHash := md5.New()
+	fileIDHash.Write(md516k[:])
+	fileIDHash.Write(length)
+	fileIDHash.Write([]byte(fileName))
+	fileID := fileIDHash.Sum(nil)
+
+	mainBody := binary.LittleEndian.AppendUint64(nil, uint64(e.sliceSize))
+	mainBody = binary.LittleEndian.AppendUint32(mainBody, 1)
+	mainBody = append(mainBody, fileID...)
+	setID := md5.Sum(mainBody)
+
+	var critical []byte
+	critical = append(critical, packet(setID, mainPacketType, mainBody)...)
+	critical = append(critical, packet(
+		setID,
+		fileDescPacketType,
+		fileID,
+		e.fileHash.Sum(nil),
+		md516k[:],
+		length,
+		padTo4(fileName),
+	)...)
+	critical = append(critical, packet(setID, ifscPacketType, fileID, e.checksums)...)
+	critical = append(critical, packet(setID, creatorPacketType, padTo4(creator))...)
+
+	recovery := make([][]byte, len(e.recovery))
+	for i, data := range e.recovery {
+		recovery[i] = packet(setID, recoveryPacketType, binary.LittleEndian.AppendUint32(nil, uint32(i)), data)
+	}
+
+	return Volume{
+		RecoveryPackets: recovery,
+		CriticalPackets: critical,
+	}
+}
@@ -0,0 +1,11 @@
+package par2
+
+import "errors"
+
+var (
+	ErrInvalidSliceSize = errors.New("slice size must be a positive multiple of 4")
+	ErrSliceTooLarge    = errors.New("slice is larger than the slice size")
+	ErrTooManySlices    = errors.New("too many input slices")
+	ErrInvalidPacket    = errors.New("invalid par2 packet")
+	ErrNotEnoughBlocks  = errors.New("not enough recovery slices to repair the missing slices")
+)
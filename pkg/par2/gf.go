@@ -0,0 +1,90 @@
+package par2
+
+// Galois field GF(2^16) of the PAR2 Reed-Solomon code, generated by x^16 + x^12 + x^3 + x + 1
+const (
+	gfPoly  = 0x1100b
+	gfLimit = 65535
+)
+
+var (
+	gfLog [gfLimit + 1]int
+	gfExp [gfLimit]uint16
+)
+
+func init() {
+	x := 1
+	for i := 0; i < gfLimit; i++ {
+		gfExp[i] = uint16(x)
+		gfLog[x] = i
+
+		x <<= 1
+		if x&0x10000 != 0 {
+			x ^= gfPoly
+		}
+	}
+}
+
+func gfMul(a, b uint16) uint16 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+
+	return gfExp[(gfLog[a]+gfLog[b])%gfLimit]
+}
+
+func gfPow(a uint16, n int) uint16 {
+	if n == 0 {
+		return 1
+	}
+	if a == 0 {
+		return 0
+	}
+
+	return gfExp[(gfLog[a]*n)%gfLimit]
+}
+
+func gfInv(a uint16) uint16 {
+	return gfExp[(gfLimit-gfLog[a])%gfLimit]
+}
+
+// nextInputExponent returns the exponent of the input slice that follows the one with
+// exponent e. The spec only uses the exponents that are coprime with 65535 so that the
+// input constants have the maximum order.
+func nextInputExponent(e int) int {
+	for e++; e%3 == 0 || e%5 == 0 || e%17 == 0 || e%257 == 0; e++ {
+	}
+
+	return e
+}
+
+// inputConstants returns the constants of the first n input slices
+func inputConstants(n int) []uint16 {
+	constants := make([]uint16, n)
+	e := 0
+	for i := range constants {
+		e = nextInputExponent(e)
+		constants[i] = gfExp[e]
+	}
+
+	return constants
+}
+
+// mulAdd adds c * src to dst, both are little endian 16 bit words
+func mulAdd(dst, src []byte, c uint16) {
+	if c == 0 {
+		return
+	}
+
+	// The product of a word is the sum of the products of its bytes
+	var low, high [256]uint16
+	for b := 0; b < 256; b++ {
+		low[b] = gfMul(c, uint16(b))
+		high[b] = gfMul(c, uint16(b)<<8)
+	}
+
+	for i := 0; i+1 < len(src); i += 2 {
+		p := low[src[i]] ^ high[src[i+1]]
+		dst[i] ^= byte(p)
+		dst[i+1] ^= byte(p >> 8)
+	}
+}
@@ -0,0 +1,77 @@
+package par2
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	headerSize = 64
+	// Size of the header and the exponent of a recovery slice packet
+	RecoveryPacketOverhead = headerSize + 4
+)
+
+var (
+	packetMagic = []byte("PAR2\x00PKT")
+
+	mainPacketType     = []byte("PAR 2.0\x00Main\x00\x00\x00\x00")
+	fileDescPacketType = []byte("PAR 2.0\x00FileDesc")
+	ifscPacketType     = []byte("PAR 2.0\x00IFSC\x00\x00\x00\x00")
+	recoveryPacketType = []byte("PAR 2.0\x00RecvSlic")
+	creatorPacketType  = []byte("PAR 2.0\x00Creator\x00")
+)
+
+// packet builds a packet of the given type, the body length must be a multiple of 4
+func packet(setID [16]byte, packetType []byte, body ...[]byte) []byte {
+	length := headerSize
+	for _, b := range body {
+		length += len(b)
+	}
+
+	p := make([]byte, headerSize, length)
+	copy(p, packetMagic)
+	binary.LittleEndian.PutUint64(p[8:], uint64(length))
+	copy(p[32:], setID[:])
+	copy(p[48:], packetType)
+	for _, b := range body {
+		p = append(p, b...)
+	}
+
+	hash := md5.Sum(p[32:])
+	copy(p[16:], hash[:])
+
+	return p
+}
+
+// padTo4 pads the string with zeros to a multiple of 4 bytes
+func padTo4(s string) []byte {
+	b := make([]byte, (len(s)+3)/4*4)
+	copy(b, s)
+
+	return b
+}
+
+// ParseRecoveryPacket verifies a recovery slice packet and returns its exponent and data
+func ParseRecoveryPacket(p []byte) (int, []byte, error) {
+	if len(p) < RecoveryPacketOverhead || !bytes.Equal(p[:8], packetMagic) {
+		return 0, nil, fmt.Errorf("%w: missing header", ErrInvalidPacket)
+	}
+
+	length := binary.LittleEndian.Uint64(p[8:])
+	if length < RecoveryPacketOverhead || length > uint64(len(p)) {
+		return 0, nil, fmt.Errorf("%w: invalid length %d", ErrInvalidPacket, length)
+	}
+	p = p[:length]
+
+	if hash := md5.Sum(p[32:]); !bytes.Equal(hash[:], p[16:32]) {
+		return 0, nil, fmt.Errorf("%w: md5 mismatch", ErrInvalidPacket)
+	}
+
+	if !bytes.Equal(p[48:64], recoveryPacketType) {
+		return 0, nil, fmt.Errorf("%w: not a recovery slice packet", ErrInvalidPacket)
+	}
+
+	return int(binary.LittleEndian.Uint32(p[64:])), p[RecoveryPacketOverhead:], nil
+}
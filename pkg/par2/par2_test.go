@@ -0,0 +1,147 @@
+package par2
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func slicesOf(data []byte, sliceSize int) [][]byte {
+	var out [][]byte
+	for len(data) > 0 {
+		n := min(len(data), sliceSize)
+		out = append(out, data[:n])
+		data = data[n:]
+	}
+
+	return out
+}
+
+func TestGF(t *testing.T) {
+	for _, a := range []uint16{1, 2, 3, 0x1234, 0xffff} {
+		assert.Equal(t, uint16(1), gfMul(a, gfInv(a)))
+	}
+
+	// The first input constants are 2^1, 2^2, 2^4 and 2^7
+	assert.Equal(t, []uint16{2, 4, 16, 128}, inputConstants(4))
+	assert.Equal(t, uint16(0x100b), gfMul(0x8000, 2))
+}
+
+func TestEncoder(t *testing.T) {
+	data := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	e, err := NewEncoder(SliceSize(301), 3)
+	require.NoError(t, err)
+	for _, slice := range slicesOf(data, SliceSize(301)) {
+		require.NoError(t, e.Add(slice))
+	}
+
+	v := e.Volume("test.bin")
+	require.Len(t, v.RecoveryPackets, 3)
+
+	t.Run("recovery slice with exponent 0 is the xor of the slices", func(t *testing.T) {
+		exponent, recovery, err := ParseRecoveryPacket(v.RecoveryPackets[0])
+		require.NoError(t, err)
+		assert.Equal(t, 0, exponent)
+
+		xor := make([]byte, SliceSize(301))
+		for _, slice := range slicesOf(data, SliceSize(301)) {
+			for i := range slice {
+				xor[i] ^= slice[i]
+			}
+		}
+		assert.Equal(t, xor, recovery)
+	})
+
+	t.Run("critical packets are valid", func(t *testing.T) {
+		p := v.CriticalPackets
+		var types []string
+		for len(p) > 0 {
+			require.True(t, bytes.HasPrefix(p, packetMagic))
+			length := binary.LittleEndian.Uint64(p[8:])
+			hash := md5.Sum(p[32:length])
+			assert.Equal(t, hash[:], p[16:32])
+			types = append(types, string(bytes.TrimRight(p[56:64], "\x00")))
+			p = p[length:]
+		}
+
+		assert.Equal(t, []string{"Main", "FileDesc", "IFSC", "Creator"}, types)
+		assert.Len(t, v.CriticalPackets, CriticalPacketsSize("test.bin", 4))
+	})
+
+	t.Run("corrupted recovery packet", func(t *testing.T) {
+		packet := bytes.Clone(v.RecoveryPackets[1])
+		packet[len(packet)-1] ^= 1
+
+		_, _, err := ParseRecoveryPacket(packet)
+		assert.ErrorIs(t, err, ErrInvalidPacket)
+	})
+
+	t.Run("slice larger than the slice size", func(t *testing.T) {
+		assert.ErrorIs(t, e.Add(make([]byte, 400)), ErrSliceTooLarge)
+	})
+}
+
+func TestRepairer(t *testing.T) {
+	sliceSize := SliceSize(101)
+	data := make([]byte, 1001)
+	rand.New(rand.NewSource(2)).Read(data)
+	parts := slicesOf(data, sliceSize)
+
+	e, err := NewEncoder(sliceSize, 4)
+	require.NoError(t, err)
+	for _, slice := range parts {
+		require.NoError(t, e.Add(slice))
+	}
+
+	recovery := map[int][]byte{}
+	for _, p := range e.Volume("test.bin").RecoveryPackets {
+		exponent, data, err := ParseRecoveryPacket(p)
+		require.NoError(t, err)
+		recovery[exponent] = data
+	}
+
+	repair := func(t *testing.T, missing []int, exponents []int) (map[int][]byte, error) {
+		r, err := NewRepairer(sliceSize, len(parts), exponents)
+		require.NoError(t, err)
+
+		for i, slice := range parts {
+			if !slices.Contains(missing, i) {
+				require.NoError(t, r.AddSlice(i, slice))
+			}
+		}
+
+		return r.Reconstruct(missing, recovery)
+	}
+
+	t.Run("repair the missing parts", func(t *testing.T) {
+		// The last slice is shorter than the others
+		missing := []int{0, 4, len(parts) - 1}
+		repaired, err := repair(t, missing, []int{0, 1, 2, 3})
+		require.NoError(t, err)
+
+		for _, index := range missing {
+			assert.Equal(t, parts[index], repaired[index][:len(parts[index])])
+		}
+	})
+
+	t.Run("repair with the last recovery parts", func(t *testing.T) {
+		repaired, err := repair(t, []int{2, 3}, []int{2, 3})
+		require.NoError(t, err)
+
+		assert.Equal(t, parts[2], repaired[2])
+		assert.Equal(t, parts[3], repaired[3])
+	})
+
+	t.Run("more missing parts than recovery parts", func(t *testing.T) {
+		_, err := repair(t, []int{0, 1, 2}, []int{0, 1})
+		assert.ErrorIs(t, err, ErrNotEnoughBlocks)
+	})
+}
@@ -0,0 +1,185 @@
+package par2
+
+import (
+	"sync"
+)
+
+// Repairer reconstructs the missing input slices of a file. The available slices are added
+// in any order, possibly concurrently, and the missing ones are solved from as many recovery
+// slices as slices are missing.
+type Repairer struct {
+	sliceSize int
+	constants []uint16
+	exponents []int
+	mx        []sync.Mutex
+	// Contribution of the added slices to each recovery slice
+	sums   [][]byte
+	padded sync.Pool
+}
+
+// NewRepairer creates a repairer of a file with the given number of input slices that can
+// use the recovery slices with the given exponents
+func NewRepairer(sliceSize, slices int, exponents []int) (*Repairer, error) {
+	if sliceSize <= 0 || sliceSize%4 != 0 {
+		return nil, ErrInvalidSliceSize
+	}
+
+	if slices > MaxSlices {
+		return nil, ErrTooManySlices
+	}
+
+	sums := make([][]byte, len(exponents))
+	for i := range sums {
+		sums[i] = make([]byte, sliceSize)
+	}
+
+	return &Repairer{
+		sliceSize: sliceSize,
+		constants: inputConstants(slices),
+		exponents: exponents,
+		mx:        make([]sync.Mutex, len(exponents)),
+		sums:      sums,
+		padded: sync.Pool{
+			New: func() any {
+				return make([]byte, sliceSize)
+			},
+		},
+	}, nil
+}
+
+// AddSlice adds an available input slice, every slice not added is considered missing
+func (r *Repairer) AddSlice(index int, data []byte) error {
+	if len(data) > r.sliceSize {
+		return ErrSliceTooLarge
+	}
+
+	if index < 0 || index >= len(r.constants) {
+		return ErrTooManySlices
+	}
+
+	slice := data
+	if len(data)%2 != 0 {
+		padded := r.padded.Get().([]byte)
+		defer r.padded.Put(padded)
+
+		slice = padded[:len(data)+1]
+		copy(slice, data)
+		slice[len(data)] = 0
+	}
+
+	for i, exponent := range r.exponents {
+		c := gfPow(r.constants[index], exponent)
+
+		r.mx[i].Lock()
+		mulAdd(r.sums[i], slice, c)
+		r.mx[i].Unlock()
+	}
+
+	return nil
+}
+
+// Reconstruct solves the missing slices from the recovery slices, keyed by exponent.
+// It must be called once all the available slices were added.
+func (r *Repairer) Reconstruct(missing []int, recovery map[int][]byte) (map[int][]byte, error) {
+	// Equations of the first recovery slices, one per missing slice
+	var rows []int
+	for i, exponent := range r.exponents {
+		if len(rows) == len(missing) {
+			break
+		}
+
+		if data, ok := recovery[exponent]; ok && len(data) == r.sliceSize {
+			rows = append(rows, i)
+		}
+	}
+
+	if len(rows) < len(missing) {
+		return nil, ErrNotEnoughBlocks
+	}
+
+	for _, index := range missing {
+		if index < 0 || index >= len(r.constants) {
+			return nil, ErrTooManySlices
+		}
+	}
+
+	n := len(missing)
+	matrix := make([][]uint16, n)
+	for i, row := range rows {
+		matrix[i] = make([]uint16, n)
+		for j, index := range missing {
+			matrix[i][j] = gfPow(r.constants[index], r.exponents[row])
+		}
+	}
+
+	inverse, ok := invert(matrix)
+	if !ok {
+		return nil, ErrNotEnoughBlocks
+	}
+
+	// Recovery slice minus the contribution of the available slices, the sum of the missing ones
+	known := make([][]byte, n)
+	for i, row := range rows {
+		known[i] = make([]byte, r.sliceSize)
+		copy(known[i], recovery[r.exponents[row]])
+		mulAdd(known[i], r.sums[row], 1)
+	}
+
+	repaired := make(map[int][]byte, n)
+	for j, index := range missing {
+		data := make([]byte, r.sliceSize)
+		for i := range rows {
+			mulAdd(data, known[i], inverse[j][i])
+		}
+		repaired[index] = data
+	}
+
+	return repaired, nil
+}
+
+// invert inverts the matrix with Gauss-Jordan elimination, it reports false if it is singular
+func invert(matrix [][]uint16) ([][]uint16, bool) {
+	n := len(matrix)
+	inverse := make([][]uint16, n)
+	for i := range inverse {
+		inverse[i] = make([]uint16, n)
+		inverse[i][i] = 1
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := -1
+		for row := col; row < n; row++ {
+			if matrix[row][col] != 0 {
+				pivot = row
+				break
+			}
+		}
+
+		if pivot == -1 {
+			return nil, false
+		}
+
+		matrix[col], matrix[pivot] = matrix[pivot], matrix[col]
+		inverse[col], inverse[pivot] = inverse[pivot], inverse[col]
+
+		scale := gfInv(matrix[col][col])
+		for k := 0; k < n; k++ {
+			matrix[col][k] = gfMul(matrix[col][k], scale)
+			inverse[col][k] = gfMul(inverse[col][k], scale)
+		}
+
+		for row := 0; row < n; row++ {
+			if row == col || matrix[row][col] == 0 {
+				continue
+			}
+
+			factor := matrix[row][col]
+			for k := 0; k < n; k++ {
+				matrix[row][k] ^= gfMul(factor, matrix[col][k])
+				inverse[row][k] ^= gfMul(factor, inverse[col][k])
+			}
+		}
+	}
+
+	return inverse, true
+}